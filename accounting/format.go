@@ -0,0 +1,105 @@
+package accounting
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"restro/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatCSV = "csv"
+	FormatIIF = "iif"
+)
+
+var ErrUnknownFormat = errors.New("format must be csv or iif")
+
+func ContentType(format string) string {
+	if format == FormatIIF {
+		return "text/plain; charset=utf-8"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Write writes the lines in the given format, with dates in loc.
+func Write(w io.Writer, format string, lines []models.JournalLine,
+	loc *time.Location) error {
+	switch format {
+	case FormatCSV:
+		return WriteCSV(w, lines, loc)
+	case FormatIIF:
+		return WriteIIF(w, lines, loc)
+	}
+	return ErrUnknownFormat
+}
+
+// WriteCSV writes a generic journal: one row per line with separate debit
+// and credit columns.
+func WriteCSV(w io.Writer, lines []models.JournalLine, loc *time.Location) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"date", "entry_id", "source", "reference", "account",
+		"description", "debit", "credit"})
+	for _, line := range lines {
+		out.Write([]string{
+			line.Date.In(loc).Format("2006-01-02"),
+			line.Entry_ID,
+			line.Source,
+			line.Reference,
+			line.Account,
+			line.Description,
+			amount(line.Debit),
+			amount(line.Credit),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// WriteIIF writes the entries as QuickBooks general journal transactions:
+// the first line of each entry is the TRNS row and the rest are SPL rows,
+// with debits positive and credits negative.
+func WriteIIF(w io.Writer, lines []models.JournalLine, loc *time.Location) error {
+	var b strings.Builder
+	b.WriteString("!TRNS\tTRNSID\tTRNSTYPE\tDATE\tACCNT\tNAME\tAMOUNT\tDOCNUM\tMEMO\n")
+	b.WriteString("!SPL\tSPLID\tTRNSTYPE\tDATE\tACCNT\tNAME\tAMOUNT\tDOCNUM\tMEMO\n")
+	b.WriteString("!ENDTRNS\n")
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return err
+	}
+	for i, line := range lines {
+		b.Reset()
+		first := i == 0 || lines[i-1].Entry_ID != line.Entry_ID
+		kind := "SPL"
+		if first {
+			kind = "TRNS"
+		}
+		fmt.Fprintf(&b, "%s\t\tGENERAL JOURNAL\t%s\t%s\t\t%s\t%s\t%s\n", kind,
+			line.Date.In(loc).Format("01/02/2006"), iifField(line.Account),
+			strconv.FormatFloat(line.Debit-line.Credit, 'f', 2, 64),
+			iifField(line.Reference), iifField(line.Description))
+		if i == len(lines)-1 || lines[i+1].Entry_ID != line.Entry_ID {
+			b.WriteString("ENDTRNS\n")
+		}
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// iifField keeps a value from breaking the tab separated rows.
+func iifField(value string) string {
+	return strings.NewReplacer("\t", " ", "\n", " ", "\r", " ", `"`, "'").
+		Replace(value)
+}
+
+func amount(value float64) string {
+	if value == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(value, 'f', 2, 64)
+}
@@ -0,0 +1,105 @@
+package accounting
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"restro/models"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// twoEntries is an invoice and a payment on it, late in the evening UTC.
+func twoEntries() []models.JournalLine {
+	at := time.Date(2024, 3, 5, 2, 30, 0, 0, time.UTC)
+	settings := settingsWith(0.1, false)
+	lines := InvoiceEntry(settings, Invoice{Invoice_ID: "i1", Order_ID: "o1",
+		Amount: 20, Created_at: at})
+	return append(lines, PaymentEntry(settings, models.Payment{
+		Payment_ID: "p1", Invoice_ID: "i1", Kind: models.PaymentKindPayment,
+		Method: method("CARD"), Amount: money(22), Tip: 3, Created_at: at})...)
+}
+
+func TestWriteCSV(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := Write(&out, FormatCSV, twoEntries(), newYork); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"date", "entry_id", "source", "reference", "account", "description",
+			"debit", "credit"},
+		// 02:30 UTC is the evening before in New York
+		{"2024-03-04", "invoice-i1", "INVOICE", "i1", "Accounts Receivable",
+			"Invoice for order o1", "22.00", ""},
+		{"2024-03-04", "invoice-i1", "INVOICE", "i1", "Sales",
+			"Invoice for order o1", "", "20.00"},
+		{"2024-03-04", "invoice-i1", "INVOICE", "i1", "Sales Tax Payable",
+			"Invoice for order o1", "", "2.00"},
+		{"2024-03-04", "payment-p1", "PAYMENT", "i1", "Card Clearing",
+			"Payment on invoice i1", "25.00", ""},
+		{"2024-03-04", "payment-p1", "PAYMENT", "i1", "Accounts Receivable",
+			"Payment on invoice i1", "", "22.00"},
+		{"2024-03-04", "payment-p1", "PAYMENT", "i1", "Tips Payable",
+			"Payment on invoice i1", "", "3.00"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("rows = %q", rows)
+	}
+	for i := range want {
+		if strings.Join(rows[i], ",") != strings.Join(want[i], ",") {
+			t.Errorf("row %d = %q, want %q", i, rows[i], want[i])
+		}
+	}
+}
+
+func TestWriteIIF(t *testing.T) {
+	lines := twoEntries()
+	// a description can't break the tab separated rows
+	for i := range lines {
+		if lines[i].Entry_ID == "payment-p1" {
+			lines[i].Description = "Paid\tby \"card\"\nat the bar"
+		}
+	}
+	var out bytes.Buffer
+	if err := Write(&out, FormatIIF, lines, time.UTC); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"!TRNS\tTRNSID\tTRNSTYPE\tDATE\tACCNT\tNAME\tAMOUNT\tDOCNUM\tMEMO",
+		"!SPL\tSPLID\tTRNSTYPE\tDATE\tACCNT\tNAME\tAMOUNT\tDOCNUM\tMEMO",
+		"!ENDTRNS",
+		"TRNS\t\tGENERAL JOURNAL\t03/05/2024\tAccounts Receivable\t\t22.00\ti1\tInvoice for order o1",
+		"SPL\t\tGENERAL JOURNAL\t03/05/2024\tSales\t\t-20.00\ti1\tInvoice for order o1",
+		"SPL\t\tGENERAL JOURNAL\t03/05/2024\tSales Tax Payable\t\t-2.00\ti1\tInvoice for order o1",
+		"ENDTRNS",
+		"TRNS\t\tGENERAL JOURNAL\t03/05/2024\tCard Clearing\t\t25.00\ti1\tPaid by 'card' at the bar",
+		"SPL\t\tGENERAL JOURNAL\t03/05/2024\tAccounts Receivable\t\t-22.00\ti1\tPaid by 'card' at the bar",
+		"SPL\t\tGENERAL JOURNAL\t03/05/2024\tTips Payable\t\t-3.00\ti1\tPaid by 'card' at the bar",
+		"ENDTRNS",
+		"",
+	}, "\n")
+	if got := out.String(); got != want {
+		t.Fatalf("IIF =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWriteUnknownFormat(t *testing.T) {
+	err := Write(&bytes.Buffer{}, "xlsx", twoEntries(), time.UTC)
+	if !errors.Is(err, ErrUnknownFormat) {
+		t.Fatalf("err = %v, want ErrUnknownFormat", err)
+	}
+	if ContentType(FormatIIF) != "text/plain; charset=utf-8" ||
+		ContentType(FormatCSV) != "text/csv; charset=utf-8" {
+		t.Fatal("wrong content types")
+	}
+}
@@ -0,0 +1,190 @@
+package accounting
+
+import (
+	"math"
+	"restro/models"
+	"sort"
+	"time"
+)
+
+const (
+	SourceInvoice = "INVOICE"
+	SourcePayment = "PAYMENT"
+	SourceRefund  = "REFUND"
+)
+
+// Invoice is an invoice with what its order comes to before any tax added
+// on top. Gift_cards is the part of Amount that sold gift cards, which
+// isn't a sale and isn't taxed.
+type Invoice struct {
+	Invoice_ID string
+	Order_ID   string
+	Amount     float64
+	Gift_cards float64
+	Created_at time.Time
+}
+
+// DefaultSettings is used until settings are saved.
+func DefaultSettings() models.AccountingSettings {
+	return models.AccountingSettings{
+		Accounts: models.ChartOfAccounts{
+			Sales:               "Sales",
+			Sales_tax:           "Sales Tax Payable",
+			Tips:                "Tips Payable",
+			Refunds:             "Sales Refunds",
+			Accounts_receivable: "Accounts Receivable",
+			Cash:                "Cash on Hand",
+			Card:                "Card Clearing",
+			Loyalty:             "Loyalty Redemptions",
+			Gift_cards:          "Gift Card Liability",
+		},
+		Prices_include_tax: true,
+		Settings_ID:        "default",
+	}
+}
+
+// InvoiceTax splits an invoice amount into what the guest owes, the sale
+// and the tax on it.
+func InvoiceTax(settings models.AccountingSettings, amount float64) (gross, net, tax float64) {
+	if settings.Prices_include_tax {
+		tax = round2(amount * settings.Tax_rate / (1 + settings.Tax_rate))
+		return round2(amount), round2(amount - tax), tax
+	}
+	tax = round2(amount * settings.Tax_rate)
+	return round2(amount + tax), round2(amount), tax
+}
+
+// InvoiceTotals is InvoiceTax for a whole invoice: gross is what the guest
+// owes, including any gift cards sold, while net and tax are the sale and
+// the tax on it alone.
+func InvoiceTotals(settings models.AccountingSettings, invoice Invoice) (gross, net, tax float64) {
+	gross, net, tax = InvoiceTax(settings, invoice.Amount-invoice.Gift_cards)
+	return round2(gross + invoice.Gift_cards), net, tax
+}
+
+// InvoiceEntry books an invoice as owed: the receivable against the sale
+// and the tax collected on it, and against the balances of any gift cards
+// sold.
+func InvoiceEntry(settings models.AccountingSettings, invoice Invoice) []models.JournalLine {
+	gross, net, tax := InvoiceTotals(settings, invoice)
+	entry := newEntry("invoice-"+invoice.Invoice_ID, invoice.Created_at,
+		SourceInvoice, invoice.Invoice_ID, "Invoice for order "+invoice.Order_ID)
+	entry.debit(settings.Accounts.Accounts_receivable, gross)
+	entry.credit(settings.Accounts.Sales, net)
+	entry.credit(settings.Accounts.Sales_tax, tax)
+	entry.credit(giftCardAccount(settings), round2(invoice.Gift_cards))
+	return entry.lines
+}
+
+// PaymentEntry books money taken, settling the receivable and holding the
+// tip for the staff. A refund gives money back out of sales and tax, at the
+// tax rate, and out of the tips held.
+func PaymentEntry(settings models.AccountingSettings, payment models.Payment) []models.JournalLine {
+	tender := settings.Accounts.Card
+	if payment.Method != nil {
+		switch *payment.Method {
+		case "CASH":
+			tender = settings.Accounts.Cash
+		case models.PaymentMethodPoints:
+			tender = settings.Accounts.Loyalty
+			if tender == "" {
+				tender = DefaultSettings().Accounts.Loyalty
+			}
+		case models.PaymentMethodGiftCard:
+			tender = giftCardAccount(settings)
+		}
+	}
+	var amount float64
+	if payment.Amount != nil {
+		amount = *payment.Amount
+	}
+	total := round2(amount + payment.Tip)
+
+	if payment.Kind == models.PaymentKindRefund {
+		tax := round2(amount * settings.Tax_rate / (1 + settings.Tax_rate))
+		entry := newEntry("refund-"+payment.Payment_ID, payment.Created_at,
+			SourceRefund, payment.Invoice_ID,
+			"Refund on invoice "+payment.Invoice_ID)
+		entry.debit(settings.Accounts.Refunds, round2(amount-tax))
+		entry.debit(settings.Accounts.Sales_tax, tax)
+		entry.debit(settings.Accounts.Tips, payment.Tip)
+		entry.credit(tender, total)
+		return entry.lines
+	}
+
+	entry := newEntry("payment-"+payment.Payment_ID, payment.Created_at,
+		SourcePayment, payment.Invoice_ID,
+		"Payment on invoice "+payment.Invoice_ID)
+	entry.debit(tender, total)
+	entry.credit(settings.Accounts.Accounts_receivable, round2(amount))
+	entry.credit(settings.Accounts.Tips, payment.Tip)
+	return entry.lines
+}
+
+// Journal books the invoices and payments in date order.
+func Journal(settings models.AccountingSettings, invoices []Invoice,
+	payments []models.Payment) []models.JournalLine {
+	lines := []models.JournalLine{}
+	for _, invoice := range invoices {
+		lines = append(lines, InvoiceEntry(settings, invoice)...)
+	}
+	for _, payment := range payments {
+		lines = append(lines, PaymentEntry(settings, payment)...)
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		if !lines[i].Date.Equal(lines[j].Date) {
+			return lines[i].Date.Before(lines[j].Date)
+		}
+		return lines[i].Entry_ID < lines[j].Entry_ID
+	})
+	return lines
+}
+
+type entry struct {
+	template models.JournalLine
+	lines    []models.JournalLine
+}
+
+func newEntry(id string, date time.Time, source, reference,
+	description string) *entry {
+	return &entry{template: models.JournalLine{
+		Entry_ID:    id,
+		Date:        date,
+		Source:      source,
+		Reference:   reference,
+		Description: description,
+	}}
+}
+
+func (e *entry) debit(account string, amount float64) {
+	if amount == 0 {
+		return
+	}
+	line := e.template
+	line.Account = account
+	line.Debit = amount
+	e.lines = append(e.lines, line)
+}
+
+func (e *entry) credit(account string, amount float64) {
+	if amount == 0 {
+		return
+	}
+	line := e.template
+	line.Account = account
+	line.Credit = amount
+	e.lines = append(e.lines, line)
+}
+
+// giftCardAccount is the gift card liability, which settings saved before
+// gift cards existed don't name.
+func giftCardAccount(settings models.AccountingSettings) string {
+	if settings.Accounts.Gift_cards == "" {
+		return DefaultSettings().Accounts.Gift_cards
+	}
+	return settings.Accounts.Gift_cards
+}
+
+func round2(num float64) float64 {
+	return math.Round(num*100) / 100
+}
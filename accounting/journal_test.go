@@ -0,0 +1,232 @@
+package accounting
+
+import (
+	"math"
+	"restro/models"
+	"testing"
+	"time"
+)
+
+func money(x float64) *float64 { return &x }
+func method(m string) *string  { return &m }
+
+func cents(x float64) int64 { return int64(math.Round(x * 100)) }
+
+// balanced checks that the lines of each entry debit what they credit,
+// to the cent.
+func balanced(t *testing.T, lines []models.JournalLine) {
+	t.Helper()
+	debits, credits := map[string]int64{}, map[string]int64{}
+	for _, line := range lines {
+		if line.Debit < 0 || line.Credit < 0 ||
+			(line.Debit != 0) == (line.Credit != 0) {
+			t.Errorf("line %+v isn't one debit or one credit", line)
+		}
+		debits[line.Entry_ID] += cents(line.Debit)
+		credits[line.Entry_ID] += cents(line.Credit)
+	}
+	for id := range debits {
+		if debits[id] != credits[id] {
+			t.Errorf("entry %s debits %d cents but credits %d", id,
+				debits[id], credits[id])
+		}
+	}
+}
+
+func settingsWith(rate float64, included bool) models.AccountingSettings {
+	settings := DefaultSettings()
+	settings.Tax_rate = rate
+	settings.Prices_include_tax = included
+	return settings
+}
+
+var taxes = []struct {
+	name     string
+	settings models.AccountingSettings
+}{
+	{"no tax", settingsWith(0, true)},
+	{"tax included", settingsWith(0.2, true)},
+	{"tax on top", settingsWith(0.0825, false)},
+	{"odd tax included", settingsWith(0.0725, true)},
+}
+
+func TestInvoiceEntriesBalance(t *testing.T) {
+	created := time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)
+	for _, tax := range taxes {
+		for _, invoice := range []Invoice{
+			{Invoice_ID: "food", Amount: 43.17},
+			{Invoice_ID: "cents", Amount: 0.01},
+			{Invoice_ID: "gift cards and food", Amount: 73.99, Gift_cards: 50},
+			{Invoice_ID: "only gift cards", Amount: 25, Gift_cards: 25},
+		} {
+			invoice.Created_at = created
+			t.Run(tax.name+"/"+invoice.Invoice_ID, func(t *testing.T) {
+				lines := InvoiceEntry(tax.settings, invoice)
+				balanced(t, lines)
+				gross, _, _ := InvoiceTotals(tax.settings, invoice)
+				var receivable float64
+				for _, line := range lines {
+					if line.Account == tax.settings.Accounts.Accounts_receivable {
+						receivable += line.Debit
+					}
+					if line.Source != SourceInvoice ||
+						line.Reference != invoice.Invoice_ID {
+						t.Errorf("line = %+v", line)
+					}
+				}
+				if cents(receivable) != cents(gross) {
+					t.Errorf("receivable = %v, want what is owed, %v",
+						receivable, gross)
+				}
+			})
+		}
+	}
+}
+
+func TestInvoiceEntryLeavesGiftCardsUntaxed(t *testing.T) {
+	settings := settingsWith(0.1, false)
+	lines := InvoiceEntry(settings, Invoice{Invoice_ID: "i1", Amount: 70,
+		Gift_cards: 50})
+	want := map[string][2]float64{
+		"Accounts Receivable": {72, 0},
+		"Sales":               {0, 20},
+		"Sales Tax Payable":   {0, 2},
+		"Gift Card Liability": {0, 50},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("lines = %+v", lines)
+	}
+	for _, line := range lines {
+		if w := want[line.Account]; line.Debit != w[0] || line.Credit != w[1] {
+			t.Errorf("%s = %v / %v, want %v / %v", line.Account, line.Debit,
+				line.Credit, w[0], w[1])
+		}
+	}
+}
+
+func TestPaymentEntriesBalance(t *testing.T) {
+	paid := time.Date(2024, 3, 4, 13, 0, 0, 0, time.UTC)
+	payments := []models.Payment{
+		{Payment_ID: "card with a tip", Kind: models.PaymentKindPayment,
+			Method: method("CARD"), Amount: money(43.17), Tip: 6.5},
+		{Payment_ID: "part in cash", Kind: models.PaymentKindPayment,
+			Method: method("CASH"), Amount: money(20)},
+		{Payment_ID: "rest in points", Kind: models.PaymentKindPayment,
+			Method: method(models.PaymentMethodPoints),
+			Amount: money(23.17)},
+		{Payment_ID: "gift card", Kind: models.PaymentKindPayment,
+			Method: method(models.PaymentMethodGiftCard),
+			Amount: money(12.34), Tip: 1.66},
+		{Payment_ID: "refund with tip", Kind: models.PaymentKindRefund,
+			Method: method("CARD"), Amount: money(10.01), Tip: 2},
+		{Payment_ID: "refund of a cent", Kind: models.PaymentKindRefund,
+			Method: method("CASH"), Amount: money(0.01)},
+		{Payment_ID: "refund to a gift card", Kind: models.PaymentKindRefund,
+			Method: method(models.PaymentMethodGiftCard), Amount: money(12.34)},
+	}
+	for _, tax := range taxes {
+		for _, payment := range payments {
+			payment.Invoice_ID = "i1"
+			payment.Created_at = paid
+			t.Run(tax.name+"/"+payment.Payment_ID, func(t *testing.T) {
+				lines := PaymentEntry(tax.settings, payment)
+				balanced(t, lines)
+				if len(lines) == 0 {
+					t.Fatal("nothing booked")
+				}
+			})
+		}
+	}
+}
+
+func TestPaymentEntryAccounts(t *testing.T) {
+	settings := settingsWith(0.25, true)
+	for _, tt := range []struct {
+		payment models.Payment
+		want    map[string][2]float64
+	}{
+		{models.Payment{Kind: models.PaymentKindPayment, Method: method("CASH"),
+			Amount: money(40), Tip: 5}, map[string][2]float64{
+			"Cash on Hand":        {45, 0},
+			"Accounts Receivable": {0, 40},
+			"Tips Payable":        {0, 5},
+		}},
+		{models.Payment{Kind: models.PaymentKindPayment,
+			Method: method(models.PaymentMethodPoints), Amount: money(10)},
+			map[string][2]float64{
+				"Loyalty Redemptions": {10, 0},
+				"Accounts Receivable": {0, 10},
+			}},
+		{models.Payment{Kind: models.PaymentKindPayment,
+			Method: method(models.PaymentMethodGiftCard), Amount: money(10)},
+			map[string][2]float64{
+				"Gift Card Liability": {10, 0},
+				"Accounts Receivable": {0, 10},
+			}},
+		// a refund comes out of sales and tax at the tax rate
+		{models.Payment{Kind: models.PaymentKindRefund, Method: method("CARD"),
+			Amount: money(25), Tip: 3}, map[string][2]float64{
+			"Sales Refunds":     {20, 0},
+			"Sales Tax Payable": {5, 0},
+			"Tips Payable":      {3, 0},
+			"Card Clearing":     {0, 28},
+		}},
+	} {
+		lines := PaymentEntry(settings, tt.payment)
+		if len(lines) != len(tt.want) {
+			t.Errorf("lines = %+v, want %v", lines, tt.want)
+			continue
+		}
+		for _, line := range lines {
+			if w, ok := tt.want[line.Account]; !ok || line.Debit != w[0] ||
+				line.Credit != w[1] {
+				t.Errorf("%s = %v / %v, want %v", line.Account, line.Debit,
+					line.Credit, w)
+			}
+		}
+	}
+}
+
+func TestJournalBalancesAndIsInDateOrder(t *testing.T) {
+	day := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	settings := settingsWith(0.0825, false)
+	refundOf := "p1"
+	invoices := []Invoice{
+		{Invoice_ID: "i2", Amount: 30, Created_at: day.Add(14 * time.Hour)},
+		{Invoice_ID: "i1", Amount: 61.5, Gift_cards: 25,
+			Created_at: day.Add(12 * time.Hour)},
+	}
+	payments := []models.Payment{
+		{Payment_ID: "p2", Kind: models.PaymentKindPayment, Invoice_ID: "i1",
+			Method: method("CASH"), Amount: money(14.51),
+			Created_at: day.Add(13 * time.Hour)},
+		{Payment_ID: "p1", Kind: models.PaymentKindPayment, Invoice_ID: "i1",
+			Method: method("CARD"), Amount: money(50), Tip: 7,
+			Created_at: day.Add(13 * time.Hour)},
+		{Payment_ID: "r1", Kind: models.PaymentKindRefund, Invoice_ID: "i1",
+			Refund_of: &refundOf, Method: method("CARD"),
+			Amount: money(5.41), Tip: 1, Created_at: day.Add(15 * time.Hour)},
+	}
+	lines := Journal(settings, invoices, payments)
+	balanced(t, lines)
+
+	var order []string
+	for i, line := range lines {
+		if i > 0 && line.Date.Before(lines[i-1].Date) {
+			t.Fatalf("line %d is dated before the one above it", i)
+		}
+		if len(order) == 0 || order[len(order)-1] != line.Entry_ID {
+			order = append(order, line.Entry_ID)
+		}
+	}
+	want := []string{"invoice-i1", "payment-p1", "payment-p2", "invoice-i2",
+		"refund-r1"}
+	if len(order) != len(want) {
+		t.Fatalf("entries = %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("entries = %v, want %v", order, want)
+		}
+	}
+}
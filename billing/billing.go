@@ -0,0 +1,117 @@
+// Package billing works out what an invoice comes to and what has been
+// paid against it. The invoice shown, the payments taken against it and
+// what is done once it is paid all go by it, so they can't disagree.
+package billing
+
+import (
+	"context"
+	"math"
+	"restro/accounting"
+	"restro/models"
+)
+
+// Item is an order item as an invoice charges it: at the price snapshot
+// taken when it was ordered, or the food's current price for items from
+// before snapshots existed.
+type Item struct {
+	Order_item_id string
+	Status        string
+	Price         float64
+	Gift_card     bool
+}
+
+// Store reads the orders and payments invoices are billed from.
+type Store interface {
+	// Items lists all the items of an order, voided ones included.
+	Items(ctx context.Context, orderID string) ([]Item, error)
+	// DeliveryFee is what an order is charged for delivery, if anything.
+	DeliveryFee(ctx context.Context, orderID string) (float64, error)
+	// Payments lists the payments and refunds against an invoice.
+	Payments(ctx context.Context, invoiceID string) ([]models.Payment, error)
+}
+
+// Billed reports whether an invoice charges for an item. Voided items are
+// not charged for.
+func Billed(item Item) bool {
+	return item.Status != models.OrderItemVoid
+}
+
+// Amount is what the order of an invoice comes to before tax: its billed
+// items and any delivery fee. Gift_cards is the part of it that sold gift
+// cards.
+func Amount(ctx context.Context, store Store,
+	invoice models.Invoice) (accounting.Invoice, error) {
+	amount := accounting.Invoice{
+		Invoice_ID: invoice.Invoice_ID,
+		Order_ID:   invoice.Order_ID,
+		Created_at: invoice.Created_at,
+	}
+	items, err := store.Items(ctx, invoice.Order_ID)
+	if err != nil {
+		return amount, err
+	}
+	fee, err := store.DeliveryFee(ctx, invoice.Order_ID)
+	if err != nil {
+		return amount, err
+	}
+	for _, item := range items {
+		if !Billed(item) {
+			continue
+		}
+		amount.Amount += item.Price
+		if item.Gift_card {
+			amount.Gift_cards += item.Price
+		}
+	}
+	amount.Amount = round2(amount.Amount + fee)
+	amount.Gift_cards = round2(amount.Gift_cards)
+	return amount, nil
+}
+
+// Paid is what payments came to, less what was refunded of them.
+func Paid(payments []models.Payment) float64 {
+	paid := 0.0
+	for _, payment := range payments {
+		if payment.Amount == nil {
+			continue
+		}
+		if payment.Kind == models.PaymentKindRefund {
+			paid -= *payment.Amount
+		} else {
+			paid += *payment.Amount
+		}
+	}
+	return round2(paid)
+}
+
+// Balance is what an invoice owes, including tax, and what has been paid
+// against it less refunds.
+func Balance(ctx context.Context, store Store,
+	settings models.AccountingSettings,
+	invoice models.Invoice) (owed, paid float64, err error) {
+	amount, err := Amount(ctx, store, invoice)
+	if err != nil {
+		return 0, 0, err
+	}
+	payments, err := store.Payments(ctx, invoice.Invoice_ID)
+	if err != nil {
+		return 0, 0, err
+	}
+	owed, _, _ = accounting.InvoiceTotals(settings, amount)
+	return owed, Paid(payments), nil
+}
+
+// Outstanding is what is left to pay of what is owed. A payment can't be
+// for more.
+func Outstanding(owed, paid float64) float64 {
+	return round2(owed - paid)
+}
+
+// Settled reports whether what has been paid covers what is owed.
+func Settled(owed, paid float64) bool {
+	return paid >= owed
+}
+
+func round2(x float64) float64 {
+	return math.Round(x*100) / 100
+}
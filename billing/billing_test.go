@@ -0,0 +1,121 @@
+package billing
+
+import (
+	"context"
+	"restro/accounting"
+	"restro/models"
+	"testing"
+)
+
+func price(x float64) *float64 { return &x }
+
+func newInvoice(store *MemoryStore) models.Invoice {
+	store.AddItem("o1", Item{Order_item_id: "pizza", Price: 12.5})
+	store.AddItem("o1", Item{Order_item_id: "wine", Price: 7.25})
+	store.SetDeliveryFee("o1", 3)
+	return models.Invoice{Invoice_ID: "i1", Order_ID: "o1"}
+}
+
+// GetInvoice shows what Balance owes, and CreatePayment takes no more than
+// its Outstanding, so a voided item has to drop out of both.
+func TestVoidedItemIsNeitherShownNorTaken(t *testing.T) {
+	ctx := context.Background()
+	for _, tt := range []struct {
+		name     string
+		settings func(*models.AccountingSettings)
+		owed     float64
+	}{
+		{"tax included", func(s *models.AccountingSettings) {
+			s.Tax_rate = 0.1
+		}, 15.5},
+		{"tax on top", func(s *models.AccountingSettings) {
+			s.Tax_rate = 0.1
+			s.Prices_include_tax = false
+		}, 17.05},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			invoice := newInvoice(store)
+			settings := accounting.DefaultSettings()
+			tt.settings(&settings)
+
+			store.SetStatus("wine", models.OrderItemVoid)
+			amount, err := Amount(ctx, store, invoice)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if amount.Amount != 15.5 {
+				t.Fatalf("amount = %v, want 15.5 without the voided wine",
+					amount.Amount)
+			}
+			owed, paid, err := Balance(ctx, store, settings, invoice)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if owed != tt.owed || paid != 0 {
+				t.Fatalf("balance = %v, %v, want %v, 0", owed, paid, tt.owed)
+			}
+			if got := Outstanding(owed, paid); got != tt.owed {
+				t.Fatalf("outstanding = %v, want %v", got, tt.owed)
+			}
+
+			store.AddPayment(models.Payment{Invoice_ID: "i1",
+				Kind: models.PaymentKindPayment, Amount: price(tt.owed)})
+			owed, paid, _ = Balance(ctx, store, settings, invoice)
+			if !Settled(owed, paid) || Outstanding(owed, paid) != 0 {
+				t.Fatalf("paying %v left %v owed", tt.owed,
+					Outstanding(owed, paid))
+			}
+		})
+	}
+}
+
+func TestPaidLessRefunds(t *testing.T) {
+	store := NewMemoryStore()
+	invoice := newInvoice(store)
+	store.AddPayment(models.Payment{Invoice_ID: "i1",
+		Kind: models.PaymentKindPayment, Amount: price(10.1)})
+	store.AddPayment(models.Payment{Invoice_ID: "i1",
+		Kind: models.PaymentKindPayment, Amount: price(12.65)})
+	store.AddPayment(models.Payment{Invoice_ID: "i1",
+		Kind: models.PaymentKindRefund, Amount: price(2.2)})
+	store.AddPayment(models.Payment{Invoice_ID: "i2",
+		Kind: models.PaymentKindPayment, Amount: price(50)})
+
+	owed, paid, err := Balance(context.Background(), store,
+		accounting.DefaultSettings(), invoice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owed != 22.75 || paid != 20.55 {
+		t.Fatalf("balance = %v, %v, want 22.75, 20.55", owed, paid)
+	}
+	if Settled(owed, paid) {
+		t.Fatal("settled with 2.20 left to pay")
+	}
+	if got := Outstanding(owed, paid); got != 2.2 {
+		t.Fatalf("outstanding = %v, want 2.2", got)
+	}
+}
+
+func TestGiftCardsAreNotTaxed(t *testing.T) {
+	store := NewMemoryStore()
+	invoice := newInvoice(store)
+	store.AddItem("o1", Item{Order_item_id: "card", Price: 50,
+		Gift_card: true})
+	settings := accounting.DefaultSettings()
+	settings.Tax_rate = 0.2
+	settings.Prices_include_tax = false
+
+	amount, err := Amount(context.Background(), store, invoice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if amount.Amount != 72.75 || amount.Gift_cards != 50 {
+		t.Fatalf("amount = %+v, want 72.75 with 50 of gift cards", amount)
+	}
+	owed, _, _ := Balance(context.Background(), store, settings, invoice)
+	if owed != 77.3 {
+		t.Fatalf("owed = %v, want 77.3: tax on 22.75 only", owed)
+	}
+}
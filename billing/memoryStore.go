@@ -0,0 +1,75 @@
+package billing
+
+import (
+	"context"
+	"restro/models"
+	"sync"
+)
+
+// MemoryStore is a Store kept in memory, for tests and local tooling.
+type MemoryStore struct {
+	mu       sync.Mutex
+	items    map[string][]Item
+	fees     map[string]float64
+	payments map[string][]models.Payment
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		items:    map[string][]Item{},
+		fees:     map[string]float64{},
+		payments: map[string][]models.Payment{},
+	}
+}
+
+// AddItem puts an item on an order.
+func (s *MemoryStore) AddItem(orderID string, item Item) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[orderID] = append(s.items[orderID], item)
+}
+
+// SetStatus moves an order item to status, as voiding it does.
+func (s *MemoryStore) SetStatus(orderItemID, status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, items := range s.items {
+		for i := range items {
+			if items[i].Order_item_id == orderItemID {
+				items[i].Status = status
+			}
+		}
+	}
+}
+
+func (s *MemoryStore) SetDeliveryFee(orderID string, fee float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fees[orderID] = fee
+}
+
+// AddPayment records a payment or refund against its invoice.
+func (s *MemoryStore) AddPayment(payment models.Payment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.payments[payment.Invoice_ID] = append(s.payments[payment.Invoice_ID],
+		payment)
+}
+
+func (s *MemoryStore) Items(ctx context.Context, orderID string) ([]Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Item{}, s.items[orderID]...), nil
+}
+
+func (s *MemoryStore) DeliveryFee(ctx context.Context, orderID string) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fees[orderID], nil
+}
+
+func (s *MemoryStore) Payments(ctx context.Context, invoiceID string) ([]models.Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]models.Payment{}, s.payments[invoiceID]...), nil
+}
@@ -0,0 +1,91 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"restro/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoStore struct {
+	orderItems *mongo.Collection
+	foods      *mongo.Collection
+	orders     *mongo.Collection
+	payments   *mongo.Collection
+}
+
+// NewMongoStore returns a Store backed by the order item, food, order and
+// payment collections. It reads in the transaction of a session context.
+func NewMongoStore(orderItems, foods, orders, payments *mongo.Collection) Store {
+	return &mongoStore{
+		orderItems: orderItems,
+		foods:      foods,
+		orders:     orders,
+		payments:   payments,
+	}
+}
+
+func (s *mongoStore) Items(ctx context.Context, orderID string) ([]Item, error) {
+	cursor, err := s.orderItems.Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{"order_id": orderID}},
+		bson.M{"$lookup": bson.M{
+			"from":         s.foods.Name(),
+			"localField":   "food_id",
+			"foreignField": "food_id",
+			"as":           "food",
+		}},
+		bson.M{"$project": bson.M{
+			"_id":           0,
+			"order_item_id": 1,
+			"status":        1,
+			"price": bson.M{"$ifNull": bson.A{"$unit_price",
+				bson.M{"$arrayElemAt": bson.A{"$food.price", 0}}, 0}},
+			"gift_card": bson.M{"$gt": bson.A{"$gift_card_code", nil}},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		Order_item_id string  `bson:"order_item_id"`
+		Status        string  `bson:"status"`
+		Price         float64 `bson:"price"`
+		Gift_card     bool    `bson:"gift_card"`
+	}
+	if err = cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	items := make([]Item, 0, len(rows))
+	for _, row := range rows {
+		items = append(items, Item(row))
+	}
+	return items, nil
+}
+
+func (s *mongoStore) DeliveryFee(ctx context.Context, orderID string) (float64, error) {
+	var order models.Order
+	err := s.orders.FindOne(ctx, bson.M{"order_id": orderID},
+		options.FindOne().SetProjection(bson.M{"delivery_fee": 1})).
+		Decode(&order)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil || order.Delivery_fee == nil {
+		return 0, err
+	}
+	return *order.Delivery_fee, nil
+}
+
+func (s *mongoStore) Payments(ctx context.Context, invoiceID string) ([]models.Payment, error) {
+	cursor, err := s.payments.Find(ctx, bson.M{"invoice_id": invoiceID},
+		options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+	payments := []models.Payment{}
+	err = cursor.All(ctx, &payments)
+	return payments, err
+}
@@ -0,0 +1,117 @@
+// Command platformstub stands in for a delivery platform when trying the
+// platform integration locally. It takes the status updates the restaurant
+// sends back, checking their signatures, and can post a signed order to
+// the restaurant's webhook.
+//
+// Run the restaurant with PLATFORMS=stub, PLATFORM_STUB_SECRET=secret and
+// PLATFORM_STUB_STATUS_URL=http://localhost:8090/status, map the stub's
+// menu items to foods, then:
+//
+//	go run ./cmd/platformstub -secret secret \
+//		-send http://localhost:8000/webhooks/platforms/stub/orders
+//
+// Give -order a JSON file to send that order instead of the sample, and
+// -repeat to deliver it more than once.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"restro/platforms"
+	"strconv"
+	"time"
+)
+
+func main() {
+	listen := flag.String("listen", ":8090", "address to take status updates on")
+	secret := flag.String("secret", "", "secret shared with the restaurant")
+	send := flag.String("send", "", "webhook URL to post an order to")
+	orderFile := flag.String("order", "", "JSON file of the order to post")
+	repeat := flag.Int("repeat", 1, "how many times to deliver the order")
+	flag.Parse()
+	if *secret == "" {
+		log.Fatal("platformstub needs -secret")
+	}
+
+	http.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := platforms.VerifyRequest(r.Header, *secret, body); err != nil {
+			log.Println("status update with a bad signature:", string(body))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		var update platforms.StatusUpdate
+		if err := json.Unmarshal(body, &update); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("order %s is %s %s", update.External_id, update.Status,
+			update.Reason)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	go func() {
+		log.Fatal(http.ListenAndServe(*listen, nil))
+	}()
+
+	if *send != "" {
+		order, err := stubOrder(*orderFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for i := 0; i < *repeat; i++ {
+			if err := postOrder(*send, *secret, order); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	log.Println("taking status updates on", *listen)
+	select {}
+}
+
+// stubOrder reads the order to post from file, or makes up a sample one.
+func stubOrder(file string) ([]byte, error) {
+	if file != "" {
+		return os.ReadFile(file)
+	}
+	return json.Marshal(platforms.Order{
+		External_id: "stub-" + strconv.FormatInt(time.Now().Unix(), 10),
+		Type:        "DELIVERY",
+		Customer: platforms.Customer{
+			Name:    "Stub Customer",
+			Phone:   "+10000000000",
+			Address: "1 Test Street",
+		},
+		Items: []platforms.Item{
+			{External_id: "stub-item-1", Name: "Sample item", Quantity: 2},
+			{External_id: "stub-item-2", Name: "Another item", Quantity: 1,
+				Modifiers: []string{"no onions"}},
+		},
+	})
+}
+
+func postOrder(url, secret string, order []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(order))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	platforms.SignRequest(req.Header, secret, order)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	fmt.Printf("%s\n%s\n", resp.Status, body)
+	return nil
+}
@@ -0,0 +1,318 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"restro/accounting"
+	"restro/database"
+	"restro/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var accountingSettingsCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "accountingSettings")
+var journalExportCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "journalExport")
+
+func loadAccountingSettings(ctx context.Context) (models.AccountingSettings, error) {
+	var settings models.AccountingSettings
+	err := accountingSettingsCollection.FindOne(ctx,
+		bson.M{"settings_id": "default"}).Decode(&settings)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return accounting.DefaultSettings(), nil
+	}
+	return settings, err
+}
+
+// invoiceAmounts loads the matching invoices with what their orders come
+// to.
+func invoiceAmounts(ctx context.Context, filter bson.M) ([]accounting.Invoice, error) {
+	pipeline := append(bson.A{bson.M{"$match": filter}}, invoiceAmountStages()...)
+	cursor, err := invoiceCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var docs []struct {
+		Invoice_id string    `bson:"invoice_id"`
+		Order_id   string    `bson:"order_id"`
+		Amount     float64   `bson:"amount"`
+		Gift_cards float64   `bson:"gift_cards"`
+		Created_at time.Time `bson:"created_at"`
+	}
+	if err = cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	invoices := make([]accounting.Invoice, 0, len(docs))
+	for _, doc := range docs {
+		invoices = append(invoices, accounting.Invoice{
+			Invoice_ID: doc.Invoice_id,
+			Order_ID:   doc.Order_id,
+			Amount:     doc.Amount,
+			Gift_cards: doc.Gift_cards,
+			Created_at: doc.Created_at,
+		})
+	}
+	return invoices, nil
+}
+
+// journalLines books the invoices raised and the payments and refunds
+// taken in the period.
+func journalLines(ctx context.Context, from, to time.Time) ([]models.JournalLine, error) {
+	settings, err := loadAccountingSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	period := bson.M{"$gte": from, "$lt": to}
+	invoices, err := invoiceAmounts(ctx, bson.M{"created_at": period})
+	if err != nil {
+		return nil, err
+	}
+	result, err := paymentCollection.Find(ctx, bson.M{"created_at": period})
+	if err != nil {
+		return nil, err
+	}
+	var payments []models.Payment
+	if err = result.All(ctx, &payments); err != nil {
+		return nil, err
+	}
+	return accounting.Journal(settings, invoices, payments), nil
+}
+
+func GetAccountingSettings() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		settings, err := loadAccountingSettings(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while loading the settings"})
+			return
+		}
+		c.JSON(http.StatusOK, settings)
+	}
+}
+
+// UpdateAccountingSettings replaces the chart of accounts mapping and the
+// tax settings.
+func UpdateAccountingSettings() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var settings models.AccountingSettings
+
+		if err := c.BindJSON(&settings); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(settings); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		settings.Settings_ID = "default"
+		settings.Updated_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		_, err := accountingSettingsCollection.ReplaceOne(ctx,
+			bson.M{"settings_id": "default"}, settings,
+			options.Replace().SetUpsert(true))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "settings update failed"})
+			return
+		}
+		c.JSON(http.StatusOK, settings)
+	}
+}
+
+// GetJournal previews the journal lines for a period without exporting
+// them.
+func GetJournal() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		q, ok := reportQuery(c)
+		if !ok {
+			return
+		}
+		lines, err := journalLines(ctx, q.From, q.To)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while building the journal"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"from":      q.From,
+			"to":        q.To,
+			"time_zone": q.Location.String(),
+			"lines":     lines,
+		})
+	}
+}
+
+// GetJournalExports lists the periods already exported, newest first.
+func GetJournalExports() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		result, err := journalExportCollection.Find(ctx, bson.M{},
+			options.Find().SetSort(bson.M{"from": -1}).
+				SetProjection(bson.M{"lines": 0}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the exports"})
+			return
+		}
+		allExports := []models.JournalExport{}
+		if err = result.All(ctx, &allExports); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the exports"})
+			return
+		}
+		c.JSON(http.StatusOK, allExports)
+	}
+}
+
+// CreateJournalExport exports the journal for a period as csv or iif
+// (format). The period has to be over and mustn't overlap one exported
+// before, so no line is ever handed over twice.
+func CreateJournalExport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		format := c.DefaultQuery("format", accounting.FormatCSV)
+		if format != accounting.FormatCSV && format != accounting.FormatIIF {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": accounting.ErrUnknownFormat.Error()})
+			return
+		}
+		q, ok := reportQuery(c)
+		if !ok {
+			return
+		}
+		if q.To.After(time.Now()) {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": "only periods that are over can be exported"})
+			return
+		}
+		lines, err := journalLines(ctx, q.From, q.To)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while building the journal"})
+			return
+		}
+		var journalExport models.JournalExport
+		journalExport.ID = primitive.NewObjectID()
+		journalExport.Export_ID = journalExport.ID.Hex()
+		journalExport.From = q.From
+		journalExport.To = q.To
+		journalExport.Time_zone = q.Location.String()
+		journalExport.Format = format
+		journalExport.Lines = lines
+		journalExport.Line_count = len(lines)
+		journalExport.Created_by = c.GetString("uid")
+		journalExport.Created_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+
+		var overlapping models.JournalExport
+		err = inTransaction(ctx, func(sc mongo.SessionContext) error {
+			if err := lockJournalExports(sc); err != nil {
+				return err
+			}
+			err := journalExportCollection.FindOne(sc, bson.M{
+				"from": bson.M{"$lt": q.To},
+				"to":   bson.M{"$gt": q.From},
+			}).Decode(&overlapping)
+			if err == nil {
+				return errJournalOverlap
+			}
+			if !errors.Is(err, mongo.ErrNoDocuments) {
+				return err
+			}
+			_, err = journalExportCollection.InsertOne(sc, journalExport)
+			return err
+		})
+		if errors.Is(err, errJournalOverlap) {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf(
+				"the period overlaps export %s (%s to %s)",
+				overlapping.Export_ID,
+				overlapping.From.Format(time.RFC3339),
+				overlapping.To.Format(time.RFC3339))})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "the export was not recorded"})
+			return
+		}
+		writeJournalExport(c, journalExport, format)
+	}
+}
+
+var errJournalOverlap = errors.New("the period overlaps a past export")
+
+// lockJournalExports writes a document every export's transaction writes,
+// so two exports can't both find no overlap: one of them is retried and
+// then sees the other.
+func lockJournalExports(sc mongo.SessionContext) error {
+	_, err := accountingSettingsCollection.UpdateOne(sc,
+		bson.M{"settings_id": "journal_exports"},
+		bson.M{"$inc": bson.M{"exports": 1}},
+		options.Update().SetUpsert(true))
+	return err
+}
+
+// DownloadJournalExport downloads an export again, in its own format or
+// the one asked for.
+func DownloadJournalExport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var journalExport models.JournalExport
+		if err := journalExportCollection.FindOne(ctx, bson.M{
+			"export_id": c.Param("export_id")}).Decode(&journalExport); err != nil {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any export with given ID"})
+			return
+		}
+		format := c.DefaultQuery("format", journalExport.Format)
+		if format != accounting.FormatCSV && format != accounting.FormatIIF {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": accounting.ErrUnknownFormat.Error()})
+			return
+		}
+		writeJournalExport(c, journalExport, format)
+	}
+}
+
+func writeJournalExport(c *gin.Context, journalExport models.JournalExport,
+	format string) {
+	location, err := time.LoadLocation(journalExport.Time_zone)
+	if err != nil {
+		location = time.UTC
+	}
+	filename := fmt.Sprintf("journal-%s-%s.%s",
+		journalExport.From.In(location).Format("20060102"),
+		journalExport.To.In(location).Format("20060102"), format)
+	c.Header("Content-Type", accounting.ContentType(format))
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+	if err := accounting.Write(c.Writer, format, journalExport.Lines,
+		location); err != nil {
+		log.Println("journal export", journalExport.Export_ID, "failed:", err)
+	}
+}
@@ -0,0 +1,340 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"restro/database"
+	"restro/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// bundleSelection is how a bundle is ordered through the order items API:
+// the bundle plus the food chosen for each of its slots.
+type bundleSelection struct {
+	Bundle_id string            `json:"bundle_id"`
+	Quantity  *string           `json:"quantity"`
+	Choices   map[string]string `json:"choices"`
+}
+
+var bundleCollection *mongo.Collection = database.OpenCollection(database.
+	Client, "bundle")
+
+func GetBundles() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		result, err := bundleCollection.Find(ctx, bson.M{})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the bundles"})
+			return
+		}
+		allBundles := []bson.M{}
+		if err = result.All(ctx, &allBundles); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the bundles"})
+			return
+		}
+		c.JSON(http.StatusOK, allBundles)
+	}
+}
+
+func GetBundle() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var bundle models.Bundle
+		err := bundleCollection.FindOne(ctx,
+			bson.M{"bundle_id": c.Param("bundle_id")}).Decode(&bundle)
+		if err != nil {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any bundle with given ID"})
+			return
+		}
+		c.JSON(http.StatusOK, bundle)
+	}
+}
+
+func CreateBundle() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var bundle models.Bundle
+
+		if err := c.BindJSON(&bundle); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(bundle); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		if err := checkBundleSlots(ctx, bundle); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if bundle.Allocation_method == "" {
+			bundle.Allocation_method = models.AllocationProportional
+		}
+		for i := range bundle.Slots {
+			bundle.Slots[i].Slot_ID = primitive.NewObjectID().Hex()
+		}
+		var price = toFixed(*bundle.Price, 2)
+		bundle.Price = &price
+		bundle.Created_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		bundle.Updated_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		bundle.ID = primitive.NewObjectID()
+		bundle.Bundle_ID = bundle.ID.Hex()
+
+		if _, err := bundleCollection.InsertOne(ctx, bundle); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "bundle was not created"})
+			return
+		}
+		c.JSON(http.StatusOK, bundle)
+	}
+}
+
+func UpdateBundle() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var bundle models.Bundle
+		bundleID := c.Param("bundle_id")
+
+		if err := c.BindJSON(&bundle); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		updateObj := bson.M{}
+		if bundle.Name != nil {
+			updateObj["name"] = bundle.Name
+		}
+		if bundle.Price != nil {
+			if *bundle.Price <= 0 {
+				c.JSON(http.StatusBadRequest,
+					gin.H{"error": "bundle price must be positive"})
+				return
+			}
+			updateObj["price"] = toFixed(*bundle.Price, 2)
+		}
+		if bundle.Allocation_method != "" {
+			if err := validate.Var(bundle.Allocation_method,
+				"eq=PROPORTIONAL|eq=WEIGHTED"); err != nil {
+				c.JSON(http.StatusBadRequest,
+					gin.H{"error": "unknown allocation method"})
+				return
+			}
+			updateObj["allocation_method"] = bundle.Allocation_method
+		}
+		if bundle.Menu_ID != nil {
+			updateObj["menu_id"] = bundle.Menu_ID
+		}
+		if bundle.Slots != nil {
+			if err := validate.Var(bundle.Slots, "min=1,dive"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if err := checkBundleSlots(ctx, bundle); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			for i := range bundle.Slots {
+				if bundle.Slots[i].Slot_ID == "" {
+					bundle.Slots[i].Slot_ID = primitive.NewObjectID().Hex()
+				}
+			}
+			updateObj["slots"] = bundle.Slots
+		}
+		updateObj["updated_at"], _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+
+		result, err := bundleCollection.UpdateOne(ctx,
+			bson.M{"bundle_id": bundleID}, bson.M{"$set": updateObj})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "bundle update failed"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any bundle with given ID"})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// checkBundleSlots makes sure every food a slot offers exists.
+func checkBundleSlots(ctx context.Context, bundle models.Bundle) error {
+	var ids []string
+	for _, slot := range bundle.Slots {
+		ids = append(ids, slot.Food_IDs...)
+	}
+	foods, err := foodsByID(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if _, ok := foods[id]; !ok {
+			return fmt.Errorf("food %s was not found", id)
+		}
+	}
+	return nil
+}
+
+func foodsByID(ctx context.Context, ids []string) (map[string]models.Food, error) {
+	foods := map[string]models.Food{}
+	if len(ids) == 0 {
+		return foods, nil
+	}
+	result, err := foodCollection.Find(ctx,
+		bson.M{"food_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	var all []models.Food
+	if err = result.All(ctx, &all); err != nil {
+		return nil, err
+	}
+	for _, food := range all {
+		foods[food.Food_ID] = food
+	}
+	return foods, nil
+}
+
+// bundleOrderItems expands one ordered bundle into an order item per slot.
+// Each component is a normal order item for the chosen food, so the kitchen
+// sees what to cook and item sales stay per food, while its Unit_price is
+// the component's share of the bundle price.
+func bundleOrderItems(ctx context.Context, selection bundleSelection,
+	orderID string) ([]models.OrderItem, error) {
+	var bundle models.Bundle
+	err := bundleCollection.FindOne(ctx,
+		bson.M{"bundle_id": selection.Bundle_id}).Decode(&bundle)
+	if err != nil {
+		return nil, fmt.Errorf("bundle %s was not found",
+			selection.Bundle_id)
+	}
+
+	chosen := make([]string, len(bundle.Slots))
+	for i, slot := range bundle.Slots {
+		foodID, ok := selection.Choices[slot.Slot_ID]
+		if !ok {
+			return nil, fmt.Errorf("no choice made for slot %q", slot.Name)
+		}
+		if !contains(slot.Food_IDs, foodID) {
+			return nil, fmt.Errorf("food %s is not a choice for slot %q",
+				foodID, slot.Name)
+		}
+		chosen[i] = foodID
+	}
+
+	foods, err := foodsByID(ctx, chosen)
+	if err != nil {
+		return nil, err
+	}
+	for _, foodID := range chosen {
+		if food := foods[foodID]; food.Available != nil && !*food.Available {
+			return nil, fmt.Errorf("food %s is not available", foodID)
+		}
+	}
+	shares, err := AllocateBundlePrice(bundle, chosen, foods)
+	if err != nil {
+		return nil, err
+	}
+
+	quantity := "M"
+	if selection.Quantity != nil {
+		quantity = *selection.Quantity
+	}
+	lineID := primitive.NewObjectID().Hex()
+	status := models.OrderItemPending
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	var orderItems []models.OrderItem
+	for i := range bundle.Slots {
+		var orderItem models.OrderItem
+		orderItem.ID = primitive.NewObjectID()
+		orderItem.Order_item_id = orderItem.ID.Hex()
+		orderItem.Order_id = orderID
+		orderItem.Food_id = &chosen[i]
+		orderItem.Quantity = &quantity
+		orderItem.Unit_price = &shares[i]
+		orderItem.Bundle_id = &bundle.Bundle_ID
+		orderItem.Bundle_line_id = &lineID
+		orderItem.Bundle_slot_id = &bundle.Slots[i].Slot_ID
+		orderItem.Status = &status
+		orderItem.Created_at = now
+		orderItem.Updated_at = now
+		orderItems = append(orderItems, orderItem)
+	}
+	return orderItems, nil
+}
+
+// AllocateBundlePrice splits the bundle price over the chosen foods, one
+// share per slot. PROPORTIONAL uses the foods' list prices as weights and
+// WEIGHTED the slots' own weights. Shares are rounded to cents and the
+// rounding difference goes to the last slot so they add up to the price.
+func AllocateBundlePrice(bundle models.Bundle, chosen []string,
+	foods map[string]models.Food) ([]float64, error) {
+	weights := make([]float64, len(bundle.Slots))
+	total := 0.0
+	for i, slot := range bundle.Slots {
+		switch bundle.Allocation_method {
+		case models.AllocationWeighted:
+			if slot.Weight == nil {
+				return nil, fmt.Errorf("slot %q has no weight", slot.Name)
+			}
+			weights[i] = *slot.Weight
+		default:
+			food, ok := foods[chosen[i]]
+			if !ok || food.Price == nil {
+				return nil, fmt.Errorf("food %s has no price", chosen[i])
+			}
+			weights[i] = *food.Price
+		}
+		total += weights[i]
+	}
+	if total <= 0 {
+		return nil, errors.New("bundle components have no value to allocate")
+	}
+
+	price := *bundle.Price
+	shares := make([]float64, len(weights))
+	allocated := 0.0
+	for i, weight := range weights {
+		if i == len(weights)-1 {
+			shares[i] = toFixed(price-allocated, 2)
+			break
+		}
+		shares[i] = toFixed(price*weight/total, 2)
+		allocated += shares[i]
+	}
+	return shares, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,503 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"restro/database"
+	"restro/models"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var customerCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "customer")
+var customerIndexOnce sync.Once
+
+var (
+	errCustomerExists  = errors.New("another customer has that phone or email")
+	errCustomerContact = errors.New("a customer needs a phone or an email")
+	errNoCustomer      = errors.New("customer was not found")
+)
+
+// customerOrder is an order in a customer's history, with what its
+// invoice came to.
+type customerOrder struct {
+	Order_id       string     `json:"order_id"`
+	Order_date     time.Time  `json:"order_date"`
+	Order_type     string     `json:"order_type"`
+	Table_id       *string    `json:"table_id"`
+	Closed_at      *time.Time `json:"closed_at"`
+	Invoice_id     *string    `json:"invoice_id"`
+	Amount         *float64   `json:"amount"`
+	Payment_status *string    `json:"payment_status"`
+}
+
+// customerHistory is a customer's visits, each an order they came for,
+// and what they have spent: their settled invoices less refunds.
+type customerHistory struct {
+	Customer       models.Customer `json:"customer"`
+	Visits         int             `json:"visits"`
+	First_visit    *time.Time      `json:"first_visit"`
+	Last_visit     *time.Time      `json:"last_visit"`
+	Lifetime_spend float64         `json:"lifetime_spend"`
+	Orders         []customerOrder `json:"orders"`
+}
+
+// GetCustomers looks customers up by ?phone= or ?email=, or lists those
+// whose name has ?q= in it.
+func GetCustomers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		filter := bson.M{}
+		if phone := c.Query("phone"); phone != "" {
+			filter["phone"] = normalizePhone(phone)
+		}
+		if email := c.Query("email"); email != "" {
+			filter["email"] = normalizeEmail(email)
+		}
+		if q := strings.TrimSpace(c.Query("q")); q != "" {
+			filter["name"] = bson.M{"$regex": regexp.QuoteMeta(q),
+				"$options": "i"}
+		}
+		result, err := customerCollection.Find(ctx, filter,
+			options.Find().SetSort(bson.M{"name": 1}).SetLimit(100))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the customers"})
+			return
+		}
+		allCustomers := []models.Customer{}
+		if err = result.All(ctx, &allCustomers); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the customers"})
+			return
+		}
+		c.JSON(http.StatusOK, allCustomers)
+	}
+}
+
+func GetCustomer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		customer, err := findCustomer(ctx, c.Param("customer_id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any customer with given ID"})
+			return
+		}
+		c.JSON(http.StatusOK, customer)
+	}
+}
+
+func CreateCustomer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var customer models.Customer
+
+		if err := c.BindJSON(&customer); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		customer.ID = primitive.NewObjectID()
+		customer.Customer_id = customer.ID.Hex()
+		customer.Created_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		customer.Updated_at = customer.Created_at
+		customer.Consent_updated_at = nil
+		if customer.Marketing_consent != nil {
+			customer.Consent_updated_at = &customer.Created_at
+		}
+		if err := checkCustomer(ctx, &customer); err != nil {
+			customerError(c, err)
+			return
+		}
+
+		if _, err := customerCollection.InsertOne(ctx, customer); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				customerError(c, errCustomerExists)
+				return
+			}
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "customer was not created"})
+			return
+		}
+		c.JSON(http.StatusOK, customer)
+	}
+}
+
+// UpdateCustomer changes the details given. An empty phone or email
+// removes it.
+func UpdateCustomer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var update models.Customer
+		customerID := c.Param("customer_id")
+
+		if err := c.BindJSON(&update); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		customer, err := findCustomer(ctx, customerID)
+		if err != nil {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any customer with given ID"})
+			return
+		}
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		if update.Name != nil {
+			customer.Name = update.Name
+		}
+		if update.Phone != nil {
+			customer.Phone = update.Phone
+		}
+		if update.Email != nil {
+			customer.Email = update.Email
+		}
+		if update.Preferences != nil {
+			customer.Preferences = update.Preferences
+		}
+		if update.Allergy_notes != nil {
+			customer.Allergy_notes = update.Allergy_notes
+		}
+		if update.Marketing_consent != nil && (customer.Marketing_consent == nil ||
+			*update.Marketing_consent != *customer.Marketing_consent) {
+			customer.Marketing_consent = update.Marketing_consent
+			customer.Consent_updated_at = &now
+		}
+		if err := checkCustomer(ctx, &customer); err != nil {
+			customerError(c, err)
+			return
+		}
+		customer.Updated_at = now
+
+		if _, err := customerCollection.ReplaceOne(ctx,
+			bson.M{"customer_id": customerID}, customer); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				customerError(c, errCustomerExists)
+				return
+			}
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "customer update failed"})
+			return
+		}
+		c.JSON(http.StatusOK, customer)
+	}
+}
+
+// DeleteCustomer forgets a customer. Their orders and invoices stay, no
+// longer saying who they were for.
+func DeleteCustomer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		customerID := c.Param("customer_id")
+		result, err := customerCollection.DeleteOne(ctx,
+			bson.M{"customer_id": customerID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "customer was not deleted"})
+			return
+		}
+		if result.DeletedCount == 0 {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any customer with given ID"})
+			return
+		}
+		detach := bson.M{"$set": bson.M{"customer_id": nil}}
+		if _, err := orderCollection.UpdateMany(ctx,
+			bson.M{"customer_id": customerID}, detach); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "the customer's orders were not updated"})
+			return
+		}
+		if _, err := invoiceCollection.UpdateMany(ctx,
+			bson.M{"customer_id": customerID}, detach); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "the customer's invoices were not updated"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"deleted": customerID})
+	}
+}
+
+// GetCustomerHistory gives a customer's orders, newest first, with their
+// visits and lifetime spend.
+func GetCustomerHistory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		customer, err := findCustomer(ctx, c.Param("customer_id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any customer with given ID"})
+			return
+		}
+		history, err := customerHistoryOf(ctx, customer)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while getting the customer's history"})
+			return
+		}
+		c.JSON(http.StatusOK, history)
+	}
+}
+
+func customerHistoryOf(ctx context.Context,
+	customer models.Customer) (customerHistory, error) {
+	history := customerHistory{Customer: customer, Orders: []customerOrder{}}
+	result, err := orderCollection.Find(ctx, bson.M{
+		"customer_id": customer.Customer_id,
+		// merged orders are part of the order they went into
+		"merged_into": nil,
+	}, options.Find().SetSort(bson.M{"order_date": -1}))
+	if err != nil {
+		return history, err
+	}
+	orders := []models.Order{}
+	if err = result.All(ctx, &orders); err != nil {
+		return history, err
+	}
+
+	var invoices []struct {
+		Invoice_id     string  `bson:"invoice_id"`
+		Order_id       string  `bson:"order_id"`
+		Payment_status *string `bson:"payment_status"`
+		Amount         float64 `bson:"amount"`
+		Gift_cards     float64 `bson:"gift_cards"`
+	}
+	pipeline := append(bson.A{
+		bson.M{"$match": bson.M{"customer_id": customer.Customer_id}},
+	}, invoiceAmountStages()...)
+	cursor, err := invoiceCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return history, err
+	}
+	if err = cursor.All(ctx, &invoices); err != nil {
+		return history, err
+	}
+	invoiceIDs := bson.A{}
+	for _, invoice := range invoices {
+		invoiceIDs = append(invoiceIDs, invoice.Invoice_id)
+	}
+	var refunds []struct {
+		Amount float64 `bson:"amount"`
+	}
+	cursor, err = paymentCollection.Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{"invoice_id": bson.M{"$in": invoiceIDs},
+			"kind": models.PaymentKindRefund}},
+		bson.M{"$group": bson.M{"_id": nil, "amount": bson.M{"$sum": "$amount"}}},
+	})
+	if err != nil {
+		return history, err
+	}
+	if err = cursor.All(ctx, &refunds); err != nil {
+		return history, err
+	}
+
+	spend := 0.0
+	for _, refund := range refunds {
+		spend -= refund.Amount
+	}
+	invoiceOfOrder := map[string]int{}
+	for i, invoice := range invoices {
+		invoiceOfOrder[invoice.Order_id] = i
+		// buying a gift card isn't spend until it is redeemed
+		if derefString(invoice.Payment_status) == "COMPLETE" {
+			spend += invoice.Amount - invoice.Gift_cards
+		}
+	}
+	history.Lifetime_spend = toFixed(spend, 2)
+
+	for _, order := range orders {
+		entry := customerOrder{
+			Order_id:   order.Order_ID,
+			Order_date: order.Order_date,
+			Order_type: orderType(order),
+			Table_id:   order.Table_ID,
+			Closed_at:  order.Closed_at,
+		}
+		if i, ok := invoiceOfOrder[order.Order_ID]; ok {
+			invoice := invoices[i]
+			amount := invoice.Amount
+			entry.Invoice_id = &invoice.Invoice_id
+			entry.Amount = &amount
+			entry.Payment_status = invoice.Payment_status
+		}
+		history.Orders = append(history.Orders, entry)
+	}
+	history.Visits = len(orders)
+	if len(orders) > 0 {
+		first, last := orders[len(orders)-1].Order_date, orders[0].Order_date
+		history.First_visit, history.Last_visit = &first, &last
+	}
+	return history, nil
+}
+
+func findCustomer(ctx context.Context, customerID string) (models.Customer, error) {
+	var customer models.Customer
+	err := customerCollection.FindOne(ctx,
+		bson.M{"customer_id": customerID}).Decode(&customer)
+	return customer, err
+}
+
+// ensureCustomerIndexes makes phones and emails unique, so two customers
+// saved at once can't both pass checkCustomer with the same one. The
+// indexes only cover strings: a customer without a phone or email has it
+// null, which a sparse index would still count.
+func ensureCustomerIndexes(ctx context.Context) {
+	customerIndexOnce.Do(func() {
+		_, err := customerCollection.Indexes().CreateMany(ctx,
+			[]mongo.IndexModel{
+				{
+					Keys: bson.D{{Key: "phone", Value: 1}},
+					Options: options.Index().SetUnique(true).
+						SetPartialFilterExpression(bson.M{
+							"phone": bson.M{"$type": "string"}}),
+				},
+				{
+					Keys: bson.D{{Key: "email", Value: 1}},
+					Options: options.Index().SetUnique(true).
+						SetPartialFilterExpression(bson.M{
+							"email": bson.M{"$type": "string"}}),
+				},
+			})
+		if err != nil {
+			log.Println("couldn't create the customer indexes:", err)
+		}
+	})
+}
+
+// checkCustomer tidies a customer's phone and email and checks them
+// against the other customers'. The error is meant for the client.
+func checkCustomer(ctx context.Context, customer *models.Customer) error {
+	if customer.Phone != nil {
+		customer.Phone = optionalString(normalizePhone(*customer.Phone))
+	}
+	if customer.Email != nil {
+		customer.Email = optionalString(normalizeEmail(*customer.Email))
+	}
+	if customer.Name != nil {
+		name := strings.TrimSpace(*customer.Name)
+		customer.Name = &name
+	}
+	if err := validate.Struct(customer); err != nil {
+		return err
+	}
+	if customer.Phone == nil && customer.Email == nil {
+		return errCustomerContact
+	}
+	ensureCustomerIndexes(ctx)
+	contacts := bson.A{}
+	if customer.Phone != nil {
+		contacts = append(contacts, bson.M{"phone": *customer.Phone})
+	}
+	if customer.Email != nil {
+		contacts = append(contacts, bson.M{"email": *customer.Email})
+	}
+	count, err := customerCollection.CountDocuments(ctx, bson.M{
+		"customer_id": bson.M{"$ne": customer.Customer_id},
+		"$or":         contacts,
+	})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errCustomerExists
+	}
+	return nil
+}
+
+// attachCustomer checks the customer an order is for, filling in who a
+// takeaway or delivery order is for from their profile when not given.
+func attachCustomer(ctx context.Context, order *models.Order) error {
+	if order.Customer_id == nil {
+		return nil
+	}
+	customer, err := findCustomer(ctx, *order.Customer_id)
+	if err != nil {
+		return errNoCustomer
+	}
+	if order.Customer_name == nil {
+		order.Customer_name = customer.Name
+	}
+	if order.Customer_phone == nil {
+		order.Customer_phone = customer.Phone
+	}
+	return nil
+}
+
+// customerByPhone is the customer with phone, if there is one.
+func customerByPhone(ctx context.Context, phone string) *string {
+	if phone = normalizePhone(phone); phone == "" {
+		return nil
+	}
+	var customer models.Customer
+	if err := customerCollection.FindOne(ctx,
+		bson.M{"phone": phone}).Decode(&customer); err != nil {
+		return nil
+	}
+	return &customer.Customer_id
+}
+
+// normalizePhone keeps a phone number's digits and any leading +, so the
+// same number written differently is found.
+func normalizePhone(phone string) string {
+	phone = strings.TrimSpace(phone)
+	var normalized strings.Builder
+	for i, r := range phone {
+		if (r >= '0' && r <= '9') || (r == '+' && i == 0) {
+			normalized.WriteRune(r)
+		}
+	}
+	return normalized.String()
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// optionalString is nil for an empty string.
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func customerError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errCustomerExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, errCustomerContact), errors.Is(err, errNoCustomer):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		var invalid validator.ValidationErrors
+		if errors.As(err, &invalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError,
+			gin.H{"error": "customer was not saved"})
+	}
+}
@@ -0,0 +1,316 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"restro/database"
+	"restro/models"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var deliveryZoneCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "deliveryZone")
+
+func GetDeliveryZones() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		result, err := deliveryZoneCollection.Find(ctx, bson.M{},
+			options.Find().SetSort(bson.M{"name": 1}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the delivery zones"})
+			return
+		}
+		allZones := []models.DeliveryZone{}
+		if err = result.All(ctx, &allZones); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the delivery zones"})
+			return
+		}
+		c.JSON(http.StatusOK, allZones)
+	}
+}
+
+func CreateDeliveryZone() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var zone models.DeliveryZone
+
+		if err := c.BindJSON(&zone); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validate.Struct(zone); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		zone.ID = primitive.NewObjectID()
+		zone.Delivery_zone_ID = zone.ID.Hex()
+		fee := toFixed(*zone.Fee, 2)
+		zone.Fee = &fee
+		zone.Postal_codes = normalizePostalCodes(zone.Postal_codes)
+		zone.Created_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		zone.Updated_at = zone.Created_at
+
+		if _, err := deliveryZoneCollection.InsertOne(ctx, zone); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "delivery zone was not created"})
+			return
+		}
+		c.JSON(http.StatusOK, zone)
+	}
+}
+
+// UpdateDeliveryZone changes a zone. Orders already taken keep the fee they
+// were charged.
+func UpdateDeliveryZone() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var update models.DeliveryZone
+		zoneID := c.Param("delivery_zone_id")
+
+		if err := c.BindJSON(&update); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var zone models.DeliveryZone
+		if err := deliveryZoneCollection.FindOne(ctx,
+			bson.M{"delivery_zone_id": zoneID}).Decode(&zone); err != nil {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any delivery zone with given ID"})
+			return
+		}
+		if update.Name != nil {
+			zone.Name = update.Name
+		}
+		if update.Fee != nil {
+			fee := toFixed(*update.Fee, 2)
+			zone.Fee = &fee
+		}
+		if update.Postal_codes != nil {
+			zone.Postal_codes = normalizePostalCodes(update.Postal_codes)
+		}
+		if err := validate.Struct(zone); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		zone.Updated_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+
+		if _, err := deliveryZoneCollection.ReplaceOne(ctx,
+			bson.M{"delivery_zone_id": zoneID}, zone); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "delivery zone update failed"})
+			return
+		}
+		c.JSON(http.StatusOK, zone)
+	}
+}
+
+func DeleteDeliveryZone() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		zoneID := c.Param("delivery_zone_id")
+		result, err := deliveryZoneCollection.DeleteOne(ctx,
+			bson.M{"delivery_zone_id": zoneID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "delivery zone was not deleted"})
+			return
+		}
+		if result.DeletedCount == 0 {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any delivery zone with given ID"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"deleted": zoneID})
+	}
+}
+
+// checkOrderType makes the order's type and the details that go with it
+// agree, defaulting the type to dine-in. Takeaway and delivery orders say
+// how to reach the customer and when they were promised, unless they came
+// from a platform, which does that itself. A delivery order's address has
+// to be in its zone, and an address with one of a zone's postal codes is
+// put in that zone when none is given. It is charged the zone's fee unless
+// given one. The error is meant for the client.
+func checkOrderType(ctx context.Context, order *models.Order) error {
+	if order.Order_type == "" {
+		order.Order_type = models.OrderDineIn
+	}
+	switch order.Order_type {
+	case models.OrderDineIn:
+		if order.Table_ID == nil {
+			return errors.New("dine-in orders need a table_id")
+		}
+	case models.OrderTakeaway, models.OrderDelivery, models.OrderDriveThrough:
+		if order.Table_ID != nil {
+			return errors.New("only dine-in orders are at a table")
+		}
+	default:
+		return errors.New("order_type must be one of " +
+			strings.Join(models.OrderTypes, ", "))
+	}
+	if order.Order_type != models.OrderDelivery &&
+		(order.Delivery_address != nil || order.Delivery_zone_id != nil ||
+			order.Delivery_fee != nil) {
+		return errors.New("only delivery orders have a delivery address, " +
+			"zone or fee")
+	}
+	if order.Order_type != models.OrderTakeaway &&
+		order.Order_type != models.OrderDelivery {
+		return nil
+	}
+	if strings.TrimSpace(derefString(order.Customer_name)) == "" {
+		return errors.New("takeaway and delivery orders need a customer_name")
+	}
+	// a scheduled order is promised for when it is scheduled
+	if order.Platform == nil &&
+		(strings.TrimSpace(derefString(order.Customer_phone)) == "" ||
+			order.Promised_at == nil && order.Scheduled_for == nil) {
+		return errors.New("takeaway and delivery orders need a " +
+			"customer_phone and a promised_at")
+	}
+	if order.Order_type != models.OrderDelivery {
+		return nil
+	}
+	if strings.TrimSpace(derefString(order.Delivery_address)) == "" {
+		return errors.New("delivery orders need a delivery_address")
+	}
+	zone, err := deliveryZoneFor(ctx, *order)
+	if err != nil {
+		return err
+	}
+	if zone != nil {
+		order.Delivery_zone_id = &zone.Delivery_zone_ID
+		if order.Delivery_fee == nil {
+			order.Delivery_fee = zone.Fee
+		}
+	}
+	if order.Delivery_fee != nil {
+		fee := toFixed(*order.Delivery_fee, 2)
+		order.Delivery_fee = &fee
+	}
+	return nil
+}
+
+// deliveryZoneFor is the zone a delivery order goes to: the one it is in,
+// which has to have its address's postal code when the zone lists any, or
+// otherwise the zone with a postal code in its address. It is nil when
+// the order isn't in a zone and no zone has its postal code.
+func deliveryZoneFor(ctx context.Context,
+	order models.Order) (*models.DeliveryZone, error) {
+	if order.Delivery_zone_id != nil {
+		var zone models.DeliveryZone
+		if err := deliveryZoneCollection.FindOne(ctx, bson.M{
+			"delivery_zone_id": *order.Delivery_zone_id,
+		}).Decode(&zone); err != nil {
+			return nil, errors.New("delivery zone was not found")
+		}
+		if len(zone.Postal_codes) > 0 &&
+			postalCodeIn(*order.Delivery_address, zone.Postal_codes) == "" {
+			return nil, errors.New("the delivery address is not in the " +
+				"delivery zone")
+		}
+		return &zone, nil
+	}
+
+	result, err := deliveryZoneCollection.Find(ctx, bson.M{
+		"postal_codes.0": bson.M{"$exists": true},
+	})
+	if err != nil {
+		return nil, errors.New("couldn't look up the delivery zones")
+	}
+	var zones []models.DeliveryZone
+	if err := result.All(ctx, &zones); err != nil {
+		return nil, errors.New("couldn't look up the delivery zones")
+	}
+	// the longest code found is the most specific
+	var found *models.DeliveryZone
+	longest := ""
+	for i := range zones {
+		code := postalCodeIn(*order.Delivery_address, zones[i].Postal_codes)
+		if len(code) > len(longest) {
+			found, longest = &zones[i], code
+		}
+	}
+	return found, nil
+}
+
+// postalCodeIn is the longest of codes that is in address on its own
+// rather than as part of a longer word or number, or "" when none is.
+// Codes are normalized as normalizePostalCodes leaves them.
+func postalCodeIn(address string, codes []string) string {
+	address = strings.ToUpper(address)
+	found := ""
+	for _, code := range codes {
+		if len(code) <= len(found) {
+			continue
+		}
+		for from := 0; from < len(address); {
+			at := strings.Index(address[from:], code)
+			if at < 0 {
+				break
+			}
+			at += from
+			end := at + len(code)
+			if (at == 0 || !isAlphanumeric(address[at-1])) &&
+				(end == len(address) || !isAlphanumeric(address[end])) {
+				found = code
+				break
+			}
+			from = at + 1
+		}
+	}
+	return found
+}
+
+// isAlphanumeric is whether c is a digit or an upper case letter.
+func isAlphanumeric(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'A' && c <= 'Z'
+}
+
+// orderType is the order's type, dine-in for orders from before there
+// were types.
+func orderType(order models.Order) string {
+	if order.Order_type == "" {
+		return models.OrderDineIn
+	}
+	return order.Order_type
+}
+
+// orderTypeFilter matches the orders of a type, counting orders without one
+// as dine-in.
+func orderTypeFilter(orderType string) interface{} {
+	if orderType == models.OrderDineIn {
+		return bson.M{"$in": bson.A{models.OrderDineIn, nil}}
+	}
+	return orderType
+}
+
+func normalizePostalCodes(codes []string) []string {
+	normalized := []string{}
+	for _, code := range codes {
+		if code = strings.ToUpper(strings.TrimSpace(code)); code != "" {
+			normalized = append(normalized, code)
+		}
+	}
+	return uniqueStrings(normalized)
+}
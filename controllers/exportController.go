@@ -0,0 +1,353 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"restro/export"
+	"restro/models"
+	"restro/reports"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// exportDataset is a collection that can be exported. filters maps the
+// query parameters that narrow it to the fields they match; dateField is
+// what the report period applies to. stages run after filtering, to join or
+// compute columns.
+type exportDataset struct {
+	collection *mongo.Collection
+	columns    []string
+	filters    map[string]string
+	dateField  string
+	match      bson.M
+	stages     func() bson.A
+}
+
+var exportDatasets = map[string]exportDataset{
+	"orders": {
+		collection: orderCollection,
+		columns: []string{"order_id", "order_date", "order_type", "table_id",
+			"guests", "customer_name", "customer_phone", "delivery_address",
+			"promised_at", "scheduled_for", "delivery_zone_id", "delivery_fee",
+			"platform", "external_order_id", "customer_id", "created_by",
+			"created_at", "updated_at"},
+		filters: map[string]string{"table_id": "table_id",
+			"created_by": "created_by", "order_type": "order_type",
+			"platform": "platform", "customer_id": "customer_id"},
+		dateField: "created_at",
+	},
+	"orderItems": {
+		collection: orderItemCollection,
+		columns: []string{"order_item_id", "order_id", "food_id", "quantity",
+			"unit_price", "status", "modifiers", "bundle_id", "created_at",
+			"fired_at", "served_at", "voided_at"},
+		filters: map[string]string{"order_id": "order_id", "food_id": "food_id",
+			"status": "status"},
+		dateField: "created_at",
+	},
+	"invoices": {
+		collection: invoiceCollection,
+		columns: []string{"invoice_id", "order_id", "payment_method",
+			"payment_status", "payment_due_date", "delivery_fee", "amount",
+			"customer_id", "created_at", "updated_at"},
+		filters: map[string]string{"order_id": "order_id",
+			"payment_method": "payment_method", "payment_status": "payment_status",
+			"customer_id": "customer_id"},
+		dateField: "created_at",
+		stages:    invoiceAmountStages,
+	},
+	// Payments are the invoices that have been paid, dated when they were.
+	"payments": {
+		collection: paymentCollection,
+		columns: []string{"payment_id", "invoice_id", "order_id", "kind",
+			"method", "amount", "tip", "refund_of", "created_by", "created_at"},
+		filters: map[string]string{"invoice_id": "invoice_id",
+			"method": "method", "kind": "kind"},
+		dateField: "created_at",
+	},
+}
+
+// invoiceAmountStages adds what each invoice's order comes to, the same way
+// billing.Amount works it out: its items that aren't voided and any
+// delivery fee. gift_cards is
+// the part of it that sold gift cards.
+func invoiceAmountStages() bson.A {
+	return bson.A{
+		bson.M{"$lookup": bson.M{
+			"from": orderItemCollection.Name(),
+			"let":  bson.M{"order_id": "$order_id"},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{
+					"$expr":  bson.M{"$eq": bson.A{"$order_id", "$$order_id"}},
+					"status": bson.M{"$ne": models.OrderItemVoid},
+				}},
+				bson.M{"$lookup": bson.M{
+					"from":         foodCollection.Name(),
+					"localField":   "food_id",
+					"foreignField": "food_id",
+					"as":           "food",
+				}},
+				bson.M{"$group": bson.M{"_id": nil, "amount": bson.M{"$sum": bson.M{
+					"$ifNull": bson.A{"$unit_price",
+						bson.M{"$arrayElemAt": bson.A{"$food.price", 0}}, 0},
+				}}, "gift_cards": bson.M{"$sum": bson.M{"$cond": bson.A{
+					bson.M{"$gt": bson.A{"$gift_card_code", nil}},
+					"$unit_price", 0,
+				}}}}},
+			},
+			"as": "totals",
+		}},
+		bson.M{"$lookup": bson.M{
+			"from":         orderCollection.Name(),
+			"localField":   "order_id",
+			"foreignField": "order_id",
+			"as":           "order",
+		}},
+		bson.M{"$addFields": bson.M{
+			"delivery_fee": bson.M{"$ifNull": bson.A{
+				bson.M{"$first": "$order.delivery_fee"}, 0}},
+			"gift_cards": bson.M{"$ifNull": bson.A{
+				bson.M{"$arrayElemAt": bson.A{"$totals.gift_cards", 0}}, 0}},
+		}},
+		bson.M{"$addFields": bson.M{"amount": bson.M{"$round": bson.A{
+			bson.M{"$add": bson.A{
+				bson.M{"$ifNull": bson.A{
+					bson.M{"$arrayElemAt": bson.A{"$totals.amount", 0}}, 0}},
+				"$delivery_fee",
+			}},
+			2,
+		}}}},
+	}
+}
+
+// ExportDataset streams orders, order items, invoices or payments in the
+// report period as CSV or XLSX. Rows go out as they come off the cursor.
+func ExportDataset() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		name := c.Param("dataset")
+		dataset, ok := exportDatasets[name]
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "unknown export " + name})
+			return
+		}
+		format, columns, ok := exportOptions(c, dataset.columns)
+		if !ok {
+			return
+		}
+		q, ok := reportQuery(c)
+		if !ok {
+			return
+		}
+
+		filter := bson.M{dataset.dateField: bson.M{"$gte": q.From, "$lt": q.To}}
+		for field, value := range dataset.match {
+			filter[field] = value
+		}
+		for param, field := range dataset.filters {
+			if value := c.Query(param); value != "" {
+				filter[field] = value
+			}
+		}
+		pipeline := bson.A{
+			bson.M{"$match": filter},
+			bson.M{"$sort": bson.M{dataset.dateField: 1}},
+		}
+		if dataset.stages != nil {
+			pipeline = append(pipeline, dataset.stages()...)
+		}
+		cursor, err := dataset.collection.Aggregate(ctx, pipeline)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while exporting " + name})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		w, ok := startExport(c, format, name, columns)
+		if !ok {
+			return
+		}
+		for cursor.Next(ctx) {
+			var doc bson.M
+			if err := cursor.Decode(&doc); err != nil {
+				log.Println("export of", name, "failed:", err)
+				return
+			}
+			if err := w.Write(export.Row(doc, columns)); err != nil {
+				log.Println("export of", name, "failed:", err)
+				return
+			}
+		}
+		if err := cursor.Err(); err != nil {
+			// The status is already sent; leaving the file unfinished is the
+			// only way left to show the export is incomplete.
+			log.Println("export of", name, "failed:", err)
+			return
+		}
+		if err := w.Close(); err != nil {
+			log.Println("export of", name, "failed:", err)
+		}
+	}
+}
+
+// ExportRevenueReport exports a /reports/revenue breakdown.
+func ExportRevenueReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		by := reports.Dimension(c.Param("dimension"))
+		if !by.Valid() {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": errUnknownDimension().Error()})
+			return
+		}
+		format, columns, ok := exportOptions(c, []string{"key", "label",
+			"revenue", "orders", "items", "average_ticket"})
+		if !ok {
+			return
+		}
+		q, ok := reportQuery(c)
+		if !ok {
+			return
+		}
+		rows, err := reportRepository.Revenue(ctx, q, by)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while building the report"})
+			return
+		}
+		writeExport(c, format, "revenue-by-"+string(by), columns, rows)
+	}
+}
+
+// ExportSalesSummary exports /reports/summary as a single row.
+func ExportSalesSummary() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		format, columns, ok := exportOptions(c, []string{"from", "to",
+			"time_zone", "revenue", "orders", "items", "average_ticket",
+			"covers", "orders_without_guests", "revenue_per_cover",
+			"open_hours", "seats", "seat_hours", "revenue_per_seat_hour"})
+		if !ok {
+			return
+		}
+		q, ok := reportQuery(c)
+		if !ok {
+			return
+		}
+		summary, err := salesSummary(ctx, q)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while building the report"})
+			return
+		}
+		writeExport(c, format, "sales-summary", columns,
+			[]reports.Summary{summary})
+	}
+}
+
+// ExportMenuEngineering exports /reports/menuEngineering.
+func ExportMenuEngineering() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		format, columns, ok := exportOptions(c, []string{"food_id", "name",
+			"menu_id", "price", "sold", "popularity", "revenue", "food_cost",
+			"margin", "unit_margin", "costed", "class"})
+		if !ok {
+			return
+		}
+		q, ok := reportQuery(c)
+		if !ok {
+			return
+		}
+		items, err := menuEngineeringReport(ctx, q, c.Query("menu_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while building the report"})
+			return
+		}
+		writeExport(c, format, "menu-engineering", columns, items)
+	}
+}
+
+// exportOptions reads the format and columns parameters, writing the error
+// response when they are invalid.
+func exportOptions(c *gin.Context, available []string) (export.Format, []string, bool) {
+	format, err := export.ParseFormat(c.Query("format"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", nil, false
+	}
+	columns, err := export.SelectColumns(available, c.Query("columns"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", nil, false
+	}
+	return format, columns, true
+}
+
+// startExport sends the download headers and the header row.
+func startExport(c *gin.Context, format export.Format, name string,
+	columns []string) (export.Writer, bool) {
+	filename := fmt.Sprintf("%s-%s%s", name, time.Now().Format("20060102"),
+		format.Extension())
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	w, err := export.NewWriter(format, c.Writer, name)
+	if err == nil {
+		header := make([]interface{}, len(columns))
+		for i, column := range columns {
+			header[i] = column
+		}
+		err = w.Write(header)
+	}
+	if err != nil {
+		log.Println("export of", name, "failed:", err)
+		return nil, false
+	}
+	return w, true
+}
+
+// writeExport exports report rows, already in memory, by their JSON fields.
+func writeExport(c *gin.Context, format export.Format, name string,
+	columns []string, rows interface{}) {
+	encoded, err := json.Marshal(rows)
+	var docs []map[string]interface{}
+	if err == nil {
+		err = json.Unmarshal(encoded, &docs)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError,
+			gin.H{"error": "error occured while exporting " + name})
+		return
+	}
+	w, ok := startExport(c, format, name, columns)
+	if !ok {
+		return
+	}
+	for _, doc := range docs {
+		if err := w.Write(export.Row(doc, columns)); err != nil {
+			log.Println("export of", name, "failed:", err)
+			return
+		}
+	}
+	if err := w.Close(); err != nil {
+		log.Println("export of", name, "failed:", err)
+	}
+}
@@ -0,0 +1,620 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"restro/database"
+	"restro/floor"
+	"restro/models"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var areaCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "area")
+
+// tableLayout places a table on the floor plan.
+type tableLayout struct {
+	Area_ID  *string  `json:"area_id"`
+	Shape    *string  `json:"shape" validate:"omitempty,eq=ROUND|eq=SQUARE|eq=RECTANGLE"`
+	X        *float64 `json:"x" validate:"omitempty,gte=0"`
+	Y        *float64 `json:"y" validate:"omitempty,gte=0"`
+	Width    *float64 `json:"width" validate:"omitempty,gt=0"`
+	Height   *float64 `json:"height" validate:"omitempty,gt=0"`
+	Rotation *float64 `json:"rotation" validate:"omitempty,gte=0,lt=360"`
+}
+
+// openTableOrder is an open order on a table with what its status depends
+// on.
+type openTableOrder struct {
+	Order_id   string    `bson:"order_id"`
+	Table_id   string    `bson:"table_id"`
+	Server_id  *string   `bson:"server_id"`
+	Guests     *int      `bson:"guests"`
+	Created_at time.Time `bson:"created_at"`
+	Items      int       `bson:"items"`
+	Invoices   int       `bson:"invoices"`
+}
+
+// floorTable is a table as the host stand draws it.
+type floorTable struct {
+	Table_id     string     `json:"table_id"`
+	Table_number *int       `json:"table_number"`
+	Seats        *int       `json:"seats"`
+	Area_id      *string    `json:"area_id"`
+	Shape        *string    `json:"shape"`
+	X            *float64   `json:"x"`
+	Y            *float64   `json:"y"`
+	Width        *float64   `json:"width"`
+	Height       *float64   `json:"height"`
+	Rotation     *float64   `json:"rotation"`
+	Status       string     `json:"status"`
+	Status_since *time.Time `json:"status_since"`
+	Group_id     *string    `json:"group_id"`
+	Server_id    *string    `json:"server_id"`
+	Guests       int        `json:"guests"`
+	Seated_at    *time.Time `json:"seated_at"`
+	Order_ids    []string   `json:"order_ids"`
+}
+
+func GetAreas() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		allAreas, err := loadAreas(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the areas"})
+			return
+		}
+		c.JSON(http.StatusOK, allAreas)
+	}
+}
+
+func CreateArea() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var area models.Area
+
+		if err := c.BindJSON(&area); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(area); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		area.Created_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		area.Updated_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		area.ID = primitive.NewObjectID()
+		area.Area_ID = area.ID.Hex()
+
+		if _, err := areaCollection.InsertOne(ctx, area); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "area was not created"})
+			return
+		}
+		c.JSON(http.StatusOK, area)
+	}
+}
+
+func UpdateArea() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var update models.Area
+		areaID := c.Param("area_id")
+
+		if err := c.BindJSON(&update); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var area models.Area
+		if err := areaCollection.FindOne(ctx,
+			bson.M{"area_id": areaID}).Decode(&area); err != nil {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any area with given ID"})
+			return
+		}
+		if update.Name != nil {
+			area.Name = update.Name
+		}
+		if update.Width != nil {
+			area.Width = update.Width
+		}
+		if update.Height != nil {
+			area.Height = update.Height
+		}
+		if update.Sort_order != 0 {
+			area.Sort_order = update.Sort_order
+		}
+		if validationErr := validate.Struct(area); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		area.Updated_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+
+		if _, err := areaCollection.ReplaceOne(ctx,
+			bson.M{"area_id": areaID}, area); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "area update failed"})
+			return
+		}
+		c.JSON(http.StatusOK, area)
+	}
+}
+
+// DeleteArea removes an area that no table is placed in any more.
+func DeleteArea() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		areaID := c.Param("area_id")
+		count, err := tableCollection.CountDocuments(ctx,
+			bson.M{"area_id": areaID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "area was not deleted"})
+			return
+		}
+		if count > 0 {
+			c.JSON(http.StatusConflict,
+				gin.H{"error": "tables are still placed in the area"})
+			return
+		}
+		result, err := areaCollection.DeleteOne(ctx, bson.M{"area_id": areaID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "area was not deleted"})
+			return
+		}
+		if result.DeletedCount == 0 {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any area with given ID"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"deleted": areaID})
+	}
+}
+
+// UpdateTableLayout moves a table on the floor plan or changes its shape.
+func UpdateTableLayout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var layout tableLayout
+		tableID := c.Param("table_id")
+
+		if err := c.BindJSON(&layout); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(layout); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		if layout.Area_ID != nil {
+			count, err := areaCollection.CountDocuments(ctx,
+				bson.M{"area_id": *layout.Area_ID})
+			if err != nil || count == 0 {
+				c.JSON(http.StatusBadRequest,
+					gin.H{"error": "area was not found"})
+				return
+			}
+		}
+		set := bson.M{}
+		if layout.Area_ID != nil {
+			set["area_id"] = *layout.Area_ID
+		}
+		if layout.Shape != nil {
+			set["shape"] = *layout.Shape
+		}
+		if layout.X != nil {
+			set["x"] = *layout.X
+		}
+		if layout.Y != nil {
+			set["y"] = *layout.Y
+		}
+		if layout.Width != nil {
+			set["width"] = *layout.Width
+		}
+		if layout.Height != nil {
+			set["height"] = *layout.Height
+		}
+		if layout.Rotation != nil {
+			set["rotation"] = *layout.Rotation
+		}
+		set["updated_at"], _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+
+		var table models.Table
+		err := tableCollection.FindOneAndUpdate(ctx,
+			bson.M{"table_id": tableID}, bson.M{"$set": set},
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).
+			Decode(&table)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any table with given ID"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "table layout update failed"})
+			return
+		}
+		c.JSON(http.StatusOK, table)
+	}
+}
+
+// SetTableStatus lets staff seat guests at a table before they order, mark
+// it dirty and free it once cleared. The status of a table with open orders
+// follows the orders, and the tables of a group change together.
+func SetTableStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var body struct {
+			Status string `json:"status"`
+		}
+		tableID := c.Param("table_id")
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var table models.Table
+		if err := tableCollection.FindOne(ctx,
+			bson.M{"table_id": tableID}).Decode(&table); err != nil {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any table with given ID"})
+			return
+		}
+		// a grouped table's orders are on the group's primary table
+		ordersOn := tableID
+		var group models.TableGroup
+		if table.Group_ID != nil {
+			if err := tableGroupCollection.FindOne(ctx,
+				bson.M{"group_id": *table.Group_ID}).Decode(&group); err == nil {
+				ordersOn = group.Primary_table_id
+			}
+		}
+		open, err := tableOpenOrders(ctx, []string{ordersOn})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while reading the orders"})
+			return
+		}
+		if err := floor.CheckManual(body.Status,
+			floorOrders(open[ordersOn])); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, floor.ErrTableInUse) {
+				status = http.StatusConflict
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		if table.Group_ID != nil {
+			err = saveGroupStatus(ctx, *table.Group_ID, body.Status)
+			table.Status = body.Status
+		} else {
+			table, err = saveTableStatus(ctx, tableID, body.Status)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "table status update failed"})
+			return
+		}
+		c.JSON(http.StatusOK, table)
+	}
+}
+
+// GetFloorPlan is the host stand view: each area with its tables, where
+// they sit and their live status, the tables not placed yet and the table
+// groups pushed together.
+func GetFloorPlan() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		areas, err := loadAreas(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the areas"})
+			return
+		}
+		tables, groups, err := liveFloor(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while reading the floor"})
+			return
+		}
+
+		byArea := map[string][]floorTable{}
+		unplaced := []floorTable{}
+		for _, view := range tables {
+			if view.Area_id == nil {
+				unplaced = append(unplaced, view)
+				continue
+			}
+			byArea[*view.Area_id] = append(byArea[*view.Area_id], view)
+		}
+		counts := map[string]int{}
+		plan := []gin.H{}
+		for _, area := range areas {
+			areaTables := byArea[area.Area_ID]
+			sortFloorTables(areaTables)
+			for _, table := range areaTables {
+				counts[table.Status]++
+			}
+			if areaTables == nil {
+				areaTables = []floorTable{}
+			}
+			plan = append(plan, gin.H{
+				"area_id":    area.Area_ID,
+				"name":       area.Name,
+				"width":      area.Width,
+				"height":     area.Height,
+				"sort_order": area.Sort_order,
+				"tables":     areaTables,
+			})
+		}
+		sortFloorTables(unplaced)
+		for _, table := range unplaced {
+			counts[table.Status]++
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"areas":    plan,
+			"unplaced": unplaced,
+			"groups":   groups,
+			"counts":   counts,
+		})
+	}
+}
+
+func newFloorTable(table models.Table, open []openTableOrder) floorTable {
+	view := floorTable{
+		Table_id:     table.Table_ID,
+		Table_number: table.Table_Number,
+		Seats:        table.Number_of_guests,
+		Area_id:      table.Area_ID,
+		Shape:        table.Shape,
+		X:            table.X,
+		Y:            table.Y,
+		Width:        table.Width,
+		Height:       table.Height,
+		Rotation:     table.Rotation,
+		Status:       floor.Status(table.Status, floorOrders(open)),
+		Status_since: table.Status_updated_at,
+		Group_id:     table.Group_ID,
+		Order_ids:    []string{},
+	}
+	for _, order := range open {
+		view.Order_ids = append(view.Order_ids, order.Order_id)
+		if order.Guests != nil {
+			view.Guests += *order.Guests
+		}
+		if view.Seated_at == nil || order.Created_at.Before(*view.Seated_at) {
+			seated := order.Created_at
+			view.Seated_at = &seated
+			view.Server_id = order.Server_id
+		}
+	}
+	return view
+}
+
+// liveFloor loads every table with its live status, and the active table
+// groups. The tables of a group all show the state of its primary table,
+// which carries the group's orders.
+func liveFloor(ctx context.Context) ([]floorTable, []models.TableGroup, error) {
+	result, err := tableCollection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, nil, err
+	}
+	var tables []models.Table
+	if err = result.All(ctx, &tables); err != nil {
+		return nil, nil, err
+	}
+	tableIDs := make([]string, 0, len(tables))
+	for _, table := range tables {
+		tableIDs = append(tableIDs, table.Table_ID)
+	}
+	open, err := tableOpenOrders(ctx, tableIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	groups, err := activeTableGroups(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	views := make([]floorTable, 0, len(tables))
+	byID := map[string]int{}
+	for _, table := range tables {
+		byID[table.Table_ID] = len(views)
+		views = append(views, newFloorTable(table, open[table.Table_ID]))
+	}
+	for _, group := range groups {
+		i, ok := byID[group.Primary_table_id]
+		if !ok {
+			continue
+		}
+		primary := views[i]
+		for _, tableID := range group.Table_ids {
+			j, ok := byID[tableID]
+			if !ok || j == i {
+				continue
+			}
+			view := &views[j]
+			view.Status = primary.Status
+			view.Server_id = primary.Server_id
+			view.Guests = primary.Guests
+			view.Seated_at = primary.Seated_at
+			view.Order_ids = primary.Order_ids
+		}
+	}
+	return views, groups, nil
+}
+
+func sortFloorTables(tables []floorTable) {
+	sort.Slice(tables, func(i, j int) bool {
+		a, b := tables[i].Table_number, tables[j].Table_number
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return *a < *b
+	})
+}
+
+func loadAreas(ctx context.Context) ([]models.Area, error) {
+	result, err := areaCollection.Find(ctx, bson.M{},
+		options.Find().SetSort(bson.D{{Key: "sort_order", Value: 1},
+			{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	areas := []models.Area{}
+	err = result.All(ctx, &areas)
+	return areas, err
+}
+
+// tableOpenOrders loads the open orders on the tables by table ID, with
+// how many items are still ordered on each and whether it is invoiced.
+func tableOpenOrders(ctx context.Context, tableIDs []string) (map[string][]openTableOrder, error) {
+	cursor, err := orderCollection.Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{
+			"table_id":  bson.M{"$in": tableIDs},
+			"closed_at": nil,
+		}},
+		bson.M{"$lookup": bson.M{
+			"from": orderItemCollection.Name(),
+			"let":  bson.M{"order_id": "$order_id"},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{
+					"$expr":  bson.M{"$eq": bson.A{"$order_id", "$$order_id"}},
+					"status": bson.M{"$ne": models.OrderItemVoid},
+				}},
+				bson.M{"$count": "items"},
+			},
+			"as": "items",
+		}},
+		bson.M{"$lookup": bson.M{
+			"from":         invoiceCollection.Name(),
+			"localField":   "order_id",
+			"foreignField": "order_id",
+			"as":           "invoices",
+		}},
+		bson.M{"$project": bson.M{
+			"order_id":   1,
+			"table_id":   1,
+			"server_id":  1,
+			"guests":     1,
+			"created_at": 1,
+			"items": bson.M{"$ifNull": bson.A{
+				bson.M{"$first": "$items.items"}, 0}},
+			"invoices": bson.M{"$size": "$invoices"},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var orders []openTableOrder
+	if err = cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+	open := map[string][]openTableOrder{}
+	for _, order := range orders {
+		open[order.Table_id] = append(open[order.Table_id], order)
+	}
+	return open, nil
+}
+
+func floorOrders(open []openTableOrder) []floor.OpenOrder {
+	orders := make([]floor.OpenOrder, 0, len(open))
+	for _, order := range open {
+		orders = append(orders, floor.OpenOrder{
+			Order_ID: order.Order_id,
+			Items:    order.Items,
+			Invoiced: order.Invoices > 0,
+		})
+	}
+	return orders
+}
+
+// refreshTableStatus brings the stored status of a table up to date with
+// its open orders, and that of the rest of its group when it is a group's
+// primary table. It is called as orders and invoices change; failures are
+// logged, as the floor plan works the status out again when drawn.
+func refreshTableStatus(ctx context.Context, tableID string) {
+	var table models.Table
+	if err := tableCollection.FindOne(ctx,
+		bson.M{"table_id": tableID}).Decode(&table); err != nil {
+		return
+	}
+	open, err := tableOpenOrders(ctx, []string{tableID})
+	if err != nil {
+		log.Println("couldn't refresh table", tableID, "status:", err)
+		return
+	}
+	status := floor.Status(table.Status, floorOrders(open[tableID]))
+	if status == table.Status {
+		return
+	}
+	if table.Group_ID != nil {
+		err = saveGroupStatus(ctx, *table.Group_ID, status)
+	} else {
+		_, err = saveTableStatus(ctx, tableID, status)
+	}
+	if err != nil {
+		log.Println("couldn't refresh table", tableID, "status:", err)
+	}
+}
+
+// refreshOrderTable refreshes the status of the table an order is on.
+func refreshOrderTable(ctx context.Context, orderID string) {
+	var order models.Order
+	if err := orderCollection.FindOne(ctx,
+		bson.M{"order_id": orderID}).Decode(&order); err != nil ||
+		order.Table_ID == nil {
+		return
+	}
+	refreshTableStatus(ctx, *order.Table_ID)
+}
+
+func saveTableStatus(ctx context.Context, tableID, status string) (models.Table, error) {
+	var table models.Table
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	err := tableCollection.FindOneAndUpdate(ctx, bson.M{"table_id": tableID},
+		bson.M{"$set": bson.M{"status": status, "status_updated_at": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).
+		Decode(&table)
+	return table, err
+}
+
+// saveGroupStatus sets the status of every table in a group.
+func saveGroupStatus(ctx context.Context, groupID, status string) error {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	_, err := tableCollection.UpdateMany(ctx, bson.M{"group_id": groupID},
+		bson.M{"$set": bson.M{"status": status, "status_updated_at": now}})
+	return err
+}
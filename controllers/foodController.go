@@ -2,6 +2,7 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
@@ -14,6 +15,7 @@ import (
 	"net/http"
 	"restro/database"
 	"restro/models"
+	"restro/search"
 	"strconv"
 	"time"
 )
@@ -44,12 +46,12 @@ func GetFoods() gin.HandlerFunc {
 				bson.D{{"_id", "null"}}},
 			{"total_count",
 				bson.D{{"$sum", 1}}},
-			{"$data", bson.D{{"$push",
-				"$ROOT"}},
+			{"data", bson.D{{"$push",
+				"$$ROOT"}},
 			}},
 		}}
 		projectStage := bson.D{{
-			"$project", bson.D{{"$id", 0},
+			"$project", bson.D{{"_id", 0},
 				{"total_count", 1},
 				{"food_items", bson.D{{"$slice",
 					[]interface{}{"$data", startIndex,
@@ -76,6 +78,16 @@ func GetFoods() gin.HandlerFunc {
 			log.Fatal(err)
 
 		}
+		if len(allFoods) == 0 {
+			c.JSON(http.StatusOK, gin.H{"total_count": 0,
+				"food_items": []bson.M{}})
+			return
+		}
+		locales := requestLocales(c)
+		if items, ok := allFoods[0]["food_items"].(bson.A); ok {
+			localizeDocuments(items, locales)
+		}
+		c.Header("Content-Language", locales[0])
 		c.JSON(http.StatusOK, allFoods[0])
 	}
 }
@@ -92,12 +104,20 @@ func GetFood() gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError,
 				gin.H{"error": "Error occured while fetching the food " +
 					"item"})
+			return
 		}
+		localizeFood(&food, requestLocales(c))
+		c.Header("Content-Language", food.Locale)
 		c.JSON(http.StatusOK, food)
 
 	}
 }
 
+// errFoodImage is returned for a food_image sent by the client: it is
+// derived from the uploaded image given by image_asset_id.
+var errFoodImage = errors.New("food_image can't be set, upload the image " +
+	"and send its image_asset_id")
+
 func CreateFood() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(),
@@ -125,6 +145,22 @@ func CreateFood() gin.HandlerFunc {
 			return
 		}
 
+		if food.Food_image != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errFoodImage.Error()})
+			return
+		}
+		if food.Image_asset_id != nil {
+			count, err := assetCollection.CountDocuments(ctx,
+				bson.M{"asset_id": food.Image_asset_id})
+			if err != nil || count == 0 {
+				msg := fmt.Sprintf("image was not found")
+				c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+				return
+			}
+			var url = imageURL(*food.Image_asset_id, "medium")
+			food.Food_image = &url
+		}
+
 		food.Created_at, _ = time.Parse(time.RFC3339,
 			time.Now().Format(time.RFC3339))
 		food.Updated_at, _ = time.Parse(time.RFC3339,
@@ -133,6 +169,13 @@ func CreateFood() gin.HandlerFunc {
 		food.Food_ID = food.ID.Hex()
 		var num = toFixed(*food.Price, 2)
 		food.Price = &num
+		food.Tags = normalizeTags(food.Tags)
+		food.Search_terms = search.Terms(*food.Name,
+			derefString(food.Description), food.Tags)
+		food.Auto_sold_out = false
+		food.Stock_override = nil
+		// a food has no plate cost until a recipe gives it one
+		food.Plate_costs = nil
 
 		result, err := foodCollection.InsertOne(ctx, food)
 
@@ -141,12 +184,45 @@ func CreateFood() gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 			return
 		}
+		_, err = recordFoodPrice(ctx, food.Food_ID, *food.Price,
+			food.Created_at, true, c.GetString("uid"))
+		if err != nil {
+			msg := fmt.Sprintf("price history was not created")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
 		defer cancel()
 
 		c.JSON(http.StatusOK, result)
 	}
 }
 
+// foodAvailable reports whether the food exists and is on sale.
+func foodAvailable(ctx context.Context, foodID string) (bool, error) {
+	var food models.Food
+	err := foodCollection.FindOne(ctx,
+		bson.M{"food_id": foodID}).Decode(&food)
+	if err != nil {
+		return false, err
+	}
+	return food.Available == nil || *food.Available, nil
+}
+
+// normalizeTags stores dietary tags in the form the search endpoint filters
+// on, dropping blanks and duplicates.
+func normalizeTags(tags []string) []string {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = search.NormalizeTag(tag)
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
 func round(num float64) int {
 	return int(num + math.Copysign(0.5, num))
 }
@@ -169,6 +245,10 @@ func UpdateFood() gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if food.Food_image != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errFoodImage.Error()})
+			return
+		}
 		var updateObj primitive.D
 
 		if food.Name != nil {
@@ -176,12 +256,87 @@ func UpdateFood() gin.HandlerFunc {
 		}
 
 		if food.Price != nil {
-			updateObj = append(updateObj, bson.E{"price", food.Price})
+			var num = toFixed(*food.Price, 2)
+			updateObj = append(updateObj, bson.E{"price", num})
 		}
 
-		if food.Food_image != nil {
+		if food.Description != nil {
+			updateObj = append(updateObj, bson.E{"description",
+				food.Description})
+		}
+
+		if food.Tags != nil {
+			food.Tags = normalizeTags(food.Tags)
+			updateObj = append(updateObj, bson.E{"tags", food.Tags})
+		}
+
+		if food.Name != nil || food.Description != nil || food.Tags != nil {
+			// the words search matches are those of the food as updated
+			var current models.Food
+			err := foodCollection.FindOne(ctx,
+				bson.M{"food_id": foodID}).Decode(&current)
+			if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusInternalServerError,
+					gin.H{"error": "Could'nt update the food item"})
+				return
+			}
+			if food.Name == nil {
+				food.Name = current.Name
+			}
+			if food.Description == nil {
+				food.Description = current.Description
+			}
+			if food.Tags == nil {
+				food.Tags = current.Tags
+			}
+			updateObj = append(updateObj, bson.E{Key: "search_terms",
+				Value: search.Terms(derefString(food.Name),
+					derefString(food.Description), food.Tags)})
+		}
+
+		if food.Prep_minutes != nil {
+			if *food.Prep_minutes < 0 {
+				c.JSON(http.StatusBadRequest,
+					gin.H{"error": "prep_minutes can't be negative"})
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "prep_minutes",
+				Value: food.Prep_minutes})
+		}
+
+		if food.Available != nil {
+			// Taking a food off or back on sale by hand overrides the
+			// stock evaluator until the stock changes whether its recipe
+			// can be made.
+			makeable, managed, err := stockEvaluator.Makeable(ctx, foodID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError,
+					gin.H{"error": "Could'nt update the food item"})
+				return
+			}
+			var override *bool
+			if managed {
+				override = &makeable
+			}
+			updateObj = append(updateObj, bson.E{"available",
+				food.Available})
+			updateObj = append(updateObj, bson.E{"auto_sold_out", false})
+			updateObj = append(updateObj, bson.E{Key: "stock_override",
+				Value: override})
+		}
+
+		if food.Image_asset_id != nil {
+			count, err := assetCollection.CountDocuments(ctx,
+				bson.M{"asset_id": food.Image_asset_id})
+			if err != nil || count == 0 {
+				msg := fmt.Sprintf("image was not found")
+				c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+				return
+			}
+			updateObj = append(updateObj, bson.E{"image_asset_id",
+				food.Image_asset_id})
 			updateObj = append(updateObj, bson.E{"food_image",
-				food.Food_image})
+				imageURL(*food.Image_asset_id, "medium")})
 		}
 
 		if food.Menu_ID != nil {
@@ -195,8 +350,8 @@ func UpdateFood() gin.HandlerFunc {
 					gin.H{"error": msg})
 				return
 			}
-			updateObj = append(updateObj, bson.E{"menu",
-				food.Price})
+			updateObj = append(updateObj, bson.E{Key: "menu_id",
+				Value: food.Menu_ID})
 		}
 
 		food.Updated_at, _ = time.Parse(time.RFC3339,
@@ -219,6 +374,17 @@ func UpdateFood() gin.HandlerFunc {
 				gin.H{"error": msg})
 			return
 		}
+		if food.Price != nil {
+			// recorded once the food has the price, as the version in force
+			_, err := recordFoodPrice(ctx, foodID, *food.Price,
+				time.Now(), true, c.GetString("uid"))
+			if err != nil {
+				msg := fmt.Sprintf("Couldn't record the price change")
+				c.JSON(http.StatusInternalServerError,
+					gin.H{"error": msg})
+				return
+			}
+		}
 		c.JSON(http.StatusOK, &result)
 		defer cancel()
 	}
@@ -0,0 +1,291 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"restro/inventory"
+	"restro/models"
+	"restro/reports"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Menu engineering classes, by popularity and margin.
+const (
+	menuClassStar      = "STAR"
+	menuClassPlowhorse = "PLOWHORSE"
+	menuClassPuzzle    = "PUZZLE"
+	menuClassDog       = "DOG"
+)
+
+type foodCost struct {
+	Food_ID     string             `json:"food_id"`
+	Name        *string            `json:"name"`
+	Menu_ID     *string            `json:"menu_id"`
+	Price       *float64           `json:"price"`
+	Plate_costs []models.PlateCost `json:"plate_costs"`
+}
+
+type menuEngineeringItem struct {
+	Food_ID     string   `json:"food_id"`
+	Name        *string  `json:"name"`
+	Menu_ID     *string  `json:"menu_id"`
+	Price       *float64 `json:"price"`
+	Sold        int      `json:"sold"`
+	Popularity  float64  `json:"popularity"`
+	Revenue     float64  `json:"revenue"`
+	Food_cost   float64  `json:"food_cost"`
+	Margin      float64  `json:"margin"`
+	Unit_margin float64  `json:"unit_margin"`
+	Costed      bool     `json:"costed"`
+	Class       string   `json:"class"`
+}
+
+// refreshPlateCosts reprices every food from the current recipes and
+// ingredient costs. It is called after anything that changes either.
+func refreshPlateCosts(ctx context.Context) {
+	plates, err := inventoryService.PlateCosts(ctx)
+	if err != nil {
+		log.Println("couldn't work out plate costs:", err)
+		return
+	}
+	result, err := foodCollection.Find(ctx, bson.M{})
+	if err != nil {
+		log.Println("couldn't list foods for plate costs:", err)
+		return
+	}
+	var foods []models.Food
+	if err = result.All(ctx, &foods); err != nil {
+		log.Println("couldn't list foods for plate costs:", err)
+		return
+	}
+	writes := []mongo.WriteModel{}
+	for _, food := range foods {
+		var update bson.M
+		if costs, ok := plates[food.Food_ID]; ok {
+			update = bson.M{"$set": bson.M{"plate_costs": costs}}
+		} else if food.Plate_costs != nil {
+			update = bson.M{"$unset": bson.M{"plate_costs": ""}}
+		} else {
+			continue
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"food_id": food.Food_ID}).SetUpdate(update))
+	}
+	if len(writes) == 0 {
+		return
+	}
+	if _, err := foodCollection.BulkWrite(ctx, writes); err != nil {
+		log.Println("couldn't save plate costs:", err)
+	}
+}
+
+// withMargins fills in the margins of a food's plate costs at its price.
+func withMargins(food models.Food) foodCost {
+	cost := foodCost{
+		Food_ID:     food.Food_ID,
+		Name:        food.Name,
+		Menu_ID:     food.Menu_ID,
+		Price:       food.Price,
+		Plate_costs: []models.PlateCost{},
+	}
+	for _, plate := range food.Plate_costs {
+		if food.Price != nil {
+			plate.Margin = toFixed(*food.Price-plate.Cost, 2)
+			if *food.Price > 0 {
+				plate.Margin_percent = toFixed(plate.Margin / *food.Price * 100, 2)
+			}
+		}
+		cost.Plate_costs = append(cost.Plate_costs, plate)
+	}
+	return cost
+}
+
+// GetFoodCosts lists the plate cost and margin of every food and size,
+// optionally for one menu.
+func GetFoodCosts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		filter := bson.M{}
+		if menuID := c.Query("menu_id"); menuID != "" {
+			filter["menu_id"] = menuID
+		}
+		result, err := foodCollection.Find(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing food items"})
+			return
+		}
+		var foods []models.Food
+		if err = result.All(ctx, &foods); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing food items"})
+			return
+		}
+		costs := make([]foodCost, 0, len(foods))
+		for _, food := range foods {
+			costs = append(costs, withMargins(food))
+		}
+		c.JSON(http.StatusOK, costs)
+	}
+}
+
+func GetFoodCost() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var food models.Food
+		if err := foodCollection.FindOne(ctx,
+			bson.M{"food_id": c.Param("food_id")}).Decode(&food); err != nil {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any food with given ID"})
+			return
+		}
+		c.JSON(http.StatusOK, withMargins(food))
+	}
+}
+
+// GetMenuEngineering sorts foods into stars, plowhorses, puzzles and dogs
+// from what sold in the report period. An item is popular when it sold at
+// least 70% of an equal share of the portions, and profitable when its
+// margin per portion is at least the average across the menu. Margins use
+// the price each item was sold at.
+func GetMenuEngineering() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		q, ok := reportQuery(c)
+		if !ok {
+			return
+		}
+
+		items, err := menuEngineeringReport(ctx, q, c.Query("menu_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while building the report"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"from":      q.From,
+			"to":        q.To,
+			"time_zone": q.Location.String(),
+			"items":     items,
+		})
+	}
+}
+
+// menuEngineeringReport loads the foods, optionally of one menu, and what
+// sold in the period, and classifies them.
+func menuEngineeringReport(ctx context.Context, q reports.Query,
+	menuID string) ([]menuEngineeringItem, error) {
+	foodFilter := bson.M{}
+	if menuID != "" {
+		foodFilter["menu_id"] = menuID
+	}
+	result, err := foodCollection.Find(ctx, foodFilter)
+	if err != nil {
+		return nil, err
+	}
+	var foods []models.Food
+	if err = result.All(ctx, &foods); err != nil {
+		return nil, err
+	}
+
+	result, err = orderItemCollection.Find(ctx, bson.M{
+		"created_at": bson.M{"$gte": q.From, "$lt": q.To},
+		"status":     bson.M{"$ne": models.OrderItemVoid},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var orderItems []models.OrderItem
+	if err = result.All(ctx, &orderItems); err != nil {
+		return nil, err
+	}
+	return menuEngineering(foods, orderItems), nil
+}
+
+func menuEngineering(foods []models.Food,
+	orderItems []models.OrderItem) []menuEngineeringItem {
+	byFood := map[string]*menuEngineeringItem{}
+	plates := map[string][]models.PlateCost{}
+	items := make([]menuEngineeringItem, len(foods))
+	for i, food := range foods {
+		items[i] = menuEngineeringItem{
+			Food_ID: food.Food_ID,
+			Name:    food.Name,
+			Menu_ID: food.Menu_ID,
+			Price:   food.Price,
+			Costed:  len(food.Plate_costs) > 0,
+		}
+		byFood[food.Food_ID] = &items[i]
+		plates[food.Food_ID] = food.Plate_costs
+	}
+
+	var sold int
+	var margin float64
+	for _, orderItem := range orderItems {
+		item, ok := byFood[derefString(orderItem.Food_id)]
+		if !ok {
+			continue
+		}
+		price := 0.0
+		if orderItem.Unit_price != nil {
+			price = *orderItem.Unit_price
+		} else if item.Price != nil {
+			price = *item.Price
+		}
+		cost, _ := inventory.PlateCostFor(plates[item.Food_ID],
+			derefString(orderItem.Quantity))
+		item.Sold++
+		item.Revenue += price
+		item.Food_cost += cost
+		sold++
+		margin += price - cost
+	}
+	if sold == 0 || len(items) == 0 {
+		for i := range items {
+			items[i].Class = menuClassDog
+		}
+		return items
+	}
+
+	popular := 0.7 / float64(len(items))
+	averageMargin := margin / float64(sold)
+	for i := range items {
+		item := &items[i]
+		item.Margin = toFixed(item.Revenue-item.Food_cost, 2)
+		item.Popularity = toFixed(float64(item.Sold)/float64(sold)*100, 2)
+		if item.Sold > 0 {
+			item.Unit_margin = toFixed(item.Margin/float64(item.Sold), 2)
+		}
+		item.Revenue = toFixed(item.Revenue, 2)
+		item.Food_cost = toFixed(item.Food_cost, 2)
+
+		isPopular := float64(item.Sold)/float64(sold) >= popular
+		isProfitable := item.Sold > 0 && item.Margin/float64(item.Sold) >= averageMargin
+		switch {
+		case isPopular && isProfitable:
+			item.Class = menuClassStar
+		case isPopular:
+			item.Class = menuClassPlowhorse
+		case isProfitable:
+			item.Class = menuClassPuzzle
+		default:
+			item.Class = menuClassDog
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Margin > items[j].Margin
+	})
+	return items
+}
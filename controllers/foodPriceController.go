@@ -0,0 +1,213 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"restro/database"
+	"restro/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var foodPriceCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "foodPrice")
+
+func GetFoodPrices() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		opts := options.Find().SetSort(bson.D{{Key: "effective_from", Value: -1}})
+		result, err := foodPriceCollection.Find(ctx,
+			bson.M{"food_id": c.Param("food_id")}, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the price history"})
+			return
+		}
+		prices := []models.FoodPrice{}
+		if err = result.All(ctx, &prices); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the price history"})
+			return
+		}
+		c.JSON(http.StatusOK, prices)
+	}
+}
+
+// CreateFoodPrice schedules a price change. Without effective_from the new
+// price applies straight away.
+func CreateFoodPrice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var price models.FoodPrice
+		foodID := c.Param("food_id")
+
+		if err := c.BindJSON(&price); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(price); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		now := time.Now()
+		effective := now
+		if price.Effective_from != nil {
+			if price.Effective_from.Before(now.Add(-time.Minute)) {
+				c.JSON(http.StatusBadRequest,
+					gin.H{"error": "price changes can't be backdated"})
+				return
+			}
+			effective = *price.Effective_from
+		}
+
+		count, err := foodCollection.CountDocuments(ctx,
+			bson.M{"food_id": foodID})
+		if err != nil || count == 0 {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any food with given ID"})
+			return
+		}
+
+		created, err := recordFoodPrice(ctx, foodID, *price.Price, effective,
+			false, c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "price change was not saved"})
+			return
+		}
+		if !effective.After(now) {
+			if err := ApplyDuePrices(ctx); err != nil {
+				c.JSON(http.StatusInternalServerError,
+					gin.H{"error": "price change couldn't be applied"})
+				return
+			}
+			created.Applied = true
+		}
+		c.JSON(http.StatusOK, created)
+	}
+}
+
+// recordFoodPrice adds a version to the food's price history. Unless the
+// caller has already written the price onto the food, applied is false and
+// ApplyDuePrices moves it there once it is effective.
+func recordFoodPrice(ctx context.Context, foodID string, price float64,
+	effective time.Time, applied bool, createdBy string) (models.FoodPrice, error) {
+	var entry models.FoodPrice
+	price = toFixed(price, 2)
+	entry.Price = &price
+	entry.Food_ID = foodID
+	entry.Effective_from = &effective
+	entry.Applied = applied
+	entry.Created_by = createdBy
+	entry.Created_at, _ = time.Parse(time.RFC3339,
+		time.Now().Format(time.RFC3339))
+	entry.ID = primitive.NewObjectID()
+	entry.Price_ID = entry.ID.Hex()
+	_, err := foodPriceCollection.InsertOne(ctx, entry)
+	return entry, err
+}
+
+// FoodPriceAt returns the price of the food in force at the given moment,
+// falling back to the food's own price for foods created before price
+// history was kept.
+func FoodPriceAt(ctx context.Context, foodID string, at time.Time) (float64, error) {
+	var entry models.FoodPrice
+	opts := options.FindOne().SetSort(bson.D{{Key: "effective_from", Value: -1}})
+	err := foodPriceCollection.FindOne(ctx, bson.M{
+		"food_id":        foodID,
+		"effective_from": bson.M{"$lte": at},
+	}, opts).Decode(&entry)
+	if err == nil {
+		return *entry.Price, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, err
+	}
+
+	var food models.Food
+	if err := foodCollection.FindOne(ctx,
+		bson.M{"food_id": foodID}).Decode(&food); err != nil {
+		return 0, err
+	}
+	if food.Price == nil {
+		return 0, errors.New("food has no price")
+	}
+	return *food.Price, nil
+}
+
+// ApplyDuePrices copies every price version that has become effective onto
+// its food, oldest first, so listings and search show the current price.
+// A version already superseded by a later one is marked applied but leaves
+// the food's price alone.
+func ApplyDuePrices(ctx context.Context) error {
+	opts := options.Find().SetSort(bson.D{{Key: "effective_from", Value: 1}})
+	result, err := foodPriceCollection.Find(ctx, bson.M{
+		"applied":        false,
+		"effective_from": bson.M{"$lte": time.Now()},
+	}, opts)
+	if err != nil {
+		return err
+	}
+	var due []models.FoodPrice
+	if err = result.All(ctx, &due); err != nil {
+		return err
+	}
+
+	for _, entry := range due {
+		var current models.FoodPrice
+		err := foodPriceCollection.FindOne(ctx, bson.M{
+			"food_id":        entry.Food_ID,
+			"effective_from": bson.M{"$lte": time.Now()},
+		}, options.FindOne().SetSort(bson.D{
+			{Key: "effective_from", Value: -1}, {Key: "_id", Value: -1},
+		})).Decode(&current)
+		if err != nil {
+			return err
+		}
+		// a version that took effect after it, such as a price set by
+		// hand since it was scheduled, is in force instead
+		if current.Price_ID == entry.Price_ID {
+			updated_at, _ := time.Parse(time.RFC3339,
+				time.Now().Format(time.RFC3339))
+			_, err := foodCollection.UpdateOne(ctx,
+				bson.M{"food_id": entry.Food_ID},
+				bson.M{"$set": bson.M{"price": entry.Price, "updated_at": updated_at}})
+			if err != nil {
+				return err
+			}
+		}
+		_, err = foodPriceCollection.UpdateOne(ctx,
+			bson.M{"price_id": entry.Price_ID},
+			bson.M{"$set": bson.M{"applied": true}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunPriceScheduler applies scheduled price changes as they fall due. It
+// blocks, so start it in its own goroutine.
+func RunPriceScheduler(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		if err := ApplyDuePrices(ctx); err != nil {
+			log.Println("couldn't apply scheduled prices:", err)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,557 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"restro/database"
+	helper "restro/helpers"
+	"restro/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var giftCardCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "giftCard")
+var giftCardEntryCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "giftCardEntry")
+
+var (
+	errNoGiftCard        = errors.New("gift card was not found")
+	errGiftCardNotActive = errors.New("the gift card isn't active")
+	errGiftCardBalance   = errors.New("the gift card's balance is too low")
+	errGiftCardLoaded    = errors.New("the gift card has already been " +
+		"loaded, freeze it instead")
+)
+
+// giftCardSale is the body of a gift card sale. With a code it tops that
+// card up rather than selling a new one.
+type giftCardSale struct {
+	Value       *float64 `json:"value" validate:"required,gt=0,lte=10000"`
+	Code        string   `json:"code"`
+	Customer_id *string  `json:"customer_id"`
+	Note        string   `json:"note" validate:"max=500"`
+}
+
+// GetGiftCards lists gift cards, newest first, optionally by status,
+// customer or the order they were sold on.
+func GetGiftCards() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		filter := bson.M{}
+		for _, field := range []string{"status", "customer_id", "order_id"} {
+			if value := c.Query(field); value != "" {
+				filter[field] = value
+			}
+		}
+		result, err := giftCardCollection.Find(ctx, filter,
+			options.Find().SetSort(bson.M{"created_at": -1}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the gift cards"})
+			return
+		}
+		cards := []models.GiftCard{}
+		if err = result.All(ctx, &cards); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the gift cards"})
+			return
+		}
+		c.JSON(http.StatusOK, cards)
+	}
+}
+
+// GetGiftCard gives a gift card and its balance. The code can be given in
+// any case, with or without its dashes.
+func GetGiftCard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		card, err := findGiftCard(ctx, c.Param("code"))
+		if err != nil {
+			giftCardError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, card)
+	}
+}
+
+// GetGiftCardLedger lists the changes to a gift card, newest first.
+func GetGiftCardLedger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		result, err := giftCardEntryCollection.Find(ctx,
+			bson.M{"code": helper.NormalizeGiftCardCode(c.Param("code"))},
+			options.Find().SetSort(bson.D{{Key: "created_at", Value: -1},
+				{Key: "_id", Value: -1}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the ledger"})
+			return
+		}
+		entries := []models.GiftCardEntry{}
+		if err = result.All(ctx, &entries); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the ledger"})
+			return
+		}
+		c.JSON(http.StatusOK, entries)
+	}
+}
+
+// SellGiftCard puts a gift card, or a top-up of one given by code, on an
+// open order. The item is charged like any other, and the value is loaded
+// onto the card when the order is paid for.
+func SellGiftCard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var sale giftCardSale
+
+		if err := c.BindJSON(&sale); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(sale); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		order, err := findOrder(ctx, c.Param("order_id"))
+		if err != nil {
+			orderMoveError(c, err)
+			return
+		}
+		if order.Closed_at != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": errOrderNotOpen.Error()})
+			return
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		value := toFixed(*sale.Value, 2)
+		status := models.OrderItemServed
+		orderItem := models.OrderItem{
+			ID:         primitive.NewObjectID(),
+			Unit_price: &value,
+			Created_at: now,
+			Updated_at: now,
+			Order_id:   order.Order_ID,
+			Status:     &status,
+			Served_at:  &now,
+		}
+		orderItem.Order_item_id = orderItem.ID.Hex()
+
+		var card models.GiftCard
+		if sale.Code != "" {
+			card, err = findGiftCard(ctx, sale.Code)
+			if err != nil {
+				giftCardError(c, err)
+				return
+			}
+			if card.Status != models.GiftCardActive {
+				giftCardError(c, errGiftCardNotActive)
+				return
+			}
+		} else {
+			card = models.GiftCard{
+				Issued_value:  value,
+				Status:        models.GiftCardPending,
+				Order_id:      order.Order_ID,
+				Order_item_id: orderItem.Order_item_id,
+				Customer_id:   order.Customer_id,
+				Note:          sale.Note,
+				Created_by:    c.GetString("uid"),
+				Created_at:    now,
+				Updated_at:    now,
+			}
+			if sale.Customer_id != nil {
+				if _, err := findCustomer(ctx, *sale.Customer_id); err != nil {
+					customerError(c, errNoCustomer)
+					return
+				}
+				card.Customer_id = sale.Customer_id
+			}
+			if card.Code, err = helper.NewGiftCardCode(); err != nil {
+				c.JSON(http.StatusInternalServerError,
+					gin.H{"error": "gift card was not created"})
+				return
+			}
+		}
+		orderItem.Gift_card_code = &card.Code
+
+		err = inTransaction(ctx, func(sc mongo.SessionContext) error {
+			if card.Status == models.GiftCardPending {
+				if _, err := giftCardCollection.InsertOne(sc, card); err != nil {
+					return err
+				}
+			}
+			_, err := orderItemCollection.InsertOne(sc, orderItem)
+			return err
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "gift card was not sold"})
+			return
+		}
+		if order.Table_ID != nil {
+			refreshTableStatus(ctx, *order.Table_ID)
+		}
+		c.JSON(http.StatusOK, gin.H{"gift_card": card, "order_item": orderItem})
+	}
+}
+
+// FreezeGiftCard stops a gift card being spent or topped up, for the
+// reason given.
+func FreezeGiftCard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var request struct {
+			Reason string `json:"reason" validate:"required,max=500"`
+		}
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		card, err := setGiftCardFrozen(ctx, c.Param("code"), true,
+			request.Reason, c.GetString("uid"))
+		if err != nil {
+			giftCardError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, card)
+	}
+}
+
+// UnfreezeGiftCard lets a frozen gift card be used again.
+func UnfreezeGiftCard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		card, err := setGiftCardFrozen(ctx, c.Param("code"), false, "",
+			c.GetString("uid"))
+		if err != nil {
+			giftCardError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, card)
+	}
+}
+
+// setGiftCardFrozen freezes an active card or unfreezes a frozen one,
+// recording it in the ledger.
+func setGiftCardFrozen(ctx context.Context, code string, frozen bool,
+	reason, by string) (models.GiftCard, error) {
+	code = helper.NormalizeGiftCardCode(code)
+	from, to, kind := models.GiftCardFrozen, models.GiftCardActive,
+		models.GiftCardUnfreeze
+	set := bson.M{"status": to, "frozen_reason": nil}
+	if frozen {
+		from, to, kind = models.GiftCardActive, models.GiftCardFrozen,
+			models.GiftCardFreeze
+		set = bson.M{"status": to, "frozen_reason": reason}
+	}
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	set["updated_at"] = now
+
+	var card models.GiftCard
+	err := inTransaction(ctx, func(sc mongo.SessionContext) error {
+		err := giftCardCollection.FindOneAndUpdate(sc,
+			bson.M{"_id": code, "status": from}, bson.M{"$set": set},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&card)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			if _, err := findGiftCard(sc, code); err != nil {
+				return err
+			}
+			return errGiftCardNotActive
+		}
+		if err != nil {
+			return err
+		}
+		return recordGiftCardEntry(sc, &models.GiftCardEntry{
+			Code:       code,
+			Kind:       kind,
+			Balance:    card.Balance,
+			Note:       reason,
+			Created_by: by,
+		})
+	})
+	return card, err
+}
+
+// payWithGiftCard records a payment from a gift card, taking the amount
+// and tip off its balance in the same transaction. The balance is checked
+// in the update itself, so two payments at once can't both spend it.
+func payWithGiftCard(ctx context.Context, payment models.Payment) error {
+	total := toFixed(*payment.Amount+payment.Tip, 2)
+	return inTransaction(ctx, func(sc mongo.SessionContext) error {
+		card, err := moveGiftCardBalance(sc, bson.M{
+			"_id":     *payment.Gift_card_code,
+			"status":  models.GiftCardActive,
+			"balance": bson.M{"$gte": total},
+		}, -total, nil)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			found, err := findGiftCard(sc, *payment.Gift_card_code)
+			if err != nil {
+				return err
+			}
+			if found.Status != models.GiftCardActive {
+				return errGiftCardNotActive
+			}
+			return errGiftCardBalance
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := paymentCollection.InsertOne(sc, payment); err != nil {
+			return err
+		}
+		return recordGiftCardEntry(sc, &models.GiftCardEntry{
+			Code:       card.Code,
+			Kind:       models.GiftCardRedeem,
+			Amount:     -total,
+			Balance:    card.Balance,
+			Order_id:   &payment.Order_ID,
+			Invoice_id: &payment.Invoice_ID,
+			Payment_id: &payment.Payment_ID,
+			Created_by: payment.Created_by,
+		})
+	})
+}
+
+// refundGiftCard puts a refund of a gift card payment back onto the card,
+// inside the refund's transaction. A frozen card takes it too.
+func refundGiftCard(sc mongo.SessionContext, refund models.Payment) error {
+	if derefString(refund.Method) != models.PaymentMethodGiftCard ||
+		refund.Gift_card_code == nil {
+		return nil
+	}
+	total := toFixed(*refund.Amount+refund.Tip, 2)
+	card, err := moveGiftCardBalance(sc, bson.M{
+		"_id":    *refund.Gift_card_code,
+		"status": bson.M{"$in": bson.A{models.GiftCardActive, models.GiftCardFrozen}},
+	}, total, nil)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return errGiftCardNotActive
+	}
+	if err != nil {
+		return err
+	}
+	return recordGiftCardEntry(sc, &models.GiftCardEntry{
+		Code:       card.Code,
+		Kind:       models.GiftCardRefund,
+		Amount:     total,
+		Balance:    card.Balance,
+		Order_id:   &refund.Order_ID,
+		Invoice_id: &refund.Invoice_ID,
+		Payment_id: &refund.Payment_ID,
+		Created_by: refund.Created_by,
+	})
+}
+
+// loadGiftCards loads the gift cards sold and topped up on an order once its
+// invoice is paid for. A card sold on it is issued its value and becomes
+// active. Each item loads once however often this runs; failures are
+// logged, and RunGiftCardLoading catches up on them.
+func loadGiftCards(ctx context.Context, orderID string) {
+	result, err := orderItemCollection.Find(ctx, bson.M{
+		"order_id":         orderID,
+		"gift_card_code":   bson.M{"$ne": nil},
+		"gift_card_loaded": bson.M{"$ne": true},
+		"status":           bson.M{"$ne": models.OrderItemVoid},
+	})
+	if err != nil {
+		log.Println("couldn't load the gift cards of order", orderID, err)
+		return
+	}
+	var orderItems []models.OrderItem
+	if err = result.All(ctx, &orderItems); err != nil {
+		log.Println("couldn't load the gift cards of order", orderID, err)
+		return
+	}
+	for _, orderItem := range orderItems {
+		err := loadGiftCard(ctx, orderItem)
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			log.Println("couldn't load gift card", *orderItem.Gift_card_code,
+				"from order item", orderItem.Order_item_id, err)
+		}
+	}
+}
+
+// RunGiftCardLoading loads the gift cards of paid invoices that haven't
+// been loaded, such as when loadGiftCards failed. It blocks, so start it in
+// its own goroutine.
+func RunGiftCardLoading(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		if err := LoadMissedGiftCards(ctx); err != nil {
+			log.Println("couldn't load missed gift cards:", err)
+		}
+		cancel()
+	}
+}
+
+// missedLoadingWindow is how far back LoadMissedGiftCards looks for
+// payments that paid for gift cards.
+const missedLoadingWindow = 7 * 24 * time.Hour
+
+// LoadMissedGiftCards loads what is left unloaded of the gift cards on the
+// invoices paid for by payments taken in the last week.
+func LoadMissedGiftCards(ctx context.Context) error {
+	invoices, err := paidInvoices(ctx,
+		time.Now().Add(-missedLoadingWindow), bson.M{})
+	if err != nil {
+		return err
+	}
+	for _, invoice := range invoices {
+		loadGiftCards(ctx, invoice.Order_ID)
+	}
+	return nil
+}
+
+// loadGiftCard claims the item's gift_card_loaded flag, unless it has been
+// voided, and loads the card in the same transaction. A void writes the
+// same item, so the two can't both commit: whichever loses is retried and
+// sees what the other did.
+func loadGiftCard(ctx context.Context, orderItem models.OrderItem) error {
+	card, err := findGiftCard(ctx, *orderItem.Gift_card_code)
+	if err != nil {
+		return err
+	}
+	kind := models.GiftCardTopUp
+	filter := bson.M{"_id": card.Code, "status": bson.M{"$in": bson.A{
+		models.GiftCardActive, models.GiftCardFrozen}}}
+	var set bson.M
+	if card.Order_item_id == orderItem.Order_item_id {
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		kind = models.GiftCardIssue
+		filter["status"] = models.GiftCardPending
+		set = bson.M{"status": models.GiftCardActive, "activated_at": now}
+	}
+	amount := toFixed(*orderItem.Unit_price, 2)
+	return inTransaction(ctx, func(sc mongo.SessionContext) error {
+		claim, err := orderItemCollection.UpdateOne(sc, bson.M{
+			"order_item_id":    orderItem.Order_item_id,
+			"status":           bson.M{"$ne": models.OrderItemVoid},
+			"gift_card_loaded": bson.M{"$ne": true},
+		}, bson.M{"$set": bson.M{"gift_card_loaded": true}})
+		if err != nil || claim.ModifiedCount == 0 {
+			return err
+		}
+		card, err := moveGiftCardBalance(sc, filter, amount, set)
+		if err != nil {
+			return err
+		}
+		return recordGiftCardEntry(sc, &models.GiftCardEntry{
+			ID:       "load:" + orderItem.Order_item_id,
+			Code:     card.Code,
+			Kind:     kind,
+			Amount:   amount,
+			Balance:  card.Balance,
+			Order_id: &orderItem.Order_id,
+		})
+	})
+}
+
+// cancelGiftCardSale runs in the transaction that voids a gift card item.
+// A card not yet loaded is cancelled with its sale, if it is still pending
+// on this item; one that has been loaded can't be voided off the order.
+func cancelGiftCardSale(sc mongo.SessionContext, orderItemID string) error {
+	var orderItem models.OrderItem
+	if err := orderItemCollection.FindOne(sc,
+		bson.M{"order_item_id": orderItemID}).Decode(&orderItem); err != nil {
+		// left to the void to report
+		return nil
+	}
+	if orderItem.Gift_card_code == nil ||
+		derefString(orderItem.Status) == models.OrderItemVoid {
+		return nil
+	}
+	if orderItem.Gift_card_loaded {
+		return errGiftCardLoaded
+	}
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	_, err := giftCardCollection.UpdateOne(sc, bson.M{
+		"_id":           *orderItem.Gift_card_code,
+		"status":        models.GiftCardPending,
+		"order_item_id": orderItemID,
+	}, bson.M{"$set": bson.M{"status": models.GiftCardCancelled,
+		"updated_at": updated_at}})
+	return err
+}
+
+// moveGiftCardBalance adds amount to the balance of the card matching
+// filter, kept to the cent, and returns the card after it.
+func moveGiftCardBalance(sc mongo.SessionContext, filter bson.M,
+	amount float64, set bson.M) (models.GiftCard, error) {
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	fields := bson.M{
+		"balance": bson.M{"$round": bson.A{
+			bson.M{"$add": bson.A{"$balance", amount}}, 2}},
+		"updated_at": updated_at,
+	}
+	for field, value := range set {
+		fields[field] = value
+	}
+	var card models.GiftCard
+	err := giftCardCollection.FindOneAndUpdate(sc, filter,
+		bson.A{bson.M{"$set": fields}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&card)
+	return card, err
+}
+
+func recordGiftCardEntry(sc mongo.SessionContext, entry *models.GiftCardEntry) error {
+	if entry.ID == "" {
+		entry.ID = primitive.NewObjectID().Hex()
+	}
+	entry.Created_at, _ = time.Parse(time.RFC3339,
+		time.Now().Format(time.RFC3339))
+	_, err := giftCardEntryCollection.InsertOne(sc, entry)
+	return err
+}
+
+func findGiftCard(ctx context.Context, code string) (models.GiftCard, error) {
+	var card models.GiftCard
+	err := giftCardCollection.FindOne(ctx,
+		bson.M{"_id": helper.NormalizeGiftCardCode(code)}).Decode(&card)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return card, errNoGiftCard
+	}
+	return card, err
+}
+
+func giftCardError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errNoGiftCard):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, errGiftCardNotActive), errors.Is(err, errGiftCardBalance),
+		errors.Is(err, errGiftCardLoaded):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError,
+			gin.H{"error": "the gift card couldn't be updated"})
+	}
+}
@@ -0,0 +1,727 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"restro/database"
+	helper "restro/helpers"
+	"restro/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var guestOrderCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "guestOrder")
+
+var (
+	errTableHasTabs = errors.New("the table has more than one open order, " +
+		"ask a member of staff")
+	errGuestItems = errors.New("the order can't be placed")
+)
+
+// guestFood is a food as guests see it on the QR menu.
+type guestFood struct {
+	Food_id     string   `json:"food_id"`
+	Name        *string  `json:"name"`
+	Description *string  `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Price       float64  `json:"price"`
+	Food_image  *string  `json:"food_image,omitempty"`
+}
+
+// guestMenu is an active menu with the foods on sale in it.
+type guestMenu struct {
+	Menu_id     string      `json:"menu_id"`
+	Name        string      `json:"name"`
+	Category    string      `json:"category"`
+	Description string      `json:"description,omitempty"`
+	Foods       []guestFood `json:"foods"`
+}
+
+// guestTabItem is an item on the table's tab.
+type guestTabItem struct {
+	Order_item_id string   `json:"order_item_id" bson:"order_item_id"`
+	Food_id       string   `json:"food_id" bson:"food_id"`
+	Food_name     *string  `json:"food_name" bson:"food_name"`
+	Quantity      *string  `json:"quantity" bson:"quantity"`
+	Modifiers     []string `json:"modifiers,omitempty" bson:"modifiers"`
+	Unit_price    float64  `json:"unit_price" bson:"unit_price"`
+	Status        *string  `json:"status" bson:"status"`
+}
+
+// GetTableQR gives the token for a table's QR code and the guest path it
+// opens.
+func GetTableQR() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var table models.Table
+		if err := tableCollection.FindOne(ctx,
+			bson.M{"table_id": c.Param("table_id")}).Decode(&table); err != nil {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any table with given ID"})
+			return
+		}
+		c.JSON(http.StatusOK, tableQR(table))
+	}
+}
+
+// RotateTableQR issues a new QR code for a table. Codes printed before stop
+// working.
+func RotateTableQR() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var table models.Table
+		err := tableCollection.FindOneAndUpdate(ctx,
+			bson.M{"table_id": c.Param("table_id")},
+			bson.M{"$inc": bson.M{"qr_version": 1}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).
+			Decode(&table)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any table with given ID"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "QR code rotation failed"})
+			return
+		}
+		c.JSON(http.StatusOK, tableQR(table))
+	}
+}
+
+// UpdateTableQR sets whether staff approve what guests order from a
+// table's QR code.
+func UpdateTableQR() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var settings struct {
+			Approval_required *bool `json:"approval_required" validate:"required"`
+		}
+		if err := c.BindJSON(&settings); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validate.Struct(settings); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var table models.Table
+		err := tableCollection.FindOneAndUpdate(ctx,
+			bson.M{"table_id": c.Param("table_id")},
+			bson.M{"$set": bson.M{"qr_approval": *settings.Approval_required}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).
+			Decode(&table)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any table with given ID"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "QR code update failed"})
+			return
+		}
+		c.JSON(http.StatusOK, tableQR(table))
+	}
+}
+
+// GetGuestMenu lists the menus active now with the foods on sale in them,
+// translated like the staff menu endpoints.
+func GetGuestMenu() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		table, ok := guestTable(ctx, c)
+		if !ok {
+			return
+		}
+		now := time.Now()
+		result, err := menuCollection.Find(ctx, bson.M{"$and": bson.A{
+			bson.M{"$or": bson.A{
+				bson.M{"start_date": nil},
+				bson.M{"start_date": bson.M{"$lte": now}},
+			}},
+			bson.M{"$or": bson.A{
+				bson.M{"end_date": nil},
+				bson.M{"end_date": bson.M{"$gt": now}},
+			}},
+		}}, options.Find().SetSort(bson.M{"name": 1}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the menu"})
+			return
+		}
+		var menus []models.Menu
+		if err = result.All(ctx, &menus); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the menu"})
+			return
+		}
+		menuIDs := make([]string, 0, len(menus))
+		for _, menu := range menus {
+			menuIDs = append(menuIDs, menu.Menu_ID)
+		}
+		result, err = foodCollection.Find(ctx, bson.M{
+			"menu_id":   bson.M{"$in": menuIDs},
+			"available": bson.M{"$ne": false},
+		}, options.Find().SetSort(bson.M{"name": 1}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the menu"})
+			return
+		}
+		var foods []models.Food
+		if err = result.All(ctx, &foods); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the menu"})
+			return
+		}
+
+		locales := requestLocales(c)
+		byMenu := map[string][]guestFood{}
+		for _, food := range foods {
+			price, err := FoodPriceAt(ctx, food.Food_ID, now)
+			if err != nil {
+				continue
+			}
+			localizeFood(&food, locales)
+			byMenu[*food.Menu_ID] = append(byMenu[*food.Menu_ID], guestFood{
+				Food_id:     food.Food_ID,
+				Name:        food.Name,
+				Description: food.Description,
+				Tags:        food.Tags,
+				Price:       toFixed(price, 2),
+				Food_image:  food.Food_image,
+			})
+		}
+		guestMenus := []guestMenu{}
+		for _, menu := range menus {
+			if len(byMenu[menu.Menu_ID]) == 0 {
+				continue
+			}
+			localizeMenu(&menu, locales)
+			guestMenus = append(guestMenus, guestMenu{
+				Menu_id:     menu.Menu_ID,
+				Name:        menu.Name,
+				Category:    menu.Category,
+				Description: menu.Description,
+				Foods:       byMenu[menu.Menu_ID],
+			})
+		}
+		c.Header("Content-Language", locales[0])
+		c.JSON(http.StatusOK, gin.H{
+			"table_number":      table.Table_Number,
+			"approval_required": table.Qr_approval,
+			"menus":             guestMenus,
+		})
+	}
+}
+
+// GetGuestTab shows the table's open tab and the rounds guests sent to it
+// that are still waiting for staff.
+func GetGuestTab() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		table, ok := guestTable(ctx, c)
+		if !ok {
+			return
+		}
+		tab, err := currentGuestTab(ctx, table.Table_ID)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			guestOrderError(c, err)
+			return
+		}
+		items := []guestTabItem{}
+		total := 0.0
+		filter := bson.M{"table_id": table.Table_ID,
+			"status": models.GuestOrderPending}
+		var orderID *string
+		if err == nil {
+			orderID = &tab.Order_ID
+			if items, err = guestTabItems(ctx, tab.Order_ID); err != nil {
+				c.JSON(http.StatusInternalServerError,
+					gin.H{"error": "error occured while reading the tab"})
+				return
+			}
+			for _, item := range items {
+				total += item.Unit_price
+			}
+			filter = bson.M{"$or": bson.A{filter,
+				bson.M{"order_id": tab.Order_ID}}}
+		}
+		result, err := guestOrderCollection.Find(ctx, filter,
+			options.Find().SetSort(bson.M{"created_at": 1}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while reading the tab"})
+			return
+		}
+		guestOrders := []models.GuestOrder{}
+		if err = result.All(ctx, &guestOrders); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while reading the tab"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"table_number": table.Table_Number,
+			"order_id":     orderID,
+			"items":        items,
+			"total":        toFixed(total, 2),
+			"guest_orders": guestOrders,
+		})
+	}
+}
+
+// CreateGuestOrder takes a round of items from a table's QR code. It goes
+// on the table's open tab, opening one if there is none, unless the table
+// needs staff approval, in which case it waits as PENDING.
+func CreateGuestOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		table, ok := guestTable(ctx, c)
+		if !ok {
+			return
+		}
+		var guestOrder models.GuestOrder
+		if err := c.BindJSON(&guestOrder); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validate.Struct(guestOrder); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// Check the items now rather than when staff get to them.
+		if _, err := buildOrderItems(ctx, "",
+			guestOrderItems(guestOrder), nil); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		guestOrder.ID = primitive.NewObjectID()
+		guestOrder.Guest_order_ID = guestOrder.ID.Hex()
+		guestOrder.Table_id = table.Table_ID
+		guestOrder.Order_id = nil
+		guestOrder.Order_item_ids = nil
+		guestOrder.Reason = ""
+		guestOrder.Reviewed_by = nil
+		guestOrder.Reviewed_at = nil
+		guestOrder.Status = models.GuestOrderPending
+		guestOrder.Created_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+
+		status := http.StatusAccepted
+		if !table.Qr_approval {
+			if err := applyGuestOrder(ctx, &guestOrder); err != nil {
+				guestOrderError(c, err)
+				return
+			}
+			status = http.StatusOK
+		}
+		if _, err := guestOrderCollection.InsertOne(ctx,
+			guestOrder); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "order was not placed"})
+			return
+		}
+		c.JSON(status, guestOrder)
+	}
+}
+
+// GetGuestOrders lists the rounds guests sent from QR codes, newest first,
+// optionally by status and table_id.
+func GetGuestOrders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		filter := bson.M{}
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+		if tableID := c.Query("table_id"); tableID != "" {
+			filter["table_id"] = tableID
+		}
+		result, err := guestOrderCollection.Find(ctx, filter,
+			options.Find().SetSort(bson.M{"created_at": -1}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing guest orders"})
+			return
+		}
+		guestOrders := []models.GuestOrder{}
+		if err = result.All(ctx, &guestOrders); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing guest orders"})
+			return
+		}
+		c.JSON(http.StatusOK, guestOrders)
+	}
+}
+
+// ApproveGuestOrder puts a pending guest round on the table's tab.
+func ApproveGuestOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		guestOrder, ok := reviewGuestOrder(ctx, c, models.GuestOrderApproved,
+			"")
+		if !ok {
+			return
+		}
+		if err := applyGuestOrder(ctx, &guestOrder); err != nil {
+			// Leave it pending so it can be approved again or rejected.
+			guestOrderCollection.UpdateOne(ctx,
+				bson.M{"guest_order_id": guestOrder.Guest_order_ID},
+				bson.M{"$set": bson.M{"status": models.GuestOrderPending,
+					"reviewed_by": nil, "reviewed_at": nil}})
+			guestOrderError(c, err)
+			return
+		}
+		if _, err := guestOrderCollection.UpdateOne(ctx,
+			bson.M{"guest_order_id": guestOrder.Guest_order_ID},
+			bson.M{"$set": bson.M{"order_id": guestOrder.Order_id,
+				"order_item_ids": guestOrder.Order_item_ids}}); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "the items were added but the guest order " +
+					"couldn't be updated"})
+			return
+		}
+		c.JSON(http.StatusOK, guestOrder)
+	}
+}
+
+// RejectGuestOrder turns down a pending guest round, with an optional
+// reason the guests see on their tab.
+func RejectGuestOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var body struct {
+			Reason string `json:"reason" validate:"max=500"`
+		}
+		if c.Request.ContentLength != 0 {
+			if err := c.BindJSON(&body); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if err := validate.Struct(body); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		guestOrder, ok := reviewGuestOrder(ctx, c, models.GuestOrderRejected,
+			body.Reason)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, guestOrder)
+	}
+}
+
+// reviewGuestOrder moves a pending guest order to status, writing the error
+// response when it isn't pending. Only one review can claim it.
+func reviewGuestOrder(ctx context.Context, c *gin.Context, status,
+	reason string) (models.GuestOrder, bool) {
+	var guestOrder models.GuestOrder
+	reviewedBy := c.GetString("uid")
+	reviewedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	set := bson.M{"status": status, "reviewed_by": reviewedBy,
+		"reviewed_at": reviewedAt}
+	if reason != "" {
+		set["reason"] = reason
+	}
+	err := guestOrderCollection.FindOneAndUpdate(ctx, bson.M{
+		"guest_order_id": c.Param("guest_order_id"),
+		"status":         models.GuestOrderPending,
+	}, bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).
+		Decode(&guestOrder)
+	if err == nil {
+		return guestOrder, true
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusInternalServerError,
+			gin.H{"error": "guest order review failed"})
+		return guestOrder, false
+	}
+	if err := guestOrderCollection.FindOne(ctx, bson.M{
+		"guest_order_id": c.Param("guest_order_id"),
+	}).Decode(&guestOrder); err != nil {
+		c.JSON(http.StatusNotFound,
+			gin.H{"error": "couldn't find any guest order with given ID"})
+		return guestOrder, false
+	}
+	c.JSON(http.StatusConflict,
+		gin.H{"error": "the guest order was already " + guestOrder.Status})
+	return guestOrder, false
+}
+
+// guestTable finds the table a guest request's token is for, writing the
+// error response when the token is forged or has been rotated out.
+func guestTable(ctx context.Context, c *gin.Context) (models.Table, bool) {
+	var table models.Table
+	tableID, version, err := helper.ParseTableToken(c.Param("token"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "this QR code isn't valid"})
+		return table, false
+	}
+	err = tableCollection.FindOne(ctx,
+		bson.M{"table_id": tableID}).Decode(&table)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusInternalServerError,
+			gin.H{"error": "error occured while reading the table"})
+		return table, false
+	}
+	if err != nil || table.Qr_version != version {
+		c.JSON(http.StatusNotFound, gin.H{"error": "this QR code is no " +
+			"longer valid, ask a member of staff for a new one"})
+		return table, false
+	}
+	return table, true
+}
+
+// applyGuestOrder adds a guest round to the table's tab and marks it
+// approved.
+func applyGuestOrder(ctx context.Context, guestOrder *models.GuestOrder) error {
+	tab, err := guestTab(ctx, guestOrder.Table_id)
+	if err != nil {
+		return err
+	}
+	orderItems, err := buildOrderItems(ctx, tab.Order_ID,
+		guestOrderItems(*guestOrder), nil)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errGuestItems, err)
+	}
+	if _, err := insertOrderItems(ctx, tab, orderItems); err != nil {
+		return err
+	}
+	guestOrder.Order_id = &tab.Order_ID
+	guestOrder.Order_item_ids = []string{}
+	for _, item := range orderItems {
+		guestOrder.Order_item_ids = append(guestOrder.Order_item_ids,
+			item.(models.OrderItem).Order_item_id)
+	}
+	guestOrder.Status = models.GuestOrderApproved
+	return nil
+}
+
+func guestOrderItems(guestOrder models.GuestOrder) []models.OrderItem {
+	orderItems := []models.OrderItem{}
+	for _, item := range guestOrder.Items {
+		orderItems = append(orderItems, models.OrderItem{
+			Food_id:   item.Food_id,
+			Quantity:  item.Quantity,
+			Modifiers: item.Modifiers,
+		})
+	}
+	return orderItems
+}
+
+// currentGuestTab is the open order guests at a table add to: the one on
+// the table's tab if still open there, else the table's only open order.
+// Tables in a group share the primary table's tab. It is ErrNoDocuments
+// when the table has no open order and errTableHasTabs when staff opened
+// more than one.
+func currentGuestTab(ctx context.Context, tableID string) (models.Order, error) {
+	tab, _, err := findGuestTab(ctx, tableID)
+	return tab, err
+}
+
+// guestTab is the table's tab, opening one when the table has no open
+// order. The table's guest_tab_id is only changed from the value read, so
+// guests ordering at once can't open two tabs.
+func guestTab(ctx context.Context, tableID string) (models.Order, error) {
+	for attempt := 0; attempt < 3; attempt++ {
+		tab, table, err := findGuestTab(ctx, tableID)
+		if err == nil {
+			return tab, nil
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return tab, err
+		}
+		if table.Guest_tab_id != nil {
+			if _, err := findOrder(ctx, *table.Guest_tab_id); errors.Is(err,
+				mongo.ErrNoDocuments) {
+				// Another guest claimed the table for a tab that is still
+				// being opened; open it the same way.
+				return openGuestTab(ctx, table, *table.Guest_tab_id)
+			}
+		}
+
+		id := primitive.NewObjectID().Hex()
+		result, err := tableCollection.UpdateOne(ctx, bson.M{
+			"table_id":     table.Table_ID,
+			"guest_tab_id": table.Guest_tab_id,
+		}, bson.M{"$set": bson.M{"guest_tab_id": id}})
+		if err != nil {
+			return tab, err
+		}
+		if result.MatchedCount == 0 {
+			continue
+		}
+		return openGuestTab(ctx, table, id)
+	}
+	return models.Order{}, errOrderChanged
+}
+
+// findGuestTab looks up the table's tab as currentGuestTab does, also
+// returning the table the tab is kept on. When the table's only open order
+// isn't its tab yet, it becomes it.
+func findGuestTab(ctx context.Context, tableID string) (models.Order, models.Table, error) {
+	var tab models.Order
+	var table models.Table
+	lookup := models.Order{Table_ID: &tableID}
+	resolveOrderTable(ctx, &lookup)
+	if err := tableCollection.FindOne(ctx,
+		bson.M{"table_id": *lookup.Table_ID}).Decode(&table); err != nil {
+		return tab, table, err
+	}
+	if table.Guest_tab_id != nil {
+		order, err := findOrder(ctx, *table.Guest_tab_id)
+		if err == nil && order.Closed_at == nil &&
+			derefString(order.Table_ID) == table.Table_ID {
+			return order, table, nil
+		}
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return tab, table, err
+		}
+	}
+	open, err := tableOpenOrders(ctx, []string{table.Table_ID})
+	if err != nil {
+		return tab, table, err
+	}
+	switch len(open[table.Table_ID]) {
+	case 0:
+		return tab, table, mongo.ErrNoDocuments
+	case 1:
+	default:
+		return tab, table, errTableHasTabs
+	}
+	tab, err = findOrder(ctx, open[table.Table_ID][0].Order_id)
+	if err != nil {
+		return tab, table, err
+	}
+	// Losing this race only means another request adopted it first.
+	tableCollection.UpdateOne(ctx, bson.M{
+		"table_id":     table.Table_ID,
+		"guest_tab_id": table.Guest_tab_id,
+	}, bson.M{"$set": bson.M{"guest_tab_id": tab.Order_ID}})
+	return tab, table, nil
+}
+
+// openGuestTab saves the order for a tab claimed on the table. The order's
+// _id comes from the claimed ID, so two requests opening the same tab save
+// it once.
+func openGuestTab(ctx context.Context, table models.Table, orderID string) (models.Order, error) {
+	var order models.Order
+	id, err := primitive.ObjectIDFromHex(orderID)
+	if err != nil {
+		return order, err
+	}
+	order.ID = id
+	order.Order_ID = orderID
+	order.Order_date, _ = time.Parse(time.RFC3339,
+		time.Now().Format(time.RFC3339))
+	order.Created_at = order.Order_date
+	order.Updated_at = order.Order_date
+	order.Order_type = models.OrderDineIn
+	order.Table_ID = &table.Table_ID
+	order.Table_group_id = table.Group_ID
+	if err := assignServer(ctx, &order); err != nil {
+		return order, err
+	}
+	data, err := bson.Marshal(order)
+	if err != nil {
+		return order, err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return order, err
+	}
+	delete(doc, "_id")
+	_, err = orderCollection.UpdateOne(ctx, bson.M{"_id": id},
+		bson.M{"$setOnInsert": doc}, options.Update().SetUpsert(true))
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return order, err
+	}
+	return findOrder(ctx, orderID)
+}
+
+// guestTabItems is what has been ordered on the tab, leaving out voided
+// items.
+func guestTabItems(ctx context.Context, orderID string) ([]guestTabItem, error) {
+	cursor, err := orderItemCollection.Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{
+			"order_id": orderID,
+			"status":   bson.M{"$ne": models.OrderItemVoid},
+		}},
+		bson.M{"$lookup": bson.M{
+			"from":         foodCollection.Name(),
+			"localField":   "food_id",
+			"foreignField": "food_id",
+			"as":           "food",
+		}},
+		bson.M{"$sort": bson.M{"created_at": 1}},
+		bson.M{"$project": bson.M{
+			"order_item_id": 1,
+			"food_id":       1,
+			"food_name":     bson.M{"$first": "$food.name"},
+			"quantity":      1,
+			"modifiers":     1,
+			"unit_price":    bson.M{"$ifNull": bson.A{"$unit_price", 0}},
+			"status":        1,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	items := []guestTabItem{}
+	err = cursor.All(ctx, &items)
+	return items, err
+}
+
+func tableQR(table models.Table) gin.H {
+	token := helper.TableToken(table.Table_ID, table.Qr_version)
+	return gin.H{
+		"table_id":          table.Table_ID,
+		"table_number":      table.Table_Number,
+		"version":           table.Qr_version,
+		"token":             token,
+		"path":              "/guest/" + token,
+		"approval_required": table.Qr_approval,
+	}
+}
+
+func guestOrderError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errGuestItems):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errTableHasTabs), errors.Is(err, errOrderChanged):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError,
+			gin.H{"error": "the order couldn't be placed"})
+	}
+}
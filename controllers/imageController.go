@@ -0,0 +1,231 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"restro/database"
+	"restro/media"
+	"restro/models"
+	"restro/storage"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var assetCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "asset")
+
+var blobStore storage.BlobStore = openBlobStore()
+
+var maxImageBytes int64 = imageSizeLimit()
+
+func openBlobStore() storage.BlobStore {
+	store, err := storage.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return store
+}
+
+// imageSizeLimit reads MAX_IMAGE_BYTES, defaulting to 5 MiB.
+func imageSizeLimit() int64 {
+	limit, err := strconv.ParseInt(os.Getenv("MAX_IMAGE_BYTES"), 10, 64)
+	if err != nil || limit <= 0 {
+		return 5 << 20
+	}
+	return limit
+}
+
+// imageURL is where GetImage serves a variant of an asset.
+func imageURL(assetID, variant string) string {
+	return "/images/" + assetID + "/" + variant
+}
+
+// UploadFoodImage stores a multipart "image" upload with its resized
+// variants and points the food at the new asset.
+func UploadFoodImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		foodID := c.Param("food_id")
+
+		var food models.Food
+		if err := foodCollection.FindOne(ctx,
+			bson.M{"food_id": foodID}).Decode(&food); err != nil {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any food with given ID"})
+			return
+		}
+
+		// Leave room for the multipart framing around the file itself.
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body,
+			maxImageBytes+64<<10)
+		header, err := c.FormFile("image")
+		if err != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": "the image file is missing or too large"})
+			return
+		}
+		if header.Size > maxImageBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf(
+				"images can't be larger than %d bytes", maxImageBytes)})
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(file, maxImageBytes+1))
+		file.Close()
+		if err != nil || int64(len(data)) > maxImageBytes {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": "the image couldn't be read"})
+			return
+		}
+
+		renditions, err := media.Process(data)
+		if errors.Is(err, media.ErrUnsupportedType) {
+			c.JSON(http.StatusUnsupportedMediaType,
+				gin.H{"error": "only JPEG, PNG and GIF images are accepted"})
+			return
+		}
+		if errors.Is(err, media.ErrTooManyPixels) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf(
+				"images can have at most %d pixels", media.MaxPixels)})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": "the image couldn't be decoded"})
+			return
+		}
+
+		var asset models.Asset
+		asset.ID = primitive.NewObjectID()
+		asset.Asset_ID = asset.ID.Hex()
+		asset.Filename = header.Filename
+		asset.Uploaded_by = c.GetString("uid")
+		asset.Created_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		asset.Variants = map[string]models.AssetVariant{}
+		for _, rendition := range renditions {
+			key := "images/" + asset.Asset_ID + "/" + rendition.Name +
+				rendition.Extension
+			if err := blobStore.Put(ctx, key, rendition.Data,
+				rendition.Content_type); err != nil {
+				deleteAssetBlobs(ctx, asset)
+				c.JSON(http.StatusInternalServerError,
+					gin.H{"error": "the image couldn't be stored"})
+				return
+			}
+			sum := sha256.Sum256(rendition.Data)
+			asset.Variants[rendition.Name] = models.AssetVariant{
+				Key:          key,
+				Content_type: rendition.Content_type,
+				Width:        rendition.Width,
+				Height:       rendition.Height,
+				Size:         len(rendition.Data),
+				Etag:         `"` + hex.EncodeToString(sum[:16]) + `"`,
+			}
+		}
+		if _, err := assetCollection.InsertOne(ctx, asset); err != nil {
+			deleteAssetBlobs(ctx, asset)
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "the image record was not created"})
+			return
+		}
+
+		updated_at, _ := time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		_, err = foodCollection.UpdateOne(ctx, bson.M{"food_id": foodID},
+			bson.M{"$set": bson.M{
+				"image_asset_id": asset.Asset_ID,
+				"food_image":     imageURL(asset.Asset_ID, "medium"),
+				"updated_at":     updated_at,
+			}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "the food couldn't be updated"})
+			return
+		}
+
+		if food.Image_asset_id != nil {
+			removeAsset(ctx, *food.Image_asset_id)
+		}
+		c.JSON(http.StatusOK, asset)
+	}
+}
+
+// GetImage serves a stored variant. Asset IDs are never reused, so the
+// response can be cached for good.
+func GetImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+
+		var asset models.Asset
+		if err := assetCollection.FindOne(ctx,
+			bson.M{"asset_id": c.Param("asset_id")}).Decode(&asset); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
+			return
+		}
+		variant, ok := asset.Variants[c.Param("variant")]
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "image size not found"})
+			return
+		}
+
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+		c.Header("ETag", variant.Etag)
+		if c.GetHeader("If-None-Match") == variant.Etag {
+			c.Status(http.StatusNotModified)
+			return
+		}
+
+		body, err := blobStore.Get(ctx, variant.Key)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
+			return
+		}
+		defer body.Close()
+		c.DataFromReader(http.StatusOK, int64(variant.Size),
+			variant.Content_type, body, nil)
+	}
+}
+
+func deleteAssetBlobs(ctx context.Context, asset models.Asset) {
+	for _, variant := range asset.Variants {
+		if err := blobStore.Delete(ctx, variant.Key); err != nil {
+			log.Println("couldn't delete image blob", variant.Key, err)
+		}
+	}
+}
+
+// removeAsset deletes a replaced image unless another food still uses it.
+func removeAsset(ctx context.Context, assetID string) {
+	count, err := foodCollection.CountDocuments(ctx,
+		bson.M{"image_asset_id": assetID})
+	if err != nil || count > 0 {
+		return
+	}
+	var asset models.Asset
+	if err := assetCollection.FindOneAndDelete(ctx,
+		bson.M{"asset_id": assetID}).Decode(&asset); err != nil {
+		return
+	}
+	deleteAssetBlobs(ctx, asset)
+}
@@ -0,0 +1,424 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"restro/database"
+	"restro/inventory"
+	"restro/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ingredientForm struct {
+	models.Ingredient
+	Opening_quantity *float64 `json:"opening_quantity"`
+}
+
+type stockAdjustment struct {
+	Ingredient_ID string   `json:"ingredient_id" validate:"required"`
+	Change        *float64 `json:"change"`
+	Counted       *float64 `json:"counted" validate:"omitempty,gte=0"`
+	Note          string   `json:"note" validate:"required"`
+}
+
+type stockLevel struct {
+	models.Ingredient
+	Stock_value float64 `json:"stock_value"`
+}
+
+var ingredientCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "ingredient")
+var recipeCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "recipe")
+var stockMovementCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "stockMovement")
+
+var inventoryService = inventory.NewService(inventory.NewMongoStore(
+	ingredientCollection, recipeCollection, stockMovementCollection))
+
+// GetIngredients lists the stock levels with their value at cost.
+func GetIngredients() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		ingredients, err := inventoryService.Store().Ingredients(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the ingredients"})
+			return
+		}
+		levels := make([]stockLevel, 0, len(ingredients))
+		for _, ingredient := range ingredients {
+			level := stockLevel{Ingredient: ingredient}
+			if ingredient.Cost_per_unit != nil {
+				level.Stock_value = toFixed(
+					ingredient.Quantity**ingredient.Cost_per_unit, 2)
+			}
+			levels = append(levels, level)
+		}
+		c.JSON(http.StatusOK, levels)
+	}
+}
+
+func GetIngredient() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		ingredient, err := inventoryService.Store().Ingredient(ctx,
+			c.Param("ingredient_id"))
+		if err != nil {
+			inventoryError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, ingredient)
+	}
+}
+
+// CreateIngredient adds an ingredient. An opening_quantity is booked as an
+// adjustment so the ledger explains every unit in stock.
+func CreateIngredient() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var form ingredientForm
+
+		if err := c.BindJSON(&form); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ingredient := form.Ingredient
+		if validationErr := validate.Struct(ingredient); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		ingredient.Created_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		ingredient.Updated_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		ingredient.ID = primitive.NewObjectID()
+		ingredient.Ingredient_ID = ingredient.ID.Hex()
+		ingredient.Quantity = 0
+		if ingredient.Supplier_ID != nil &&
+			!supplierExists(ctx, *ingredient.Supplier_ID) {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": "supplier was not found"})
+			return
+		}
+
+		if err := inventoryService.Store().SaveIngredient(ctx,
+			ingredient); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "ingredient was not created"})
+			return
+		}
+		if form.Opening_quantity != nil && *form.Opening_quantity != 0 {
+			movement, err := inventoryService.Adjust(ctx,
+				ingredient.Ingredient_ID, *form.Opening_quantity,
+				"opening stock", c.GetString("uid"))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError,
+					gin.H{"error": "opening stock was not recorded"})
+				return
+			}
+			ingredient.Quantity = movement.Balance_after
+			stockEvaluator.Trigger()
+		}
+		c.JSON(http.StatusOK, ingredient)
+	}
+}
+
+// UpdateIngredient changes the name, unit, cost, stock levels or preferred
+// supplier. Quantities only change through stock movements.
+func UpdateIngredient() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var update models.Ingredient
+
+		if err := c.BindJSON(&update); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ingredient, err := inventoryService.Store().Ingredient(ctx,
+			c.Param("ingredient_id"))
+		if err != nil {
+			inventoryError(c, err)
+			return
+		}
+		if update.Name != nil {
+			ingredient.Name = update.Name
+		}
+		if update.Unit != nil {
+			ingredient.Unit = update.Unit
+		}
+		if update.Cost_per_unit != nil {
+			ingredient.Cost_per_unit = update.Cost_per_unit
+		}
+		if update.Reorder_threshold != nil {
+			ingredient.Reorder_threshold = update.Reorder_threshold
+		}
+		if update.Par_level != nil {
+			ingredient.Par_level = update.Par_level
+		}
+		if update.Supplier_ID != nil {
+			if !supplierExists(ctx, *update.Supplier_ID) {
+				c.JSON(http.StatusBadRequest,
+					gin.H{"error": "supplier was not found"})
+				return
+			}
+			ingredient.Supplier_ID = update.Supplier_ID
+		}
+		if validationErr := validate.Struct(ingredient); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		ingredient.Updated_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+
+		if err := inventoryService.Store().SaveIngredient(ctx,
+			ingredient); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "ingredient update failed"})
+			return
+		}
+		if update.Cost_per_unit != nil {
+			refreshPlateCosts(ctx)
+		}
+		stockEvaluator.Trigger()
+		c.JSON(http.StatusOK, ingredient)
+	}
+}
+
+func GetRecipes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		recipes, err := inventoryService.Store().Recipes(ctx, c.Query("food_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the recipes"})
+			return
+		}
+		if recipes == nil {
+			recipes = []models.Recipe{}
+		}
+		c.JSON(http.StatusOK, recipes)
+	}
+}
+
+func CreateRecipe() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var recipe models.Recipe
+
+		if err := c.BindJSON(&recipe); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !checkRecipe(ctx, c, recipe) {
+			return
+		}
+		recipe.Created_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		recipe.Updated_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		recipe.ID = primitive.NewObjectID()
+		recipe.Recipe_ID = recipe.ID.Hex()
+
+		if err := inventoryService.Store().SaveRecipe(ctx, recipe); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "recipe was not created"})
+			return
+		}
+		refreshPlateCosts(ctx)
+		c.JSON(http.StatusOK, recipe)
+	}
+}
+
+// UpdateRecipe replaces the recipe's components.
+func UpdateRecipe() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var update models.Recipe
+
+		if err := c.BindJSON(&update); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		recipe, err := inventoryService.Store().Recipe(ctx, c.Param("recipe_id"))
+		if err != nil {
+			inventoryError(c, err)
+			return
+		}
+		recipe.Components = update.Components
+		if !checkRecipe(ctx, c, recipe) {
+			return
+		}
+		recipe.Updated_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		if err := inventoryService.Store().SaveRecipe(ctx, recipe); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "recipe update failed"})
+			return
+		}
+		refreshPlateCosts(ctx)
+		c.JSON(http.StatusOK, recipe)
+	}
+}
+
+func DeleteRecipe() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		if err := inventoryService.Store().DeleteRecipe(ctx,
+			c.Param("recipe_id")); err != nil {
+			inventoryError(c, err)
+			return
+		}
+		refreshPlateCosts(ctx)
+		c.JSON(http.StatusOK, gin.H{"deleted": c.Param("recipe_id")})
+	}
+}
+
+// checkRecipe validates a recipe and that its food and ingredients exist,
+// writing the error response when they don't.
+func checkRecipe(ctx context.Context, c *gin.Context, recipe models.Recipe) bool {
+	if validationErr := validate.Struct(recipe); validationErr != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+		return false
+	}
+	if recipe.Food_ID == nil && recipe.Modifier == nil {
+		c.JSON(http.StatusBadRequest,
+			gin.H{"error": "a recipe needs a food_id, a modifier or both"})
+		return false
+	}
+	if recipe.Food_ID != nil {
+		foods, err := foodsByID(ctx, []string{*recipe.Food_ID})
+		if err != nil || len(foods) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "food was not found"})
+			return false
+		}
+	}
+	for _, component := range recipe.Components {
+		if _, err := inventoryService.Store().Ingredient(ctx,
+			component.Ingredient_ID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ingredient " +
+				component.Ingredient_ID + " was not found"})
+			return false
+		}
+	}
+	return true
+}
+
+// GetStockMovements returns the stock ledger, optionally for one
+// ingredient, reason or date range (RFC 3339 from/to).
+func GetStockMovements() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		filter := inventory.MovementFilter{
+			Ingredient_ID: c.Query("ingredient_id"),
+			Order_item_id: c.Query("order_item_id"),
+			Reason:        c.Query("reason"),
+			Reference:     c.Query("reference"),
+		}
+		var err error
+		if filter.From, err = queryTime(c, "from"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC 3339 time"})
+			return
+		}
+		if filter.To, err = queryTime(c, "to"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC 3339 time"})
+			return
+		}
+		movements, err := inventoryService.Store().Movements(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the stock movements"})
+			return
+		}
+		c.JSON(http.StatusOK, movements)
+	}
+}
+
+// CreateStockAdjustment books a manual correction, either as a change or as
+// the counted quantity from a stock take.
+func CreateStockAdjustment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var adjustment stockAdjustment
+
+		if err := c.BindJSON(&adjustment); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(adjustment); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		if (adjustment.Change == nil) == (adjustment.Counted == nil) {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": "give either change or counted"})
+			return
+		}
+
+		var movement models.StockMovement
+		var err error
+		if adjustment.Change != nil {
+			movement, err = inventoryService.Adjust(ctx, adjustment.Ingredient_ID,
+				*adjustment.Change, adjustment.Note, c.GetString("uid"))
+		} else {
+			movement, err = inventoryService.Count(ctx, adjustment.Ingredient_ID,
+				*adjustment.Counted, adjustment.Note, c.GetString("uid"))
+		}
+		if err != nil {
+			inventoryError(c, err)
+			return
+		}
+		stockEvaluator.Trigger()
+		c.JSON(http.StatusOK, movement)
+	}
+}
+
+func inventoryError(c *gin.Context, err error) {
+	if errors.Is(err, inventory.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// queryTime parses an optional RFC 3339 query parameter.
+func queryTime(c *gin.Context, key string) (*time.Time, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return nil, nil
+	}
+	value, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
@@ -22,6 +23,11 @@ type InvoiceViewFormat struct {
 	Payment_Status   *string
 	Payment_due      interface{}
 	Table_number     interface{}
+	Table_numbers    []int `json:",omitempty"`
+	Order_type       string
+	Delivery_fee     *float64 `json:",omitempty"`
+	Customer_id      *string  `json:",omitempty"`
+	Customer_name    *string  `json:",omitempty"`
 	Payment_due_date time.Time
 	Order_details    interface{}
 }
@@ -30,6 +36,11 @@ var invoiceCollection *mongo.Collection = database.OpenCollection(
 	database.Client,
 	"invoice")
 
+// errPaidByPayments is returned when an invoice is marked COMPLETE by hand;
+// only the payments that cover it settle it.
+var errPaidByPayments = errors.New("an invoice is completed by taking " +
+	"payments against it")
+
 func GetInvoice() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(),
@@ -56,9 +67,36 @@ func GetInvoice() gin.HandlerFunc {
 		}
 		invoiceView.Invoice_id = invoice.Invoice_ID
 		invoiceView.Payment_Status = *&invoice.Payment_Status
-		invoiceView.Payment_due = allOrderItems[0]["payment_due"]
-		invoiceView.Table_number = allOrderItems[0]["table_number"]
-		invoiceView.Order_details = allOrderItems[0]["order_details"]
+		if err == nil && len(allOrderItems) > 0 {
+			invoiceView.Table_number = allOrderItems[0]["table_number"]
+			invoiceView.Order_details = allOrderItems[0]["order_details"]
+		}
+		// what is due is what a payment is checked against
+		owed, _, err := invoiceBalance(ctx, invoice)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while working out the balance"})
+			return
+		}
+		invoiceView.Payment_due = owed
+		if invoice.Customer_id != nil {
+			invoiceView.Customer_id = invoice.Customer_id
+			if customer, err := findCustomer(ctx,
+				*invoice.Customer_id); err == nil {
+				invoiceView.Customer_name = customer.Name
+			}
+		}
+		var order models.Order
+		if err := orderCollection.FindOne(ctx, bson.M{"order_id": invoice.Order_ID}).
+			Decode(&order); err == nil {
+			// a party at pushed-together tables is billed for all of them
+			if order.Table_group_id != nil {
+				invoiceView.Table_numbers = groupTableNumbers(ctx,
+					*order.Table_group_id)
+			}
+			invoiceView.Order_type = orderType(order)
+			invoiceView.Delivery_fee = order.Delivery_fee
+		}
 
 		c.JSON(http.StatusOK, invoiceView)
 	}
@@ -105,10 +143,27 @@ func CreateInvoice() gin.HandlerFunc {
 				gin.H{"error": msg})
 			return
 		}
+		if invoice.Customer_id == nil {
+			invoice.Customer_id = order.Customer_id
+		} else {
+			invoice.Customer_id = optionalString(*invoice.Customer_id)
+		}
+		if invoice.Customer_id != nil {
+			if _, err := findCustomer(ctx, *invoice.Customer_id); err != nil {
+				c.JSON(http.StatusBadRequest,
+					gin.H{"error": errNoCustomer.Error()})
+				return
+			}
+		}
 		status := "PENDING"
 		if invoice.Payment_Status == nil {
 			invoice.Payment_Status = &status
 		}
+		if *invoice.Payment_Status == "COMPLETE" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errPaidByPayments.Error()})
+			return
+		}
+		invoice.Payments = 0
 		invoice.Payment_due_date, _ = time.Parse(time.RFC3339,
 			time.Now().AddDate(0, 0, 1).Format(time.RFC3339))
 		invoice.Created_at, _ = time.Parse(time.RFC3339,
@@ -120,16 +175,37 @@ func CreateInvoice() gin.HandlerFunc {
 
 		validationErr := validate.Struct(invoice)
 		if validationErr != nil {
-			c.JSON(http.StatusInternalServerError,
+			c.JSON(http.StatusBadRequest,
 				gin.H{"error": validationErr.Error()})
 			return
 		}
-		result, err := invoiceCollection.InsertOne(ctx, invoice)
+		// touching the order makes a merge of it at the same time retry
+		// and find the invoice
+		var result *mongo.InsertOneResult
+		err = inTransaction(ctx, func(sc mongo.SessionContext) error {
+			touched, err := orderCollection.UpdateOne(sc, bson.M{
+				"order_id":    invoice.Order_ID,
+				"merged_into": nil,
+			}, bson.M{"$set": bson.M{"updated_at": invoice.Created_at}})
+			if err != nil {
+				return err
+			}
+			if touched.MatchedCount == 0 {
+				return errOrderMerged
+			}
+			result, err = invoiceCollection.InsertOne(sc, invoice)
+			return err
+		})
+		if errors.Is(err, errOrderMerged) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError,
 				gin.H{"error": "Invoice item was not created"})
 			return
 		}
+		refreshOrderTable(ctx, invoice.Order_ID)
 		defer cancel()
 
 		c.JSON(http.StatusOK, result)
@@ -149,6 +225,25 @@ func UpdateInvoice() gin.HandlerFunc {
 				gin.H{"error": err.Error()})
 			return
 		}
+		var fields []string
+		if invoice.Payment_Method != nil {
+			fields = append(fields, "Payment_Method")
+		}
+		if invoice.Payment_Status != nil {
+			fields = append(fields, "Payment_Status")
+		}
+		if validationErr := validate.StructPartial(invoice,
+			fields...); validationErr != nil {
+			defer cancel()
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		if derefString(invoice.Payment_Status) == "COMPLETE" {
+			defer cancel()
+			c.JSON(http.StatusBadRequest, gin.H{"error": errPaidByPayments.Error()})
+			return
+		}
 		filter := bson.M{"invoice_id": invoiceID}
 		var updateObj primitive.D
 
@@ -160,6 +255,20 @@ func UpdateInvoice() gin.HandlerFunc {
 			updateObj = append(updateObj, bson.E{"payment_status",
 				invoice.Payment_Status})
 		}
+		if invoice.Customer_id != nil {
+			// an empty customer_id says the invoice is for no one
+			customerID := optionalString(*invoice.Customer_id)
+			if customerID != nil {
+				if _, err := findCustomer(ctx, *customerID); err != nil {
+					defer cancel()
+					c.JSON(http.StatusBadRequest,
+						gin.H{"error": errNoCustomer.Error()})
+					return
+				}
+			}
+			updateObj = append(updateObj,
+				bson.E{Key: "customer_id", Value: customerID})
+		}
 		invoice.Updated_at, _ = time.Parse(time.RFC3339,
 			time.Now().Format(time.RFC3339))
 		updateObj = append(updateObj, bson.E{"updated_at",
@@ -169,10 +278,6 @@ func UpdateInvoice() gin.HandlerFunc {
 		opt := options.UpdateOptions{
 			Upsert: &upsert,
 		}
-		status := "PENDING"
-		if invoice.Payment_Status == nil {
-			invoice.Payment_Status = &status
-		}
 		result, err := invoiceCollection.UpdateOne(ctx, filter,
 			bson.D{{"$set",
 				updateObj}}, &opt)
@@ -183,6 +288,11 @@ func UpdateInvoice() gin.HandlerFunc {
 				gin.H{"error": msg})
 			return
 		}
+		var updated models.Invoice
+		if err := invoiceCollection.FindOne(ctx,
+			filter).Decode(&updated); err == nil {
+			refreshOrderTable(ctx, updated.Order_ID)
+		}
 		defer cancel()
 		c.JSON(http.StatusOK, result)
 	}
@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"restro/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type kitchenItem struct {
+	Order_item_id  string     `json:"order_item_id"`
+	Food_id        string     `json:"food_id"`
+	Food_name      string     `json:"food_name"`
+	Size           string     `json:"size"`
+	Modifiers      []string   `json:"modifiers"`
+	Status         string     `json:"status"`
+	Bundle_line_id *string    `json:"bundle_line_id,omitempty"`
+	Ordered_at     time.Time  `json:"ordered_at"`
+	Fired_at       *time.Time `json:"fired_at,omitempty"`
+}
+
+// kitchenTicket is an order's items to make. Takeaway and delivery tickets
+// say who they are for and when they were promised. Items of scheduled
+// orders only show once the order is released.
+type kitchenTicket struct {
+	Order_id      string        `json:"order_id"`
+	Order_type    string        `json:"order_type"`
+	Customer_name *string       `json:"customer_name,omitempty"`
+	Promised_at   *time.Time    `json:"promised_at,omitempty"`
+	Scheduled_for *time.Time    `json:"scheduled_for,omitempty"`
+	Items         []kitchenItem `json:"items"`
+}
+
+// GetKitchenQueue lists the pending and fired order items as one ticket per
+// order, oldest first, optionally only those of one order_type.
+func GetKitchenQueue() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+
+		result, err := orderItemCollection.Find(ctx,
+			bson.M{"status": bson.M{"$in": bson.A{
+				models.OrderItemPending, models.OrderItemFired}}},
+			options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the kitchen queue"})
+			return
+		}
+		var orderItems []models.OrderItem
+		if err = result.All(ctx, &orderItems); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the kitchen queue"})
+			return
+		}
+		tickets := kitchenTickets(ctx, orderItems)
+		if orderType := c.Query("order_type"); orderType != "" {
+			matching := []kitchenTicket{}
+			for _, ticket := range tickets {
+				if ticket.Order_type == orderType {
+					matching = append(matching, ticket)
+				}
+			}
+			tickets = matching
+		}
+		c.JSON(http.StatusOK, tickets)
+	}
+}
+
+func kitchenTickets(ctx context.Context, orderItems []models.OrderItem) []kitchenTicket {
+	var foodIDs, orderIDs []string
+	for _, orderItem := range orderItems {
+		foodIDs = append(foodIDs, derefString(orderItem.Food_id))
+		orderIDs = append(orderIDs, orderItem.Order_id)
+	}
+	foods, _ := foodsByID(ctx, foodIDs)
+	orders, _ := ordersByID(ctx, orderIDs)
+
+	tickets := []kitchenTicket{}
+	index := map[string]int{}
+	for _, orderItem := range orderItems {
+		i, ok := index[orderItem.Order_id]
+		if !ok {
+			i = len(tickets)
+			index[orderItem.Order_id] = i
+			order := orders[orderItem.Order_id]
+			tickets = append(tickets, kitchenTicket{
+				Order_id:      orderItem.Order_id,
+				Order_type:    orderType(order),
+				Customer_name: order.Customer_name,
+				Promised_at:   order.Promised_at,
+				Scheduled_for: order.Scheduled_for,
+			})
+		}
+		foodID := derefString(orderItem.Food_id)
+		tickets[i].Items = append(tickets[i].Items, kitchenItem{
+			Order_item_id:  orderItem.Order_item_id,
+			Food_id:        foodID,
+			Food_name:      derefString(foods[foodID].Name),
+			Size:           derefString(orderItem.Quantity),
+			Modifiers:      orderItem.Modifiers,
+			Status:         derefString(orderItem.Status),
+			Bundle_line_id: orderItem.Bundle_line_id,
+			Ordered_at:     orderItem.Created_at,
+			Fired_at:       orderItem.Fired_at,
+		})
+	}
+	return tickets
+}
+
+// ordersByID loads the orders with the given IDs.
+func ordersByID(ctx context.Context, ids []string) (map[string]models.Order, error) {
+	orders := map[string]models.Order{}
+	if len(ids) == 0 {
+		return orders, nil
+	}
+	result, err := orderCollection.Find(ctx,
+		bson.M{"order_id": bson.M{"$in": uniqueStrings(ids)}})
+	if err != nil {
+		return nil, err
+	}
+	var all []models.Order
+	if err = result.All(ctx, &all); err != nil {
+		return nil, err
+	}
+	for _, order := range all {
+		orders[order.Order_ID] = order
+	}
+	return orders, nil
+}
@@ -0,0 +1,1185 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"restro/billing"
+	"restro/database"
+	"restro/loyalty"
+	"restro/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var loyaltySettingsCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "loyaltySettings")
+var loyaltyMemberCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "loyaltyMember")
+var loyaltyEntryCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "loyaltyEntry")
+var loyaltyRewardCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "loyaltyReward")
+
+var (
+	errNotMember       = errors.New("the customer isn't a loyalty member")
+	errNotEnoughPoints = errors.New("the member doesn't have enough points")
+	errPointsChanged   = errors.New("the points changed at the same time, " +
+		"try again")
+	errLoyalty = errors.New("the points can't be used")
+)
+
+// loyaltyBalance is a member's points as they stand: what they are worth
+// as a tender, the tier they are in and the next one, and how many expire
+// in the next 30 days.
+type loyaltyBalance struct {
+	models.LoyaltyMember `bson:",inline"`
+	Name                 *string    `json:"name"`
+	Points_value         float64    `json:"points_value"`
+	Multiplier           float64    `json:"multiplier"`
+	Next_tier            *string    `json:"next_tier"`
+	Points_to_next_tier  *int       `json:"points_to_next_tier"`
+	Expiring_points      int        `json:"expiring_points"`
+	Next_expiry          *time.Time `json:"next_expiry"`
+}
+
+func GetLoyaltySettings() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		settings, err := loadLoyaltySettings(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while reading the settings"})
+			return
+		}
+		c.JSON(http.StatusOK, settings)
+	}
+}
+
+// UpdateLoyaltySettings replaces the earn rules, tiers, point value and
+// expiry. Points already earned keep their expiry, and members move tier
+// the next time they earn.
+func UpdateLoyaltySettings() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var settings models.LoyaltySettings
+
+		if err := c.BindJSON(&settings); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(settings); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		ruleIDs := map[string]bool{}
+		for _, rule := range settings.Earn_rules {
+			if ruleIDs[rule.Rule_id] {
+				c.JSON(http.StatusBadRequest,
+					gin.H{"error": "earn rule " + rule.Rule_id + " is there twice"})
+				return
+			}
+			ruleIDs[rule.Rule_id] = true
+		}
+		tierNames := map[string]bool{}
+		for _, tier := range settings.Tiers {
+			if tierNames[tier.Name] {
+				c.JSON(http.StatusBadRequest,
+					gin.H{"error": "tier " + tier.Name + " is there twice"})
+				return
+			}
+			tierNames[tier.Name] = true
+		}
+		settings.Settings_ID = "default"
+		settings.Updated_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		_, err := loyaltySettingsCollection.ReplaceOne(ctx,
+			bson.M{"settings_id": "default"}, settings,
+			options.Replace().SetUpsert(true))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "settings update failed"})
+			return
+		}
+		c.JSON(http.StatusOK, settings)
+	}
+}
+
+// EnrollLoyaltyMember enrolls a customer given by customer_id, or found by
+// phone or email. A customer who isn't known yet is created from the name,
+// phone and email given.
+func EnrollLoyaltyMember() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var request struct {
+			Customer_id *string `json:"customer_id"`
+			models.Customer
+		}
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		customer, err := enrollingCustomer(ctx, request.Customer_id,
+			request.Customer)
+		if err != nil {
+			customerError(c, err)
+			return
+		}
+		settings, err := loadLoyaltySettings(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while reading the settings"})
+			return
+		}
+
+		member := models.LoyaltyMember{Customer_id: customer.Customer_id}
+		member.Enrolled_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		member.Updated_at = member.Enrolled_at
+		if tier, ok := loyalty.TierFor(settings.Tiers, 0); ok {
+			member.Tier = tier.Name
+		}
+		if _, err := loyaltyMemberCollection.InsertOne(ctx, member); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				c.JSON(http.StatusConflict,
+					gin.H{"error": "the customer is already a member"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "member was not enrolled"})
+			return
+		}
+		balance, err := memberBalance(ctx, settings, member)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while reading the balance"})
+			return
+		}
+		c.JSON(http.StatusOK, balance)
+	}
+}
+
+// GetLoyaltyMembers lists the members, with the most points first, or
+// looks one up by ?phone= or ?email=.
+func GetLoyaltyMembers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		filter := bson.M{}
+		if c.Query("phone") != "" || c.Query("email") != "" {
+			customerFilter := bson.M{}
+			if phone := c.Query("phone"); phone != "" {
+				customerFilter["phone"] = normalizePhone(phone)
+			}
+			if email := c.Query("email"); email != "" {
+				customerFilter["email"] = normalizeEmail(email)
+			}
+			customerIDs, err := customerCollection.Distinct(ctx,
+				"customer_id", customerFilter)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError,
+					gin.H{"error": "error occured while listing the members"})
+				return
+			}
+			filter["_id"] = bson.M{"$in": customerIDs}
+		}
+		settings, err := loadLoyaltySettings(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while reading the settings"})
+			return
+		}
+		result, err := loyaltyMemberCollection.Find(ctx, filter,
+			options.Find().SetSort(bson.M{"points": -1}).SetLimit(100))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the members"})
+			return
+		}
+		members := []models.LoyaltyMember{}
+		if err = result.All(ctx, &members); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the members"})
+			return
+		}
+		balances := []loyaltyBalance{}
+		for _, member := range members {
+			balance, err := memberBalance(ctx, settings, member)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError,
+					gin.H{"error": "error occured while reading the balances"})
+				return
+			}
+			balances = append(balances, balance)
+		}
+		c.JSON(http.StatusOK, balances)
+	}
+}
+
+// GetLoyaltyMember gives a member's balance.
+func GetLoyaltyMember() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		member, err := findMember(ctx, c.Param("customer_id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any member with given ID"})
+			return
+		}
+		settings, err := loadLoyaltySettings(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while reading the settings"})
+			return
+		}
+		balance, err := memberBalance(ctx, settings, member)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while reading the balance"})
+			return
+		}
+		c.JSON(http.StatusOK, balance)
+	}
+}
+
+// GetLoyaltyLedger lists the changes to a member's points, newest first.
+func GetLoyaltyLedger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		result, err := loyaltyEntryCollection.Find(ctx,
+			bson.M{"customer_id": c.Param("customer_id")},
+			options.Find().SetSort(bson.D{{Key: "created_at", Value: -1},
+				{Key: "_id", Value: -1}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the ledger"})
+			return
+		}
+		entries := []models.LoyaltyEntry{}
+		if err = result.All(ctx, &entries); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the ledger"})
+			return
+		}
+		c.JSON(http.StatusOK, entries)
+	}
+}
+
+// AdjustLoyaltyPoints gives a member points, or takes them away given a
+// negative number, for the reason given. Points can't be taken below
+// zero.
+func AdjustLoyaltyPoints() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var request struct {
+			Points int    `json:"points" validate:"required,ne=0"`
+			Reason string `json:"reason" validate:"required,max=500"`
+		}
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		settings, err := loadLoyaltySettings(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while reading the settings"})
+			return
+		}
+		entry := models.LoyaltyEntry{
+			Customer_id: c.Param("customer_id"),
+			Kind:        models.LoyaltyAdjust,
+			Points:      request.Points,
+			Reason:      request.Reason,
+			Created_by:  c.GetString("uid"),
+		}
+		if err := inTransaction(ctx, func(sc mongo.SessionContext) error {
+			return movePoints(sc, settings, &entry, true)
+		}); err != nil {
+			loyaltyError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, entry)
+	}
+}
+
+// GetLoyaltyRewards lists the rewards, only those members can have now
+// given ?active=true.
+func GetLoyaltyRewards() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		filter := bson.M{}
+		if c.Query("active") == "true" {
+			filter["active"] = true
+		}
+		result, err := loyaltyRewardCollection.Find(ctx, filter,
+			options.Find().SetSort(bson.M{"points_cost": 1}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the rewards"})
+			return
+		}
+		rewards := []models.LoyaltyReward{}
+		if err = result.All(ctx, &rewards); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the rewards"})
+			return
+		}
+		c.JSON(http.StatusOK, rewards)
+	}
+}
+
+// CreateLoyaltyReward offers a food for points, in size M and active
+// unless said otherwise.
+func CreateLoyaltyReward() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var reward models.LoyaltyReward
+
+		if err := c.BindJSON(&reward); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if reward.Size == nil {
+			size := "M"
+			reward.Size = &size
+		}
+		if reward.Active == nil {
+			active := true
+			reward.Active = &active
+		}
+		if validationErr := validate.Struct(reward); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		var food models.Food
+		if err := foodCollection.FindOne(ctx,
+			bson.M{"food_id": *reward.Food_id}).Decode(&food); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "food was not found"})
+			return
+		}
+		reward.ID = primitive.NewObjectID()
+		reward.Reward_id = reward.ID.Hex()
+		reward.Created_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		reward.Updated_at = reward.Created_at
+
+		if _, err := loyaltyRewardCollection.InsertOne(ctx, reward); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "reward was not created"})
+			return
+		}
+		c.JSON(http.StatusOK, reward)
+	}
+}
+
+// UpdateLoyaltyReward changes a reward's name, size, cost or whether it is
+// active.
+func UpdateLoyaltyReward() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var update models.LoyaltyReward
+		rewardID := c.Param("reward_id")
+
+		if err := c.BindJSON(&update); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var reward models.LoyaltyReward
+		if err := loyaltyRewardCollection.FindOne(ctx,
+			bson.M{"reward_id": rewardID}).Decode(&reward); err != nil {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any reward with given ID"})
+			return
+		}
+		if update.Name != nil {
+			reward.Name = update.Name
+		}
+		if update.Size != nil {
+			reward.Size = update.Size
+		}
+		if update.Points_cost != nil {
+			reward.Points_cost = update.Points_cost
+		}
+		if update.Active != nil {
+			reward.Active = update.Active
+		}
+		if validationErr := validate.Struct(reward); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		reward.Updated_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+
+		if _, err := loyaltyRewardCollection.ReplaceOne(ctx,
+			bson.M{"reward_id": rewardID}, reward); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "reward update failed"})
+			return
+		}
+		c.JSON(http.StatusOK, reward)
+	}
+}
+
+// RedeemLoyaltyReward puts a reward on an open order of the member's at no
+// charge, spending its points. An order for no customer becomes the
+// member's. Voiding the item gives the points back.
+func RedeemLoyaltyReward() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var request struct {
+			Order_id string `json:"order_id" validate:"required"`
+		}
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		customerID := c.Param("customer_id")
+		var reward models.LoyaltyReward
+		if err := loyaltyRewardCollection.FindOne(ctx,
+			bson.M{"reward_id": c.Param("reward_id")}).Decode(&reward); err != nil {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any reward with given ID"})
+			return
+		}
+		if !*reward.Active {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": "the reward isn't offered now"})
+			return
+		}
+		order, err := findOrder(ctx, request.Order_id)
+		if err != nil {
+			orderMoveError(c, err)
+			return
+		}
+		if order.Closed_at != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": errOrderNotOpen.Error()})
+			return
+		}
+		if order.Customer_id != nil && *order.Customer_id != customerID {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": "the order is for another customer"})
+			return
+		}
+		settings, err := loadLoyaltySettings(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while reading the settings"})
+			return
+		}
+
+		items, err := buildOrderItems(ctx, order.Order_ID, []models.OrderItem{{
+			Food_id:  reward.Food_id,
+			Quantity: reward.Size,
+		}}, nil)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		orderItem := items[0].(models.OrderItem)
+		free := 0.0
+		orderItem.Unit_price = &free
+		orderItem.Reward_id = &reward.Reward_id
+		if order.Scheduled_for != nil && order.Released_at == nil {
+			// held back with the rest of the order
+			status := models.OrderItemScheduled
+			orderItem.Status = &status
+		}
+		entry := models.LoyaltyEntry{
+			// found by the item when it is voided
+			ID:          "redeem:" + orderItem.Order_item_id,
+			Customer_id: customerID,
+			Kind:        models.LoyaltyRedeem,
+			Points:      -*reward.Points_cost,
+			Order_id:    &order.Order_ID,
+			Reward_id:   &reward.Reward_id,
+			Reason:      derefString(reward.Name),
+			Created_by:  c.GetString("uid"),
+		}
+		err = inTransaction(ctx, func(sc mongo.SessionContext) error {
+			if order.Customer_id == nil {
+				if _, err := orderCollection.UpdateOne(sc, bson.M{
+					"order_id":    order.Order_ID,
+					"customer_id": nil,
+				}, bson.M{"$set": bson.M{"customer_id": customerID}}); err != nil {
+					return err
+				}
+			}
+			if _, err := orderItemCollection.InsertOne(sc, orderItem); err != nil {
+				return err
+			}
+			return movePoints(sc, settings, &entry, true)
+		})
+		if err != nil {
+			loyaltyError(c, err)
+			return
+		}
+		if order.Table_ID != nil {
+			refreshTableStatus(ctx, *order.Table_ID)
+		}
+		c.JSON(http.StatusOK, gin.H{"order_item": orderItem, "entry": entry})
+	}
+}
+
+// RunLoyaltyExpiry expires points as they reach their expiry. It blocks,
+// so start it in its own goroutine.
+func RunLoyaltyExpiry(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		if err := ExpireLoyaltyPoints(ctx); err != nil {
+			log.Println("couldn't expire loyalty points:", err)
+		}
+		cancel()
+	}
+}
+
+// ExpireLoyaltyPoints takes away what is left of the points that have
+// reached their expiry. A lot spent from at the same time is left for the
+// next run.
+func ExpireLoyaltyPoints(ctx context.Context) error {
+	settings, err := loadLoyaltySettings(ctx)
+	if err != nil {
+		return err
+	}
+	result, err := loyaltyEntryCollection.Find(ctx, bson.M{
+		"remaining":  bson.M{"$gt": 0},
+		"expires_at": bson.M{"$lte": time.Now()},
+	})
+	if err != nil {
+		return err
+	}
+	var lots []models.LoyaltyEntry
+	if err = result.All(ctx, &lots); err != nil {
+		return err
+	}
+	for _, lot := range lots {
+		lot := lot
+		err := inTransaction(ctx, func(sc mongo.SessionContext) error {
+			claim, err := loyaltyEntryCollection.UpdateOne(sc, bson.M{
+				"_id":       lot.ID,
+				"remaining": lot.Remaining,
+			}, bson.M{"$set": bson.M{"remaining": 0}})
+			if err != nil || claim.MatchedCount == 0 {
+				return err
+			}
+			entry := models.LoyaltyEntry{
+				Customer_id: lot.Customer_id,
+				Kind:        models.LoyaltyExpire,
+				Points:      -lot.Remaining,
+				Reverses:    &lot.ID,
+			}
+			return movePoints(sc, settings, &entry, false)
+		})
+		if err != nil && !errors.Is(err, errNotMember) {
+			log.Println("couldn't expire loyalty points", lot.ID, err)
+		}
+	}
+	return nil
+}
+
+// RunLoyaltyEarning earns the points of paid invoices that haven't
+// earned them, such as when earnLoyaltyPoints failed. It blocks, so start
+// it in its own goroutine.
+func RunLoyaltyEarning(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		if err := EarnMissedLoyaltyPoints(ctx); err != nil {
+			log.Println("couldn't earn missed loyalty points:", err)
+		}
+		cancel()
+	}
+}
+
+// missedEarningWindow is how far back EarnMissedLoyaltyPoints looks for
+// payments that paid for invoices without earning.
+const missedEarningWindow = 7 * 24 * time.Hour
+
+// EarnMissedLoyaltyPoints earns the points of the invoices of members paid
+// for by payments taken in the last week that have no earn entry. Invoices
+// that earn nothing are looked at again each run until their payments are
+// out of the window.
+func EarnMissedLoyaltyPoints(ctx context.Context) error {
+	invoices, err := paidInvoices(ctx, time.Now().Add(-missedEarningWindow),
+		bson.M{"customer_id": bson.M{"$ne": nil}})
+	if err != nil {
+		return err
+	}
+	for _, invoice := range invoices {
+		earned, err := loyaltyEntryCollection.CountDocuments(ctx,
+			bson.M{"_id": "earn:" + invoice.Invoice_ID})
+		if err != nil {
+			return err
+		}
+		if earned > 0 {
+			continue
+		}
+		err = earnInvoicePoints(ctx, invoice)
+		if err != nil && !errors.Is(err, errNotMember) &&
+			!mongo.IsDuplicateKeyError(err) {
+			log.Println("couldn't earn loyalty points on invoice",
+				invoice.Invoice_ID, err)
+		}
+	}
+	return nil
+}
+
+// earnLoyaltyPoints gives the member an order's invoice is for the points it
+// earns, once the payments taken against it cover it. It runs on its own,
+// after the invoice is settled; RunLoyaltyEarning catches up on any that
+// fail.
+func earnLoyaltyPoints(orderID string) {
+	var ctx, cancel = context.WithTimeout(context.Background(),
+		30*time.Second)
+	defer cancel()
+	var invoice models.Invoice
+	if err := invoiceCollection.FindOne(ctx, bson.M{
+		"order_id":    orderID,
+		"customer_id": bson.M{"$ne": nil},
+	}).Decode(&invoice); err != nil {
+		return
+	}
+	owed, paid, err := invoiceBalance(ctx, invoice)
+	if err != nil || !billing.Settled(owed, paid) {
+		return
+	}
+	err = earnInvoicePoints(ctx, invoice)
+	if err != nil && !errors.Is(err, errNotMember) &&
+		!mongo.IsDuplicateKeyError(err) {
+		log.Println("couldn't earn loyalty points on invoice",
+			invoice.Invoice_ID, err)
+	}
+}
+
+// earnInvoicePoints works out the points a paid invoice earns under the
+// earn rules and the member's tier, on what its items came to less what
+// was paid with points. An invoice earns once.
+func earnInvoicePoints(ctx context.Context, invoice models.Invoice) error {
+	member, err := findMember(ctx, *invoice.Customer_id)
+	if err != nil {
+		return errNotMember
+	}
+	settings, err := loadLoyaltySettings(ctx)
+	if err != nil {
+		return err
+	}
+	order, err := findOrder(ctx, invoice.Order_ID)
+	if err != nil {
+		return err
+	}
+	result, err := orderItemCollection.Find(ctx, bson.M{
+		"order_id": invoice.Order_ID,
+		"status":   bson.M{"$ne": models.OrderItemVoid},
+	})
+	if err != nil {
+		return err
+	}
+	var orderItems []models.OrderItem
+	if err = result.All(ctx, &orderItems); err != nil {
+		return err
+	}
+	lines := []loyalty.Line{}
+	total := 0.0
+	for _, item := range orderItems {
+		if item.Gift_card_code != nil {
+			// points are earned when the card is spent
+			continue
+		}
+		var amount float64
+		if item.Unit_price != nil {
+			amount = *item.Unit_price
+		}
+		lines = append(lines, loyalty.Line{Food_id: derefString(item.Food_id),
+			Amount: amount})
+		total += amount
+	}
+	if total <= 0 {
+		return nil
+	}
+
+	result, err = paymentCollection.Find(ctx, bson.M{
+		"invoice_id": invoice.Invoice_ID,
+		"method":     models.PaymentMethodPoints,
+	})
+	if err != nil {
+		return err
+	}
+	var pointsPayments []models.Payment
+	if err = result.All(ctx, &pointsPayments); err != nil {
+		return err
+	}
+	pointsPaid := 0.0
+	for _, payment := range pointsPayments {
+		if payment.Kind == models.PaymentKindRefund {
+			pointsPaid -= *payment.Amount
+		} else {
+			pointsPaid += *payment.Amount
+		}
+	}
+
+	multiplier := 1.0
+	if tier, ok := loyalty.TierFor(settings.Tiers, member.Lifetime_points); ok {
+		multiplier = tier.Multiplier
+	}
+	points, spend := loyalty.Earn(settings.Earn_rules, orderType(order), lines,
+		(total-pointsPaid)/total, multiplier)
+	if points <= 0 {
+		return nil
+	}
+	entry := models.LoyaltyEntry{
+		ID:          "earn:" + invoice.Invoice_ID,
+		Customer_id: member.Customer_id,
+		Kind:        models.LoyaltyEarn,
+		Points:      points,
+		Spend:       &spend,
+		Invoice_id:  &invoice.Invoice_ID,
+		Order_id:    &invoice.Order_ID,
+	}
+	return inTransaction(ctx, func(sc mongo.SessionContext) error {
+		return movePoints(sc, settings, &entry, false)
+	})
+}
+
+// payWithPoints records a payment in the points of the member the invoice
+// is for, spending the points in the same transaction.
+func payWithPoints(ctx context.Context, invoice models.Invoice,
+	payment models.Payment) error {
+	if invoice.Customer_id == nil {
+		return errNotMember
+	}
+	settings, err := loadLoyaltySettings(ctx)
+	if err != nil {
+		return err
+	}
+	if settings.Point_value <= 0 {
+		return fmt.Errorf("%w: points don't pay for invoices", errLoyalty)
+	}
+	entry := models.LoyaltyEntry{
+		Customer_id: *invoice.Customer_id,
+		Kind:        models.LoyaltyRedeem,
+		Points:      -loyalty.PointsFor(*payment.Amount, settings.Point_value),
+		Invoice_id:  &invoice.Invoice_ID,
+		Payment_id:  &payment.Payment_ID,
+		Order_id:    &invoice.Order_ID,
+		Created_by:  payment.Created_by,
+	}
+	return inTransaction(ctx, func(sc mongo.SessionContext) error {
+		if _, err := paymentCollection.InsertOne(sc, payment); err != nil {
+			return err
+		}
+		return movePoints(sc, settings, &entry, true)
+	})
+}
+
+// refundLoyaltyPoints undoes the points side of a refund, inside the
+// refund's transaction: points paid with are given back, and what the
+// invoice earned is taken back, in proportion to the refund. What has been
+// undone is counted on the entry undone, so refunds can't undo more than
+// it.
+func refundLoyaltyPoints(sc mongo.SessionContext, original,
+	refund models.Payment) error {
+	var source models.LoyaltyEntry
+	var whole float64
+	sign := -1
+	filter := bson.M{"_id": "earn:" + original.Invoice_ID}
+	if derefString(original.Method) == models.PaymentMethodPoints {
+		filter = bson.M{"kind": models.LoyaltyRedeem,
+			"payment_id": original.Payment_ID}
+		sign = 1
+	}
+	err := loyaltyEntryCollection.FindOne(sc, filter).Decode(&source)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	undone := source.Points
+	if undone < 0 {
+		undone = -undone
+	}
+	if sign > 0 {
+		whole = *original.Amount
+	} else if source.Spend != nil {
+		whole = *source.Spend
+	}
+	points := loyalty.Share(undone, *refund.Amount, whole)
+	if left := undone - source.Reversed; points > left {
+		points = left
+	}
+	if points <= 0 {
+		return nil
+	}
+	claim, err := loyaltyEntryCollection.UpdateOne(sc, bson.M{
+		"_id":      source.ID,
+		"reversed": source.Reversed,
+	}, bson.M{"$inc": bson.M{"reversed": points}})
+	if err != nil {
+		return err
+	}
+	if claim.MatchedCount == 0 {
+		return errPointsChanged
+	}
+
+	settings, err := loadLoyaltySettings(sc)
+	if err != nil {
+		return err
+	}
+	entry := models.LoyaltyEntry{
+		Customer_id: source.Customer_id,
+		Kind:        models.LoyaltyReverse,
+		Points:      sign * points,
+		Reverses:    &source.ID,
+		Invoice_id:  &refund.Invoice_ID,
+		Payment_id:  &refund.Payment_ID,
+		Order_id:    &refund.Order_ID,
+		Created_by:  refund.Created_by,
+	}
+	err = movePoints(sc, settings, &entry, false)
+	if errors.Is(err, errNotMember) {
+		return nil
+	}
+	return err
+}
+
+// returnRewardPoints gives back the points a reward item was had for,
+// inside the transaction that voids it.
+func returnRewardPoints(sc mongo.SessionContext, orderItem models.OrderItem,
+	by string) error {
+	if orderItem.Reward_id == nil {
+		return nil
+	}
+	var redeem models.LoyaltyEntry
+	err := loyaltyEntryCollection.FindOne(sc,
+		bson.M{"_id": "redeem:" + orderItem.Order_item_id}).Decode(&redeem)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	points := -redeem.Points - redeem.Reversed
+	if points <= 0 {
+		return nil
+	}
+	claim, err := loyaltyEntryCollection.UpdateOne(sc, bson.M{
+		"_id":      redeem.ID,
+		"reversed": redeem.Reversed,
+	}, bson.M{"$inc": bson.M{"reversed": points}})
+	if err != nil {
+		return err
+	}
+	if claim.MatchedCount == 0 {
+		return errPointsChanged
+	}
+
+	settings, err := loadLoyaltySettings(sc)
+	if err != nil {
+		return err
+	}
+	entry := models.LoyaltyEntry{
+		Customer_id: redeem.Customer_id,
+		Kind:        models.LoyaltyReverse,
+		Points:      points,
+		Reverses:    &redeem.ID,
+		Order_id:    &orderItem.Order_id,
+		Reward_id:   orderItem.Reward_id,
+		Created_by:  by,
+	}
+	err = movePoints(sc, settings, &entry, false)
+	if errors.Is(err, errNotMember) {
+		return nil
+	}
+	return err
+}
+
+// movePoints changes a member's points by entry.Points and records the
+// entry, inside the caller's transaction. Points added are a lot, less any
+// the member owed, that expires under the settings; points taken come out
+// of the lots, soonest expiring first, except when expiring a lot, which
+// the caller empties. With strict, taking more than the balance is refused
+// with errNotEnoughPoints; otherwise the balance can go below zero. Points
+// earned count towards the member's tier.
+func movePoints(sc mongo.SessionContext, settings models.LoyaltySettings,
+	entry *models.LoyaltyEntry, strict bool) error {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	if entry.ID == "" {
+		entry.ID = primitive.NewObjectID().Hex()
+	}
+	entry.Created_at = now
+
+	filter := bson.M{"_id": entry.Customer_id}
+	if strict && entry.Points < 0 {
+		filter["points"] = bson.M{"$gte": -entry.Points}
+	}
+	inc := bson.M{"points": entry.Points}
+	if entry.Kind == models.LoyaltyEarn {
+		inc["lifetime_points"] = entry.Points
+	}
+	var member models.LoyaltyMember
+	err := loyaltyMemberCollection.FindOneAndUpdate(sc, filter, bson.M{
+		"$inc": inc,
+		"$set": bson.M{"updated_at": now},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).
+		Decode(&member)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if _, err := findMember(sc, entry.Customer_id); err != nil {
+			return errNotMember
+		}
+		return errNotEnoughPoints
+	}
+	if err != nil {
+		return err
+	}
+	entry.Balance = member.Points
+
+	if entry.Points > 0 {
+		// points that pay off a balance below zero aren't left to spend
+		entry.Remaining = entry.Points
+		if member.Points < entry.Points {
+			entry.Remaining = member.Points
+		}
+		if entry.Remaining < 0 {
+			entry.Remaining = 0
+		}
+		if settings.Expiry_months > 0 {
+			expires := now.AddDate(0, settings.Expiry_months, 0)
+			entry.Expires_at = &expires
+		}
+	} else if entry.Kind != models.LoyaltyExpire {
+		if err := takeFromLots(sc, entry.Customer_id, -entry.Points); err != nil {
+			return err
+		}
+	}
+
+	if entry.Kind == models.LoyaltyEarn {
+		if tier, ok := loyalty.TierFor(settings.Tiers,
+			member.Lifetime_points); ok && tier.Name != member.Tier {
+			if _, err := loyaltyMemberCollection.UpdateOne(sc,
+				bson.M{"_id": member.Customer_id},
+				bson.M{"$set": bson.M{"tier": tier.Name}}); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = loyaltyEntryCollection.InsertOne(sc, entry)
+	return err
+}
+
+// takeFromLots spends points from a member's lots, soonest expiring first.
+// Points the lots fall short by were already spent from a balance below
+// zero.
+func takeFromLots(sc mongo.SessionContext, customerID string, points int) error {
+	result, err := loyaltyEntryCollection.Find(sc, bson.M{
+		"customer_id": customerID,
+		"remaining":   bson.M{"$gt": 0},
+	})
+	if err != nil {
+		return err
+	}
+	var entries []models.LoyaltyEntry
+	if err = result.All(sc, &entries); err != nil {
+		return err
+	}
+	lots := []loyalty.Lot{}
+	for _, entry := range entries {
+		lots = append(lots, loyalty.Lot{ID: entry.ID,
+			Remaining: entry.Remaining, Expires_at: entry.Expires_at})
+	}
+	taken, _ := loyalty.Take(lots, points)
+	for _, lot := range taken {
+		result, err := loyaltyEntryCollection.UpdateOne(sc, bson.M{
+			"_id":       lot.ID,
+			"remaining": bson.M{"$gte": lot.Remaining},
+		}, bson.M{"$inc": bson.M{"remaining": -lot.Remaining}})
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return errPointsChanged
+		}
+	}
+	return nil
+}
+
+// loadLoyaltySettings loads the loyalty settings, earning a point for each
+// 1.00 spent, each worth 0.01 and expiring after a year, until they are
+// set.
+func loadLoyaltySettings(ctx context.Context) (models.LoyaltySettings, error) {
+	var settings models.LoyaltySettings
+	err := loyaltySettingsCollection.FindOne(ctx,
+		bson.M{"settings_id": "default"}).Decode(&settings)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.LoyaltySettings{
+			Earn_rules: []models.EarnRule{{Rule_id: "base",
+				Name: "Points on spend", Points_per_unit: 1}},
+			Tiers:         []models.LoyaltyTier{},
+			Point_value:   0.01,
+			Expiry_months: 12,
+			Settings_ID:   "default",
+		}, nil
+	}
+	return settings, err
+}
+
+func findMember(ctx context.Context, customerID string) (models.LoyaltyMember, error) {
+	var member models.LoyaltyMember
+	err := loyaltyMemberCollection.FindOne(ctx,
+		bson.M{"_id": customerID}).Decode(&member)
+	return member, err
+}
+
+// enrollingCustomer is the customer given by ID, or the one with the phone
+// or email given, created when there is none.
+func enrollingCustomer(ctx context.Context, customerID *string,
+	customer models.Customer) (models.Customer, error) {
+	if customerID != nil {
+		found, err := findCustomer(ctx, *customerID)
+		if err != nil {
+			return found, errNoCustomer
+		}
+		return found, nil
+	}
+	contacts := bson.A{}
+	if customer.Phone != nil && normalizePhone(*customer.Phone) != "" {
+		contacts = append(contacts,
+			bson.M{"phone": normalizePhone(*customer.Phone)})
+	}
+	if customer.Email != nil && normalizeEmail(*customer.Email) != "" {
+		contacts = append(contacts,
+			bson.M{"email": normalizeEmail(*customer.Email)})
+	}
+	if len(contacts) == 0 {
+		return customer, errCustomerContact
+	}
+	var found models.Customer
+	err := customerCollection.FindOne(ctx,
+		bson.M{"$or": contacts}).Decode(&found)
+	if err == nil {
+		return found, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return found, err
+	}
+
+	customer.ID = primitive.NewObjectID()
+	customer.Customer_id = customer.ID.Hex()
+	customer.Created_at, _ = time.Parse(time.RFC3339,
+		time.Now().Format(time.RFC3339))
+	customer.Updated_at = customer.Created_at
+	customer.Consent_updated_at = nil
+	if customer.Marketing_consent != nil {
+		customer.Consent_updated_at = &customer.Created_at
+	}
+	if err := checkCustomer(ctx, &customer); err != nil {
+		return customer, err
+	}
+	_, err = customerCollection.InsertOne(ctx, customer)
+	if mongo.IsDuplicateKeyError(err) {
+		// saved at the same time by another request
+		err = customerCollection.FindOne(ctx,
+			bson.M{"$or": contacts}).Decode(&found)
+		return found, err
+	}
+	return customer, err
+}
+
+// memberBalance is a member's points as they stand.
+func memberBalance(ctx context.Context, settings models.LoyaltySettings,
+	member models.LoyaltyMember) (loyaltyBalance, error) {
+	balance := loyaltyBalance{LoyaltyMember: member, Multiplier: 1}
+	if customer, err := findCustomer(ctx, member.Customer_id); err == nil {
+		balance.Name = customer.Name
+	}
+	if member.Points > 0 {
+		balance.Points_value = toFixed(
+			float64(member.Points)*settings.Point_value, 2)
+	}
+	if tier, ok := loyalty.TierFor(settings.Tiers,
+		member.Lifetime_points); ok {
+		balance.Multiplier = tier.Multiplier
+	}
+	if next, ok := loyalty.NextTier(settings.Tiers,
+		member.Lifetime_points); ok {
+		toNext := next.Min_points - member.Lifetime_points
+		balance.Next_tier = &next.Name
+		balance.Points_to_next_tier = &toNext
+	}
+
+	result, err := loyaltyEntryCollection.Find(ctx, bson.M{
+		"customer_id": member.Customer_id,
+		"remaining":   bson.M{"$gt": 0},
+		"expires_at":  bson.M{"$lte": time.Now().AddDate(0, 0, 30)},
+	}, options.Find().SetSort(bson.M{"expires_at": 1}))
+	if err != nil {
+		return balance, err
+	}
+	var lots []models.LoyaltyEntry
+	if err = result.All(ctx, &lots); err != nil {
+		return balance, err
+	}
+	for _, lot := range lots {
+		balance.Expiring_points += lot.Remaining
+		if balance.Next_expiry == nil {
+			balance.Next_expiry = lot.Expires_at
+		}
+	}
+	return balance, nil
+}
+
+func loyaltyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errNotMember):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, errLoyalty):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errNotEnoughPoints), errors.Is(err, errPointsChanged):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError,
+			gin.H{"error": "the points couldn't be updated"})
+	}
+}
@@ -17,11 +17,14 @@ func GetMenu() gin.HandlerFunc {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		menuId := c.Param("menu_id")
 		var menu models.Menu
-		err := foodCollection.FindOne(ctx, bson.M{"menu_id": menuId}).Decode(&menu)
+		err := menuCollection.FindOne(ctx, bson.M{"menu_id": menuId}).Decode(&menu)
 		defer cancel()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occured while fetching the menu item"})
+			return
 		}
+		localizeMenu(&menu, requestLocales(c))
+		c.Header("Content-Language", menu.Locale)
 		c.JSON(http.StatusOK, menu)
 	}
 }
@@ -38,6 +41,11 @@ func GetMenus() gin.HandlerFunc {
 		if err = result.All(ctx, &allMenus); err != nil {
 			log.Fatal(err)
 		}
+		locales := requestLocales(c)
+		for _, menu := range allMenus {
+			localizeDocument(menu, locales)
+		}
+		c.Header("Content-Language", locales[0])
 		c.JSON(http.StatusOK, allMenus)
 	}
 }
@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"restro/database"
+	"restro/inventory"
+	"restro/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var notificationCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "notification")
+
+// mongoNotifier publishes to the notification collection.
+type mongoNotifier struct{}
+
+func (mongoNotifier) Notify(ctx context.Context, notification models.Notification) error {
+	_, err := notificationCollection.InsertOne(ctx, notification)
+	return err
+}
+
+// mongoMenu gives the stock evaluator access to the food collection.
+type mongoMenu struct{}
+
+func (mongoMenu) Foods(ctx context.Context) ([]models.Food, error) {
+	result, err := foodCollection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var foods []models.Food
+	err = result.All(ctx, &foods)
+	return foods, err
+}
+
+func (mongoMenu) SetAvailability(ctx context.Context, foodID string,
+	available, auto bool) error {
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	_, err := foodCollection.UpdateOne(ctx, bson.M{"food_id": foodID},
+		bson.M{"$set": bson.M{
+			"available":     available,
+			"auto_sold_out": auto,
+			"updated_at":    updated_at,
+		}, "$unset": bson.M{"stock_override": ""}})
+	return err
+}
+
+var stockEvaluator = inventory.NewEvaluator(inventoryService.Store(),
+	mongoMenu{}, mongoNotifier{})
+
+// RunStockEvaluator checks stock levels every interval and after every stock
+// movement made through the API. It blocks, so start it in its own
+// goroutine.
+func RunStockEvaluator(interval time.Duration) {
+	stockEvaluator.Run(interval)
+}
+
+// GetNotifications returns the newest notifications first; ?unread=true
+// leaves out the ones already read.
+func GetNotifications() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+
+		limit, err := strconv.Atoi(c.Query("limit"))
+		if err != nil || limit < 1 {
+			limit = 50
+		}
+		filter := bson.M{}
+		if c.Query("unread") == "true" {
+			filter["read"] = false
+		}
+		if kind := c.Query("type"); kind != "" {
+			filter["type"] = kind
+		}
+		opts := options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}}).
+			SetLimit(int64(limit))
+		result, err := notificationCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the notifications"})
+			return
+		}
+		notifications := []models.Notification{}
+		if err = result.All(ctx, &notifications); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the notifications"})
+			return
+		}
+		c.JSON(http.StatusOK, notifications)
+	}
+}
+
+func MarkNotificationRead() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		result, err := notificationCollection.UpdateOne(ctx,
+			bson.M{"notification_id": c.Param("notification_id")},
+			bson.M{"$set": bson.M{"read": true}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "notification update failed"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any notification with given ID"})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
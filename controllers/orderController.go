@@ -6,7 +6,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo"
 	"log"
 	"net/http"
 	"restro/database"
@@ -22,7 +22,11 @@ var tableCollection = database.OpenCollection(database.Client,
 func GetOrders() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-		result, err := orderCollection.Find(context.TODO(), bson.M{})
+		filter := bson.M{}
+		if orderType := c.Query("order_type"); orderType != "" {
+			filter["order_type"] = orderTypeFilter(orderType)
+		}
+		result, err := orderCollection.Find(context.TODO(), filter)
 		defer cancel()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError,
@@ -68,6 +72,16 @@ func CreateOrder() gin.HandlerFunc {
 			return
 		}
 
+		if err := attachCustomer(ctx, &order); err != nil {
+			defer cancel()
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := checkOrderType(ctx, &order); err != nil {
+			defer cancel()
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		validationErr := validate.Struct(order)
 		if validationErr != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
@@ -94,73 +108,202 @@ func CreateOrder() gin.HandlerFunc {
 
 		order.ID = primitive.NewObjectID()
 		order.Order_ID = order.ID.Hex()
+		order.Created_by = c.GetString("uid")
+		order.Server_transfers = nil
+		order.Closed_at = nil
+		order.Table_group_id = nil
+		resolveOrderTable(ctx, &order)
+		if err := assignServer(ctx, &order); err != nil {
+			defer cancel()
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if _, err := scheduleOrder(ctx, &order, nil); err != nil {
+			defer cancel()
+			scheduleError(c, err)
+			return
+		}
 
 		result, insertErr := orderCollection.InsertOne(ctx, order)
 
 		if insertErr != nil {
+			unscheduleOrder(ctx, order)
 			c.JSON(http.StatusInternalServerError,
 				gin.H{"error": "Order item was not created"})
 			return
 		}
+		if order.Table_ID != nil {
+			refreshTableStatus(ctx, *order.Table_ID)
+		}
 
 		defer cancel()
 		c.JSON(http.StatusOK, result)
 	}
 }
 
+// UpdateOrder changes the guest count of an order, the customer it is for
+// (an empty customer_id detaches them), who a takeaway or delivery order
+// is for and when it is promised or scheduled for, and moves it to another
+// table given a table_id, the same audited way as MoveOrder. Nothing is
+// changed unless all of it can be.
 func UpdateOrder() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var table models.Table
-		var order models.Order
+		var update models.Order
 
 		var ctx, cancel = context.WithTimeout(context.Background(),
 			100*time.Second)
+		defer cancel()
 
 		var orderID string = c.Param("order_id")
-		if err := c.BindJSON(&order); err != nil {
-			c.JSON(http.StatusInternalServerError,
-				gin.H{"error": "Couldn't find any order"})
+		if err := c.BindJSON(&update); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		order, err := findOrder(ctx, orderID)
+		if err != nil {
+			orderMoveError(c, err)
 			return
 		}
 
-		var updateObj primitive.D
-		if order.Table_ID != nil {
-			err := menuCollection.FindOne(ctx,
-				bson.M{"table_id": table.Table_ID}).Decode(&table)
+		changed := order
+		if update.Guests != nil {
+			if *update.Guests < 0 {
+				c.JSON(http.StatusBadRequest,
+					gin.H{"error": "guests can't be negative"})
+				return
+			}
+			changed.Guests = update.Guests
+		}
+		customerChanged := update.Customer_id != nil &&
+			*update.Customer_id != derefString(order.Customer_id)
+		if customerChanged {
+			changed.Customer_id = optionalString(*update.Customer_id)
+			if err := attachCustomer(ctx, &changed); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if update.Customer_name != nil {
+			changed.Customer_name = update.Customer_name
+		}
+		if update.Customer_phone != nil {
+			changed.Customer_phone = update.Customer_phone
+		}
+		if update.Delivery_address != nil {
+			// a new address is put in its own zone unless one is given
+			changed.Delivery_address = update.Delivery_address
+			if update.Delivery_zone_id == nil {
+				changed.Delivery_zone_id = nil
+				changed.Delivery_fee = nil
+			}
+		}
+		if update.Promised_at != nil {
+			changed.Promised_at = update.Promised_at
+		}
+		if update.Delivery_zone_id != nil {
+			// charge the new zone's fee unless one is given
+			changed.Delivery_zone_id = update.Delivery_zone_id
+			changed.Delivery_fee = nil
+		}
+		if update.Delivery_fee != nil {
+			changed.Delivery_fee = update.Delivery_fee
+		}
+		if update.Customer_name != nil || update.Customer_phone != nil ||
+			update.Delivery_address != nil || update.Promised_at != nil ||
+			update.Delivery_zone_id != nil || update.Delivery_fee != nil {
+			if err := checkOrderType(ctx, &changed); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		var rescheduled *models.Order
+		if update.Scheduled_for != nil && (order.Scheduled_for == nil ||
+			!update.Scheduled_for.Equal(*order.Scheduled_for)) {
+			planned, err := planReschedule(ctx, changed, *update.Scheduled_for)
 			if err != nil {
-				c.JSON(http.StatusInternalServerError,
-					gin.H{"error": "Table not found"})
-
+				scheduleError(c, err)
+				return
+			}
+			rescheduled = &planned
+		}
+		moved := update.Table_ID != nil &&
+			*update.Table_ID != derefString(order.Table_ID)
+		if moved {
+			if _, err := moveTarget(ctx, order, *update.Table_ID); err != nil {
+				orderMoveError(c, err)
+				return
 			}
-			updateObj = append(updateObj,
-				bson.E{"order", table.Table_ID})
-
 		}
-		order.Updated_at, _ = time.Parse(time.RFC3339,
-			time.Now().Format(time.RFC3339))
-		updateObj = append(updateObj, bson.E{"updated_at", order.Updated_at})
-
-		upsert := true
 
-		filter := bson.M{"order_id": orderID}
-		opt := options.UpdateOptions{
-			Upsert: &upsert,
+		// the slot is booked first, as it can still turn out to be full
+		if rescheduled != nil {
+			order, err = rescheduleOrder(ctx, order, *rescheduled)
+			if err != nil {
+				scheduleError(c, err)
+				return
+			}
+		}
+		if rescheduled != nil {
+			// worked out with the new time
+			changed.Promised_at = rescheduled.Promised_at
 		}
-		result, err := orderCollection.UpdateOne(ctx, filter,
-			bson.D{{"$st",
-				updateObj}}, &opt)
+		changed.Updated_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		err = inTransaction(ctx, func(sc mongo.SessionContext) error {
+			if _, err := orderCollection.UpdateOne(sc,
+				bson.M{"order_id": orderID},
+				bson.M{"$set": bson.M{
+					"guests":           changed.Guests,
+					"customer_id":      changed.Customer_id,
+					"order_type":       changed.Order_type,
+					"customer_name":    changed.Customer_name,
+					"customer_phone":   changed.Customer_phone,
+					"delivery_address": changed.Delivery_address,
+					"promised_at":      changed.Promised_at,
+					"delivery_zone_id": changed.Delivery_zone_id,
+					"delivery_fee":     changed.Delivery_fee,
+					"updated_at":       changed.Updated_at,
+				}}); err != nil {
+				return err
+			}
+			if !customerChanged {
+				return nil
+			}
+			_, err := invoiceCollection.UpdateMany(sc,
+				bson.M{"order_id": orderID},
+				bson.M{"$set": bson.M{"customer_id": changed.Customer_id}})
+			return err
+		})
 		if err != nil {
-			msg := fmt.Sprintf("order item update failed")
 			c.JSON(http.StatusInternalServerError,
-				gin.H{"error": msg})
+				gin.H{"error": "order update failed"})
 			return
 		}
-		defer cancel()
-		c.JSON(http.StatusOK, &result)
+		order.Guests = changed.Guests
+		order.Customer_id = changed.Customer_id
+		order.Order_type = changed.Order_type
+		order.Customer_name = changed.Customer_name
+		order.Customer_phone = changed.Customer_phone
+		order.Delivery_address = changed.Delivery_address
+		order.Delivery_zone_id = changed.Delivery_zone_id
+		order.Delivery_fee = changed.Delivery_fee
+		order.Promised_at = changed.Promised_at
+		order.Updated_at = changed.Updated_at
+		if moved {
+			order, err = moveOrder(ctx, order, *update.Table_ID, "",
+				c.GetString("uid"))
+			if err != nil {
+				orderMoveError(c, err)
+				return
+			}
+		}
+		c.JSON(http.StatusOK, order)
 	}
 }
 
-func OrderItemOrderCreator(order models.Order) string {
+// OrderItemOrderCreator fills in the order that order items are being
+// created for and returns its ID. The caller inserts it.
+func OrderItemOrderCreator(order *models.Order) string {
 	var _, cancel = context.WithTimeout(context.Background(),
 		100*time.Second)
 	order.Created_at, _ = time.Parse(time.RFC3339,
@@ -172,3 +315,24 @@ func OrderItemOrderCreator(order models.Order) string {
 	defer cancel()
 	return order.Order_ID
 }
+
+// closeOrder closes an order once its invoice is settled and refreshes its
+// table's status. An order already closed keeps its time. The platform an
+// order came from is told it is completed, and the member it is for earns
+// its points.
+func closeOrder(ctx context.Context, orderID string) error {
+	closedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	result, err := orderCollection.UpdateOne(ctx,
+		bson.M{"order_id": orderID, "closed_at": nil},
+		bson.M{"$set": bson.M{"closed_at": closedAt, "updated_at": closedAt}})
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount > 0 {
+		freeEmptyOrderSlot(ctx, orderID)
+		go platformOrderClosed(orderID)
+		go earnLoyaltyPoints(orderID)
+	}
+	refreshOrderTable(ctx, orderID)
+	return nil
+}
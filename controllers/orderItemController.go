@@ -2,6 +2,8 @@ package controller
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -15,9 +17,24 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// orderItemPack is the order to create and its items. Takeaway and
+// delivery orders have no table and say who they are for instead, and can
+// be scheduled for later.
 type orderItemPack struct {
-	Table_id   *string
-	OrderItems []models.OrderItem
+	Table_id         *string
+	Guests           *int
+	Server_id        *string
+	Order_type       string
+	Customer_name    *string
+	Customer_phone   *string
+	Delivery_address *string
+	Promised_at      *time.Time
+	Delivery_zone_id *string
+	Delivery_fee     *float64
+	Scheduled_for    *time.Time
+	Customer_id      *string
+	OrderItems       []models.OrderItem
+	Bundles          []bundleSelection
 }
 
 var orderItemCollection *mongo.Collection = database.OpenCollection(database.
@@ -64,7 +81,8 @@ func ItemsByOrder(id string) (OrderItems []primitive.M, err error) {
 	var ctx, cancel = context.WithTimeout(context.Background(),
 		100*time.Second)
 
-	matchStage := bson.D{{"$match", bson.D{{"order_id", id}}}}
+	matchStage := bson.D{{"$match", bson.D{{"order_id", id},
+		{"status", bson.M{"$ne": models.OrderItemVoid}}}}}
 	lookUpStage := bson.D{{"$lookup", bson.D{{"from", "food"},
 		{"localField", "food_id"}, {"foreignField", "food_id"}, {"as",
 			"food"}}}}
@@ -88,7 +106,11 @@ func ItemsByOrder(id string) (OrderItems []primitive.M, err error) {
 		{
 			"$project", bson.D{
 				{"id", 0},
-				{"amount", "$food.price"},
+				// unit_price is the price snapshot taken when the item
+				// was ordered; only items from before snapshots existed
+				// fall back to the food's current price.
+				{"amount", bson.D{{"$ifNull", bson.A{"$unit_price",
+					"$food.price"}}}},
 				{"total_count", 1},
 				{"food_name", "$food.name"},
 				{"food_image", "$food.food_image"},
@@ -207,6 +229,7 @@ func CreateOrderItem() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(),
 			100*time.Second)
+		defer cancel()
 		var orderItempack orderItemPack
 		var order models.Order
 
@@ -217,37 +240,136 @@ func CreateOrderItem() gin.HandlerFunc {
 		order.Order_date, _ = time.Parse(time.RFC3339,
 			time.Now().Format(time.RFC3339))
 
-		orderItemstobeInserted := []interface{}{}
 		order.Table_ID = orderItempack.Table_id
-		order_id := OrderItemOrderCreator(order)
-
-		for _, orderItem := range orderItempack.OrderItems {
-			orderItem.Order_id = order_id
-			validationErr := validate.Struct(order)
-			if validationErr != nil {
-				c.JSON(500, gin.H{"error": validationErr.Error()})
-				return
-			}
-			orderItem.ID = primitive.NewObjectID()
-			orderItem.Created_at, _ = time.Parse(time.RFC3339,
-				time.Now().Format(time.RFC3339))
-			orderItem.Updated_at, _ = time.Parse(time.RFC3339,
-				time.Now().Format(time.RFC3339))
-			orderItem.Order_item_id = orderItem.ID.Hex()
-			var num = toFixed(*orderItem.Unit_price, 2)
-			orderItem.Unit_price = &num
-			orderItemstobeInserted = append(orderItemstobeInserted,
-				orderItem)
+		order.Guests = orderItempack.Guests
+		order.Created_by = c.GetString("uid")
+		order.Server_id = orderItempack.Server_id
+		order.Order_type = orderItempack.Order_type
+		order.Customer_name = orderItempack.Customer_name
+		order.Customer_phone = orderItempack.Customer_phone
+		order.Delivery_address = orderItempack.Delivery_address
+		order.Promised_at = orderItempack.Promised_at
+		order.Delivery_zone_id = orderItempack.Delivery_zone_id
+		order.Delivery_fee = orderItempack.Delivery_fee
+		order.Scheduled_for = orderItempack.Scheduled_for
+		order.Customer_id = orderItempack.Customer_id
+		if err := attachCustomer(ctx, &order); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := checkOrderType(ctx, &order); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		resolveOrderTable(ctx, &order)
+		if err := assignServer(ctx, &order); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		order_id := OrderItemOrderCreator(&order)
+		if validationErr := validate.Struct(order); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
 		}
-		insertedOrderItems, err := orderItemCollection.InsertMany(
-			ctx,
-			orderItemstobeInserted)
-		defer cancel()
 
+		orderItemstobeInserted, err := buildOrderItems(ctx, order_id,
+			orderItempack.OrderItems, orderItempack.Bundles)
 		if err != nil {
-			log.Fatal(err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		orderItemstobeInserted, err = scheduleOrder(ctx, &order,
+			orderItemstobeInserted)
+		if err != nil {
+			scheduleError(c, err)
+			return
+		}
+		var insertedOrderItems *mongo.InsertManyResult
+		err = inTransaction(ctx, func(sc mongo.SessionContext) error {
+			if _, err := orderCollection.InsertOne(sc, order); err != nil {
+				return err
+			}
+			var err error
+			insertedOrderItems, err = insertOrderItems(sc, order,
+				orderItemstobeInserted)
+			return err
+		})
+		if err != nil {
+			unscheduleOrder(ctx, order)
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "order was not created"})
+			return
 		}
 
 		c.JSON(200, &insertedOrderItems)
 	}
 }
+
+// buildOrderItems prices the order items and the components of the bundles
+// for the order, checking each food can be ordered. The error is meant for
+// the client.
+func buildOrderItems(ctx context.Context, orderID string,
+	orderItems []models.OrderItem, bundles []bundleSelection) ([]interface{}, error) {
+	orderItemstobeInserted := []interface{}{}
+	for _, orderItem := range orderItems {
+		orderItem.Order_id = orderID
+		orderItem.ID = primitive.NewObjectID()
+		orderItem.Created_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		orderItem.Updated_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		orderItem.Order_item_id = orderItem.ID.Hex()
+		if orderItem.Food_id == nil {
+			return nil, errors.New("every order item needs a food_id")
+		}
+		if available, err := foodAvailable(ctx,
+			*orderItem.Food_id); err != nil || !available {
+			return nil, fmt.Errorf("food %s is not available",
+				*orderItem.Food_id)
+		}
+		price, err := FoodPriceAt(ctx, *orderItem.Food_id, time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("couldn't find the price of food %s",
+				*orderItem.Food_id)
+		}
+		var num = toFixed(price, 2)
+		orderItem.Unit_price = &num
+		var status = models.OrderItemPending
+		orderItem.Status = &status
+		orderItem.Stock_depleted = false
+		// gift cards are sold through SellGiftCard
+		orderItem.Gift_card_code = nil
+		orderItem.Gift_card_loaded = false
+		orderItemstobeInserted = append(orderItemstobeInserted, orderItem)
+	}
+
+	for _, selection := range bundles {
+		components, err := bundleOrderItems(ctx, selection, orderID)
+		if err != nil {
+			return nil, err
+		}
+		for _, component := range components {
+			orderItemstobeInserted = append(orderItemstobeInserted,
+				component)
+		}
+	}
+	return orderItemstobeInserted, nil
+}
+
+// insertOrderItems adds the items built for an order that is already saved
+// and brings its table's status up to date.
+func insertOrderItems(ctx context.Context, order models.Order,
+	orderItems []interface{}) (*mongo.InsertManyResult, error) {
+	result := &mongo.InsertManyResult{InsertedIDs: []interface{}{}}
+	if len(orderItems) > 0 {
+		var err error
+		result, err = orderItemCollection.InsertMany(ctx, orderItems)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if order.Table_ID != nil {
+		refreshTableStatus(ctx, *order.Table_ID)
+	}
+	return result, nil
+}
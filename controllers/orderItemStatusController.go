@@ -0,0 +1,237 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"restro/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// orderItemTransitions lists the statuses each status can be reached from.
+// Items created before statuses existed have none and count as pending.
+var orderItemTransitions = map[string][]interface{}{
+	models.OrderItemFired:  {models.OrderItemPending, nil},
+	models.OrderItemServed: {models.OrderItemPending, models.OrderItemFired, nil},
+	models.OrderItemVoid: {models.OrderItemScheduled, models.OrderItemPending,
+		models.OrderItemFired, models.OrderItemServed, nil},
+}
+
+// orderItemVoid is the optional body of a void.
+type orderItemVoid struct {
+	Waste_reason string `json:"waste_reason" validate:"omitempty,eq=EXPIRED|eq=DROPPED|eq=RETURNED|eq=OVERPRODUCTION"`
+	Note         string `json:"note"`
+}
+
+var errStockMovement = errors.New("stock movement failed")
+
+var orderItemStatusTimes = map[string]string{
+	models.OrderItemFired:  "fired_at",
+	models.OrderItemServed: "served_at",
+	models.OrderItemVoid:   "voided_at",
+}
+
+func FireOrderItem() gin.HandlerFunc {
+	return transitionOrderItem(models.OrderItemFired)
+}
+
+func ServeOrderItem() gin.HandlerFunc {
+	return transitionOrderItem(models.OrderItemServed)
+}
+
+// VoidOrderItem cancels an order item. Normally its stock is given back;
+// with a waste_reason the food was made and thrown away, so the stock stays
+// used and a waste entry records what it cost. A gift card sold on the item
+// is cancelled with it unless the card has been loaded, and the points a
+// reward item was had for are given back, all in the same transaction.
+func VoidOrderItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var body orderItemVoid
+		// the body is optional: without one the stock is given back
+		if err := c.ShouldBindJSON(&body); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(body); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		wasted := body.Waste_reason != ""
+
+		var orderItem models.OrderItem
+		var waste *models.WasteEntry
+		var stockMoved bool
+		err := inTransaction(ctx, func(sc mongo.SessionContext) error {
+			waste = nil
+			if err := cancelGiftCardSale(sc, c.Param("orderItem_id")); err != nil {
+				return err
+			}
+			var err error
+			orderItem, stockMoved, err = moveOrderItemStatus(sc,
+				c.Param("orderItem_id"), models.OrderItemVoid,
+				c.GetString("uid"), wasted)
+			if err != nil {
+				return err
+			}
+			if wasted && orderItem.Stock_depleted {
+				// the item isn't voided without its waste entry
+				entry, err := recordOrderItemWaste(sc, orderItem,
+					body.Waste_reason, body.Note, c.GetString("uid"))
+				if err != nil {
+					return err
+				}
+				waste = &entry
+			}
+			return returnRewardPoints(sc, orderItem, c.GetString("uid"))
+		})
+		if errors.Is(err, errGiftCardLoaded) {
+			giftCardError(c, err)
+			return
+		}
+		if errors.Is(err, errPointsChanged) {
+			loyaltyError(c, err)
+			return
+		}
+		if err != nil {
+			orderItemStatusError(c, models.OrderItemVoid, err)
+			return
+		}
+		orderItemStatusMoved(orderItem, models.OrderItemVoid, stockMoved)
+		freeEmptyOrderSlot(ctx, orderItem.Order_id)
+		refreshOrderTable(ctx, orderItem.Order_id)
+		if waste == nil {
+			c.JSON(http.StatusOK, orderItem)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"order_item": orderItem, "waste": waste})
+	}
+}
+
+func transitionOrderItem(status string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+
+		orderItem, err := setOrderItemStatus(ctx, c.Param("orderItem_id"),
+			status, c.GetString("uid"), false)
+		if err != nil {
+			orderItemStatusError(c, status, err)
+			return
+		}
+		c.JSON(http.StatusOK, orderItem)
+	}
+}
+
+func orderItemStatusError(c *gin.Context, status string, err error) {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusConflict, gin.H{"error": "the order item " +
+			"doesn't exist or can't move to " + status})
+		return
+	}
+	if errors.Is(err, errStockMovement) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "the order " +
+			"item wasn't moved to " + status + " because its stock couldn't " +
+			"be updated"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError,
+		gin.H{"error": "order item status update failed"})
+}
+
+// setOrderItemStatus moves an order item to status and keeps stock in step.
+// The stock_depleted flag is claimed with a conditional update before stock
+// moves, so concurrent or repeated calls can't deplete or restore twice.
+// The status, the claim and the stock movements share a transaction: if
+// the stock can't move, nothing changes and the error is returned.
+// keepStock leaves the stock of a voided item used up.
+func setOrderItemStatus(ctx context.Context, orderItemID, status,
+	by string, keepStock bool) (models.OrderItem, error) {
+	var orderItem models.OrderItem
+	var stockMoved bool
+	err := inTransaction(ctx, func(sc mongo.SessionContext) error {
+		var err error
+		orderItem, stockMoved, err = moveOrderItemStatus(sc, orderItemID,
+			status, by, keepStock)
+		return err
+	})
+	if err != nil {
+		return orderItem, err
+	}
+	orderItemStatusMoved(orderItem, status, stockMoved)
+	return orderItem, nil
+}
+
+// moveOrderItemStatus is setOrderItemStatus within the caller's
+// transaction. It reports whether stock moved; once the transaction
+// commits, orderItemStatusMoved must be called.
+func moveOrderItemStatus(sc mongo.SessionContext, orderItemID, status,
+	by string, keepStock bool) (models.OrderItem, bool, error) {
+	var orderItem models.OrderItem
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	err := orderItemCollection.FindOneAndUpdate(sc,
+		bson.M{
+			"order_item_id": orderItemID,
+			"status":        bson.M{"$in": orderItemTransitions[status]},
+		},
+		bson.M{"$set": bson.M{
+			"status":                     status,
+			orderItemStatusTimes[status]: now,
+			"updated_at":                 now,
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&orderItem)
+	if err != nil {
+		return orderItem, false, err
+	}
+
+	deplete := status != models.OrderItemVoid
+	if !deplete && keepStock {
+		return orderItem, false, nil
+	}
+	claimFilter := bson.M{"order_item_id": orderItemID,
+		"stock_depleted": bson.M{"$ne": true}}
+	if !deplete {
+		claimFilter["stock_depleted"] = true
+	}
+	claim, err := orderItemCollection.UpdateOne(sc, claimFilter,
+		bson.M{"$set": bson.M{"stock_depleted": deplete}})
+	if err != nil {
+		return orderItem, false, err
+	}
+	if claim.ModifiedCount == 0 {
+		return orderItem, false, nil
+	}
+	orderItem.Stock_depleted = deplete
+
+	if deplete {
+		_, err = inventoryService.Consume(sc, orderItem, by)
+	} else {
+		_, err = inventoryService.Reverse(sc, orderItem, by)
+	}
+	if err != nil {
+		return orderItem, false, fmt.Errorf("%w: %v", errStockMovement, err)
+	}
+	return orderItem, true, nil
+}
+
+// orderItemStatusMoved tells the delivery platform about the change and
+// has sold out foods re-evaluated if stock moved.
+func orderItemStatusMoved(orderItem models.OrderItem, status string,
+	stockMoved bool) {
+	go platformOrderChanged(orderItem.Order_id, status)
+	if stockMoved {
+		stockEvaluator.Trigger()
+	}
+}
@@ -0,0 +1,419 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"restro/database"
+	"restro/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var orderAuditCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "orderAudit")
+
+var (
+	errOrderNotOpen  = errors.New("the order is closed")
+	errOrderChanged  = errors.New("the order changed at the same time, try again")
+	errOrderInvoiced = errors.New("an invoice was raised for the order; " +
+		"settle it first")
+	errSameTable      = errors.New("the order is already on that table")
+	errOrderMergeSelf = errors.New("an order can't be merged into itself")
+	errOrderTableGone = errors.New("table was not found")
+	errNotDineIn      = errors.New("only dine-in orders are at a table")
+	errOrderTypes     = errors.New("orders of different types can't be merged")
+	errDeliveryMerge  = errors.New("delivery orders go to one address for " +
+		"one fee and can't be merged")
+	errPlatformMerge = errors.New("orders from delivery platforms can't " +
+		"be merged into each other")
+	errOrderCustomers = errors.New("the orders are for different customers")
+	errOrderMerged    = errors.New("the order was merged into another order")
+)
+
+// orderMove is the body of a move: the table to move to, or of a merge:
+// the order to merge in.
+type orderMove struct {
+	Table_id *string `json:"table_id"`
+	Order_id *string `json:"order_id"`
+	Note     string  `json:"note"`
+}
+
+// MoveOrder moves an open order, with its order items, to another table.
+func MoveOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var body orderMove
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if body.Table_id == nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": "a move needs the table_id to move to"})
+			return
+		}
+		order, err := findOrder(ctx, c.Param("order_id"))
+		if err != nil {
+			orderMoveError(c, err)
+			return
+		}
+		order, err = moveOrder(ctx, order, *body.Table_id, body.Note,
+			c.GetString("uid"))
+		if err != nil {
+			orderMoveError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+// MergeOrder merges another open order into this one: its order items move
+// over and it is closed, so the tables pay together.
+func MergeOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var body orderMove
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if body.Order_id == nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": "a merge needs the order_id to merge in"})
+			return
+		}
+		target, err := findOrder(ctx, c.Param("order_id"))
+		if err != nil {
+			orderMoveError(c, err)
+			return
+		}
+		source, err := findOrder(ctx, *body.Order_id)
+		if err != nil {
+			orderMoveError(c, err)
+			return
+		}
+		target, err = mergeOrders(ctx, target, source, body.Note,
+			c.GetString("uid"))
+		if err != nil {
+			orderMoveError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, target)
+	}
+}
+
+// GetOrderAudit lists the moves and merges of an order, oldest first.
+func GetOrderAudit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		orderID := c.Param("order_id")
+		result, err := orderAuditCollection.Find(ctx, bson.M{"$or": bson.A{
+			bson.M{"order_id": orderID},
+			bson.M{"merged_order_id": orderID},
+		}}, options.Find().SetSort(bson.M{"created_at": 1}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the order audit"})
+			return
+		}
+		audit := []models.OrderAudit{}
+		if err = result.All(ctx, &audit); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the order audit"})
+			return
+		}
+		c.JSON(http.StatusOK, audit)
+	}
+}
+
+// moveOrder moves an open order to a table, onto the primary table when
+// the table is in a group. The move and its audit entry are written in one
+// transaction.
+func moveOrder(ctx context.Context, order models.Order, tableID, note,
+	by string) (models.Order, error) {
+	target, err := moveTarget(ctx, order, tableID)
+	if err != nil {
+		return order, err
+	}
+	from := derefString(order.Table_ID)
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	err = inTransaction(ctx, func(sc mongo.SessionContext) error {
+		result, err := orderCollection.UpdateOne(sc, bson.M{
+			"order_id":  order.Order_ID,
+			"closed_at": nil,
+			"table_id":  order.Table_ID,
+		}, bson.M{"$set": bson.M{
+			"table_id":       *target.Table_ID,
+			"table_group_id": target.Table_group_id,
+			"updated_at":     now,
+		}})
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return errOrderChanged
+		}
+		audit := newOrderAudit(models.OrderAuditMove, order.Order_ID, note,
+			by, now)
+		audit.From_table_id = order.Table_ID
+		audit.To_table_id = target.Table_ID
+		_, err = orderAuditCollection.InsertOne(sc, audit)
+		return err
+	})
+	if err != nil {
+		return order, err
+	}
+	order.Table_ID = target.Table_ID
+	order.Table_group_id = target.Table_group_id
+	order.Updated_at = now
+	if from != "" {
+		refreshTableStatus(ctx, from)
+	}
+	refreshTableStatus(ctx, *order.Table_ID)
+	return order, nil
+}
+
+// moveTarget checks an order can move to a table and returns where it
+// would be: the table, or the primary table of its group.
+func moveTarget(ctx context.Context, order models.Order,
+	tableID string) (models.Order, error) {
+	var target models.Order
+	if order.Closed_at != nil {
+		return target, errOrderNotOpen
+	}
+	if orderType(order) != models.OrderDineIn {
+		return target, errNotDineIn
+	}
+	count, err := tableCollection.CountDocuments(ctx,
+		bson.M{"table_id": tableID})
+	if err != nil {
+		return target, err
+	}
+	if count == 0 {
+		return target, errOrderTableGone
+	}
+	target.Table_ID = &tableID
+	resolveOrderTable(ctx, &target)
+	if *target.Table_ID == derefString(order.Table_ID) {
+		return target, errSameTable
+	}
+	return target, nil
+}
+
+// mergeOrders moves the order items of source onto target and closes
+// source as merged, in one transaction with the audit entry. Orders with an
+// invoice can't be merged, as the invoice would no longer match the order.
+// The target takes on the source's customer and delivery platform, and a
+// source booked into a schedule slot gives the slot back.
+func mergeOrders(ctx context.Context, target, source models.Order, note,
+	by string) (models.Order, error) {
+	if target.Order_ID == source.Order_ID {
+		return target, errOrderMergeSelf
+	}
+	if target.Closed_at != nil || source.Closed_at != nil {
+		return target, errOrderNotOpen
+	}
+	if orderType(target) != orderType(source) {
+		return target, errOrderTypes
+	}
+	if orderType(source) == models.OrderDelivery {
+		return target, errDeliveryMerge
+	}
+	if source.Platform != nil && target.Platform != nil {
+		return target, errPlatformMerge
+	}
+	if source.Customer_id != nil && target.Customer_id != nil &&
+		*source.Customer_id != *target.Customer_id {
+		return target, errOrderCustomers
+	}
+	freeSourceSlot := source.Scheduled_for != nil &&
+		source.Released_at == nil && !source.Slot_freed
+	// held items wait for the target's release, or go now if it has none
+	targetHolds := target.Scheduled_for != nil && target.Released_at == nil
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	err := inTransaction(ctx, func(sc mongo.SessionContext) error {
+		// CreateInvoice writes the order too, so an invoice raised while
+		// this runs makes one of the two retry
+		invoiced, err := invoiceCollection.CountDocuments(sc, bson.M{
+			"order_id": bson.M{"$in": bson.A{target.Order_ID, source.Order_ID}}})
+		if err != nil {
+			return err
+		}
+		if invoiced > 0 {
+			return errOrderInvoiced
+		}
+
+		closeSource := bson.M{
+			"closed_at":   now,
+			"merged_into": target.Order_ID,
+			"updated_at":  now,
+		}
+		if freeSourceSlot {
+			closeSource["slot_freed"] = true
+		}
+		result, err := orderCollection.UpdateOne(sc, bson.M{
+			"order_id":  source.Order_ID,
+			"closed_at": nil,
+		}, bson.M{"$set": closeSource})
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return errOrderChanged
+		}
+		var guests interface{} = "$guests"
+		if source.Guests != nil {
+			guests = bson.M{"$add": bson.A{
+				bson.M{"$ifNull": bson.A{"$guests", 0}}, *source.Guests}}
+		}
+		set := bson.M{"guests": guests, "updated_at": now}
+		if source.Customer_id != nil {
+			set["customer_id"] = source.Customer_id
+		}
+		if source.Platform != nil {
+			set["platform"] = source.Platform
+			set["external_order_id"] = source.External_order_id
+		}
+		result, err = orderCollection.UpdateOne(sc, bson.M{
+			"order_id":  target.Order_ID,
+			"closed_at": nil,
+		}, bson.A{bson.M{"$set": set}})
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return errOrderChanged
+		}
+		if source.Platform != nil {
+			if _, err = platformOrderCollection.UpdateMany(sc,
+				bson.M{"order_id": source.Order_ID},
+				bson.M{"$set": bson.M{"order_id": target.Order_ID}}); err != nil {
+				return err
+			}
+		}
+
+		cursor, err := orderItemCollection.Find(sc,
+			bson.M{"order_id": source.Order_ID},
+			options.Find().SetProjection(bson.M{"order_item_id": 1}))
+		if err != nil {
+			return err
+		}
+		var items []models.OrderItem
+		if err = cursor.All(sc, &items); err != nil {
+			return err
+		}
+		itemIDs := make([]string, 0, len(items))
+		for _, item := range items {
+			itemIDs = append(itemIDs, item.Order_item_id)
+		}
+		if _, err = orderItemCollection.UpdateMany(sc,
+			bson.M{"order_item_id": bson.M{"$in": itemIDs}},
+			bson.M{"$set": bson.M{"order_id": target.Order_ID,
+				"updated_at": now}}); err != nil {
+			return err
+		}
+		if !targetHolds {
+			if _, err = orderItemCollection.UpdateMany(sc, bson.M{
+				"order_item_id": bson.M{"$in": itemIDs},
+				"status":        models.OrderItemScheduled,
+			}, bson.M{"$set": bson.M{"status": models.OrderItemPending}}); err != nil {
+				return err
+			}
+		}
+
+		audit := newOrderAudit(models.OrderAuditMerge, target.Order_ID, note,
+			by, now)
+		audit.From_table_id = source.Table_ID
+		audit.To_table_id = target.Table_ID
+		audit.Merged_order_id = &source.Order_ID
+		audit.Order_item_ids = itemIDs
+		_, err = orderAuditCollection.InsertOne(sc, audit)
+		return err
+	})
+	if err != nil {
+		return target, err
+	}
+	if freeSourceSlot {
+		unscheduleOrder(ctx, source)
+	}
+	if source.Table_ID != nil {
+		refreshTableStatus(ctx, *source.Table_ID)
+	}
+	if target.Table_ID != nil {
+		refreshTableStatus(ctx, *target.Table_ID)
+	}
+	return findOrder(ctx, target.Order_ID)
+}
+
+func newOrderAudit(action, orderID, note, by string,
+	at time.Time) models.OrderAudit {
+	var audit models.OrderAudit
+	audit.ID = primitive.NewObjectID()
+	audit.Audit_ID = audit.ID.Hex()
+	audit.Action = action
+	audit.Order_id = orderID
+	audit.Note = note
+	audit.Created_by = by
+	audit.Created_at = at
+	return audit
+}
+
+func findOrder(ctx context.Context, orderID string) (models.Order, error) {
+	var order models.Order
+	err := orderCollection.FindOne(ctx,
+		bson.M{"order_id": orderID}).Decode(&order)
+	return order, err
+}
+
+// inTransaction runs fn in a transaction, retried by the driver on
+// transient errors. Inside another transaction it joins that one.
+func inTransaction(ctx context.Context, fn func(sc mongo.SessionContext) error) error {
+	if sc, ok := ctx.(mongo.SessionContext); ok {
+		return fn(sc)
+	}
+	session, err := database.Client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx,
+		func(sc mongo.SessionContext) (interface{}, error) {
+			return nil, fn(sc)
+		})
+	return err
+}
+
+func orderMoveError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		c.JSON(http.StatusNotFound,
+			gin.H{"error": "couldn't find any order with given ID"})
+	case errors.Is(err, errOrderTableGone), errors.Is(err, errSameTable),
+		errors.Is(err, errOrderMergeSelf), errors.Is(err, errNotDineIn),
+		errors.Is(err, errOrderTypes), errors.Is(err, errDeliveryMerge),
+		errors.Is(err, errPlatformMerge), errors.Is(err, errOrderCustomers):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errOrderNotOpen), errors.Is(err, errOrderChanged),
+		errors.Is(err, errOrderInvoiced):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError,
+			gin.H{"error": "order update failed"})
+	}
+}
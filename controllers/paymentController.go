@@ -0,0 +1,401 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"restro/billing"
+	"restro/database"
+	helper "restro/helpers"
+	"restro/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type paymentRefund struct {
+	Amount *float64 `json:"amount" validate:"required,gt=0"`
+	Tip    float64  `json:"tip" validate:"gte=0"`
+	Note   string   `json:"note"`
+}
+
+var paymentCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "payment")
+
+// invoiceBilling is what invoices are billed from, for GetInvoice and the
+// payments taken against them alike.
+var invoiceBilling = billing.NewMongoStore(orderItemCollection,
+	foodCollection, orderCollection, paymentCollection)
+
+// GetPayments lists payments and refunds, optionally for one invoice or
+// kind.
+func GetPayments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		filter := bson.M{}
+		if invoiceID := c.Query("invoice_id"); invoiceID != "" {
+			filter["invoice_id"] = invoiceID
+		}
+		if kind := c.Query("kind"); kind != "" {
+			filter["kind"] = kind
+		}
+		result, err := paymentCollection.Find(ctx, filter,
+			options.Find().SetSort(bson.M{"created_at": 1}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the payments"})
+			return
+		}
+		allPayments := []models.Payment{}
+		if err = result.All(ctx, &allPayments); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the payments"})
+			return
+		}
+		c.JSON(http.StatusOK, allPayments)
+	}
+}
+
+// CreatePayment takes a payment, with an optional tip, against an invoice.
+// The invoice is marked complete once it has been paid in full; a payment
+// can't be for more than is left to pay. The check, the payment and the
+// settling are one transaction, with the invoice locked. A payment
+// in POINTS spends the points of the member the invoice is for, and one by
+// GIFT_CARD spends the balance of the card with gift_card_code.
+func CreatePayment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var payment models.Payment
+
+		if err := c.BindJSON(&payment); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(payment); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		var invoice models.Invoice
+		if err := invoiceCollection.FindOne(ctx, bson.M{
+			"invoice_id": c.Param("invoice_id")}).Decode(&invoice); err != nil {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any invoice with given ID"})
+			return
+		}
+		if derefString(invoice.Payment_Status) == "COMPLETE" {
+			c.JSON(http.StatusConflict, gin.H{"error": errInvoicePaid.Error()})
+			return
+		}
+
+		amount := toFixed(*payment.Amount, 2)
+		payment.Amount = &amount
+		payment.Tip = toFixed(payment.Tip, 2)
+		payment.Kind = models.PaymentKindPayment
+		payment.Invoice_ID = invoice.Invoice_ID
+		payment.Order_ID = invoice.Order_ID
+		payment.Refund_of = nil
+		payment.Refunds = 0
+		payment.Created_by = c.GetString("uid")
+		payment.Created_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		payment.ID = primitive.NewObjectID()
+		payment.Payment_ID = payment.ID.Hex()
+
+		if *payment.Method != models.PaymentMethodGiftCard {
+			payment.Gift_card_code = nil
+		}
+		switch *payment.Method {
+		case models.PaymentMethodPoints:
+			if payment.Tip > 0 {
+				c.JSON(http.StatusBadRequest,
+					gin.H{"error": "tips can't be paid with points"})
+				return
+			}
+		case models.PaymentMethodGiftCard:
+			if payment.Gift_card_code == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "a gift card " +
+					"payment needs the gift_card_code"})
+				return
+			}
+			code := helper.NormalizeGiftCardCode(*payment.Gift_card_code)
+			payment.Gift_card_code = &code
+		}
+
+		var outstanding float64
+		var settled bool
+		err := inTransaction(ctx, func(sc mongo.SessionContext) error {
+			invoice, err := lockInvoice(sc, invoice.Invoice_ID)
+			if err != nil {
+				return err
+			}
+			if derefString(invoice.Payment_Status) == "COMPLETE" {
+				return errInvoicePaid
+			}
+			owed, paid, err := invoiceBalance(sc, invoice)
+			if err != nil {
+				return err
+			}
+			if outstanding = billing.Outstanding(owed, paid); amount > outstanding {
+				return errOverpayment
+			}
+			switch *payment.Method {
+			case models.PaymentMethodPoints:
+				err = payWithPoints(sc, invoice, payment)
+			case models.PaymentMethodGiftCard:
+				err = payWithGiftCard(sc, payment)
+			default:
+				_, err = paymentCollection.InsertOne(sc, payment)
+			}
+			if err != nil {
+				return err
+			}
+			settled, err = settleInvoice(sc, invoice, *payment.Method)
+			return err
+		})
+		switch {
+		case err == nil:
+		case errors.Is(err, errInvoicePaid):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, errOverpayment):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(),
+				"outstanding": outstanding})
+			return
+		case errors.Is(err, errGiftCardBalance):
+			card, _ := findGiftCard(ctx, *payment.Gift_card_code)
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(),
+				"balance": card.Balance})
+			return
+		case errors.Is(err, errNoGiftCard), errors.Is(err, errGiftCardNotActive):
+			giftCardError(c, err)
+			return
+		case errors.Is(err, errNotMember), errors.Is(err, errLoyalty),
+			errors.Is(err, errNotEnoughPoints), errors.Is(err, errPointsChanged):
+			loyaltyError(c, err)
+			return
+		default:
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "payment was not recorded"})
+			return
+		}
+		if settled {
+			loadGiftCards(ctx, invoice.Order_ID)
+			if err := closeOrder(ctx, invoice.Order_ID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "the " +
+					"invoice was paid but its order wasn't closed"})
+				return
+			}
+		}
+		c.JSON(http.StatusOK, payment)
+	}
+}
+
+var (
+	errInvoicePaid = errors.New("the invoice has already been paid")
+	errOverpayment = errors.New("the payment is more than is left to pay " +
+		"on the invoice")
+)
+
+// RefundPayment gives back part or all of a payment, and its tip, by the
+// same method it was taken. Points paid with are given back to the member,
+// and points the invoice earned are taken back in proportion. A gift card
+// payment is put back onto the card.
+func RefundPayment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var request paymentRefund
+
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(request); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		var original models.Payment
+		if err := paymentCollection.FindOne(ctx, bson.M{
+			"payment_id": c.Param("payment_id"),
+			"kind":       models.PaymentKindPayment,
+		}).Decode(&original); err != nil {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any payment with given ID"})
+			return
+		}
+
+		amount := toFixed(*request.Amount, 2)
+		tip := toFixed(request.Tip, 2)
+
+		var refund models.Payment
+		refund.Kind = models.PaymentKindRefund
+		refund.Invoice_ID = original.Invoice_ID
+		refund.Order_ID = original.Order_ID
+		refund.Method = original.Method
+		refund.Amount = &amount
+		refund.Tip = tip
+		refund.Refund_of = &original.Payment_ID
+		refund.Gift_card_code = original.Gift_card_code
+		refund.Note = request.Note
+		refund.Created_by = c.GetString("uid")
+		refund.Created_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		refund.ID = primitive.NewObjectID()
+		refund.Payment_ID = refund.ID.Hex()
+
+		var refundable, refundableTip float64
+		err := inTransaction(ctx, func(sc mongo.SessionContext) error {
+			var err error
+			refundable, refundableTip, err = refundableOf(sc, original)
+			if err != nil {
+				return err
+			}
+			if amount > refundable || tip > refundableTip {
+				return errRefundTooLarge
+			}
+			if _, err := paymentCollection.InsertOne(sc, refund); err != nil {
+				return err
+			}
+			if err := refundGiftCard(sc, refund); err != nil {
+				return err
+			}
+			return refundLoyaltyPoints(sc, original, refund)
+		})
+		if errors.Is(err, errRefundTooLarge) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(),
+				"refundable":     refundable,
+				"refundable_tip": refundableTip})
+			return
+		}
+		if err != nil {
+			if errors.Is(err, errPointsChanged) {
+				loyaltyError(c, err)
+				return
+			}
+			if errors.Is(err, errGiftCardNotActive) {
+				giftCardError(c, err)
+				return
+			}
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "refund was not recorded"})
+			return
+		}
+		c.JSON(http.StatusOK, refund)
+	}
+}
+
+var errRefundTooLarge = errors.New("only what is left of the payment and " +
+	"its tip can be refunded")
+
+// refundableOf works out what is left of a payment and its tip to refund.
+// It bumps the payment's refund count first, so a concurrent refund of it
+// conflicts with this transaction instead of reading the same refunds.
+func refundableOf(sc mongo.SessionContext,
+	original models.Payment) (amount, tip float64, err error) {
+	if _, err = paymentCollection.UpdateOne(sc,
+		bson.M{"payment_id": original.Payment_ID},
+		bson.M{"$inc": bson.M{"refunds": 1}}); err != nil {
+		return 0, 0, err
+	}
+	result, err := paymentCollection.Find(sc, bson.M{
+		"refund_of": original.Payment_ID})
+	if err != nil {
+		return 0, 0, err
+	}
+	var refunds []models.Payment
+	if err = result.All(sc, &refunds); err != nil {
+		return 0, 0, err
+	}
+	amount, tip = *original.Amount, original.Tip
+	for _, refund := range refunds {
+		amount -= *refund.Amount
+		tip -= refund.Tip
+	}
+	return toFixed(amount, 2), toFixed(tip, 2), nil
+}
+
+// invoiceBalance works out what an invoice owes, including tax, and what
+// has been paid against it less refunds.
+func invoiceBalance(ctx context.Context,
+	invoice models.Invoice) (owed, paid float64, err error) {
+	settings, err := loadAccountingSettings(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	return billing.Balance(ctx, invoiceBilling, settings, invoice)
+}
+
+// paidInvoices lists the invoices matching filter with payments taken
+// against them since, that what has been paid less refunds covers.
+func paidInvoices(ctx context.Context, since time.Time,
+	filter bson.M) ([]models.Invoice, error) {
+	ids, err := paymentCollection.Distinct(ctx, "invoice_id",
+		bson.M{"created_at": bson.M{"$gte": since}})
+	if err != nil {
+		return nil, err
+	}
+	filter["invoice_id"] = bson.M{"$in": ids}
+	result, err := invoiceCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var invoices []models.Invoice
+	if err = result.All(ctx, &invoices); err != nil {
+		return nil, err
+	}
+	paid := []models.Invoice{}
+	for _, invoice := range invoices {
+		owed, paidIn, err := invoiceBalance(ctx, invoice)
+		if err != nil {
+			return nil, err
+		}
+		if billing.Settled(owed, paidIn) {
+			paid = append(paid, invoice)
+		}
+	}
+	return paid, nil
+}
+
+// lockInvoice bumps an invoice's payment count and returns it, inside the
+// transaction of a payment. A payment taken against it at the same time
+// then conflicts with this one instead of reading the same balance.
+func lockInvoice(sc mongo.SessionContext, invoiceID string) (models.Invoice, error) {
+	var invoice models.Invoice
+	err := invoiceCollection.FindOneAndUpdate(sc,
+		bson.M{"invoice_id": invoiceID},
+		bson.M{"$inc": bson.M{"payments": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&invoice)
+	return invoice, err
+}
+
+// settleInvoice marks the invoice complete once what has been paid against
+// it, less refunds, covers what is owed including tax. It runs in the
+// transaction of the payment; the caller closes the order once it commits.
+func settleInvoice(sc mongo.SessionContext, invoice models.Invoice,
+	method string) (bool, error) {
+	owed, paid, err := invoiceBalance(sc, invoice)
+	if err != nil || !billing.Settled(owed, paid) {
+		return false, err
+	}
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	_, err = invoiceCollection.UpdateOne(sc,
+		bson.M{"invoice_id": invoice.Invoice_ID},
+		bson.M{"$set": bson.M{
+			"payment_status": "COMPLETE",
+			"payment_method": method,
+			"updated_at":     updated_at,
+		}})
+	return err == nil, err
+}
@@ -0,0 +1,441 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"restro/database"
+	"restro/models"
+	"restro/platforms"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var platformOrderCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "platformOrder")
+var platformMenuCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "platformMenu")
+
+var platformRegistry *platforms.Registry = openPlatforms()
+var platformStore platforms.Store = platforms.NewMongoStore(
+	platformOrderCollection)
+var platformIntake = &platforms.Intake{
+	Registry: platformRegistry,
+	Store:    platformStore,
+	Take:     createPlatformOrder,
+}
+
+func openPlatforms() *platforms.Registry {
+	registry, err := platforms.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return registry
+}
+
+// ReceivePlatformOrder takes an order posted by a delivery platform's
+// webhook, creating the order and its items. The platform is told the
+// order was accepted, or rejected with why when it can't be taken as sent.
+// A webhook delivered again is answered as the first was.
+func ReceivePlatformOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		platformIntake.ServeWebhook(c.Writer, c.Request, c.Param("platform"))
+	}
+}
+
+// RunPlatformNotifier tells the platforms, every interval, the statuses
+// of their orders that didn't go through.
+func RunPlatformNotifier(interval time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), interval)
+	if err := platformStore.EnsureIndexes(ctx); err != nil {
+		log.Println("couldn't create the platform order indexes:", err)
+	}
+	cancel()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		if err := platformIntake.RetryStatuses(ctx); err != nil {
+			log.Println("couldn't retry the platform statuses:", err)
+		}
+		cancel()
+	}
+}
+
+// GetPlatformOrders lists the orders received from platforms, newest
+// first, optionally only those from ?platform= or in ?status=.
+func GetPlatformOrders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		filter := bson.M{}
+		if platform := c.Query("platform"); platform != "" {
+			filter["platform"] = strings.ToLower(platform)
+		}
+		if status := c.Query("status"); status != "" {
+			filter["status"] = strings.ToUpper(status)
+		}
+		result, err := platformOrderCollection.Find(ctx, filter,
+			options.Find().SetSort(bson.M{"created_at": -1}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the platform orders"})
+			return
+		}
+		allOrders := []models.PlatformOrder{}
+		if err = result.All(ctx, &allOrders); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the platform orders"})
+			return
+		}
+		c.JSON(http.StatusOK, allOrders)
+	}
+}
+
+func GetPlatformOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var record models.PlatformOrder
+		if err := platformOrderCollection.FindOne(ctx,
+			bson.M{"_id": c.Param("platform_order_id")}).Decode(&record); err != nil {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any platform order with given ID"})
+			return
+		}
+		c.JSON(http.StatusOK, record)
+	}
+}
+
+// SendPlatformOrderStatus tells a platform a status of one of its orders
+// by hand, such as READY when a takeaway is packed or CANCELLED.
+func SendPlatformOrderStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var request struct {
+			Status string `json:"status" validate:"eq=PREPARING|eq=READY|eq=COMPLETED|eq=CANCELLED"`
+			Reason string `json:"reason" validate:"max=500"`
+		}
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		request.Status = strings.ToUpper(request.Status)
+		if err := validate.Struct(request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		id := c.Param("platform_order_id")
+		err := platformIntake.Notify(ctx, id, request.Status, request.Reason)
+		if errors.Is(err, platforms.ErrStatus) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadGateway,
+				gin.H{"error": "the platform didn't take the update: " + err.Error()})
+			return
+		}
+		var record models.PlatformOrder
+		if err := platformOrderCollection.FindOne(ctx,
+			bson.M{"_id": id}).Decode(&record); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while finding the platform order"})
+			return
+		}
+		c.JSON(http.StatusOK, record)
+	}
+}
+
+// GetPlatformMenu lists how a platform's menu items map to foods.
+func GetPlatformMenu() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		result, err := platformMenuCollection.Find(ctx,
+			bson.M{"platform": strings.ToLower(c.Param("platform"))},
+			options.Find().SetSort(bson.M{"external_id": 1}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the platform menu"})
+			return
+		}
+		allItems := []models.PlatformMenuItem{}
+		if err = result.All(ctx, &allItems); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the platform menu"})
+			return
+		}
+		c.JSON(http.StatusOK, allItems)
+	}
+}
+
+// PutPlatformMenuItem maps an item on a platform's menu to a food, made in
+// size M unless given a size.
+func PutPlatformMenuItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var item models.PlatformMenuItem
+		if err := c.BindJSON(&item); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		item.Platform = strings.ToLower(c.Param("platform"))
+		item.External_id = c.Param("external_id")
+		item.ID = item.Platform + ":" + item.External_id
+		if item.Size == nil {
+			size := "M"
+			item.Size = &size
+		}
+		if err := validate.Struct(item); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var food models.Food
+		if err := foodCollection.FindOne(ctx,
+			bson.M{"food_id": *item.Food_id}).Decode(&food); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "food was not found"})
+			return
+		}
+		item.Updated_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+
+		if _, err := platformMenuCollection.ReplaceOne(ctx,
+			bson.M{"_id": item.ID}, item,
+			options.Replace().SetUpsert(true)); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "platform menu item was not saved"})
+			return
+		}
+		c.JSON(http.StatusOK, item)
+	}
+}
+
+func DeletePlatformMenuItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		id := strings.ToLower(c.Param("platform")) + ":" + c.Param("external_id")
+		result, err := platformMenuCollection.DeleteOne(ctx, bson.M{"_id": id})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "platform menu item was not deleted"})
+			return
+		}
+		if result.DeletedCount == 0 {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any platform menu item with given ID"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"deleted": id})
+	}
+}
+
+// createPlatformOrder creates the order for a platform order, with the ID
+// chosen when it was first received. The order, its items and the record
+// of it being created are saved together, so a redelivery can't create it
+// twice. Errors wrapping platforms.ErrRejected are about the order as sent.
+func createPlatformOrder(ctx context.Context, record models.PlatformOrder,
+	incoming platforms.Order) error {
+	orderItems, err := platformOrderItems(ctx, record.Platform, incoming.Items)
+	if err != nil {
+		return err
+	}
+	orderID, err := primitive.ObjectIDFromHex(record.Order_id)
+	if err != nil {
+		return err
+	}
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	customer := strings.TrimSpace(incoming.Customer.Name)
+	if customer == "" {
+		customer = record.Platform + " #" + record.External_id
+	}
+	order := models.Order{
+		ID:                orderID,
+		Order_ID:          record.Order_id,
+		Order_date:        now,
+		Created_at:        now,
+		Updated_at:        now,
+		Order_type:        incoming.Type,
+		Customer_name:     &customer,
+		Scheduled_for:     incoming.Scheduled_for,
+		Platform:          &record.Platform,
+		External_order_id: &record.External_id,
+	}
+	if phone := strings.TrimSpace(incoming.Customer.Phone); phone != "" {
+		order.Customer_phone = &phone
+		order.Customer_id = customerByPhone(ctx, phone)
+	}
+	if order.Order_type == models.OrderDelivery {
+		address := strings.TrimSpace(incoming.Customer.Address)
+		order.Delivery_address = &address
+		order.Delivery_fee = incoming.Delivery_fee
+	}
+	if err := checkOrderType(ctx, &order); err != nil {
+		return fmt.Errorf("%w: %v", platforms.ErrRejected, err)
+	}
+	if err := validate.Struct(order); err != nil {
+		return fmt.Errorf("%w: %v", platforms.ErrRejected, err)
+	}
+	items, err := buildOrderItems(ctx, order.Order_ID, orderItems, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %v", platforms.ErrRejected, err)
+	}
+	items, err = scheduleOrder(ctx, &order, items)
+	if errors.Is(err, errSchedule) || errors.Is(err, errSlotFull) {
+		return fmt.Errorf("%w: %v", platforms.ErrRejected, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = inTransaction(ctx, func(sc mongo.SessionContext) error {
+		if _, err := orderCollection.InsertOne(sc, order); err != nil {
+			return err
+		}
+		if _, err := orderItemCollection.InsertMany(sc, items); err != nil {
+			return err
+		}
+		return platformStore.Created(sc, record.ID, record.Attempt_id, now)
+	})
+	if err != nil {
+		unscheduleOrder(ctx, order)
+	}
+	return err
+}
+
+// platformOrderItems turns the items of a platform order into order items
+// for the foods they are mapped to, one for each of the quantity.
+func platformOrderItems(ctx context.Context, platform string,
+	items []platforms.Item) ([]models.OrderItem, error) {
+	externalIDs := []string{}
+	for _, item := range items {
+		externalIDs = append(externalIDs, item.External_id)
+	}
+	result, err := platformMenuCollection.Find(ctx, bson.M{
+		"platform":    platform,
+		"external_id": bson.M{"$in": uniqueStrings(externalIDs)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	mappings := []models.PlatformMenuItem{}
+	if err = result.All(ctx, &mappings); err != nil {
+		return nil, err
+	}
+	byExternalID := map[string]models.PlatformMenuItem{}
+	for _, mapping := range mappings {
+		byExternalID[mapping.External_id] = mapping
+	}
+
+	orderItems := []models.OrderItem{}
+	unmapped := []string{}
+	for _, item := range items {
+		mapping, ok := byExternalID[item.External_id]
+		if !ok {
+			unmapped = append(unmapped, item.External_id)
+			continue
+		}
+		for i := 0; i < item.Quantity; i++ {
+			foodID, size := *mapping.Food_id, *mapping.Size
+			orderItems = append(orderItems, models.OrderItem{
+				Food_id:   &foodID,
+				Quantity:  &size,
+				Modifiers: item.Modifiers,
+			})
+		}
+	}
+	if len(unmapped) > 0 {
+		return nil, fmt.Errorf("%w: no food is mapped to %s", platforms.ErrRejected,
+			strings.Join(uniqueStrings(unmapped), ", "))
+	}
+	return orderItems, nil
+}
+
+// notifyPlatform tells a platform the status of one of its orders on its
+// own, after the request that changed it.
+func notifyPlatform(platformOrderID, status, reason string) {
+	var ctx, cancel = context.WithTimeout(context.Background(),
+		30*time.Second)
+	defer cancel()
+	err := platformIntake.Notify(ctx, platformOrderID, status, reason)
+	if err != nil && !errors.Is(err, platforms.ErrStatus) {
+		log.Println("couldn't tell the platform order", platformOrderID,
+			"is", status, err)
+	}
+}
+
+// platformOrderChanged tells the platform an order came from, if it came
+// from one, how it is getting on after one of its items moved to status:
+// PREPARING once an item is fired, READY once the items left on it are
+// served and CANCELLED once they are all voided.
+func platformOrderChanged(orderID, itemStatus string) {
+	var ctx, cancel = context.WithTimeout(context.Background(),
+		30*time.Second)
+	defer cancel()
+	var record models.PlatformOrder
+	if err := platformOrderCollection.FindOne(ctx, bson.M{
+		"order_id": orderID,
+		"status":   models.PlatformOrderCreated,
+	}).Decode(&record); err != nil {
+		return
+	}
+	var status string
+	switch itemStatus {
+	case models.OrderItemFired:
+		status = platforms.StatusPreparing
+	case models.OrderItemServed, models.OrderItemVoid:
+		open, err := orderItemCollection.CountDocuments(ctx, bson.M{
+			"order_id": orderID,
+			"status": bson.M{"$in": bson.A{models.OrderItemScheduled,
+				models.OrderItemPending, models.OrderItemFired}},
+		})
+		if err != nil || open > 0 {
+			return
+		}
+		served, err := orderItemCollection.CountDocuments(ctx, bson.M{
+			"order_id": orderID, "status": models.OrderItemServed})
+		if err != nil {
+			return
+		}
+		status = platforms.StatusCancelled
+		if served > 0 {
+			status = platforms.StatusReady
+		}
+	default:
+		return
+	}
+	notifyPlatform(record.ID, status, "")
+}
+
+// platformOrderClosed tells the platform an order came from that it is
+// completed.
+func platformOrderClosed(orderID string) {
+	var ctx, cancel = context.WithTimeout(context.Background(),
+		30*time.Second)
+	defer cancel()
+	var record models.PlatformOrder
+	if err := platformOrderCollection.FindOne(ctx, bson.M{
+		"order_id": orderID,
+		"status":   models.PlatformOrderCreated,
+	}).Decode(&record); err != nil {
+		return
+	}
+	notifyPlatform(record.ID, platforms.StatusCompleted, "")
+}
@@ -0,0 +1,516 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"restro/database"
+	"restro/inventory"
+	"restro/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// goodsReceipt is one delivery against a purchase order. Unit_cost is what
+// was actually charged; without it the agreed cost on the line is used.
+type goodsReceipt struct {
+	Lines []struct {
+		Line_ID   string   `json:"line_id" validate:"required"`
+		Quantity  float64  `json:"quantity" validate:"gt=0"`
+		Unit_cost *float64 `json:"unit_cost" validate:"omitempty,gte=0"`
+	} `json:"lines" validate:"required,min=1,dive"`
+	Note string `json:"note"`
+}
+
+type purchaseOrderNote struct {
+	Note string `json:"note"`
+}
+
+// bindPurchaseOrderNote reads the optional note sent with a step of a
+// purchase order. It writes the error response when it fails.
+func bindPurchaseOrderNote(c *gin.Context, body *purchaseOrderNote) bool {
+	if err := c.ShouldBindJSON(body); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+var purchaseOrderCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "purchaseOrder")
+
+var errPurchaseOrderChanged = errors.New(
+	"the purchase order was changed by someone else, reload it and try again")
+
+// GetPurchaseOrders lists purchase orders, newest first, optionally for one
+// status or supplier.
+func GetPurchaseOrders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		filter := bson.M{}
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+		if supplierID := c.Query("supplier_id"); supplierID != "" {
+			filter["supplier_id"] = supplierID
+		}
+		result, err := purchaseOrderCollection.Find(ctx, filter,
+			options.Find().SetSort(bson.M{"created_at": -1}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the purchase orders"})
+			return
+		}
+		allOrders := []models.PurchaseOrder{}
+		if err = result.All(ctx, &allOrders); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the purchase orders"})
+			return
+		}
+		c.JSON(http.StatusOK, allOrders)
+	}
+}
+
+func GetPurchaseOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		order, ok := findPurchaseOrder(ctx, c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+// CreatePurchaseOrder starts a draft. Lines without a unit_cost take the
+// ingredient's current cost.
+func CreatePurchaseOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var order models.PurchaseOrder
+
+		if err := c.BindJSON(&order); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !checkPurchaseOrder(ctx, c, &order) {
+			return
+		}
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		order.ID = primitive.NewObjectID()
+		order.Purchase_order_ID = order.ID.Hex()
+		order.Status = models.PurchaseOrderDraft
+		order.Version = 1
+		order.Created_at = now
+		order.Updated_at = now
+		order.History = []models.PurchaseOrderEvent{purchaseOrderEvent(
+			"created", models.PurchaseOrderDraft, order.Note, c.GetString("uid"))}
+
+		if _, err := purchaseOrderCollection.InsertOne(ctx, order); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "purchase order was not created"})
+			return
+		}
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+// UpdatePurchaseOrder changes the lines, expected date or note of a draft.
+// Once sent, the supplier is working from it and it can't be edited.
+func UpdatePurchaseOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var update models.PurchaseOrder
+
+		if err := c.BindJSON(&update); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		order, ok := findPurchaseOrder(ctx, c)
+		if !ok {
+			return
+		}
+		if order.Status != models.PurchaseOrderDraft {
+			c.JSON(http.StatusConflict,
+				gin.H{"error": "only draft purchase orders can be edited"})
+			return
+		}
+		if update.Supplier_ID != nil {
+			order.Supplier_ID = update.Supplier_ID
+		}
+		if update.Lines != nil {
+			order.Lines = update.Lines
+		}
+		if update.Expected_at != nil {
+			order.Expected_at = update.Expected_at
+		}
+		if update.Note != "" {
+			order.Note = update.Note
+		}
+		if !checkPurchaseOrder(ctx, c, &order) {
+			return
+		}
+		if !savePurchaseOrder(ctx, c, &order, purchaseOrderEvent("updated",
+			order.Status, "", c.GetString("uid"))) {
+			return
+		}
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+// SendPurchaseOrder marks a draft as sent to the supplier.
+func SendPurchaseOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var body purchaseOrderNote
+		if !bindPurchaseOrderNote(c, &body) {
+			return
+		}
+
+		order, ok := findPurchaseOrder(ctx, c)
+		if !ok {
+			return
+		}
+		if order.Status != models.PurchaseOrderDraft {
+			c.JSON(http.StatusConflict,
+				gin.H{"error": "only draft purchase orders can be sent"})
+			return
+		}
+		order.Status = models.PurchaseOrderSent
+		if !savePurchaseOrder(ctx, c, &order, purchaseOrderEvent("sent",
+			order.Status, body.Note, c.GetString("uid"))) {
+			return
+		}
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+// ReceivePurchaseOrder books a delivery, which may cover only part of the
+// order. The stock comes in at the cost actually charged. The order closes
+// once every line has been received in full. The receipt on the order and
+// the stock it brings in are saved together.
+func ReceivePurchaseOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var receipt goodsReceipt
+
+		if err := c.BindJSON(&receipt); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(receipt); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		order, ok := findPurchaseOrder(ctx, c)
+		if !ok {
+			return
+		}
+		if order.Status != models.PurchaseOrderSent &&
+			order.Status != models.PurchaseOrderPartiallyReceived {
+			c.JSON(http.StatusConflict, gin.H{"error": "goods can only be " +
+				"received against a sent purchase order"})
+			return
+		}
+
+		lines := map[string]int{}
+		for i, line := range order.Lines {
+			lines[line.Line_ID] = i
+		}
+		type delivery struct {
+			ingredientID   string
+			quantity, cost float64
+		}
+		deliveries := []delivery{}
+		for _, received := range receipt.Lines {
+			i, ok := lines[received.Line_ID]
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "line " +
+					received.Line_ID + " is not on this purchase order"})
+				return
+			}
+			line := &order.Lines[i]
+			cost := line.Unit_cost
+			if received.Unit_cost != nil {
+				cost = received.Unit_cost
+			}
+			if cost == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "line " +
+					received.Line_ID + " has no unit_cost, send the cost charged"})
+				return
+			}
+			line.Received_quantity += received.Quantity
+			line.Received_cost = toFixed(line.Received_cost+
+				received.Quantity**cost, 2)
+			deliveries = append(deliveries,
+				delivery{line.Ingredient_ID, received.Quantity, *cost})
+		}
+
+		order.Status = models.PurchaseOrderClosed
+		for _, line := range order.Lines {
+			if line.Received_quantity < line.Quantity {
+				order.Status = models.PurchaseOrderPartiallyReceived
+				break
+			}
+		}
+		// The version claimed on the order makes a delivery submitted twice
+		// fail before it is booked into stock twice.
+		event := purchaseOrderEvent("received", order.Status, receipt.Note,
+			c.GetString("uid"))
+		var received models.PurchaseOrder
+		var movements []models.StockMovement
+		err := inTransaction(ctx, func(sc mongo.SessionContext) error {
+			received = order
+			movements = []models.StockMovement{}
+			if err := storePurchaseOrder(sc, &received, event); err != nil {
+				return err
+			}
+			for _, d := range deliveries {
+				movement, err := inventoryService.Receive(sc, d.ingredientID,
+					d.quantity, d.cost, order.Purchase_order_ID, receipt.Note,
+					c.GetString("uid"))
+				if err != nil {
+					return err
+				}
+				movements = append(movements, movement)
+			}
+			return nil
+		})
+		if errors.Is(err, errPurchaseOrderChanged) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "the delivery was not booked: " + err.Error()})
+			return
+		}
+		order = received
+		refreshPlateCosts(ctx)
+		stockEvaluator.Trigger()
+		c.JSON(http.StatusOK, gin.H{"purchase_order": order,
+			"movements": movements})
+	}
+}
+
+// ClosePurchaseOrder closes an order that won't be delivered in full, or
+// cancels a draft.
+func ClosePurchaseOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var body purchaseOrderNote
+		if !bindPurchaseOrderNote(c, &body) {
+			return
+		}
+
+		order, ok := findPurchaseOrder(ctx, c)
+		if !ok {
+			return
+		}
+		if order.Status == models.PurchaseOrderClosed {
+			c.JSON(http.StatusConflict,
+				gin.H{"error": "the purchase order is already closed"})
+			return
+		}
+		order.Status = models.PurchaseOrderClosed
+		if !savePurchaseOrder(ctx, c, &order, purchaseOrderEvent("closed",
+			order.Status, body.Note, c.GetString("uid"))) {
+			return
+		}
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+// GetReorderSuggestions proposes quantities to order from the par levels,
+// the stock on hand and on open purchase orders, and the average daily use
+// over the last days days (default 14) times the supplier's lead time.
+func GetReorderSuggestions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		days, err := strconv.Atoi(c.DefaultQuery("days", "14"))
+		if err != nil || days < 1 {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": "days must be a positive number"})
+			return
+		}
+
+		ingredients, err := inventoryService.Store().Ingredients(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the ingredients"})
+			return
+		}
+		usage, err := inventoryService.Usage(ctx,
+			time.Now().AddDate(0, 0, -days))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while reading the stock ledger"})
+			return
+		}
+
+		onOrder := map[string]float64{}
+		result, err := purchaseOrderCollection.Find(ctx, bson.M{"status": bson.M{
+			"$in": []string{models.PurchaseOrderSent,
+				models.PurchaseOrderPartiallyReceived}}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the purchase orders"})
+			return
+		}
+		var open []models.PurchaseOrder
+		if err = result.All(ctx, &open); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the purchase orders"})
+			return
+		}
+		for _, order := range open {
+			for _, line := range order.Lines {
+				if outstanding := line.Quantity - line.Received_quantity; outstanding > 0 {
+					onOrder[line.Ingredient_ID] += outstanding
+				}
+			}
+		}
+
+		leadTimes := map[string]int{}
+		result, err = supplierCollection.Find(ctx, bson.M{})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the suppliers"})
+			return
+		}
+		var suppliers []models.Supplier
+		if err = result.All(ctx, &suppliers); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the suppliers"})
+			return
+		}
+		for _, supplier := range suppliers {
+			if supplier.Lead_time_days != nil {
+				leadTimes[supplier.Supplier_ID] = *supplier.Lead_time_days
+			}
+		}
+
+		c.JSON(http.StatusOK, inventory.SuggestReorders(ingredients, usage,
+			days, onOrder, leadTimes))
+	}
+}
+
+func findPurchaseOrder(ctx context.Context, c *gin.Context) (models.PurchaseOrder, bool) {
+	var order models.PurchaseOrder
+	err := purchaseOrderCollection.FindOne(ctx, bson.M{
+		"purchase_order_id": c.Param("purchase_order_id")}).Decode(&order)
+	if err != nil {
+		c.JSON(http.StatusNotFound,
+			gin.H{"error": "couldn't find any purchase order with given ID"})
+		return order, false
+	}
+	return order, true
+}
+
+// checkPurchaseOrder validates a draft, that its supplier and ingredients
+// exist, and fills in line IDs and missing unit costs.
+func checkPurchaseOrder(ctx context.Context, c *gin.Context,
+	order *models.PurchaseOrder) bool {
+	if validationErr := validate.Struct(order); validationErr != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+		return false
+	}
+	if !supplierExists(ctx, *order.Supplier_ID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "supplier was not found"})
+		return false
+	}
+	for i := range order.Lines {
+		line := &order.Lines[i]
+		ingredient, err := inventoryService.Store().Ingredient(ctx,
+			line.Ingredient_ID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ingredient " +
+				line.Ingredient_ID + " was not found"})
+			return false
+		}
+		if line.Line_ID == "" {
+			line.Line_ID = primitive.NewObjectID().Hex()
+		}
+		if line.Unit_cost == nil && ingredient.Cost_per_unit != nil {
+			cost := *ingredient.Cost_per_unit
+			line.Unit_cost = &cost
+		}
+		line.Received_quantity = 0
+		line.Received_cost = 0
+	}
+	return true
+}
+
+func purchaseOrderEvent(action, status, note, by string) models.PurchaseOrderEvent {
+	var event models.PurchaseOrderEvent
+	event.Action = action
+	event.Status = status
+	event.Note = note
+	event.Created_by = by
+	event.Created_at, _ = time.Parse(time.RFC3339,
+		time.Now().Format(time.RFC3339))
+	return event
+}
+
+// savePurchaseOrder writes the order back with storePurchaseOrder. It
+// writes the error response when it fails.
+func savePurchaseOrder(ctx context.Context, c *gin.Context,
+	order *models.PurchaseOrder, event models.PurchaseOrderEvent) bool {
+	err := storePurchaseOrder(ctx, order, event)
+	if errors.Is(err, errPurchaseOrderChanged) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError,
+			gin.H{"error": "purchase order update failed"})
+		return false
+	}
+	return true
+}
+
+// storePurchaseOrder writes the order back with the event added to its
+// audit trail, provided nobody saved it since it was read.
+func storePurchaseOrder(ctx context.Context, order *models.PurchaseOrder,
+	event models.PurchaseOrderEvent) error {
+	version := order.Version
+	order.Version++
+	order.Updated_at = event.Created_at
+	order.History = append(order.History, event)
+
+	result, err := purchaseOrderCollection.ReplaceOne(ctx, bson.M{
+		"purchase_order_id": order.Purchase_order_ID,
+		"version":           version,
+	}, order)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errPurchaseOrderChanged
+	}
+	return nil
+}
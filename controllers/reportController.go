@@ -0,0 +1,451 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"restro/accounting"
+	"restro/database"
+	"restro/labour"
+	"restro/models"
+	"restro/reports"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var reportRepository = reports.NewMongoRepository(orderItemCollection,
+	orderCollection, foodCollection, menuCollection, tableCollection,
+	userCollection)
+
+var openingHoursCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "openingHours")
+
+// reportTimeZone is REPORT_TIMEZONE, the zone reports bucket days and hours
+// in unless the request asks for another. It defaults to UTC.
+func reportTimeZone() string {
+	if zone := os.Getenv("REPORT_TIMEZONE"); zone != "" {
+		return zone
+	}
+	return "UTC"
+}
+
+// reportQuery reads the period a report covers. tz is an IANA time zone;
+// from and to are RFC 3339 times or dates in that zone, to being inclusive
+// for a date. It defaults to the 30 days up to now and writes the error
+// response when a parameter doesn't parse.
+func reportQuery(c *gin.Context) (reports.Query, bool) {
+	var q reports.Query
+	zone := c.DefaultQuery("tz", reportTimeZone())
+	location, err := time.LoadLocation(zone)
+	if err != nil || zone == "Local" {
+		c.JSON(http.StatusBadRequest,
+			gin.H{"error": "tz must be an IANA time zone such as Europe/London"})
+		return q, false
+	}
+	q.Location = location
+
+	parse := func(key string, endOfDay bool) (*time.Time, bool) {
+		raw := c.Query(key)
+		if raw == "" {
+			return nil, true
+		}
+		if at, err := time.Parse(time.RFC3339, raw); err == nil {
+			return &at, true
+		}
+		day, err := time.ParseInLocation("2006-01-02", raw, location)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": key +
+				" must be an RFC 3339 time or a YYYY-MM-DD date"})
+			return nil, false
+		}
+		if endOfDay {
+			day = day.AddDate(0, 0, 1)
+		}
+		return &day, true
+	}
+	from, ok := parse("from", false)
+	if !ok {
+		return q, false
+	}
+	to, ok := parse("to", true)
+	if !ok {
+		return q, false
+	}
+
+	q.To = time.Now().In(location)
+	if to != nil {
+		q.To = *to
+	}
+	if from != nil {
+		q.From = *from
+	} else {
+		today := time.Date(q.To.Year(), q.To.Month(), q.To.Day(), 0, 0, 0, 0,
+			location)
+		q.From = today.AddDate(0, 0, -29)
+	}
+	if !q.From.Before(q.To) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return q, false
+	}
+	return q, true
+}
+
+// errUnknownDimension lists the dimensions revenue can be reported by.
+func errUnknownDimension() error {
+	names := make([]string, 0, len(reports.Dimensions))
+	for _, dimension := range reports.Dimensions {
+		names = append(names, string(dimension))
+	}
+	last := len(names) - 1
+	return errors.New("revenue can be reported by " +
+		strings.Join(names[:last], ", ") + " or " + names[last])
+}
+
+// GetRevenueReport breaks revenue down by day, hour, weekday, category,
+// food, table, staff or order type.
+func GetRevenueReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		by := reports.Dimension(c.Param("dimension"))
+		if !by.Valid() {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": errUnknownDimension().Error()})
+			return
+		}
+		q, ok := reportQuery(c)
+		if !ok {
+			return
+		}
+		rows, err := reportRepository.Revenue(ctx, q, by)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while building the report"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"from":      q.From,
+			"to":        q.To,
+			"time_zone": q.Location.String(),
+			"by":        by,
+			"rows":      rows,
+		})
+	}
+}
+
+// GetSalesSummary reports revenue, average ticket, covers and revenue per
+// seat hour for the period.
+func GetSalesSummary() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		q, ok := reportQuery(c)
+		if !ok {
+			return
+		}
+		summary, err := salesSummary(ctx, q)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while building the report"})
+			return
+		}
+		c.JSON(http.StatusOK, summary)
+	}
+}
+
+// salesSummary is the sales summary for the period, with seat hours over
+// the opening hours.
+func salesSummary(ctx context.Context, q reports.Query) (reports.Summary,
+	error) {
+	hours, err := loadOpeningHours(ctx)
+	if err != nil {
+		return reports.Summary{}, err
+	}
+	q.Opening_hours = &hours
+	return reportRepository.Summary(ctx, q)
+}
+
+func GetOpeningHours() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		hours, err := loadOpeningHours(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while reading the opening hours"})
+			return
+		}
+		c.JSON(http.StatusOK, hours)
+	}
+}
+
+// UpdateOpeningHours replaces the opening hours, which seat hours are
+// counted over from then on, for past periods too.
+func UpdateOpeningHours() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var hours models.OpeningHours
+
+		if err := c.BindJSON(&hours); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(hours); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		if _, err := time.LoadLocation(hours.Time_zone); err != nil ||
+			hours.Time_zone == "Local" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "time_zone must " +
+				"be an IANA time zone such as Europe/London"})
+			return
+		}
+		if hours.Periods == nil {
+			hours.Periods = []models.OpeningPeriod{}
+		}
+		hours.Settings_ID = "default"
+		hours.Updated_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		_, err := openingHoursCollection.ReplaceOne(ctx,
+			bson.M{"settings_id": "default"}, hours,
+			options.Replace().SetUpsert(true))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "opening hours update failed"})
+			return
+		}
+		c.JSON(http.StatusOK, hours)
+	}
+}
+
+// loadOpeningHours reads the opening hours, which default to none, so that
+// the whole of a period counts as open.
+func loadOpeningHours(ctx context.Context) (models.OpeningHours, error) {
+	var hours models.OpeningHours
+	err := openingHoursCollection.FindOne(ctx,
+		bson.M{"settings_id": "default"}).Decode(&hours)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.OpeningHours{
+			Time_zone:   reportTimeZone(),
+			Periods:     []models.OpeningPeriod{},
+			Settings_ID: "default",
+		}, nil
+	}
+	return hours, err
+}
+
+// GetLabourReport compares scheduled and actual hours per staff member and
+// role, and puts labour cost against the sales invoiced in the period, net
+// of tax.
+func GetLabourReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		q, ok := reportQuery(c)
+		if !ok {
+			return
+		}
+		report, err := labourReport(ctx, q)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while building the report"})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+func labourReport(ctx context.Context, q reports.Query) (labour.Report, error) {
+	var report labour.Report
+	result, err := shiftCollection.Find(ctx, bson.M{
+		"start": bson.M{"$lt": q.To},
+		"end":   bson.M{"$gt": q.From},
+	})
+	if err != nil {
+		return report, err
+	}
+	var shifts []models.Shift
+	if err = result.All(ctx, &shifts); err != nil {
+		return report, err
+	}
+	result, err = timeClockCollection.Find(ctx, clockedBetween(q.From, q.To))
+	if err != nil {
+		return report, err
+	}
+	var entries []models.TimeClockEntry
+	if err = result.All(ctx, &entries); err != nil {
+		return report, err
+	}
+
+	userIDs := []string{}
+	for _, shift := range shifts {
+		userIDs = append(userIDs, derefString(shift.User_id))
+	}
+	for _, entry := range entries {
+		userIDs = append(userIDs, entry.User_id)
+	}
+	result, err = userCollection.Find(ctx,
+		bson.M{"user_id": bson.M{"$in": userIDs}})
+	if err != nil {
+		return report, err
+	}
+	var users []models.User
+	if err = result.All(ctx, &users); err != nil {
+		return report, err
+	}
+	rates := map[string]float64{}
+	names := map[string]string{}
+	for _, user := range users {
+		if user.Hourly_rate != nil {
+			rates[user.User_id] = *user.Hourly_rate
+		}
+		names[user.User_id] = strings.TrimSpace(derefString(user.First_name) +
+			" " + derefString(user.Last_name))
+	}
+
+	settings, err := loadAccountingSettings(ctx)
+	if err != nil {
+		return report, err
+	}
+	invoices, err := invoiceAmounts(ctx,
+		bson.M{"created_at": bson.M{"$gte": q.From, "$lt": q.To}})
+	if err != nil {
+		return report, err
+	}
+	var sales float64
+	for _, invoice := range invoices {
+		_, net, _ := accounting.InvoiceTotals(settings, invoice)
+		sales += net
+	}
+	return labour.Build(q.From, q.To, time.Now(), shifts, entries, rates,
+		names, sales), nil
+}
+
+// serverReportRow is a server's sales and the tips they took.
+type serverReportRow struct {
+	Server_id      string  `json:"server_id"`
+	Name           string  `json:"name"`
+	Revenue        float64 `json:"revenue"`
+	Orders         int     `json:"orders"`
+	Items          int     `json:"items"`
+	Average_ticket float64 `json:"average_ticket"`
+	Tips           float64 `json:"tips"`
+	Tip_percent    float64 `json:"tip_percent"`
+}
+
+// GetServerReport reports sales and tips per server, going by who served
+// each order after any table transfers.
+func GetServerReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		q, ok := reportQuery(c)
+		if !ok {
+			return
+		}
+		revenue, err := reportRepository.Revenue(ctx, q, reports.ByStaff)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while building the report"})
+			return
+		}
+		tips, err := serverTips(ctx, q)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while building the report"})
+			return
+		}
+
+		rows := []serverReportRow{}
+		for _, row := range revenue {
+			rows = append(rows, serverReportRow{
+				Server_id:      row.Key,
+				Name:           row.Label,
+				Revenue:        row.Revenue,
+				Orders:         row.Orders,
+				Items:          row.Items,
+				Average_ticket: row.Average_ticket,
+				Tips:           tips[row.Key],
+			})
+			delete(tips, row.Key)
+		}
+		for serverID, tip := range tips {
+			row := serverReportRow{Server_id: serverID, Tips: tip}
+			if user, err := findStaff(ctx, serverID); err == nil {
+				row.Name = strings.TrimSpace(derefString(user.First_name) +
+					" " + derefString(user.Last_name))
+			}
+			rows = append(rows, row)
+		}
+		for i := range rows {
+			rows[i].Tips = toFixed(rows[i].Tips, 2)
+			if rows[i].Revenue > 0 {
+				rows[i].Tip_percent = toFixed(
+					rows[i].Tips/rows[i].Revenue*100, 2)
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"from":      q.From,
+			"to":        q.To,
+			"time_zone": q.Location.String(),
+			"rows":      rows,
+		})
+	}
+}
+
+// serverTips totals the tips taken in the period by the server of each
+// order, net of tips refunded.
+func serverTips(ctx context.Context, q reports.Query) (map[string]float64, error) {
+	cursor, err := paymentCollection.Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{
+			"created_at": bson.M{"$gte": q.From, "$lt": q.To},
+			"tip":        bson.M{"$gt": 0},
+		}},
+		bson.M{"$lookup": bson.M{
+			"from":         orderCollection.Name(),
+			"localField":   "order_id",
+			"foreignField": "order_id",
+			"as":           "order",
+		}},
+		bson.M{"$unwind": bson.M{"path": "$order",
+			"preserveNullAndEmptyArrays": true}},
+		bson.M{"$group": bson.M{
+			"_id": bson.M{"$ifNull": bson.A{"$order.server_id",
+				"$order.created_by", ""}},
+			"tips": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$kind", models.PaymentKindRefund}},
+				bson.M{"$multiply": bson.A{"$tip", -1}},
+				"$tip",
+			}}},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var totals []struct {
+		Server_id string  `bson:"_id"`
+		Tips      float64 `bson:"tips"`
+	}
+	if err = cursor.All(ctx, &totals); err != nil {
+		return nil, err
+	}
+	tips := map[string]float64{}
+	for _, total := range totals {
+		tips[total.Server_id] = total.Tips
+	}
+	return tips, nil
+}
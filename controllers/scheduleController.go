@@ -0,0 +1,552 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"restro/database"
+	"restro/models"
+	"restro/scheduling"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var schedulingSettingsCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "schedulingSettings")
+var scheduleSlotCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "scheduleSlot")
+
+var (
+	errSchedule      = errors.New("the order can't be scheduled")
+	errSlotFull      = errors.New("that time is fully booked, pick another")
+	errOrderReleased = errors.New("the order has already gone to the kitchen")
+)
+
+// scheduleSlot is a slot as the booking screen shows it. Available is nil
+// when slots aren't capped.
+type scheduleSlot struct {
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Orders    int       `json:"orders"`
+	Capacity  int       `json:"capacity"`
+	Available *int      `json:"available"`
+}
+
+func GetSchedulingSettings() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		settings, err := loadSchedulingSettings(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while reading the settings"})
+			return
+		}
+		c.JSON(http.StatusOK, settings)
+	}
+}
+
+// UpdateSchedulingSettings replaces the slot capacity and release timing.
+// Orders already booked keep their release time.
+func UpdateSchedulingSettings() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var settings models.SchedulingSettings
+
+		if err := c.BindJSON(&settings); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(settings); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		settings.Settings_ID = "default"
+		settings.Updated_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		_, err := schedulingSettingsCollection.ReplaceOne(ctx,
+			bson.M{"settings_id": "default"}, settings,
+			options.Replace().SetUpsert(true))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "settings update failed"})
+			return
+		}
+		c.JSON(http.StatusOK, settings)
+	}
+}
+
+// GetScheduleSlots lists the slots of a day (date, YYYY-MM-DD in tz, by
+// default today) with how many orders are booked into each.
+func GetScheduleSlots() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		zone := c.DefaultQuery("tz", reportTimeZone())
+		location, err := time.LoadLocation(zone)
+		if err != nil || zone == "Local" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "tz must be an " +
+				"IANA time zone such as Europe/London"})
+			return
+		}
+		now := time.Now().In(location)
+		day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0,
+			location)
+		if raw := c.Query("date"); raw != "" {
+			if day, err = time.ParseInLocation("2006-01-02", raw,
+				location); err != nil {
+				c.JSON(http.StatusBadRequest,
+					gin.H{"error": "date must be a YYYY-MM-DD date"})
+				return
+			}
+		}
+		next := day.AddDate(0, 0, 1)
+		settings, err := loadSchedulingSettings(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while reading the settings"})
+			return
+		}
+		result, err := scheduleSlotCollection.Find(ctx, bson.M{
+			"start": bson.M{"$gte": day, "$lt": next}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the slots"})
+			return
+		}
+		var booked []models.ScheduleSlot
+		if err = result.All(ctx, &booked); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the slots"})
+			return
+		}
+		orders := map[string]int{}
+		for _, slot := range booked {
+			orders[slot.ID] = slot.Orders
+		}
+
+		slots := []scheduleSlot{}
+		for _, start := range scheduling.Slots(day, next) {
+			slot := scheduleSlot{
+				Start:    start.In(location),
+				End:      start.Add(scheduling.SlotLength).In(location),
+				Orders:   orders[scheduling.SlotID(start)],
+				Capacity: settings.Slot_capacity,
+			}
+			if settings.Slot_capacity > 0 {
+				available := settings.Slot_capacity - slot.Orders
+				if available < 0 {
+					available = 0
+				}
+				slot.Available = &available
+			}
+			slots = append(slots, slot)
+		}
+		c.JSON(http.StatusOK, slots)
+	}
+}
+
+// GetScheduledOrders lists the orders placed ahead that are still waiting
+// to go to the kitchen, next to go first.
+func GetScheduledOrders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		result, err := orderCollection.Find(ctx, bson.M{
+			"scheduled_for": bson.M{"$ne": nil},
+			"released_at":   nil,
+			"closed_at":     nil,
+		}, options.Find().SetSort(bson.M{"release_at": 1}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing scheduled orders"})
+			return
+		}
+		allOrders := []models.Order{}
+		if err = result.All(ctx, &allOrders); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing scheduled orders"})
+			return
+		}
+		c.JSON(http.StatusOK, allOrders)
+	}
+}
+
+// ReleaseOrder sends a scheduled order to the kitchen now rather than at
+// its release time.
+func ReleaseOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		order, err := findOrder(ctx, c.Param("order_id"))
+		if err != nil {
+			orderMoveError(c, err)
+			return
+		}
+		if order.Scheduled_for == nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": "the order isn't scheduled"})
+			return
+		}
+		released, err := releaseOrder(ctx, order.Order_ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "the order couldn't be released"})
+			return
+		}
+		if !released {
+			c.JSON(http.StatusConflict, gin.H{"error": errOrderReleased.Error()})
+			return
+		}
+		order, err = findOrder(ctx, order.Order_ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "the order was released but couldn't be read"})
+			return
+		}
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+// RunOrderScheduler sends scheduled orders to the kitchen as they fall due.
+// It blocks, so start it in its own goroutine.
+func RunOrderScheduler(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		if err := ReleaseDueOrders(ctx); err != nil {
+			log.Println("couldn't release scheduled orders:", err)
+		}
+		cancel()
+	}
+}
+
+// ReleaseDueOrders sends the scheduled orders whose release time has come
+// to the kitchen.
+func ReleaseDueOrders(ctx context.Context) error {
+	result, err := orderCollection.Find(ctx, bson.M{
+		"scheduled_for": bson.M{"$ne": nil},
+		"release_at":    bson.M{"$lte": time.Now()},
+		"released_at":   nil,
+	}, options.Find().SetSort(bson.M{"release_at": 1}))
+	if err != nil {
+		return err
+	}
+	var due []models.Order
+	if err = result.All(ctx, &due); err != nil {
+		return err
+	}
+	for _, order := range due {
+		if _, err := releaseOrder(ctx, order.Order_ID); err != nil {
+			log.Println("couldn't release order", order.Order_ID, err)
+		}
+	}
+	return nil
+}
+
+// releaseOrder marks a scheduled order released and puts its held items in
+// the kitchen queue, in one transaction. It is false when the order was
+// already released.
+func releaseOrder(ctx context.Context, orderID string) (bool, error) {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	released := false
+	err := inTransaction(ctx, func(sc mongo.SessionContext) error {
+		released = false
+		result, err := orderCollection.UpdateOne(sc, bson.M{
+			"order_id":      orderID,
+			"scheduled_for": bson.M{"$ne": nil},
+			"released_at":   nil,
+		}, bson.M{"$set": bson.M{"released_at": now, "updated_at": now}})
+		if err != nil || result.MatchedCount == 0 {
+			return err
+		}
+		released = true
+		_, err = orderItemCollection.UpdateMany(sc, bson.M{
+			"order_id": orderID,
+			"status":   models.OrderItemScheduled,
+		}, bson.M{"$set": bson.M{"status": models.OrderItemPending,
+			"updated_at": now}})
+		return err
+	})
+	return released, err
+}
+
+// scheduleOrder books an order placed ahead into its slot and works out
+// when it goes to the kitchen, as planSchedule does. Orders that aren't
+// scheduled are left as they are.
+func scheduleOrder(ctx context.Context, order *models.Order,
+	orderItems []interface{}) ([]interface{}, error) {
+	orderItems, err := planSchedule(ctx, order, orderItems)
+	if err != nil || order.Scheduled_for == nil {
+		return orderItems, err
+	}
+	settings, err := loadSchedulingSettings(ctx)
+	if err != nil {
+		return orderItems, err
+	}
+	return orderItems, reserveSlot(ctx, *order.Scheduled_for,
+		settings.Slot_capacity)
+}
+
+// unscheduleOrder gives back the slot of an order that was booked but
+// couldn't be saved.
+func unscheduleOrder(ctx context.Context, order models.Order) {
+	if order.Scheduled_for == nil {
+		return
+	}
+	if err := freeSlot(ctx, *order.Scheduled_for); err != nil {
+		log.Println("couldn't free the slot of order", order.Order_ID, err)
+	}
+}
+
+// freeEmptyOrderSlot gives back the slot of a scheduled order that hasn't
+// gone to the kitchen and has nothing left to make, its items all voided.
+// An order paid for ahead still keeps its slot. The order is marked so the
+// slot is only given back once.
+func freeEmptyOrderSlot(ctx context.Context, orderID string) {
+	live, err := orderItemCollection.CountDocuments(ctx, bson.M{
+		"order_id": orderID,
+		"status":   bson.M{"$ne": models.OrderItemVoid},
+	})
+	if err != nil || live > 0 {
+		return
+	}
+	var order models.Order
+	err = orderCollection.FindOneAndUpdate(ctx, bson.M{
+		"order_id":      orderID,
+		"scheduled_for": bson.M{"$ne": nil},
+		"released_at":   nil,
+		"slot_freed":    bson.M{"$ne": true},
+	}, bson.M{"$set": bson.M{"slot_freed": true}}).Decode(&order)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return
+	}
+	if err == nil {
+		err = freeSlot(ctx, *order.Scheduled_for)
+	}
+	if err != nil {
+		log.Println("couldn't free the slot of order", orderID, err)
+	}
+}
+
+// planSchedule checks a scheduled order and sets when it goes to the
+// kitchen from how long its items take to make. Until then the items are
+// held as SCHEDULED; an order due already goes straight away. It is
+// promised for when it is wanted unless promised otherwise.
+func planSchedule(ctx context.Context, order *models.Order,
+	orderItems []interface{}) ([]interface{}, error) {
+	order.Release_at = nil
+	order.Released_at = nil
+	order.Slot_freed = false
+	if order.Scheduled_for == nil {
+		return orderItems, nil
+	}
+	if kind := orderType(*order); kind != models.OrderTakeaway &&
+		kind != models.OrderDelivery {
+		return orderItems, fmt.Errorf("%w: only takeaway and delivery "+
+			"orders can be scheduled", errSchedule)
+	}
+	now := time.Now()
+	if !order.Scheduled_for.After(now) {
+		return orderItems, fmt.Errorf("%w: scheduled_for must be in the "+
+			"future", errSchedule)
+	}
+	settings, err := loadSchedulingSettings(ctx)
+	if err != nil {
+		return orderItems, err
+	}
+	var foodIDs []string
+	for _, item := range orderItems {
+		foodIDs = append(foodIDs, derefString(item.(models.OrderItem).Food_id))
+	}
+	foods, err := foodsByID(ctx, uniqueStrings(foodIDs))
+	if err != nil {
+		return orderItems, err
+	}
+	prepMinutes := make([]*int, 0, len(orderItems))
+	for _, item := range orderItems {
+		food := foods[derefString(item.(models.OrderItem).Food_id)]
+		prepMinutes = append(prepMinutes, food.Prep_minutes)
+	}
+
+	releaseAt := scheduling.ReleaseAt(*order.Scheduled_for, prepMinutes,
+		settings.Default_prep_minutes, settings.Buffer_minutes).
+		Truncate(time.Second)
+	order.Release_at = &releaseAt
+	if order.Promised_at == nil {
+		order.Promised_at = order.Scheduled_for
+	}
+	if !releaseAt.After(now) {
+		releasedAt, _ := time.Parse(time.RFC3339, now.Format(time.RFC3339))
+		order.Released_at = &releasedAt
+		return orderItems, nil
+	}
+	held := make([]interface{}, 0, len(orderItems))
+	for _, item := range orderItems {
+		orderItem := item.(models.OrderItem)
+		status := models.OrderItemScheduled
+		orderItem.Status = &status
+		held = append(held, orderItem)
+	}
+	return held, nil
+}
+
+// planReschedule checks that a scheduled order that hasn't gone to the
+// kitchen yet can move to another time, and returns it as it would be.
+// rescheduleOrder makes the move.
+func planReschedule(ctx context.Context, order models.Order,
+	wanted time.Time) (models.Order, error) {
+	if order.Scheduled_for == nil {
+		return order, fmt.Errorf("%w: the order isn't scheduled", errSchedule)
+	}
+	if order.Released_at != nil {
+		return order, errOrderReleased
+	}
+	if order.Slot_freed {
+		return order, fmt.Errorf("%w: the order has nothing left to make",
+			errSchedule)
+	}
+	result, err := orderItemCollection.Find(ctx, bson.M{
+		"order_id": order.Order_ID,
+		"status":   models.OrderItemScheduled,
+	})
+	if err != nil {
+		return order, err
+	}
+	var items []models.OrderItem
+	if err = result.All(ctx, &items); err != nil {
+		return order, err
+	}
+	orderItems := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		orderItems = append(orderItems, item)
+	}
+
+	changed := order
+	changed.Scheduled_for = &wanted
+	if order.Promised_at != nil && order.Promised_at.Equal(*order.Scheduled_for) {
+		changed.Promised_at = nil
+	}
+	if _, err := planSchedule(ctx, &changed, orderItems); err != nil {
+		return order, err
+	}
+	return changed, nil
+}
+
+// rescheduleOrder moves a scheduled order to the time planReschedule
+// worked out for it, moving its booking to the new slot.
+func rescheduleOrder(ctx context.Context, order,
+	changed models.Order) (models.Order, error) {
+	wanted := *changed.Scheduled_for
+	moved := scheduling.SlotID(wanted) != scheduling.SlotID(*order.Scheduled_for)
+	if moved {
+		settings, err := loadSchedulingSettings(ctx)
+		if err != nil {
+			return order, err
+		}
+		if err := reserveSlot(ctx, wanted, settings.Slot_capacity); err != nil {
+			return order, err
+		}
+	}
+	changed.Updated_at, _ = time.Parse(time.RFC3339,
+		time.Now().Format(time.RFC3339))
+	update, err := orderCollection.UpdateOne(ctx, bson.M{
+		"order_id":      order.Order_ID,
+		"scheduled_for": order.Scheduled_for,
+		"released_at":   nil,
+	}, bson.M{"$set": bson.M{
+		"scheduled_for": changed.Scheduled_for,
+		"release_at":    changed.Release_at,
+		"promised_at":   changed.Promised_at,
+		"updated_at":    changed.Updated_at,
+	}})
+	if err == nil && update.MatchedCount == 0 {
+		err = errOrderChanged
+	}
+	if err != nil {
+		if moved {
+			unscheduleOrder(ctx, changed)
+		}
+		return order, err
+	}
+	if moved {
+		unscheduleOrder(ctx, order)
+	}
+	if changed.Released_at != nil {
+		// the new time is close enough that it has to go now
+		if _, err := releaseOrder(ctx, order.Order_ID); err != nil {
+			return order, err
+		}
+	}
+	return findOrder(ctx, order.Order_ID)
+}
+
+// reserveSlot counts an order into the slot wanted falls in, unless that
+// would take it over capacity. The count only goes up while below
+// capacity; when it doesn't match, the upsert collides with the slot's
+// existing document and the slot is full.
+func reserveSlot(ctx context.Context, wanted time.Time, capacity int) error {
+	filter := bson.M{"_id": scheduling.SlotID(wanted)}
+	if capacity > 0 {
+		filter["orders"] = bson.M{"$lt": capacity}
+	}
+	_, err := scheduleSlotCollection.UpdateOne(ctx, filter, bson.M{
+		"$inc":         bson.M{"orders": 1},
+		"$setOnInsert": bson.M{"start": scheduling.Slot(wanted)},
+	}, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return errSlotFull
+	}
+	return err
+}
+
+func freeSlot(ctx context.Context, wanted time.Time) error {
+	_, err := scheduleSlotCollection.UpdateOne(ctx, bson.M{
+		"_id":    scheduling.SlotID(wanted),
+		"orders": bson.M{"$gt": 0},
+	}, bson.M{"$inc": bson.M{"orders": -1}})
+	return err
+}
+
+// loadSchedulingSettings reads the settings, which default to uncapped
+// slots, 15 minutes to make a food and a 5 minute buffer.
+func loadSchedulingSettings(ctx context.Context) (models.SchedulingSettings, error) {
+	var settings models.SchedulingSettings
+	err := schedulingSettingsCollection.FindOne(ctx,
+		bson.M{"settings_id": "default"}).Decode(&settings)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.SchedulingSettings{
+			Buffer_minutes:       5,
+			Default_prep_minutes: 15,
+			Settings_ID:          "default",
+		}, nil
+	}
+	return settings, err
+}
+
+func scheduleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errSchedule):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errSlotFull), errors.Is(err, errOrderReleased),
+		errors.Is(err, errOrderChanged):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError,
+			gin.H{"error": "the order couldn't be scheduled"})
+	}
+}
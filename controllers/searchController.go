@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"restro/search"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var foodSearch search.Repository = search.NewMongoRepository(foodCollection,
+	menuCollection)
+var searchIndexOnce sync.Once
+
+func SearchFoods() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+
+		searchIndexOnce.Do(func() {
+			if err := foodSearch.EnsureIndexes(ctx); err != nil {
+				log.Println("couldn't create the search indexes:", err)
+			}
+		})
+
+		query := search.Query{
+			Text:     c.Query("q"),
+			Match:    c.Query("match"),
+			Category: c.Query("category"),
+			Sort:     c.Query("sort"),
+		}
+		if tags := c.Query("tags"); tags != "" {
+			query.Tags = strings.Split(tags, ",")
+		}
+		var err error
+		if query.Min_price, err = queryFloat(c, "min_price"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_price must be a number"})
+			return
+		}
+		if query.Max_price, err = queryFloat(c, "max_price"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_price must be a number"})
+			return
+		}
+		query.RecordPerPage, _ = strconv.Atoi(c.Query("recordPerPage"))
+		query.Page, _ = strconv.Atoi(c.Query("page"))
+
+		result, err := foodSearch.Search(ctx, query)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while searching the foods"})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// queryFloat parses an optional numeric query parameter.
+func queryFloat(c *gin.Context, key string) (*float64, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
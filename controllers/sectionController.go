@@ -0,0 +1,438 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"restro/database"
+	"restro/models"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var sectionCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "section")
+
+// tableTransfer hands open orders to another server: those on the tables
+// listed, or else every open order of the server handing over.
+type tableTransfer struct {
+	Table_ids      []string `json:"table_ids"`
+	From_server_id *string  `json:"from_server_id"`
+	Server_id      *string  `json:"server_id" validate:"required"`
+}
+
+// sectionServer is a server on the floor for a section.
+type sectionServer struct {
+	User_id  string    `json:"user_id"`
+	Name     string    `json:"name"`
+	Shift_ID string    `json:"shift_id"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+}
+
+func GetSections() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		allSections, err := loadSections(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the sections"})
+			return
+		}
+		c.JSON(http.StatusOK, allSections)
+	}
+}
+
+func GetSection() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var section models.Section
+		err := sectionCollection.FindOne(ctx,
+			bson.M{"section_id": c.Param("section_id")}).Decode(&section)
+		if err != nil {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any section with given ID"})
+			return
+		}
+		c.JSON(http.StatusOK, section)
+	}
+}
+
+func CreateSection() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var section models.Section
+
+		if err := c.BindJSON(&section); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		section.ID = primitive.NewObjectID()
+		section.Section_ID = section.ID.Hex()
+		if section.Table_ids == nil {
+			section.Table_ids = []string{}
+		}
+		if !checkSection(ctx, c, section) {
+			return
+		}
+		section.Created_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		section.Updated_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+
+		if _, err := sectionCollection.InsertOne(ctx, section); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "section was not created"})
+			return
+		}
+		c.JSON(http.StatusOK, section)
+	}
+}
+
+func UpdateSection() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var update models.Section
+		sectionID := c.Param("section_id")
+
+		if err := c.BindJSON(&update); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var section models.Section
+		if err := sectionCollection.FindOne(ctx,
+			bson.M{"section_id": sectionID}).Decode(&section); err != nil {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any section with given ID"})
+			return
+		}
+		if update.Name != nil {
+			section.Name = update.Name
+		}
+		if update.Table_ids != nil {
+			section.Table_ids = update.Table_ids
+		}
+		if !checkSection(ctx, c, section) {
+			return
+		}
+		section.Updated_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+
+		if _, err := sectionCollection.ReplaceOne(ctx,
+			bson.M{"section_id": sectionID}, section); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "section update failed"})
+			return
+		}
+		c.JSON(http.StatusOK, section)
+	}
+}
+
+// DeleteSection removes a section and takes the servers assigned to it off
+// the floor for their shifts.
+func DeleteSection() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		sectionID := c.Param("section_id")
+		result, err := sectionCollection.DeleteOne(ctx,
+			bson.M{"section_id": sectionID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "section was not deleted"})
+			return
+		}
+		if result.DeletedCount == 0 {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any section with given ID"})
+			return
+		}
+		if _, err := shiftCollection.UpdateMany(ctx,
+			bson.M{"section_id": sectionID},
+			bson.M{"$set": bson.M{"section_id": nil}}); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "section was deleted but its shifts were not updated"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"deleted": sectionID})
+	}
+}
+
+// GetSectionAssignments lists each section with the servers on shift for it
+// at a time (at, RFC 3339), by default now.
+func GetSectionAssignments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		at := time.Now()
+		if raw := c.Query("at"); raw != "" {
+			parsed, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest,
+					gin.H{"error": "at must be an RFC 3339 time"})
+				return
+			}
+			at = parsed
+		}
+		sections, err := loadSections(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the sections"})
+			return
+		}
+		servers, err := serversOnFloor(ctx, at)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while reading the schedule"})
+			return
+		}
+		assignments := []gin.H{}
+		for _, section := range sections {
+			onShift := servers[section.Section_ID]
+			if onShift == nil {
+				onShift = []sectionServer{}
+			}
+			assignments = append(assignments, gin.H{
+				"section_id": section.Section_ID,
+				"name":       section.Name,
+				"table_ids":  section.Table_ids,
+				"servers":    onShift,
+			})
+		}
+		c.JSON(http.StatusOK, gin.H{"at": at, "sections": assignments})
+	}
+}
+
+// TransferTables hands open orders over to another server, for a table
+// changing hands or a server going off shift.
+func TransferTables() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var transfer tableTransfer
+
+		if err := c.BindJSON(&transfer); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(transfer); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		if len(transfer.Table_ids) == 0 && transfer.From_server_id == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "a transfer " +
+				"needs the table_ids or the from_server_id to hand over"})
+			return
+		}
+		to := *transfer.Server_id
+		if _, err := findStaff(ctx, to); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "server was not found"})
+			return
+		}
+
+		filter := bson.M{"closed_at": nil, "server_id": bson.M{"$ne": to}}
+		if len(transfer.Table_ids) > 0 {
+			filter["table_id"] = bson.M{"$in": transfer.Table_ids}
+		}
+		if transfer.From_server_id != nil {
+			filter["$or"] = bson.A{
+				bson.M{"server_id": *transfer.From_server_id},
+				bson.M{"server_id": nil,
+					"created_by": *transfer.From_server_id},
+			}
+		}
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		// a pipeline update, so each order's transfer records the server
+		// it had
+		result, err := orderCollection.UpdateMany(ctx, filter, bson.A{
+			bson.M{"$set": bson.M{
+				"server_transfers": bson.M{"$concatArrays": bson.A{
+					bson.M{"$ifNull": bson.A{"$server_transfers", bson.A{}}},
+					bson.A{bson.M{
+						"from": bson.M{"$ifNull": bson.A{"$server_id",
+							"$created_by", ""}},
+						"to":         to,
+						"created_by": c.GetString("uid"),
+						"created_at": now,
+					}},
+				}},
+				"server_id":  to,
+				"updated_at": now,
+			}},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "table transfer failed"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"server_id": to,
+			"orders_transferred": result.ModifiedCount})
+	}
+}
+
+// assignServer sets the server on a new order: the one asked for, else who
+// is already serving the table, else who took the order.
+func assignServer(ctx context.Context, order *models.Order) error {
+	if order.Server_id != nil {
+		if _, err := findStaff(ctx, *order.Server_id); err != nil {
+			return errors.New("server was not found")
+		}
+		return nil
+	}
+	serverID := order.Created_by
+	if order.Table_ID != nil {
+		if server := tableServer(ctx, *order.Table_ID,
+			time.Now()); server != "" {
+			serverID = server
+		}
+	}
+	if serverID != "" {
+		order.Server_id = &serverID
+	}
+	return nil
+}
+
+// tableServer is who serves a table at a time: the server of its open
+// orders, else the server on shift for its section. It is empty when
+// neither is known.
+func tableServer(ctx context.Context, tableID string, at time.Time) string {
+	var order models.Order
+	err := orderCollection.FindOne(ctx, bson.M{
+		"table_id":  tableID,
+		"closed_at": nil,
+		"server_id": bson.M{"$ne": nil},
+	}, options.FindOne().SetSort(bson.M{"created_at": -1})).Decode(&order)
+	if err == nil {
+		return *order.Server_id
+	}
+	var section models.Section
+	if err := sectionCollection.FindOne(ctx,
+		bson.M{"table_ids": tableID}).Decode(&section); err != nil {
+		return ""
+	}
+	var shift models.Shift
+	if err := shiftCollection.FindOne(ctx, bson.M{
+		"section_id": section.Section_ID,
+		"start":      bson.M{"$lte": at},
+		"end":        bson.M{"$gt": at},
+	}, options.FindOne().SetSort(bson.M{"start": 1})).Decode(&shift); err != nil {
+		return ""
+	}
+	return *shift.User_id
+}
+
+// serversOnFloor returns the servers on shift at a time by section ID.
+func serversOnFloor(ctx context.Context, at time.Time) (map[string][]sectionServer, error) {
+	result, err := shiftCollection.Find(ctx, bson.M{
+		"section_id": bson.M{"$ne": nil},
+		"start":      bson.M{"$lte": at},
+		"end":        bson.M{"$gt": at},
+	}, options.Find().SetSort(bson.M{"start": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var shifts []models.Shift
+	if err = result.All(ctx, &shifts); err != nil {
+		return nil, err
+	}
+	servers := map[string][]sectionServer{}
+	for _, shift := range shifts {
+		server := sectionServer{
+			User_id:  *shift.User_id,
+			Shift_ID: shift.Shift_ID,
+			Start:    *shift.Start,
+			End:      *shift.End,
+		}
+		if user, err := findStaff(ctx, server.User_id); err == nil {
+			server.Name = strings.TrimSpace(derefString(user.First_name) +
+				" " + derefString(user.Last_name))
+		}
+		servers[*shift.Section_ID] = append(servers[*shift.Section_ID], server)
+	}
+	return servers, nil
+}
+
+func loadSections(ctx context.Context) ([]models.Section, error) {
+	result, err := sectionCollection.Find(ctx, bson.M{},
+		options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+	sections := []models.Section{}
+	err = result.All(ctx, &sections)
+	return sections, err
+}
+
+// checkSection validates a section, that its tables exist and that none of
+// them is in another section, writing the error response when it isn't.
+func checkSection(ctx context.Context, c *gin.Context, section models.Section) bool {
+	if validationErr := validate.Struct(section); validationErr != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+		return false
+	}
+	if len(section.Table_ids) == 0 {
+		return true
+	}
+	count, err := tableCollection.CountDocuments(ctx,
+		bson.M{"table_id": bson.M{"$in": section.Table_ids}})
+	if err != nil || int(count) != len(uniqueStrings(section.Table_ids)) {
+		c.JSON(http.StatusBadRequest,
+			gin.H{"error": "some of the tables were not found"})
+		return false
+	}
+	var other models.Section
+	err = sectionCollection.FindOne(ctx, bson.M{
+		"section_id": bson.M{"$ne": section.Section_ID},
+		"table_ids":  bson.M{"$in": section.Table_ids},
+	}).Decode(&other)
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "some of the tables " +
+			"are already in section " + derefString(other.Name),
+			"section_id": other.Section_ID})
+		return false
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusInternalServerError,
+			gin.H{"error": "error occured while checking the sections"})
+		return false
+	}
+	return true
+}
+
+// sectionExists reports whether the section ID is known.
+func sectionExists(ctx context.Context, sectionID string) bool {
+	count, err := sectionCollection.CountDocuments(ctx,
+		bson.M{"section_id": sectionID})
+	return err == nil && count > 0
+}
+
+// uniqueStrings drops repeats, keeping the first of each.
+func uniqueStrings(values []string) []string {
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
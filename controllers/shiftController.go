@@ -0,0 +1,239 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"restro/database"
+	"restro/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var shiftCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "shift")
+
+// GetShifts lists the schedule, optionally for one staff member (user_id),
+// role or section (section_id). Given from or to it only lists shifts overlapping that period.
+func GetShifts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		filter := bson.M{}
+		if userID := c.Query("user_id"); userID != "" {
+			filter["user_id"] = userID
+		}
+		if role := c.Query("role"); role != "" {
+			filter["role"] = role
+		}
+		if sectionID := c.Query("section_id"); sectionID != "" {
+			filter["section_id"] = sectionID
+		}
+		if c.Query("from") != "" || c.Query("to") != "" {
+			q, ok := reportQuery(c)
+			if !ok {
+				return
+			}
+			filter["start"] = bson.M{"$lt": q.To}
+			filter["end"] = bson.M{"$gt": q.From}
+		}
+		result, err := shiftCollection.Find(ctx, filter,
+			options.Find().SetSort(bson.M{"start": 1}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the shifts"})
+			return
+		}
+		allShifts := []models.Shift{}
+		if err = result.All(ctx, &allShifts); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the shifts"})
+			return
+		}
+		c.JSON(http.StatusOK, allShifts)
+	}
+}
+
+func GetShift() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var shift models.Shift
+		err := shiftCollection.FindOne(ctx,
+			bson.M{"shift_id": c.Param("shift_id")}).Decode(&shift)
+		if err != nil {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any shift with given ID"})
+			return
+		}
+		c.JSON(http.StatusOK, shift)
+	}
+}
+
+func CreateShift() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var shift models.Shift
+
+		if err := c.BindJSON(&shift); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		shift.ID = primitive.NewObjectID()
+		shift.Shift_ID = shift.ID.Hex()
+		if !checkShift(ctx, c, shift) {
+			return
+		}
+		shift.Created_by = c.GetString("uid")
+		shift.Created_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		shift.Updated_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+
+		if _, err := shiftCollection.InsertOne(ctx, shift); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "shift was not created"})
+			return
+		}
+		c.JSON(http.StatusOK, shift)
+	}
+}
+
+func UpdateShift() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var update models.Shift
+		shiftID := c.Param("shift_id")
+
+		if err := c.BindJSON(&update); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var shift models.Shift
+		if err := shiftCollection.FindOne(ctx,
+			bson.M{"shift_id": shiftID}).Decode(&shift); err != nil {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any shift with given ID"})
+			return
+		}
+		if update.User_id != nil {
+			shift.User_id = update.User_id
+		}
+		if update.Role != nil {
+			shift.Role = update.Role
+		}
+		if update.Start != nil {
+			shift.Start = update.Start
+		}
+		if update.End != nil {
+			shift.End = update.End
+		}
+		if update.Hourly_rate != nil {
+			shift.Hourly_rate = update.Hourly_rate
+		}
+		if update.Section_ID != nil {
+			// an empty section_id takes the server off the floor
+			shift.Section_ID = update.Section_ID
+			if *update.Section_ID == "" {
+				shift.Section_ID = nil
+			}
+		}
+		if update.Note != "" {
+			shift.Note = update.Note
+		}
+		if !checkShift(ctx, c, shift) {
+			return
+		}
+		shift.Updated_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+
+		if _, err := shiftCollection.ReplaceOne(ctx,
+			bson.M{"shift_id": shiftID}, shift); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "shift update failed"})
+			return
+		}
+		c.JSON(http.StatusOK, shift)
+	}
+}
+
+func DeleteShift() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		result, err := shiftCollection.DeleteOne(ctx,
+			bson.M{"shift_id": c.Param("shift_id")})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "shift was not deleted"})
+			return
+		}
+		if result.DeletedCount == 0 {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any shift with given ID"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"deleted": c.Param("shift_id")})
+	}
+}
+
+// checkShift validates a shift, that its staff member and section exist and
+// that it doesn't overlap another of their shifts, writing the error
+// response when it isn't.
+func checkShift(ctx context.Context, c *gin.Context, shift models.Shift) bool {
+	if validationErr := validate.Struct(shift); validationErr != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+		return false
+	}
+	if !shift.Start.Before(*shift.End) {
+		c.JSON(http.StatusBadRequest,
+			gin.H{"error": "a shift has to end after it starts"})
+		return false
+	}
+	if _, err := findStaff(ctx, *shift.User_id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user was not found"})
+		return false
+	}
+	if shift.Section_ID != nil && !sectionExists(ctx, *shift.Section_ID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "section was not found"})
+		return false
+	}
+	var clash models.Shift
+	err := shiftCollection.FindOne(ctx, bson.M{
+		"user_id":  *shift.User_id,
+		"shift_id": bson.M{"$ne": shift.Shift_ID},
+		"start":    bson.M{"$lt": *shift.End},
+		"end":      bson.M{"$gt": *shift.Start},
+	}).Decode(&clash)
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":    "the shift overlaps another shift of the same user",
+			"shift_id": clash.Shift_ID})
+		return false
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusInternalServerError,
+			gin.H{"error": "error occured while checking the schedule"})
+		return false
+	}
+	return true
+}
+
+// findStaff loads a staff member by user ID.
+func findStaff(ctx context.Context, userID string) (models.User, error) {
+	var user models.User
+	err := userCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&user)
+	return user, err
+}
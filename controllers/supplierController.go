@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"restro/database"
+	"restro/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var supplierCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "supplier")
+
+func GetSuppliers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		result, err := supplierCollection.Find(ctx, bson.M{},
+			options.Find().SetSort(bson.M{"name": 1}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the suppliers"})
+			return
+		}
+		allSuppliers := []models.Supplier{}
+		if err = result.All(ctx, &allSuppliers); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the suppliers"})
+			return
+		}
+		c.JSON(http.StatusOK, allSuppliers)
+	}
+}
+
+func GetSupplier() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var supplier models.Supplier
+		err := supplierCollection.FindOne(ctx,
+			bson.M{"supplier_id": c.Param("supplier_id")}).Decode(&supplier)
+		if err != nil {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any supplier with given ID"})
+			return
+		}
+		c.JSON(http.StatusOK, supplier)
+	}
+}
+
+func CreateSupplier() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var supplier models.Supplier
+
+		if err := c.BindJSON(&supplier); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(supplier); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		supplier.Created_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		supplier.Updated_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		supplier.ID = primitive.NewObjectID()
+		supplier.Supplier_ID = supplier.ID.Hex()
+
+		if _, err := supplierCollection.InsertOne(ctx, supplier); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "supplier was not created"})
+			return
+		}
+		c.JSON(http.StatusOK, supplier)
+	}
+}
+
+func UpdateSupplier() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var update models.Supplier
+		supplierID := c.Param("supplier_id")
+
+		if err := c.BindJSON(&update); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var supplier models.Supplier
+		if err := supplierCollection.FindOne(ctx,
+			bson.M{"supplier_id": supplierID}).Decode(&supplier); err != nil {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any supplier with given ID"})
+			return
+		}
+		if update.Name != nil {
+			supplier.Name = update.Name
+		}
+		if update.Contact_name != nil {
+			supplier.Contact_name = update.Contact_name
+		}
+		if update.Phone != nil {
+			supplier.Phone = update.Phone
+		}
+		if update.Email != nil {
+			supplier.Email = update.Email
+		}
+		if update.Address != nil {
+			supplier.Address = update.Address
+		}
+		if update.Lead_time_days != nil {
+			supplier.Lead_time_days = update.Lead_time_days
+		}
+		if validationErr := validate.Struct(supplier); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		supplier.Updated_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+
+		if _, err := supplierCollection.ReplaceOne(ctx,
+			bson.M{"supplier_id": supplierID}, supplier); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "supplier update failed"})
+			return
+		}
+		c.JSON(http.StatusOK, supplier)
+	}
+}
+
+// supplierExists reports whether the supplier ID is known.
+func supplierExists(ctx context.Context, supplierID string) bool {
+	count, err := supplierCollection.CountDocuments(ctx,
+		bson.M{"supplier_id": supplierID})
+	return err == nil && count > 0
+}
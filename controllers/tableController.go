@@ -75,6 +75,9 @@ func CreateTable() gin.HandlerFunc {
 
 		table.ID = primitive.NewObjectID()
 		table.Table_ID = table.ID.Hex()
+		table.Status = models.TableFree
+		table.Status_updated_at = &table.Created_at
+		table.Guest_tab_id = nil
 
 		result, insertErr := tableCollection.InsertOne(ctx, table)
 		if insertErr != nil {
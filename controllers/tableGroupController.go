@@ -0,0 +1,334 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"restro/database"
+	"restro/floor"
+	"restro/models"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var tableGroupCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "tableGroup")
+
+// GetTableGroups lists the active table groups, or all of them with
+// all=true.
+func GetTableGroups() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		filter := bson.M{"split_at": nil}
+		if c.Query("all") == "true" {
+			filter = bson.M{}
+		}
+		result, err := tableGroupCollection.Find(ctx, filter,
+			options.Find().SetSort(bson.M{"created_at": -1}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the table groups"})
+			return
+		}
+		allGroups := []models.TableGroup{}
+		if err = result.All(ctx, &allGroups); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the table groups"})
+			return
+		}
+		c.JSON(http.StatusOK, allGroups)
+	}
+}
+
+func GetTableGroup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var group models.TableGroup
+		err := tableGroupCollection.FindOne(ctx,
+			bson.M{"group_id": c.Param("group_id")}).Decode(&group)
+		if err != nil {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any table group with given ID"})
+			return
+		}
+		c.JSON(http.StatusOK, group)
+	}
+}
+
+// CreateTableGroup pushes tables together for a party. None of them may be
+// in another group, and at most one may have open orders: a party already
+// seated there keeps its order, and that table becomes the primary.
+func CreateTableGroup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var group models.TableGroup
+
+		if err := c.BindJSON(&group); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		group.Table_ids = uniqueStrings(group.Table_ids)
+		if len(group.Table_ids) < 2 {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": "a table group needs at least two tables"})
+			return
+		}
+		result, err := tableCollection.Find(ctx,
+			bson.M{"table_id": bson.M{"$in": group.Table_ids}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while reading the tables"})
+			return
+		}
+		var tables []models.Table
+		if err = result.All(ctx, &tables); err != nil ||
+			len(tables) != len(group.Table_ids) {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": "some of the tables were not found"})
+			return
+		}
+		open, err := tableOpenOrders(ctx, group.Table_ids)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while reading the orders"})
+			return
+		}
+		if len(open) > 1 {
+			c.JSON(http.StatusConflict, gin.H{"error": "more than one of " +
+				"the tables has open orders; move or merge them first"})
+			return
+		}
+
+		group.Primary_table_id = group.Table_ids[0]
+		for tableID := range open {
+			group.Primary_table_id = tableID
+		}
+		var primary models.Table
+		group.Seats = 0
+		for _, table := range tables {
+			if table.Group_ID != nil {
+				c.JSON(http.StatusConflict, gin.H{"error": "table " +
+					table.Table_ID + " is already in a table group"})
+				return
+			}
+			if table.Number_of_guests != nil {
+				group.Seats += *table.Number_of_guests
+			}
+			if table.Table_ID == group.Primary_table_id {
+				primary = table
+			}
+		}
+		group.ID = primitive.NewObjectID()
+		group.Group_ID = group.ID.Hex()
+		group.Split_at = nil
+		group.Created_by = c.GetString("uid")
+		group.Created_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+
+		// claim the tables only if they are still free of any group, so
+		// two groups can't take the same table
+		claimed, err := tableCollection.UpdateMany(ctx, bson.M{
+			"table_id": bson.M{"$in": group.Table_ids},
+			"group_id": nil,
+		}, bson.M{"$set": bson.M{"group_id": group.Group_ID}})
+		if err != nil || claimed.ModifiedCount != int64(len(group.Table_ids)) {
+			releaseTableGroup(ctx, group.Group_ID)
+			c.JSON(http.StatusConflict, gin.H{"error": "some of the " +
+				"tables were grouped at the same time, try again"})
+			return
+		}
+		if _, err := tableGroupCollection.InsertOne(ctx, group); err != nil {
+			releaseTableGroup(ctx, group.Group_ID)
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "table group was not created"})
+			return
+		}
+		status := floor.Status(primary.Status,
+			floorOrders(open[group.Primary_table_id]))
+		if err := saveGroupStatus(ctx, group.Group_ID, status); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "the " +
+				"table group was created but its status was not set"})
+			return
+		}
+		c.JSON(http.StatusOK, group)
+	}
+}
+
+// SplitTableGroup splits a group back into its tables once its orders are
+// settled. The tables keep the group's status, typically dirty.
+func SplitTableGroup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		groupID := c.Param("group_id")
+		var group models.TableGroup
+		if err := tableGroupCollection.FindOne(ctx,
+			bson.M{"group_id": groupID}).Decode(&group); err != nil {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any table group with given ID"})
+			return
+		}
+		open, err := tableOpenOrders(ctx, []string{group.Primary_table_id})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while reading the orders"})
+			return
+		}
+		if len(open[group.Primary_table_id]) > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "the group has " +
+				"open orders; settle or move them before splitting"})
+			return
+		}
+		splitAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		err = tableGroupCollection.FindOneAndUpdate(ctx,
+			bson.M{"group_id": groupID, "split_at": nil},
+			bson.M{"$set": bson.M{"split_at": splitAt}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).
+			Decode(&group)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusConflict,
+				gin.H{"error": "the table group is already split"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "table group split failed"})
+			return
+		}
+		if err := releaseTableGroup(ctx, groupID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "the " +
+				"table group was split but its tables were not released"})
+			return
+		}
+		c.JSON(http.StatusOK, group)
+	}
+}
+
+// GetAvailableTables finds where a party of guests can sit now: free
+// tables, and free table groups, with enough seats, smallest first.
+func GetAvailableTables() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		guests, err := strconv.Atoi(c.Query("guests"))
+		if err != nil || guests < 1 {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": "guests must be a whole number above zero"})
+			return
+		}
+		tables, groups, err := liveFloor(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while reading the floor"})
+			return
+		}
+		statuses := map[string]string{}
+		available := []floorTable{}
+		for _, table := range tables {
+			statuses[table.Table_id] = table.Status
+			if table.Group_id == nil && table.Status == models.TableFree &&
+				table.Seats != nil && *table.Seats >= guests {
+				available = append(available, table)
+			}
+		}
+		availableGroups := []models.TableGroup{}
+		for _, group := range groups {
+			if statuses[group.Primary_table_id] == models.TableFree &&
+				group.Seats >= guests {
+				availableGroups = append(availableGroups, group)
+			}
+		}
+		sort.SliceStable(available, func(i, j int) bool {
+			return *available[i].Seats < *available[j].Seats
+		})
+		sort.SliceStable(availableGroups, func(i, j int) bool {
+			return availableGroups[i].Seats < availableGroups[j].Seats
+		})
+		c.JSON(http.StatusOK, gin.H{
+			"guests": guests,
+			"tables": available,
+			"groups": availableGroups,
+		})
+	}
+}
+
+// resolveOrderTable puts an order for a table in a group on the group's
+// primary table, so the party shares one order.
+func resolveOrderTable(ctx context.Context, order *models.Order) {
+	if order.Table_ID == nil {
+		return
+	}
+	var table models.Table
+	if err := tableCollection.FindOne(ctx,
+		bson.M{"table_id": *order.Table_ID}).Decode(&table); err != nil ||
+		table.Group_ID == nil {
+		return
+	}
+	var group models.TableGroup
+	if err := tableGroupCollection.FindOne(ctx, bson.M{
+		"group_id": *table.Group_ID,
+		"split_at": nil,
+	}).Decode(&group); err != nil {
+		return
+	}
+	order.Table_ID = &group.Primary_table_id
+	order.Table_group_id = &group.Group_ID
+}
+
+// groupTableNumbers is the numbers of the tables in a group, in order.
+func groupTableNumbers(ctx context.Context, groupID string) []int {
+	numbers := []int{}
+	var group models.TableGroup
+	if err := tableGroupCollection.FindOne(ctx,
+		bson.M{"group_id": groupID}).Decode(&group); err != nil {
+		return numbers
+	}
+	result, err := tableCollection.Find(ctx,
+		bson.M{"table_id": bson.M{"$in": group.Table_ids}})
+	if err != nil {
+		return numbers
+	}
+	var tables []models.Table
+	if err = result.All(ctx, &tables); err != nil {
+		return numbers
+	}
+	for _, table := range tables {
+		if table.Table_Number != nil {
+			numbers = append(numbers, *table.Table_Number)
+		}
+	}
+	sort.Ints(numbers)
+	return numbers
+}
+
+func activeTableGroups(ctx context.Context) ([]models.TableGroup, error) {
+	result, err := tableGroupCollection.Find(ctx, bson.M{"split_at": nil})
+	if err != nil {
+		return nil, err
+	}
+	groups := []models.TableGroup{}
+	err = result.All(ctx, &groups)
+	return groups, err
+}
+
+// releaseTableGroup takes the tables out of a group.
+func releaseTableGroup(ctx context.Context, groupID string) error {
+	_, err := tableCollection.UpdateMany(ctx, bson.M{"group_id": groupID},
+		bson.M{"$set": bson.M{"group_id": nil}})
+	return err
+}
@@ -0,0 +1,301 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"restro/database"
+	"restro/models"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var timeClockCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "timeClock")
+var timeClockIndexOnce sync.Once
+
+// timeClockPunch is the body of the time clock actions. The staff member
+// defaults to the one signed in; only managers punch for someone else. Clocking in takes the role from the shift
+// when one is given; Paid applies to a break being started.
+type timeClockPunch struct {
+	User_id  *string `json:"user_id"`
+	Shift_ID *string `json:"shift_id"`
+	Role     *string `json:"role"`
+	Paid     bool    `json:"paid"`
+}
+
+// GetTimeClockEntries lists time clock entries, optionally for one staff
+// member (user_id) and, given from or to, overlapping that period.
+func GetTimeClockEntries() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		filter := bson.M{}
+		if userID := c.Query("user_id"); userID != "" {
+			filter["user_id"] = userID
+		}
+		if c.Query("from") != "" || c.Query("to") != "" {
+			q, ok := reportQuery(c)
+			if !ok {
+				return
+			}
+			for key, value := range clockedBetween(q.From, q.To) {
+				filter[key] = value
+			}
+		}
+		result, err := timeClockCollection.Find(ctx, filter,
+			options.Find().SetSort(bson.M{"clock_in": -1}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the time clock"})
+			return
+		}
+		allEntries := []models.TimeClockEntry{}
+		if err = result.All(ctx, &allEntries); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the time clock"})
+			return
+		}
+		c.JSON(http.StatusOK, allEntries)
+	}
+}
+
+// ClockIn starts a time clock entry. A staff member can only be clocked in
+// once at a time.
+func ClockIn() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		ensureTimeClockIndexes(ctx)
+		punch, ok := bindPunch(ctx, c)
+		if !ok {
+			return
+		}
+		user, err := findStaff(ctx, *punch.User_id)
+		if err != nil {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any user with given ID"})
+			return
+		}
+		if _, err := openTimeClockEntry(ctx, *punch.User_id); err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "already clocked in"})
+			return
+		} else if !errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while reading the time clock"})
+			return
+		}
+
+		var entry models.TimeClockEntry
+		entry.User_id = *punch.User_id
+		if user.Hourly_rate != nil {
+			entry.Hourly_rate = *user.Hourly_rate
+		}
+		if punch.Shift_ID != nil {
+			var shift models.Shift
+			if err := shiftCollection.FindOne(ctx, bson.M{
+				"shift_id": *punch.Shift_ID,
+				"user_id":  entry.User_id,
+			}).Decode(&shift); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "shift " +
+					*punch.Shift_ID + " is not one of the user's shifts"})
+				return
+			}
+			entry.Shift_ID = &shift.Shift_ID
+			entry.Role = *shift.Role
+			if shift.Hourly_rate != nil {
+				entry.Hourly_rate = *shift.Hourly_rate
+			}
+		}
+		if punch.Role != nil {
+			entry.Role = *punch.Role
+		}
+		if entry.Role == "" {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": "clocking in needs a shift_id or a role"})
+			return
+		}
+		entry.ID = primitive.NewObjectID()
+		entry.Entry_ID = entry.ID.Hex()
+		entry.Breaks = []models.Break{}
+		entry.Clock_in, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		entry.Created_at = entry.Clock_in
+		entry.Updated_at = entry.Clock_in
+
+		if _, err := timeClockCollection.InsertOne(ctx, entry); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				c.JSON(http.StatusConflict, gin.H{"error": "already clocked in"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "clocking in failed"})
+			return
+		}
+		c.JSON(http.StatusOK, entry)
+	}
+}
+
+// ClockOut ends the staff member's open entry, and any break still running.
+func ClockOut() gin.HandlerFunc {
+	return punchOpenEntry(func(c *gin.Context, entry *models.TimeClockEntry,
+		now time.Time, punch timeClockPunch) bool {
+		if last := openBreak(entry); last != nil {
+			last.End = &now
+		}
+		entry.Clock_out = &now
+		return true
+	})
+}
+
+// StartBreak starts a break in the staff member's open entry.
+func StartBreak() gin.HandlerFunc {
+	return punchOpenEntry(func(c *gin.Context, entry *models.TimeClockEntry,
+		now time.Time, punch timeClockPunch) bool {
+		if openBreak(entry) != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "already on a break"})
+			return false
+		}
+		entry.Breaks = append(entry.Breaks,
+			models.Break{Start: now, Paid: punch.Paid})
+		return true
+	})
+}
+
+// EndBreak ends the break running in the staff member's open entry.
+func EndBreak() gin.HandlerFunc {
+	return punchOpenEntry(func(c *gin.Context, entry *models.TimeClockEntry,
+		now time.Time, punch timeClockPunch) bool {
+		last := openBreak(entry)
+		if last == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "not on a break"})
+			return false
+		}
+		last.End = &now
+		return true
+	})
+}
+
+// punchOpenEntry builds a handler that changes the staff member's open entry
+// with apply and saves it. apply writes the error response when it refuses
+// the change. The save only matches the entry at the version read, so two
+// punches at once can't both apply.
+func punchOpenEntry(apply func(c *gin.Context, entry *models.TimeClockEntry,
+	now time.Time, punch timeClockPunch) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		punch, ok := bindPunch(ctx, c)
+		if !ok {
+			return
+		}
+		entry, err := openTimeClockEntry(ctx, *punch.User_id)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusConflict, gin.H{"error": "not clocked in"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while reading the time clock"})
+			return
+		}
+		version := entry.Version
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		if !apply(c, &entry, now, punch) {
+			return
+		}
+		entry.Updated_at = now
+		entry.Version++
+
+		result, err := timeClockCollection.ReplaceOne(ctx,
+			bson.M{"entry_id": entry.Entry_ID, "version": version}, entry)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "time clock update failed"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "the time clock " +
+				"entry changed at the same time, try again"})
+			return
+		}
+		c.JSON(http.StatusOK, entry)
+	}
+}
+
+// bindPunch reads the punch body, which may be empty, writing the error
+// response when it doesn't parse or punches for someone else without
+// being a manager.
+func bindPunch(ctx context.Context, c *gin.Context) (timeClockPunch, bool) {
+	var punch timeClockPunch
+	if c.Request.ContentLength != 0 {
+		if err := c.BindJSON(&punch); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return punch, false
+		}
+	}
+	uid := c.GetString("uid")
+	if punch.User_id == nil {
+		punch.User_id = &uid
+	}
+	if *punch.User_id != uid && !isManager(ctx, uid) {
+		c.JSON(http.StatusForbidden,
+			gin.H{"error": "only managers can punch for someone else"})
+		return punch, false
+	}
+	return punch, true
+}
+
+// ensureTimeClockIndexes lets each staff member have one open entry, so two
+// clock-ins at once can't both start one. Open entries have a null
+// clock_out.
+func ensureTimeClockIndexes(ctx context.Context) {
+	timeClockIndexOnce.Do(func() {
+		_, err := timeClockCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{
+					"clock_out": bson.M{"$type": "null"}}),
+		})
+		if err != nil {
+			log.Println("couldn't create the time clock indexes:", err)
+		}
+	})
+}
+
+func openTimeClockEntry(ctx context.Context, userID string) (models.TimeClockEntry, error) {
+	var entry models.TimeClockEntry
+	err := timeClockCollection.FindOne(ctx,
+		bson.M{"user_id": userID, "clock_out": nil}).Decode(&entry)
+	return entry, err
+}
+
+// openBreak is the entry's running break, if any.
+func openBreak(entry *models.TimeClockEntry) *models.Break {
+	if n := len(entry.Breaks); n > 0 && entry.Breaks[n-1].End == nil {
+		return &entry.Breaks[n-1]
+	}
+	return nil
+}
+
+// clockedBetween matches the entries on the clock at some point between
+// from and to, counting open entries as running until now.
+func clockedBetween(from, to time.Time) bson.M {
+	return bson.M{
+		"clock_in": bson.M{"$lt": to},
+		"$or": bson.A{
+			bson.M{"clock_out": nil},
+			bson.M{"clock_out": bson.M{"$gt": from}},
+		},
+	}
+}
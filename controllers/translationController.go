@@ -0,0 +1,319 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	helper "restro/helpers"
+	"restro/models"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type missingTranslation struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Missing []string `json:"missing"`
+}
+
+type missingTranslations struct {
+	Foods []missingTranslation `json:"foods"`
+	Menus []missingTranslation `json:"menus"`
+}
+
+// requestLocales returns the locale chain for the request. An explicit lang
+// query parameter wins over the Accept-Language header.
+func requestLocales(c *gin.Context) []string {
+	if lang := c.Query("lang"); lang != "" {
+		return helper.LocaleChain(strings.Split(lang, ","))
+	}
+	return helper.LocaleChain(
+		helper.ParseAcceptLanguage(c.GetHeader("Accept-Language")))
+}
+
+// translate returns the first non-empty value along the chain and the locale
+// it came from. The default locale is served from the untranslated field.
+func translate(translations map[string]models.Translation, chain []string,
+	get func(models.Translation) string, fallback string) (string, string) {
+	defaultLocale := helper.DefaultLocale()
+	for _, locale := range chain {
+		if locale == defaultLocale && fallback != "" {
+			return fallback, locale
+		}
+		if value := get(translations[locale]); value != "" {
+			return value, locale
+		}
+	}
+	return fallback, defaultLocale
+}
+
+func translationName(t models.Translation) string        { return t.Name }
+func translationDescription(t models.Translation) string { return t.Description }
+func translationCategory(t models.Translation) string    { return t.Category }
+
+func localizeFood(food *models.Food, chain []string) {
+	name, locale := translate(food.Translations, chain, translationName,
+		derefString(food.Name))
+	food.Name = &name
+	food.Locale = locale
+	if food.Description != nil {
+		description, _ := translate(food.Translations, chain,
+			translationDescription, *food.Description)
+		food.Description = &description
+	}
+}
+
+func localizeMenu(menu *models.Menu, chain []string) {
+	menu.Name, menu.Locale = translate(menu.Translations, chain,
+		translationName, menu.Name)
+	menu.Category, _ = translate(menu.Translations, chain,
+		translationCategory, menu.Category)
+	menu.Description, _ = translate(menu.Translations, chain,
+		translationDescription, menu.Description)
+}
+
+// localizeDocument does the same as localizeFood and localizeMenu for the
+// raw documents returned by the list endpoints.
+func localizeDocument(doc bson.M, chain []string) {
+	var translations map[string]models.Translation
+	if raw, ok := doc["translations"]; ok && raw != nil {
+		if data, err := bson.Marshal(bson.M{"t": raw}); err == nil {
+			var wrapper struct {
+				T map[string]models.Translation
+			}
+			if bson.Unmarshal(data, &wrapper) == nil {
+				translations = wrapper.T
+			}
+		}
+	}
+	fields := []struct {
+		key string
+		get func(models.Translation) string
+	}{
+		{"name", translationName},
+		{"description", translationDescription},
+		{"category", translationCategory},
+	}
+	for _, field := range fields {
+		original, ok := doc[field.key].(string)
+		if !ok {
+			continue
+		}
+		value, locale := translate(translations, chain, field.get, original)
+		doc[field.key] = value
+		if field.key == "name" {
+			doc["locale"] = locale
+		}
+	}
+}
+
+func localizeDocuments(docs []interface{}, chain []string) {
+	for i, item := range docs {
+		switch doc := item.(type) {
+		case bson.M:
+			localizeDocument(doc, chain)
+		case bson.D:
+			m := doc.Map()
+			localizeDocument(m, chain)
+			docs[i] = m
+		}
+	}
+}
+
+func PutFoodTranslation() gin.HandlerFunc {
+	return putTranslation(foodCollection, "food_id")
+}
+
+func DeleteFoodTranslation() gin.HandlerFunc {
+	return deleteTranslation(foodCollection, "food_id")
+}
+
+func PutMenuTranslation() gin.HandlerFunc {
+	return putTranslation(menuCollection, "menu_id")
+}
+
+func DeleteMenuTranslation() gin.HandlerFunc {
+	return deleteTranslation(menuCollection, "menu_id")
+}
+
+func putTranslation(collection *mongo.Collection, idKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var translation models.Translation
+
+		locale, ok := translationLocale(c)
+		if !ok {
+			return
+		}
+		if err := c.BindJSON(&translation); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if translation.Name == "" && translation.Description == "" &&
+			translation.Category == "" {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": "translation has no text"})
+			return
+		}
+
+		updated_at, _ := time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		result, err := collection.UpdateOne(ctx,
+			bson.M{idKey: c.Param(idKey)},
+			bson.M{"$set": bson.M{
+				"translations." + locale: translation,
+				"updated_at":             updated_at,
+			}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "translation was not saved"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any item with given ID"})
+			return
+		}
+		c.JSON(http.StatusOK, translation)
+	}
+}
+
+func deleteTranslation(collection *mongo.Collection, idKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+
+		locale, ok := translationLocale(c)
+		if !ok {
+			return
+		}
+		result, err := collection.UpdateOne(ctx,
+			bson.M{idKey: c.Param(idKey)},
+			bson.M{"$unset": bson.M{"translations." + locale: ""}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "translation was not deleted"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any item with given ID"})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// translationLocale reads the locale path parameter, rejecting the default
+// locale (which lives in the untranslated fields) and unsupported ones.
+func translationLocale(c *gin.Context) (string, bool) {
+	locale := helper.NormalizeLocale(c.Param("locale"))
+	if locale == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid locale"})
+		return "", false
+	}
+	supported := helper.SupportedLocales()
+	if locale == supported[0] {
+		c.JSON(http.StatusBadRequest,
+			gin.H{"error": "the default locale is edited on the item itself"})
+		return "", false
+	}
+	for _, l := range supported[1:] {
+		if l == locale {
+			return locale, true
+		}
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported locale"})
+	return "", false
+}
+
+// GetMissingTranslations reports, for each supported locale (or the one
+// given with ?locale=), which foods and menus lack a translation of a field
+// they have text for.
+func GetMissingTranslations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+
+		locales := helper.SupportedLocales()[1:]
+		if requested := c.Query("locale"); requested != "" {
+			locales = []string{helper.NormalizeLocale(requested)}
+		}
+
+		var foods []models.Food
+		result, err := foodCollection.Find(ctx, bson.M{})
+		if err == nil {
+			err = result.All(ctx, &foods)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the foods"})
+			return
+		}
+		var menus []models.Menu
+		result, err = menuCollection.Find(ctx, bson.M{})
+		if err == nil {
+			err = result.All(ctx, &menus)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the menus"})
+			return
+		}
+
+		report := map[string]missingTranslations{}
+		for _, locale := range locales {
+			missing := missingTranslations{
+				Foods: []missingTranslation{},
+				Menus: []missingTranslation{},
+			}
+			for _, food := range foods {
+				t := food.Translations[locale]
+				var fields []string
+				if t.Name == "" {
+					fields = append(fields, "name")
+				}
+				if derefString(food.Description) != "" && t.Description == "" {
+					fields = append(fields, "description")
+				}
+				if len(fields) > 0 {
+					missing.Foods = append(missing.Foods, missingTranslation{
+						food.Food_ID, derefString(food.Name), fields})
+				}
+			}
+			for _, menu := range menus {
+				t := menu.Translations[locale]
+				var fields []string
+				if t.Name == "" {
+					fields = append(fields, "name")
+				}
+				if menu.Category != "" && t.Category == "" {
+					fields = append(fields, "category")
+				}
+				if menu.Description != "" && t.Description == "" {
+					fields = append(fields, "description")
+				}
+				if len(fields) > 0 {
+					missing.Menus = append(missing.Menus, missingTranslation{
+						menu.Menu_ID, menu.Name, fields})
+				}
+			}
+			report[locale] = missing
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
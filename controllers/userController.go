@@ -130,6 +130,9 @@ func SignUp() gin.HandlerFunc {
 		user.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		user.ID = primitive.NewObjectID()
 		user.User_id = user.ID.Hex()
+		// the pay rate is set by a manager, not at signup
+		user.Hourly_rate = nil
+		user.Manager = false
 
 		//generate token and refersh token (generate all tokens function from helper)
 
@@ -208,3 +211,95 @@ func VerifyPassword(userPassword string, providedPassword string) (bool, string)
 	}
 	return check, msg
 }
+
+// SetUserManager makes a staff member a manager, or no longer one. Only
+// managers can; the first is made in the database.
+func SetUserManager() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var body struct {
+			Manager *bool `json:"manager" validate:"required"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(body); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		if !isManager(ctx, c.GetString("uid")) {
+			c.JSON(http.StatusForbidden,
+				gin.H{"error": "only managers can make managers"})
+			return
+		}
+		updatedAt, _ := time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		result, err := userCollection.UpdateOne(ctx,
+			bson.M{"user_id": c.Param("user_id")},
+			bson.M{"$set": bson.M{"manager": *body.Manager,
+				"updated_at": updatedAt}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "manager update failed"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any user with given ID"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"user_id": c.Param("user_id"),
+			"manager": *body.Manager})
+	}
+}
+
+// isManager reports whether the user is a manager.
+func isManager(ctx context.Context, userID string) bool {
+	count, err := userCollection.CountDocuments(ctx,
+		bson.M{"user_id": userID, "manager": true})
+	return err == nil && count > 0
+}
+
+// SetUserHourlyRate sets what a staff member is paid per hour, used for
+// their time clock entries and for shifts without a rate of their own.
+func SetUserHourlyRate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var body struct {
+			Hourly_rate *float64 `json:"hourly_rate" validate:"required,gte=0"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(body); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		updatedAt, _ := time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+		result, err := userCollection.UpdateOne(ctx,
+			bson.M{"user_id": c.Param("user_id")},
+			bson.M{"$set": bson.M{"hourly_rate": *body.Hourly_rate,
+				"updated_at": updatedAt}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "hourly rate update failed"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound,
+				gin.H{"error": "couldn't find any user with given ID"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"user_id": c.Param("user_id"),
+			"hourly_rate": *body.Hourly_rate})
+	}
+}
@@ -0,0 +1,283 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"restro/database"
+	"restro/inventory"
+	"restro/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var wasteCollection *mongo.Collection = database.OpenCollection(
+	database.Client, "waste")
+
+// GetWasteEntries lists waste, newest first, optionally for one reason,
+// food, ingredient or date range (RFC 3339 from/to).
+func GetWasteEntries() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		filter, ok := wasteFilter(c)
+		if !ok {
+			return
+		}
+		for _, key := range []string{"reason", "food_id", "ingredient_id"} {
+			if value := c.Query(key); value != "" {
+				filter[key] = value
+			}
+		}
+		result, err := wasteCollection.Find(ctx, filter,
+			options.Find().SetSort(bson.M{"created_at": -1}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the waste"})
+			return
+		}
+		allWaste := []models.WasteEntry{}
+		if err = result.All(ctx, &allWaste); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while listing the waste"})
+			return
+		}
+		c.JSON(http.StatusOK, allWaste)
+	}
+}
+
+// CreateWasteEntry logs food or an ingredient thrown away and takes it out
+// of stock. Wasted food uses up its recipe for the given size and
+// modifiers.
+func CreateWasteEntry() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		var entry models.WasteEntry
+
+		if err := c.BindJSON(&entry); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if validationErr := validate.Struct(entry); validationErr != nil {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": validationErr.Error()})
+			return
+		}
+		if (entry.Food_ID == nil) == (entry.Ingredient_ID == nil) {
+			c.JSON(http.StatusBadRequest,
+				gin.H{"error": "give either food_id or ingredient_id"})
+			return
+		}
+		entry.ID = primitive.NewObjectID()
+		entry.Waste_ID = entry.ID.Hex()
+		entry.Order_item_id = nil
+		entry.Created_by = c.GetString("uid")
+		entry.Created_at, _ = time.Parse(time.RFC3339,
+			time.Now().Format(time.RFC3339))
+
+		var movements []models.StockMovement
+		if entry.Food_ID != nil {
+			foods, err := foodsByID(ctx, []string{*entry.Food_ID})
+			food, found := foods[*entry.Food_ID]
+			if err != nil || !found {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "food was not found"})
+				return
+			}
+			entry.Name = derefString(food.Name)
+			var item models.OrderItem
+			item.Food_id = entry.Food_ID
+			item.Quantity = entry.Variant
+			item.Modifiers = entry.Modifiers
+			movements, err = inventoryService.WasteFood(ctx, item,
+				entry.Quantity, entry.Waste_ID, entry.Note, entry.Created_by)
+			if err != nil {
+				inventoryError(c, err)
+				return
+			}
+		} else {
+			ingredient, err := inventoryService.Store().Ingredient(ctx,
+				*entry.Ingredient_ID)
+			if err != nil {
+				inventoryError(c, err)
+				return
+			}
+			entry.Name = derefString(ingredient.Name)
+			movement, err := inventoryService.WasteIngredient(ctx,
+				*entry.Ingredient_ID, entry.Quantity, entry.Waste_ID,
+				entry.Note, entry.Created_by)
+			if err != nil {
+				inventoryError(c, err)
+				return
+			}
+			movements = append(movements, movement)
+		}
+		entry.Cost = toFixed(inventory.CostOf(movements), 2)
+		stockEvaluator.Trigger()
+
+		if _, err := wasteCollection.InsertOne(ctx, entry); err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "the stock was taken out but the waste entry " +
+					"was not created"})
+			return
+		}
+		c.JSON(http.StatusOK, entry)
+	}
+}
+
+// GetWasteReport values the waste at cost by day, reason and item, with an
+// optional RFC 3339 from/to range.
+func GetWasteReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(),
+			100*time.Second)
+		defer cancel()
+		filter, ok := wasteFilter(c)
+		if !ok {
+			return
+		}
+		// summary groups the entries by key and names the key's parts in
+		// the output.
+		summary := func(key interface{}, fields bson.M,
+			extra bson.M) bson.A {
+			group := bson.M{"_id": key, "cost": bson.M{"$sum": "$cost"},
+				"entries": bson.M{"$sum": 1}}
+			project := bson.M{"_id": 0, "entries": 1,
+				"cost": bson.M{"$round": bson.A{"$cost", 2}}}
+			for field, accumulator := range extra {
+				group[field] = accumulator
+				project[field] = 1
+			}
+			for field, value := range fields {
+				project[field] = value
+			}
+			return bson.A{bson.M{"$group": group}, bson.M{"$project": project}}
+		}
+		byDay := append(summary(bson.M{"$dateToString": bson.M{
+			"format": "%Y-%m-%d", "date": "$created_at"}},
+			bson.M{"day": "$_id"}, nil),
+			bson.M{"$sort": bson.M{"day": 1}})
+		byReason := append(summary("$reason", bson.M{"reason": "$_id"}, nil),
+			bson.M{"$sort": bson.M{"cost": -1}})
+		byItem := append(summary(
+			bson.M{"food_id": "$food_id", "ingredient_id": "$ingredient_id"},
+			bson.M{"food_id": "$_id.food_id",
+				"ingredient_id": "$_id.ingredient_id"},
+			bson.M{
+				"name":     bson.M{"$last": "$name"},
+				"quantity": bson.M{"$sum": "$quantity"},
+			}), bson.M{"$sort": bson.M{"cost": -1}})
+		total := summary(nil, nil, nil)
+
+		result, err := wasteCollection.Aggregate(ctx, bson.A{
+			bson.M{"$match": filter},
+			bson.M{"$sort": bson.M{"created_at": 1}},
+			bson.M{"$facet": bson.M{
+				"by_day":    byDay,
+				"by_reason": byReason,
+				"by_item":   byItem,
+				"total":     total,
+			}},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while building the waste report"})
+			return
+		}
+		var report []struct {
+			By_day    []bson.M `bson:"by_day"`
+			By_reason []bson.M `bson:"by_reason"`
+			By_item   []bson.M `bson:"by_item"`
+			Total     []struct {
+				Cost    float64 `bson:"cost"`
+				Entries int     `bson:"entries"`
+			} `bson:"total"`
+		}
+		if err = result.All(ctx, &report); err != nil || len(report) == 0 {
+			c.JSON(http.StatusInternalServerError,
+				gin.H{"error": "error occured while building the waste report"})
+			return
+		}
+		var totalCost float64
+		var entries int
+		if len(report[0].Total) > 0 {
+			totalCost = report[0].Total[0].Cost
+			entries = report[0].Total[0].Entries
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"from":       c.Query("from"),
+			"to":         c.Query("to"),
+			"total_cost": totalCost,
+			"entries":    entries,
+			"by_day":     report[0].By_day,
+			"by_reason":  report[0].By_reason,
+			"by_item":    report[0].By_item,
+		})
+	}
+}
+
+// recordOrderItemWaste logs a voided order item that was already made as
+// one portion of waste, valued at what its stock cost. It runs in the
+// void's transaction, so an item is never voided without its entry.
+func recordOrderItemWaste(ctx context.Context, orderItem models.OrderItem,
+	reason, note, by string) (models.WasteEntry, error) {
+	var entry models.WasteEntry
+	entry.ID = primitive.NewObjectID()
+	entry.Waste_ID = entry.ID.Hex()
+	entry.Food_ID = orderItem.Food_id
+	entry.Variant = orderItem.Quantity
+	entry.Modifiers = orderItem.Modifiers
+	entry.Quantity = 1
+	entry.Reason = reason
+	entry.Note = note
+	entry.Order_item_id = &orderItem.Order_item_id
+	entry.Created_by = by
+	entry.Created_at, _ = time.Parse(time.RFC3339,
+		time.Now().Format(time.RFC3339))
+
+	if orderItem.Food_id != nil {
+		if foods, err := foodsByID(ctx, []string{*orderItem.Food_id}); err == nil {
+			entry.Name = derefString(foods[*orderItem.Food_id].Name)
+		}
+	}
+	cost, err := inventoryService.ConsumedCost(ctx, orderItem.Order_item_id)
+	if err != nil {
+		return entry, err
+	}
+	entry.Cost = toFixed(cost, 2)
+	_, err = wasteCollection.InsertOne(ctx, entry)
+	return entry, err
+}
+
+// wasteFilter turns the from/to query parameters into a created_at filter,
+// writing the error response when they don't parse.
+func wasteFilter(c *gin.Context) (bson.M, bool) {
+	filter := bson.M{}
+	from, err := queryTime(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC 3339 time"})
+		return nil, false
+	}
+	to, err := queryTime(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC 3339 time"})
+		return nil, false
+	}
+	created := bson.M{}
+	if from != nil {
+		created["$gte"] = *from
+	}
+	if to != nil {
+		created["$lt"] = *to
+	}
+	if len(created) > 0 {
+		filter["created_at"] = created
+	}
+	return filter, true
+}
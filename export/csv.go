@@ -0,0 +1,40 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (w *csvWriter) Write(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		value = cell(value)
+		record[i] = text(value)
+		// Spreadsheets run text starting like a formula; quote it so an
+		// exported name or note can't.
+		if s, ok := value.(string); ok && s != "" {
+			switch s[0] {
+			case '=', '+', '-', '@', '\t', '\r':
+				record[i] = "'" + s
+			}
+		}
+	}
+	if err := w.w.Write(record); err != nil {
+		return err
+	}
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func (w *csvWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
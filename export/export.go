@@ -0,0 +1,189 @@
+package export
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Format string
+
+const (
+	CSV  Format = "csv"
+	XLSX Format = "xlsx"
+)
+
+var ErrUnknownFormat = errors.New("format must be csv or xlsx")
+
+func ParseFormat(raw string) (Format, error) {
+	switch Format(strings.ToLower(raw)) {
+	case "", CSV:
+		return CSV, nil
+	case XLSX:
+		return XLSX, nil
+	}
+	return "", ErrUnknownFormat
+}
+
+func (f Format) ContentType() string {
+	if f == XLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+func (f Format) Extension() string {
+	return "." + string(f)
+}
+
+// Writer writes a table one row at a time. Nothing is buffered beyond the
+// current row, so exports can stream straight from a database cursor.
+// Close must be called to finish the file.
+type Writer interface {
+	Write(values []interface{}) error
+	Close() error
+}
+
+func NewWriter(format Format, w io.Writer, sheet string) (Writer, error) {
+	switch format {
+	case CSV:
+		return newCSVWriter(w), nil
+	case XLSX:
+		return newXLSXWriter(w, sheet)
+	}
+	return nil, ErrUnknownFormat
+}
+
+// SelectColumns picks the requested columns, a comma separated list, in the
+// order given. An empty request selects every available column.
+func SelectColumns(available []string, requested string) ([]string, error) {
+	if strings.TrimSpace(requested) == "" {
+		return available, nil
+	}
+	known := map[string]bool{}
+	for _, column := range available {
+		known[column] = true
+	}
+	var columns []string
+	for _, column := range strings.Split(requested, ",") {
+		column = strings.TrimSpace(column)
+		if column == "" {
+			continue
+		}
+		if !known[column] {
+			return nil, fmt.Errorf("unknown column %q, available columns are %s",
+				column, strings.Join(available, ", "))
+		}
+		columns = append(columns, column)
+	}
+	if len(columns) == 0 {
+		return available, nil
+	}
+	return columns, nil
+}
+
+// Field reads a dotted path such as "food.name" out of a decoded document.
+func Field(doc map[string]interface{}, path string) interface{} {
+	var value interface{} = doc
+	for _, key := range strings.Split(path, ".") {
+		switch current := value.(type) {
+		case map[string]interface{}:
+			value = current[key]
+		case primitive.M:
+			value = current[key]
+		case primitive.D:
+			value = current.Map()[key]
+		default:
+			return nil
+		}
+	}
+	return value
+}
+
+// Row picks the columns out of a document.
+func Row(doc map[string]interface{}, columns []string) []interface{} {
+	values := make([]interface{}, len(columns))
+	for i, column := range columns {
+		values[i] = Field(doc, column)
+	}
+	return values
+}
+
+// cell normalises a value to a string, a number, a bool or nil.
+func cell(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string, bool, float64:
+		return v
+	case *string:
+		if v == nil {
+			return nil
+		}
+		return *v
+	case *float64:
+		if v == nil {
+			return nil
+		}
+		return *v
+	case *int:
+		if v == nil {
+			return nil
+		}
+		return float64(*v)
+	case int:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case *time.Time:
+		if v == nil {
+			return nil
+		}
+		return v.UTC().Format(time.RFC3339)
+	case primitive.DateTime:
+		return v.Time().UTC().Format(time.RFC3339)
+	case primitive.ObjectID:
+		return v.Hex()
+	case primitive.A:
+		return joinCells(v)
+	case []interface{}:
+		return joinCells(v)
+	case []string:
+		return strings.Join(v, ";")
+	}
+	return fmt.Sprint(value)
+}
+
+func joinCells(values []interface{}) string {
+	parts := make([]string, 0, len(values))
+	for _, value := range values {
+		parts = append(parts, text(cell(value)))
+	}
+	return strings.Join(parts, ";")
+}
+
+// text renders a normalised cell for CSV.
+func text(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,71 @@
+package floor
+
+import (
+	"errors"
+	"restro/models"
+)
+
+// OpenOrder is what the status of a table depends on for each of its open
+// orders.
+type OpenOrder struct {
+	Order_ID string
+	Items    int
+	Invoiced bool
+}
+
+var (
+	ErrUnknownStatus = errors.New("status must be FREE, SEATED or DIRTY")
+	ErrTableInUse    = errors.New("the table has open orders")
+)
+
+// Status works out a table's status from its open orders. A table with an
+// invoice out is awaiting the bill, one with items ordered, and one with
+// only an empty order seated. Once the last order is closed a table that
+// had ordered needs clearing; otherwise it stays as staff left it, so a
+// walk-in seated before ordering stays seated.
+func Status(previous string, open []OpenOrder) string {
+	if len(open) == 0 {
+		if previous == models.TableOrdered ||
+			previous == models.TableAwaitingBill {
+			return models.TableDirty
+		}
+		if previous == "" {
+			return models.TableFree
+		}
+		return previous
+	}
+	status := models.TableSeated
+	for _, order := range open {
+		if order.Invoiced {
+			return models.TableAwaitingBill
+		}
+		if order.Items > 0 {
+			status = models.TableOrdered
+		}
+	}
+	return status
+}
+
+// Occupied reports whether guests are at a table with the status.
+func Occupied(status string) bool {
+	switch status {
+	case models.TableSeated, models.TableOrdered, models.TableAwaitingBill:
+		return true
+	}
+	return false
+}
+
+// CheckManual checks a status set by staff. They can seat guests at a free
+// or dirty table, mark it dirty and free it once cleared, but not while it
+// has open orders, whose status follows them.
+func CheckManual(status string, open []OpenOrder) error {
+	switch status {
+	case models.TableFree, models.TableSeated, models.TableDirty:
+	default:
+		return ErrUnknownStatus
+	}
+	if len(open) > 0 {
+		return ErrTableInUse
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package helper
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+)
+
+// giftCardAlphabet leaves out 0, 1, I and O, which are easily misread off
+// a card.
+const giftCardAlphabet = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+
+// NewGiftCardCode is a random code for a gift card, in four groups of four
+// characters. At 80 random bits it can't be guessed.
+func NewGiftCardCode() (string, error) {
+	var code strings.Builder
+	max := big.NewInt(int64(len(giftCardAlphabet)))
+	for i := 0; i < 16; i++ {
+		if i > 0 && i%4 == 0 {
+			code.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code.WriteByte(giftCardAlphabet[n.Int64()])
+	}
+	return code.String(), nil
+}
+
+// NormalizeGiftCardCode writes a code as it is stored, whatever case and
+// spacing it was typed in.
+func NormalizeGiftCardCode(code string) string {
+	var chars []byte
+	for _, r := range strings.ToUpper(code) {
+		if (r >= '0' && r <= '9') || (r >= 'A' && r <= 'Z') {
+			chars = append(chars, byte(r))
+		}
+	}
+	var normalized strings.Builder
+	for i, c := range chars {
+		if i > 0 && i%4 == 0 {
+			normalized.WriteByte('-')
+		}
+		normalized.WriteByte(c)
+	}
+	return normalized.String()
+}
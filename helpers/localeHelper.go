@@ -0,0 +1,111 @@
+package helper
+
+import (
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+// DefaultLocale is the language the untranslated name, description and
+// category fields are written in.
+func DefaultLocale() string {
+	if locale := NormalizeLocale(os.Getenv("DEFAULT_LOCALE")); locale != "" {
+		return locale
+	}
+	return "en"
+}
+
+// SupportedLocales lists the locales translations are managed for, from the
+// comma separated SUPPORTED_LOCALES variable. The default locale is always
+// first.
+func SupportedLocales() []string {
+	locales := []string{DefaultLocale()}
+	for _, locale := range strings.Split(os.Getenv("SUPPORTED_LOCALES"), ",") {
+		locale = NormalizeLocale(locale)
+		if locale != "" && !containsLocale(locales, locale) {
+			locales = append(locales, locale)
+		}
+	}
+	return locales
+}
+
+// NormalizeLocale lowercases a language tag and uses dashes as separators,
+// returning "" for anything that isn't a language tag.
+func NormalizeLocale(locale string) string {
+	locale = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+	if !localePattern.MatchString(locale) {
+		return ""
+	}
+	return locale
+}
+
+// ParseAcceptLanguage returns the locales of an Accept-Language header in
+// order of preference, leaving out wildcards and anything with q=0.
+func ParseAcceptLanguage(header string) []string {
+	type weighted struct {
+		locale string
+		q      float64
+	}
+	var entries []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		locale := NormalizeLocale(fields[0])
+		if locale == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if value, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = value
+				}
+			}
+		}
+		if q > 0 {
+			entries = append(entries, weighted{locale, q})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].q > entries[j].q
+	})
+	locales := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		locales = append(locales, entry.locale)
+	}
+	return locales
+}
+
+// LocaleChain expands the requested locales into the order translations are
+// tried in: each locale followed by its base language ("pt-br", "pt"), then
+// the default locale.
+func LocaleChain(requested []string) []string {
+	var chain []string
+	add := func(locale string) {
+		if locale != "" && !containsLocale(chain, locale) {
+			chain = append(chain, locale)
+		}
+	}
+	for _, locale := range requested {
+		locale = NormalizeLocale(locale)
+		add(locale)
+		if i := strings.Index(locale, "-"); i > 0 {
+			add(locale[:i])
+		}
+	}
+	add(DefaultLocale())
+	return chain
+}
+
+func containsLocale(locales []string, locale string) bool {
+	for _, l := range locales {
+		if l == locale {
+			return true
+		}
+	}
+	return false
+}
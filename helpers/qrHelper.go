@@ -0,0 +1,51 @@
+package helper
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidTableToken = errors.New("invalid table token")
+
+// TableToken is the token in a table's QR code. It names the table and the
+// version of its code, signed so guests can't make one up; rotating the
+// code bumps the version, which retires the codes printed before.
+func TableToken(tableID string, version int) string {
+	payload := tableID + "." + strconv.Itoa(version)
+	return payload + "." + tableTokenSignature(payload)
+}
+
+// ParseTableToken checks the signature of a table token and returns the
+// table and code version it is for.
+func ParseTableToken(token string) (tableID string, version int, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] == "" {
+		return "", 0, ErrInvalidTableToken
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(tableTokenSignature(payload))) {
+		return "", 0, ErrInvalidTableToken
+	}
+	version, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return "", 0, ErrInvalidTableToken
+	}
+	return parts[0], version, nil
+}
+
+// tableTokenSignature signs with QR_SECRET, falling back to the key the
+// login tokens are signed with.
+func tableTokenSignature(payload string) string {
+	key := os.Getenv("QR_SECRET")
+	if key == "" {
+		key = SECRET_KEY
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
@@ -0,0 +1,63 @@
+package inventory
+
+import (
+	"context"
+	"math"
+	"restro/models"
+	"sort"
+)
+
+// PlateCosts prices one portion of every food with a recipe at the
+// ingredients' current cost: the base recipe and each sized recipe. Sizes
+// without their own recipe cost the same as the base and aren't listed.
+// Modifier recipes are extras and aren't included.
+func (s *Service) PlateCosts(ctx context.Context) (map[string][]models.PlateCost, error) {
+	recipes, err := s.store.Recipes(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	ingredients, err := s.store.Ingredients(ctx)
+	if err != nil {
+		return nil, err
+	}
+	costs := map[string]float64{}
+	for _, ingredient := range ingredients {
+		if ingredient.Cost_per_unit != nil {
+			costs[ingredient.Ingredient_ID] = *ingredient.Cost_per_unit
+		}
+	}
+
+	sort.SliceStable(recipes, func(i, j int) bool {
+		return derefString(recipes[i].Variant) < derefString(recipes[j].Variant)
+	})
+	plates := map[string][]models.PlateCost{}
+	for _, recipe := range recipes {
+		if recipe.Food_ID == nil || recipe.Modifier != nil {
+			continue
+		}
+		var cost float64
+		for _, component := range recipe.Components {
+			cost += component.Quantity * costs[component.Ingredient_ID]
+		}
+		plates[*recipe.Food_ID] = append(plates[*recipe.Food_ID],
+			models.PlateCost{
+				Variant: recipe.Variant,
+				Cost:    math.Round(cost*100) / 100,
+			})
+	}
+	return plates, nil
+}
+
+// PlateCostFor picks the cost of the given size, falling back to the base
+// recipe. ok is false when there is neither.
+func PlateCostFor(plates []models.PlateCost, variant string) (cost float64, ok bool) {
+	for _, plate := range plates {
+		if plate.Variant != nil && *plate.Variant == variant {
+			return plate.Cost, true
+		}
+		if plate.Variant == nil {
+			cost, ok = plate.Cost, true
+		}
+	}
+	return cost, ok
+}
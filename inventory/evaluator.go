@@ -0,0 +1,233 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"restro/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Menu is the part of the food catalogue the evaluator needs.
+// SetAvailability ends any hand set override of the food's availability.
+type Menu interface {
+	Foods(ctx context.Context) ([]models.Food, error)
+	SetAvailability(ctx context.Context, foodID string, available, auto bool) error
+}
+
+// Notifier publishes to the in-app notification feed.
+type Notifier interface {
+	Notify(ctx context.Context, notification models.Notification) error
+}
+
+// Evaluator watches stock levels. It raises an alert when an ingredient
+// falls to its reorder threshold or runs out, takes foods whose recipe can't
+// be made off sale and puts them back once stock is received. A food put on
+// or off sale by hand is left as it is until the stock changes whether its
+// recipe can be made.
+type Evaluator struct {
+	store    Store
+	menu     Menu
+	notifier Notifier
+	trigger  chan struct{}
+}
+
+func NewEvaluator(store Store, menu Menu, notifier Notifier) *Evaluator {
+	return &Evaluator{
+		store:    store,
+		menu:     menu,
+		notifier: notifier,
+		trigger:  make(chan struct{}, 1),
+	}
+}
+
+// Trigger asks the running evaluator for a check as soon as possible, for
+// callers that have just moved stock. It never blocks.
+func (e *Evaluator) Trigger() {
+	select {
+	case e.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Run evaluates every interval and whenever triggered. It blocks, so start
+// it in its own goroutine.
+func (e *Evaluator) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.trigger:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		if err := e.Evaluate(ctx); err != nil {
+			log.Println("stock evaluation failed:", err)
+		}
+		cancel()
+	}
+}
+
+// Evaluate runs one check over all ingredients and foods.
+func (e *Evaluator) Evaluate(ctx context.Context) error {
+	ingredients, err := e.store.Ingredients(ctx)
+	if err != nil {
+		return err
+	}
+	stock := map[string]models.Ingredient{}
+	for _, ingredient := range ingredients {
+		stock[ingredient.Ingredient_ID] = ingredient
+		if err := e.checkIngredient(ctx, ingredient); err != nil {
+			return err
+		}
+	}
+
+	recipes, err := e.store.Recipes(ctx, "")
+	if err != nil {
+		return err
+	}
+	foods, err := e.menu.Foods(ctx)
+	if err != nil {
+		return err
+	}
+	for _, food := range foods {
+		makeable, managed := CanMake(recipes, food.Food_ID, stock)
+		if !managed {
+			continue
+		}
+		overridden := food.Stock_override != nil
+		if overridden && *food.Stock_override == makeable {
+			continue
+		}
+		available := food.Available == nil || *food.Available
+		switch {
+		case available && !makeable:
+			if err := e.menu.SetAvailability(ctx, food.Food_ID, false, true); err != nil {
+				return err
+			}
+			e.notify(ctx, models.NotificationFoodSoldOut, nil, &food.Food_ID,
+				fmt.Sprintf("%s is sold out: not enough stock for its recipe",
+					derefString(food.Name)))
+		case !available && makeable && food.Auto_sold_out:
+			if err := e.menu.SetAvailability(ctx, food.Food_ID, true, false); err != nil {
+				return err
+			}
+			e.notify(ctx, models.NotificationFoodRestored, nil, &food.Food_ID,
+				fmt.Sprintf("%s is back on sale", derefString(food.Name)))
+		case overridden:
+			// the stock changed, so the food is the evaluator's again
+			if err := e.menu.SetAvailability(ctx, food.Food_ID, available,
+				food.Auto_sold_out); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Makeable reports whether one portion of the food can be made from the
+// stock now, as CanMake does.
+func (e *Evaluator) Makeable(ctx context.Context, foodID string) (makeable,
+	managed bool, err error) {
+	ingredients, err := e.store.Ingredients(ctx)
+	if err != nil {
+		return false, false, err
+	}
+	stock := map[string]models.Ingredient{}
+	for _, ingredient := range ingredients {
+		stock[ingredient.Ingredient_ID] = ingredient
+	}
+	recipes, err := e.store.Recipes(ctx, foodID)
+	if err != nil {
+		return false, false, err
+	}
+	makeable, managed = CanMake(recipes, foodID, stock)
+	return makeable, managed, nil
+}
+
+func (e *Evaluator) checkIngredient(ctx context.Context, ingredient models.Ingredient) error {
+	if ingredient.Reorder_threshold == nil {
+		return nil
+	}
+	low := ingredient.Quantity <= *ingredient.Reorder_threshold
+	if low == ingredient.Low_stock {
+		return nil
+	}
+	if err := e.store.SetLowStock(ctx, ingredient.Ingredient_ID, low); err != nil {
+		return err
+	}
+
+	name := derefString(ingredient.Name)
+	unit := derefString(ingredient.Unit)
+	switch {
+	case !low:
+		e.notify(ctx, models.NotificationRestocked, &ingredient.Ingredient_ID, nil,
+			fmt.Sprintf("%s is back above its reorder threshold (%g %s)",
+				name, ingredient.Quantity, unit))
+	case ingredient.Quantity <= 0:
+		e.notify(ctx, models.NotificationOutOfStock, &ingredient.Ingredient_ID, nil,
+			fmt.Sprintf("%s is out of stock", name))
+	default:
+		e.notify(ctx, models.NotificationLowStock, &ingredient.Ingredient_ID, nil,
+			fmt.Sprintf("%s is low: %g %s left, reorder threshold %g %s",
+				name, ingredient.Quantity, unit, *ingredient.Reorder_threshold, unit))
+	}
+	return nil
+}
+
+func (e *Evaluator) notify(ctx context.Context, kind string, ingredientID,
+	foodID *string, message string) {
+	var notification models.Notification
+	notification.ID = primitive.NewObjectID()
+	notification.Notification_ID = notification.ID.Hex()
+	notification.Type = kind
+	notification.Message = message
+	notification.Ingredient_ID = ingredientID
+	notification.Food_ID = foodID
+	notification.Created_at, _ = time.Parse(time.RFC3339,
+		time.Now().Format(time.RFC3339))
+	if err := e.notifier.Notify(ctx, notification); err != nil {
+		log.Println("couldn't publish notification:", err)
+	}
+}
+
+// CanMake reports whether one portion of the food can be made from the
+// stock. A food with a base recipe needs that; a food with only sized
+// recipes needs at least one of them. managed is false for foods without a
+// recipe, whose availability is left to the staff.
+func CanMake(recipes []models.Recipe, foodID string,
+	stock map[string]models.Ingredient) (makeable, managed bool) {
+	var base *models.Recipe
+	var sized []*models.Recipe
+	for i := range recipes {
+		recipe := &recipes[i]
+		if recipe.Food_ID == nil || *recipe.Food_ID != foodID || recipe.Modifier != nil {
+			continue
+		}
+		if recipe.Variant == nil {
+			base = recipe
+		} else {
+			sized = append(sized, recipe)
+		}
+	}
+	if base != nil {
+		return fulfillable(*base, stock), true
+	}
+	for _, recipe := range sized {
+		if fulfillable(*recipe, stock) {
+			return true, true
+		}
+	}
+	return false, len(sized) > 0
+}
+
+func fulfillable(recipe models.Recipe, stock map[string]models.Ingredient) bool {
+	for _, component := range recipe.Components {
+		if stock[component.Ingredient_ID].Quantity < component.Quantity {
+			return false
+		}
+	}
+	return true
+}
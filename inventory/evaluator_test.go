@@ -0,0 +1,229 @@
+package inventory
+
+import (
+	"context"
+	"restro/models"
+	"sync"
+	"testing"
+)
+
+// fakeMenu keeps foods the way the Mongo menu does: setting availability
+// ends any override.
+type fakeMenu struct {
+	mu    sync.Mutex
+	foods map[string]models.Food
+}
+
+func (m *fakeMenu) Foods(ctx context.Context) ([]models.Food, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	foods := []models.Food{}
+	for _, food := range m.foods {
+		foods = append(foods, food)
+	}
+	return foods, nil
+}
+
+func (m *fakeMenu) SetAvailability(ctx context.Context, foodID string,
+	available, auto bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	food := m.foods[foodID]
+	food.Available = &available
+	food.Auto_sold_out = auto
+	food.Stock_override = nil
+	m.foods[foodID] = food
+	return nil
+}
+
+func (m *fakeMenu) food(id string) models.Food {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.foods[id]
+}
+
+// setByHand is staff setting a food's availability, recording whether its
+// recipe could be made then.
+func (m *fakeMenu) setByHand(id string, available, makeable bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	food := m.foods[id]
+	food.Available = &available
+	food.Auto_sold_out = false
+	food.Stock_override = &makeable
+	m.foods[id] = food
+}
+
+type notifications struct {
+	kinds []string
+}
+
+func (n *notifications) Notify(ctx context.Context,
+	notification models.Notification) error {
+	n.kinds = append(n.kinds, notification.Type)
+	return nil
+}
+
+func (n *notifications) take() []string {
+	kinds := n.kinds
+	n.kinds = nil
+	return kinds
+}
+
+// cheeseKitchen makes a pizza of 0.2 of cheese, with a reorder threshold of
+// 1, and a salad without a recipe.
+func cheeseKitchen(t *testing.T, cheese float64) (*MemoryStore, *Service,
+	*fakeMenu, *notifications, *Evaluator) {
+	store := NewMemoryStore()
+	addIngredient(t, store, "cheese", cheese, 2)
+	ingredient, _ := store.Ingredient(context.Background(), "cheese")
+	ingredient.Reorder_threshold = num(1)
+	if err := store.SaveIngredient(context.Background(), ingredient); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveRecipe(context.Background(), models.Recipe{
+		Recipe_ID: "pizza", Food_ID: str("pizza"),
+		Components: []models.RecipeComponent{
+			{Ingredient_ID: "cheese", Quantity: 0.2}}}); err != nil {
+		t.Fatal(err)
+	}
+	menu := &fakeMenu{foods: map[string]models.Food{
+		"pizza": {Food_ID: "pizza", Name: str("Pizza")},
+		"salad": {Food_ID: "salad", Name: str("Salad")},
+	}}
+	notifier := &notifications{}
+	return store, NewService(store), menu, notifier,
+		NewEvaluator(store, menu, notifier)
+}
+
+func available(food models.Food) bool {
+	return food.Available == nil || *food.Available
+}
+
+func evaluate(t *testing.T, evaluator *Evaluator) {
+	t.Helper()
+	if err := evaluator.Evaluate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestEvaluatorSellsOutAndRestores(t *testing.T) {
+	ctx := context.Background()
+	store, service, menu, notifier, evaluator := cheeseKitchen(t, 0.1)
+
+	evaluate(t, evaluator)
+	if pizza := menu.food("pizza"); available(pizza) || !pizza.Auto_sold_out {
+		t.Fatalf("pizza = %+v, want sold out by the evaluator", pizza)
+	}
+	if salad := menu.food("salad"); salad.Available != nil {
+		t.Fatalf("salad without a recipe was set: %+v", salad)
+	}
+	if got := notifier.take(); !equal(got, []string{models.NotificationLowStock,
+		models.NotificationFoodSoldOut}) {
+		t.Fatalf("notifications = %v", got)
+	}
+	if cheese, _ := store.Ingredient(ctx, "cheese"); !cheese.Low_stock {
+		t.Fatal("cheese isn't marked low")
+	}
+
+	// nothing changed, so nothing is said again
+	evaluate(t, evaluator)
+	if got := notifier.take(); len(got) != 0 {
+		t.Fatalf("notified again: %v", got)
+	}
+
+	if _, err := service.Receive(ctx, "cheese", 5, 2, "", "", "u1"); err != nil {
+		t.Fatal(err)
+	}
+	evaluate(t, evaluator)
+	if pizza := menu.food("pizza"); !available(pizza) || pizza.Auto_sold_out {
+		t.Fatalf("pizza = %+v, want back on sale", pizza)
+	}
+	if got := notifier.take(); !equal(got, []string{models.NotificationRestocked,
+		models.NotificationFoodRestored}) {
+		t.Fatalf("notifications = %v", got)
+	}
+
+	if _, err := service.Adjust(ctx, "cheese", -5.1, "", "u1"); err != nil {
+		t.Fatal(err)
+	}
+	evaluate(t, evaluator)
+	if got := notifier.take(); !equal(got, []string{models.NotificationOutOfStock,
+		models.NotificationFoodSoldOut}) {
+		t.Fatalf("notifications = %v", got)
+	}
+}
+
+func TestEvaluatorLeavesHandSetFoodsUntilStockChanges(t *testing.T) {
+	ctx := context.Background()
+	_, service, menu, _, evaluator := cheeseKitchen(t, 5)
+
+	// taken off sale by hand while it could be made
+	menu.setByHand("pizza", false, true)
+	evaluate(t, evaluator)
+	if pizza := menu.food("pizza"); available(pizza) ||
+		pizza.Stock_override == nil {
+		t.Fatalf("pizza = %+v, want left off sale by hand", pizza)
+	}
+
+	// running out changes whether it can be made, so the evaluator has it
+	// back, and it stays off sale
+	if _, err := service.Adjust(ctx, "cheese", -5, "", "u1"); err != nil {
+		t.Fatal(err)
+	}
+	evaluate(t, evaluator)
+	if pizza := menu.food("pizza"); available(pizza) ||
+		pizza.Stock_override != nil {
+		t.Fatalf("pizza = %+v, want off sale without the override", pizza)
+	}
+
+	// put back on sale by hand while it can't be made
+	menu.setByHand("pizza", true, false)
+	evaluate(t, evaluator)
+	if pizza := menu.food("pizza"); !available(pizza) ||
+		pizza.Stock_override == nil {
+		t.Fatalf("pizza = %+v, want left on sale by hand", pizza)
+	}
+
+	if _, err := service.Receive(ctx, "cheese", 5, 2, "", "", "u1"); err != nil {
+		t.Fatal(err)
+	}
+	evaluate(t, evaluator)
+	if pizza := menu.food("pizza"); !available(pizza) ||
+		pizza.Stock_override != nil {
+		t.Fatalf("pizza = %+v, want on sale without the override", pizza)
+	}
+	// once the evaluator has it back, running out sells it out again
+	if _, err := service.Adjust(ctx, "cheese", -5, "", "u1"); err != nil {
+		t.Fatal(err)
+	}
+	evaluate(t, evaluator)
+	if pizza := menu.food("pizza"); available(pizza) || !pizza.Auto_sold_out {
+		t.Fatalf("pizza = %+v, want sold out by the evaluator", pizza)
+	}
+}
+
+func TestEvaluatorMakeable(t *testing.T) {
+	ctx := context.Background()
+	_, _, _, _, evaluator := cheeseKitchen(t, 0.1)
+	if makeable, managed, err := evaluator.Makeable(ctx, "pizza"); err != nil ||
+		makeable || !managed {
+		t.Fatalf("pizza = %v, %v, %v, want not makeable", makeable, managed,
+			err)
+	}
+	if _, managed, _ := evaluator.Makeable(ctx, "salad"); managed {
+		t.Fatal("salad without a recipe is managed")
+	}
+}
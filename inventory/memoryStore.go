@@ -0,0 +1,160 @@
+package inventory
+
+import (
+	"context"
+	"restro/models"
+	"sort"
+	"sync"
+)
+
+// MemoryStore is a Store kept in memory, for tests and local tooling.
+// Its transactions run one at a time.
+type MemoryStore struct {
+	tx          sync.Mutex
+	mu          sync.Mutex
+	ingredients map[string]models.Ingredient
+	recipes     map[string]models.Recipe
+	movements   []models.StockMovement
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		ingredients: map[string]models.Ingredient{},
+		recipes:     map[string]models.Recipe{},
+	}
+}
+
+func (s *MemoryStore) Ingredient(ctx context.Context, id string) (models.Ingredient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ingredient, ok := s.ingredients[id]
+	if !ok {
+		return models.Ingredient{}, ErrNotFound
+	}
+	return ingredient, nil
+}
+
+func (s *MemoryStore) Ingredients(ctx context.Context) ([]models.Ingredient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all := make([]models.Ingredient, 0, len(s.ingredients))
+	for _, ingredient := range s.ingredients {
+		all = append(all, ingredient)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return derefString(all[i].Name) < derefString(all[j].Name)
+	})
+	return all, nil
+}
+
+// SaveIngredient keeps the quantity of an existing ingredient and starts new
+// ones at zero, like the Mongo store.
+func (s *MemoryStore) SaveIngredient(ctx context.Context, ingredient models.Ingredient) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ingredient.Quantity = 0
+	if existing, ok := s.ingredients[ingredient.Ingredient_ID]; ok {
+		ingredient.Quantity = existing.Quantity
+		ingredient.Low_stock = existing.Low_stock
+		ingredient.Created_at = existing.Created_at
+	}
+	s.ingredients[ingredient.Ingredient_ID] = ingredient
+	return nil
+}
+
+func (s *MemoryStore) SetLowStock(ctx context.Context, id string, low bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ingredient, ok := s.ingredients[id]
+	if !ok {
+		return ErrNotFound
+	}
+	ingredient.Low_stock = low
+	s.ingredients[id] = ingredient
+	return nil
+}
+
+func (s *MemoryStore) Recipe(ctx context.Context, id string) (models.Recipe, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	recipe, ok := s.recipes[id]
+	if !ok {
+		return models.Recipe{}, ErrNotFound
+	}
+	return recipe, nil
+}
+
+func (s *MemoryStore) Recipes(ctx context.Context, foodID string) ([]models.Recipe, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var all []models.Recipe
+	for _, recipe := range s.recipes {
+		if foodID == "" || recipe.Food_ID == nil || *recipe.Food_ID == foodID {
+			all = append(all, recipe)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Recipe_ID < all[j].Recipe_ID })
+	return all, nil
+}
+
+func (s *MemoryStore) SaveRecipe(ctx context.Context, recipe models.Recipe) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recipes[recipe.Recipe_ID] = recipe
+	return nil
+}
+
+func (s *MemoryStore) DeleteRecipe(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.recipes[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.recipes, id)
+	return nil
+}
+
+func (s *MemoryStore) ApplyMovement(ctx context.Context, movement models.StockMovement) (models.StockMovement, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ingredient, ok := s.ingredients[movement.Ingredient_ID]
+	if !ok {
+		return movement, ErrNotFound
+	}
+	ingredient.Quantity += movement.Change
+	s.ingredients[movement.Ingredient_ID] = ingredient
+	movement.Balance_after = ingredient.Quantity
+	s.movements = append(s.movements, movement)
+	return movement, nil
+}
+
+func (s *MemoryStore) Movements(ctx context.Context, filter MovementFilter) ([]models.StockMovement, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var matched []models.StockMovement
+	for _, movement := range s.movements {
+		if filter.matches(movement) {
+			matched = append(matched, movement)
+		}
+	}
+	return matched, nil
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+type inTransaction struct{}
+
+func (s *MemoryStore) InTransaction(ctx context.Context,
+	fn func(ctx context.Context) error) error {
+	if ctx.Value(inTransaction{}) != nil {
+		return fn(ctx)
+	}
+	s.tx.Lock()
+	defer s.tx.Unlock()
+	return fn(context.WithValue(ctx, inTransaction{}, true))
+}
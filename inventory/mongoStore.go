@@ -0,0 +1,204 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"restro/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoStore struct {
+	ingredients *mongo.Collection
+	recipes     *mongo.Collection
+	movements   *mongo.Collection
+}
+
+func NewMongoStore(ingredients, recipes, movements *mongo.Collection) Store {
+	return &mongoStore{
+		ingredients: ingredients,
+		recipes:     recipes,
+		movements:   movements,
+	}
+}
+
+func (s *mongoStore) Ingredient(ctx context.Context, id string) (models.Ingredient, error) {
+	var ingredient models.Ingredient
+	err := s.ingredients.FindOne(ctx, bson.M{"ingredient_id": id}).Decode(&ingredient)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ingredient, ErrNotFound
+	}
+	return ingredient, err
+}
+
+func (s *mongoStore) Ingredients(ctx context.Context) ([]models.Ingredient, error) {
+	cursor, err := s.ingredients.Find(ctx, bson.M{},
+		options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	all := []models.Ingredient{}
+	err = cursor.All(ctx, &all)
+	return all, err
+}
+
+// SaveIngredient never touches the quantity of an existing ingredient; stock
+// only moves through ApplyMovement so the ledger stays complete.
+func (s *mongoStore) SaveIngredient(ctx context.Context, ingredient models.Ingredient) error {
+	_, err := s.ingredients.UpdateOne(ctx,
+		bson.M{"ingredient_id": ingredient.Ingredient_ID},
+		bson.M{
+			"$set": bson.M{
+				"name":              ingredient.Name,
+				"unit":              ingredient.Unit,
+				"cost_per_unit":     ingredient.Cost_per_unit,
+				"reorder_threshold": ingredient.Reorder_threshold,
+				"par_level":         ingredient.Par_level,
+				"supplier_id":       ingredient.Supplier_ID,
+				"updated_at":        ingredient.Updated_at,
+			},
+			"$setOnInsert": bson.M{
+				"_id":        ingredient.ID,
+				"quantity":   0.0,
+				"low_stock":  false,
+				"created_at": ingredient.Created_at,
+			},
+		},
+		options.Update().SetUpsert(true))
+	return err
+}
+
+func (s *mongoStore) SetLowStock(ctx context.Context, id string, low bool) error {
+	_, err := s.ingredients.UpdateOne(ctx, bson.M{"ingredient_id": id},
+		bson.M{"$set": bson.M{"low_stock": low}})
+	return err
+}
+
+func (s *mongoStore) Recipe(ctx context.Context, id string) (models.Recipe, error) {
+	var recipe models.Recipe
+	err := s.recipes.FindOne(ctx, bson.M{"recipe_id": id}).Decode(&recipe)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return recipe, ErrNotFound
+	}
+	return recipe, err
+}
+
+func (s *mongoStore) Recipes(ctx context.Context, foodID string) ([]models.Recipe, error) {
+	filter := bson.M{}
+	if foodID != "" {
+		filter = bson.M{"food_id": bson.M{"$in": bson.A{foodID, nil}}}
+	}
+	cursor, err := s.recipes.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var all []models.Recipe
+	err = cursor.All(ctx, &all)
+	return all, err
+}
+
+func (s *mongoStore) SaveRecipe(ctx context.Context, recipe models.Recipe) error {
+	_, err := s.recipes.ReplaceOne(ctx, bson.M{"recipe_id": recipe.Recipe_ID},
+		recipe, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *mongoStore) DeleteRecipe(ctx context.Context, id string) error {
+	result, err := s.recipes.DeleteOne(ctx, bson.M{"recipe_id": id})
+	if err == nil && result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *mongoStore) InTransaction(ctx context.Context,
+	fn func(ctx context.Context) error) error {
+	if mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+	session, err := s.ingredients.Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx,
+		func(sc mongo.SessionContext) (interface{}, error) {
+			return nil, fn(sc)
+		})
+	return err
+}
+
+// ApplyMovement joins the transaction of a session context, and otherwise
+// runs in one of its own, so the stock and the ledger can't disagree.
+func (s *mongoStore) ApplyMovement(ctx context.Context, movement models.StockMovement) (models.StockMovement, error) {
+	if mongo.SessionFromContext(ctx) != nil {
+		return s.applyMovement(ctx, movement)
+	}
+	session, err := s.ingredients.Database().Client().StartSession()
+	if err != nil {
+		return movement, err
+	}
+	defer session.EndSession(ctx)
+	applied, err := session.WithTransaction(ctx,
+		func(sc mongo.SessionContext) (interface{}, error) {
+			return s.applyMovement(sc, movement)
+		})
+	if err != nil {
+		return movement, err
+	}
+	return applied.(models.StockMovement), nil
+}
+
+func (s *mongoStore) applyMovement(ctx context.Context, movement models.StockMovement) (models.StockMovement, error) {
+	var ingredient models.Ingredient
+	err := s.ingredients.FindOneAndUpdate(ctx,
+		bson.M{"ingredient_id": movement.Ingredient_ID},
+		bson.M{"$inc": bson.M{"quantity": movement.Change}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&ingredient)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return movement, ErrNotFound
+	}
+	if err != nil {
+		return movement, err
+	}
+	movement.Balance_after = ingredient.Quantity
+	_, err = s.movements.InsertOne(ctx, movement)
+	return movement, err
+}
+
+func (s *mongoStore) Movements(ctx context.Context, filter MovementFilter) ([]models.StockMovement, error) {
+	query := bson.M{}
+	if filter.Ingredient_ID != "" {
+		query["ingredient_id"] = filter.Ingredient_ID
+	}
+	if filter.Order_item_id != "" {
+		query["order_item_id"] = filter.Order_item_id
+	}
+	if filter.Reason != "" {
+		query["reason"] = filter.Reason
+	}
+	if filter.Reference != "" {
+		query["reference"] = filter.Reference
+	}
+	created := bson.M{}
+	if filter.From != nil {
+		created["$gte"] = *filter.From
+	}
+	if filter.To != nil {
+		created["$lt"] = *filter.To
+	}
+	if len(created) > 0 {
+		query["created_at"] = created
+	}
+	cursor, err := s.movements.Find(ctx, query,
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	all := []models.StockMovement{}
+	err = cursor.All(ctx, &all)
+	return all, err
+}
@@ -0,0 +1,70 @@
+package inventory
+
+import (
+	"math"
+	"restro/models"
+	"sort"
+)
+
+// Suggestion is how much of an ingredient to order to get back to par.
+type Suggestion struct {
+	Ingredient_ID      string   `json:"ingredient_id"`
+	Name               *string  `json:"name"`
+	Unit               *string  `json:"unit"`
+	Supplier_ID        *string  `json:"supplier_id"`
+	On_hand            float64  `json:"on_hand"`
+	On_order           float64  `json:"on_order"`
+	Par_level          float64  `json:"par_level"`
+	Daily_usage        float64  `json:"daily_usage"`
+	Lead_time_days     int      `json:"lead_time_days"`
+	Suggested_quantity float64  `json:"suggested_quantity"`
+	Unit_cost          *float64 `json:"unit_cost"`
+}
+
+// SuggestReorders proposes an order for every ingredient with a par level
+// whose stock, counting what is already on order, won't cover the par level
+// plus what the kitchen uses while the delivery is on its way. usage is
+// what was used over the last days days; leadTimes are by supplier.
+func SuggestReorders(ingredients []models.Ingredient, usage map[string]float64,
+	days int, onOrder map[string]float64, leadTimes map[string]int) []Suggestion {
+	suggestions := []Suggestion{}
+	for _, ingredient := range ingredients {
+		if ingredient.Par_level == nil {
+			continue
+		}
+		suggestion := Suggestion{
+			Ingredient_ID: ingredient.Ingredient_ID,
+			Name:          ingredient.Name,
+			Unit:          ingredient.Unit,
+			Supplier_ID:   ingredient.Supplier_ID,
+			On_hand:       ingredient.Quantity,
+			On_order:      onOrder[ingredient.Ingredient_ID],
+			Par_level:     *ingredient.Par_level,
+			Unit_cost:     ingredient.Cost_per_unit,
+		}
+		if days > 0 {
+			suggestion.Daily_usage = math.Max(0,
+				usage[ingredient.Ingredient_ID]/float64(days))
+		}
+		if ingredient.Supplier_ID != nil {
+			suggestion.Lead_time_days = leadTimes[*ingredient.Supplier_ID]
+		}
+		target := suggestion.Par_level +
+			suggestion.Daily_usage*float64(suggestion.Lead_time_days)
+		need := target - suggestion.On_hand - suggestion.On_order
+		if need <= 0 {
+			continue
+		}
+		suggestion.Suggested_quantity = math.Ceil(need*100) / 100
+		suggestions = append(suggestions, suggestion)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := derefString(suggestions[i].Supplier_ID),
+			derefString(suggestions[j].Supplier_ID)
+		if a != b {
+			return a < b
+		}
+		return derefString(suggestions[i].Name) < derefString(suggestions[j].Name)
+	})
+	return suggestions
+}
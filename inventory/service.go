@@ -0,0 +1,283 @@
+package inventory
+
+import (
+	"context"
+	"restro/models"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Service applies the stock rules on top of a Store. Stock is allowed to go
+// negative: the kitchen has already cooked the dish, so the ledger records
+// it and the count is corrected with an adjustment.
+type Service struct {
+	store Store
+}
+
+func NewService(store Store) *Service {
+	return &Service{store: store}
+}
+
+func (s *Service) Store() Store {
+	return s.store
+}
+
+// Requirements returns how much of each ingredient one order item uses: the
+// recipe for its size (or the food's base recipe) plus a recipe for each of
+// its modifiers, preferring one specific to the food over a general one.
+func Requirements(recipes []models.Recipe, item models.OrderItem) map[string]float64 {
+	foodID := derefString(item.Food_id)
+	size := derefString(item.Quantity)
+
+	var base, sized *models.Recipe
+	modifiers := map[string]*models.Recipe{}
+	for i := range recipes {
+		recipe := &recipes[i]
+		forFood := recipe.Food_ID != nil && *recipe.Food_ID == foodID
+		switch {
+		case recipe.Modifier != nil:
+			current := modifiers[*recipe.Modifier]
+			if recipe.Food_ID == nil && current == nil ||
+				forFood && (current == nil || current.Food_ID == nil) {
+				modifiers[*recipe.Modifier] = recipe
+			}
+		case !forFood:
+		case recipe.Variant == nil:
+			base = recipe
+		case *recipe.Variant == size:
+			sized = recipe
+		}
+	}
+	if sized != nil {
+		base = sized
+	}
+
+	needs := map[string]float64{}
+	if base != nil {
+		for _, component := range base.Components {
+			needs[component.Ingredient_ID] += component.Quantity
+		}
+	}
+	for _, modifier := range item.Modifiers {
+		if recipe := modifiers[modifier]; recipe != nil {
+			for _, component := range recipe.Components {
+				needs[component.Ingredient_ID] += component.Quantity
+			}
+		}
+	}
+	return needs
+}
+
+// Consume takes the stock for a fired or served order item.
+func (s *Service) Consume(ctx context.Context, item models.OrderItem, by string) ([]models.StockMovement, error) {
+	recipes, err := s.store.Recipes(ctx, derefString(item.Food_id))
+	if err != nil {
+		return nil, err
+	}
+	needs := Requirements(recipes, item)
+	changes := map[string]float64{}
+	for id, quantity := range needs {
+		changes[id] = -quantity
+	}
+	return s.applyAll(ctx, changes, models.MovementConsumption,
+		&item.Order_item_id, "", "", by)
+}
+
+// Reverse gives back what was consumed for an order item. It works from the
+// ledger rather than the recipe, so a recipe edited since the item was fired
+// doesn't skew the stock.
+func (s *Service) Reverse(ctx context.Context, item models.OrderItem, by string) ([]models.StockMovement, error) {
+	recorded, err := s.store.Movements(ctx,
+		MovementFilter{Order_item_id: item.Order_item_id})
+	if err != nil {
+		return nil, err
+	}
+	changes := map[string]float64{}
+	for _, movement := range recorded {
+		switch movement.Reason {
+		case models.MovementConsumption, models.MovementReversal:
+			changes[movement.Ingredient_ID] -= movement.Change
+		}
+	}
+	return s.applyAll(ctx, changes, models.MovementReversal,
+		&item.Order_item_id, "", "", by)
+}
+
+// Adjust records a manual stock correction of change units.
+func (s *Service) Adjust(ctx context.Context, ingredientID string, change float64,
+	note, by string) (models.StockMovement, error) {
+	ingredient, err := s.store.Ingredient(ctx, ingredientID)
+	if err != nil {
+		return models.StockMovement{}, err
+	}
+	return s.store.ApplyMovement(ctx, newMovement(ingredient, change,
+		models.MovementAdjustment, nil, note, by))
+}
+
+// Count records a stock take: the adjustment that brings the ingredient to
+// the counted quantity.
+func (s *Service) Count(ctx context.Context, ingredientID string, counted float64,
+	note, by string) (models.StockMovement, error) {
+	ingredient, err := s.store.Ingredient(ctx, ingredientID)
+	if err != nil {
+		return models.StockMovement{}, err
+	}
+	return s.store.ApplyMovement(ctx, newMovement(ingredient,
+		counted-ingredient.Quantity, models.MovementAdjustment, nil, note, by))
+}
+
+// Receive books goods coming in at the price actually paid and moves the
+// ingredient's cost to the weighted average of the stock on hand and the
+// delivery. reference ties the movement to its purchase order. The cost is
+// read and saved in the movement's transaction, so two deliveries at once
+// can't both average from the same cost.
+func (s *Service) Receive(ctx context.Context, ingredientID string, quantity,
+	unitCost float64, reference, note, by string) (models.StockMovement, error) {
+	var movement models.StockMovement
+	err := s.store.InTransaction(ctx, func(ctx context.Context) error {
+		ingredient, err := s.store.Ingredient(ctx, ingredientID)
+		if err != nil {
+			return err
+		}
+		movement = newMovement(ingredient, quantity, models.MovementReceipt,
+			nil, note, by)
+		movement.Unit_cost = unitCost
+		if reference != "" {
+			movement.Reference = &reference
+		}
+		movement, err = s.store.ApplyMovement(ctx, movement)
+		if err != nil {
+			return err
+		}
+
+		cost := unitCost
+		if onHand := movement.Balance_after - quantity; onHand > 0 &&
+			ingredient.Cost_per_unit != nil {
+			cost = (onHand**ingredient.Cost_per_unit + quantity*unitCost) /
+				movement.Balance_after
+		}
+		ingredient.Cost_per_unit = &cost
+		ingredient.Updated_at = movement.Created_at
+		return s.store.SaveIngredient(ctx, ingredient)
+	})
+	return movement, err
+}
+
+// WasteFood takes what portions of a food are made of out of stock as
+// waste. The item gives the food, size and modifiers; reference ties the
+// movements to the waste entry.
+func (s *Service) WasteFood(ctx context.Context, item models.OrderItem,
+	portions float64, reference, note, by string) ([]models.StockMovement, error) {
+	recipes, err := s.store.Recipes(ctx, derefString(item.Food_id))
+	if err != nil {
+		return nil, err
+	}
+	changes := map[string]float64{}
+	for id, quantity := range Requirements(recipes, item) {
+		changes[id] = -quantity * portions
+	}
+	return s.applyAll(ctx, changes, models.MovementWaste, nil, reference,
+		note, by)
+}
+
+// WasteIngredient takes quantity of an ingredient out of stock as waste.
+func (s *Service) WasteIngredient(ctx context.Context, ingredientID string,
+	quantity float64, reference, note, by string) (models.StockMovement, error) {
+	movements, err := s.applyAll(ctx, map[string]float64{ingredientID: -quantity},
+		models.MovementWaste, nil, reference, note, by)
+	if err != nil || len(movements) == 0 {
+		return models.StockMovement{}, err
+	}
+	return movements[0], nil
+}
+
+// ConsumedCost is what the stock used for an order item cost, net of
+// anything given back.
+func (s *Service) ConsumedCost(ctx context.Context, orderItemID string) (float64, error) {
+	movements, err := s.store.Movements(ctx,
+		MovementFilter{Order_item_id: orderItemID})
+	if err != nil {
+		return 0, err
+	}
+	return CostOf(movements), nil
+}
+
+// CostOf values the stock the movements took out at the cost each was
+// booked at. Stock coming back counts against it.
+func CostOf(movements []models.StockMovement) float64 {
+	var cost float64
+	for _, movement := range movements {
+		cost -= movement.Change * movement.Unit_cost
+	}
+	return cost
+}
+
+// Usage returns how much of each ingredient was used or thrown away since
+// the given time, net of reversals.
+func (s *Service) Usage(ctx context.Context, since time.Time) (map[string]float64, error) {
+	movements, err := s.store.Movements(ctx, MovementFilter{From: &since})
+	if err != nil {
+		return nil, err
+	}
+	usage := map[string]float64{}
+	for _, movement := range movements {
+		switch movement.Reason {
+		case models.MovementConsumption, models.MovementReversal,
+			models.MovementWaste:
+			usage[movement.Ingredient_ID] -= movement.Change
+		}
+	}
+	return usage, nil
+}
+
+func (s *Service) applyAll(ctx context.Context, changes map[string]float64,
+	reason string, orderItemID *string, reference, note,
+	by string) ([]models.StockMovement, error) {
+	ids := make([]string, 0, len(changes))
+	for id, change := range changes {
+		if change != 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	applied := []models.StockMovement{}
+	for _, id := range ids {
+		ingredient, err := s.store.Ingredient(ctx, id)
+		if err != nil {
+			return applied, err
+		}
+		movement := newMovement(ingredient, changes[id], reason, orderItemID,
+			note, by)
+		if reference != "" {
+			movement.Reference = &reference
+		}
+		movement, err = s.store.ApplyMovement(ctx, movement)
+		if err != nil {
+			return applied, err
+		}
+		applied = append(applied, movement)
+	}
+	return applied, nil
+}
+
+func newMovement(ingredient models.Ingredient, change float64, reason string,
+	orderItemID *string, note, by string) models.StockMovement {
+	var movement models.StockMovement
+	movement.ID = primitive.NewObjectID()
+	movement.Movement_ID = movement.ID.Hex()
+	movement.Ingredient_ID = ingredient.Ingredient_ID
+	movement.Change = change
+	if ingredient.Cost_per_unit != nil {
+		movement.Unit_cost = *ingredient.Cost_per_unit
+	}
+	movement.Reason = reason
+	movement.Order_item_id = orderItemID
+	movement.Note = note
+	movement.Created_by = by
+	movement.Created_at, _ = time.Parse(time.RFC3339,
+		time.Now().Format(time.RFC3339))
+	return movement
+}
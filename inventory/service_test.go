@@ -0,0 +1,218 @@
+package inventory
+
+import (
+	"context"
+	"math"
+	"restro/models"
+	"sync"
+	"testing"
+)
+
+func str(s string) *string   { return &s }
+func num(x float64) *float64 { return &x }
+func near(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+func addIngredient(t *testing.T, store *MemoryStore, id string, quantity,
+	cost float64) {
+	t.Helper()
+	ctx := context.Background()
+	if err := store.SaveIngredient(ctx, models.Ingredient{
+		Ingredient_ID: id, Name: str(id), Unit: str("kg"),
+		Cost_per_unit: num(cost)}); err != nil {
+		t.Fatal(err)
+	}
+	if quantity != 0 {
+		if _, err := store.ApplyMovement(ctx, models.StockMovement{
+			Ingredient_ID: id, Change: quantity,
+			Reason: models.MovementAdjustment}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func quantityOf(t *testing.T, store Store, id string) float64 {
+	t.Helper()
+	ingredient, err := store.Ingredient(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ingredient.Quantity
+}
+
+// pizzaKitchen has a pizza with a base and a large recipe, and extra
+// cheese as a general modifier and one specific to the pizza.
+func pizzaKitchen(t *testing.T) (*MemoryStore, *Service) {
+	store := NewMemoryStore()
+	addIngredient(t, store, "flour", 10, 0.5)
+	addIngredient(t, store, "cheese", 5, 2)
+	ctx := context.Background()
+	for _, recipe := range []models.Recipe{
+		{Recipe_ID: "base", Food_ID: str("pizza"), Components: []models.RecipeComponent{
+			{Ingredient_ID: "flour", Quantity: 0.3},
+			{Ingredient_ID: "cheese", Quantity: 0.2}}},
+		{Recipe_ID: "large", Food_ID: str("pizza"), Variant: str("L"),
+			Components: []models.RecipeComponent{
+				{Ingredient_ID: "flour", Quantity: 0.5},
+				{Ingredient_ID: "cheese", Quantity: 0.3}}},
+		{Recipe_ID: "extra", Modifier: str("extra cheese"),
+			Components: []models.RecipeComponent{
+				{Ingredient_ID: "cheese", Quantity: 0.1}}},
+		{Recipe_ID: "extra-pizza", Food_ID: str("pizza"),
+			Modifier: str("extra cheese"), Components: []models.RecipeComponent{
+				{Ingredient_ID: "cheese", Quantity: 0.15}}},
+	} {
+		if err := store.SaveRecipe(ctx, recipe); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store, NewService(store)
+}
+
+func TestConsumeUsesSizeAndModifierRecipes(t *testing.T) {
+	store, service := pizzaKitchen(t)
+	item := models.OrderItem{Order_item_id: "i1", Food_id: str("pizza"),
+		Quantity: str("L"), Modifiers: []string{"extra cheese"}}
+	movements, err := service.Consume(context.Background(), item, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(movements) != 2 {
+		t.Fatalf("got %d movements, want flour and cheese", len(movements))
+	}
+	for _, movement := range movements {
+		if movement.Reason != models.MovementConsumption ||
+			derefString(movement.Order_item_id) != "i1" ||
+			movement.Created_by != "u1" {
+			t.Errorf("movement = %+v", movement)
+		}
+	}
+	if got := quantityOf(t, store, "flour"); !near(got, 9.5) {
+		t.Errorf("flour = %v, want 9.5 from the large recipe", got)
+	}
+	if got := quantityOf(t, store, "cheese"); !near(got, 4.55) {
+		t.Errorf("cheese = %v, want 4.55 with the pizza's own extra cheese",
+			got)
+	}
+	cost, _ := service.ConsumedCost(context.Background(), "i1")
+	if !near(cost, 0.5*0.5+0.45*2) {
+		t.Errorf("consumed cost = %v, want 1.15", cost)
+	}
+
+	// a size without its own recipe uses the base
+	item = models.OrderItem{Order_item_id: "i2", Food_id: str("pizza"),
+		Quantity: str("M")}
+	if _, err := service.Consume(context.Background(), item, "u1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := quantityOf(t, store, "flour"); !near(got, 9.2) {
+		t.Errorf("flour = %v, want 9.2 after a base pizza", got)
+	}
+}
+
+func TestReverseGivesBackOnce(t *testing.T) {
+	store, service := pizzaKitchen(t)
+	ctx := context.Background()
+	item := models.OrderItem{Order_item_id: "i1", Food_id: str("pizza"),
+		Modifiers: []string{"extra cheese"}}
+	if _, err := service.Consume(ctx, item, "u1"); err != nil {
+		t.Fatal(err)
+	}
+	// an edit to the recipe since doesn't change what is given back
+	if err := store.SaveRecipe(ctx, models.Recipe{Recipe_ID: "base",
+		Food_ID: str("pizza"), Components: []models.RecipeComponent{
+			{Ingredient_ID: "flour", Quantity: 1}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	movements, err := service.Reverse(ctx, item, "u2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(movements) != 2 {
+		t.Fatalf("got %d reversals, want 2", len(movements))
+	}
+	for _, movement := range movements {
+		if movement.Reason != models.MovementReversal || movement.Change <= 0 {
+			t.Errorf("reversal = %+v", movement)
+		}
+	}
+	if flour, cheese := quantityOf(t, store, "flour"),
+		quantityOf(t, store, "cheese"); !near(flour, 10) || !near(cheese, 5) {
+		t.Fatalf("stock = %v flour, %v cheese, want 10 and 5", flour, cheese)
+	}
+
+	movements, err = service.Reverse(ctx, item, "u2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(movements) != 0 {
+		t.Fatalf("reversing again moved %+v", movements)
+	}
+	if flour := quantityOf(t, store, "flour"); !near(flour, 10) {
+		t.Fatalf("flour = %v after reversing twice, want 10", flour)
+	}
+	if cost, _ := service.ConsumedCost(ctx, "i1"); !near(cost, 0) {
+		t.Fatalf("consumed cost = %v once reversed, want 0", cost)
+	}
+}
+
+func TestReceiveAveragesCost(t *testing.T) {
+	ctx := context.Background()
+	for _, tt := range []struct {
+		name     string
+		quantity float64
+		cost     float64
+		want     float64
+	}{
+		{"with stock on hand", 10, 0.5, (10*0.5 + 30*0.9) / 40},
+		{"with none on hand", 0, 0.5, 0.9},
+		// what is owed to the stock isn't valued
+		{"with stock below zero", -5, 0.5, 0.9},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			addIngredient(t, store, "flour", tt.quantity, tt.cost)
+			service := NewService(store)
+			movement, err := service.Receive(ctx, "flour", 30, 0.9, "po1",
+				"", "u1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if movement.Reason != models.MovementReceipt ||
+				movement.Unit_cost != 0.9 ||
+				derefString(movement.Reference) != "po1" ||
+				!near(movement.Balance_after, tt.quantity+30) {
+				t.Fatalf("receipt = %+v", movement)
+			}
+			flour, _ := store.Ingredient(ctx, "flour")
+			if !near(*flour.Cost_per_unit, tt.want) {
+				t.Fatalf("cost = %v, want %v", *flour.Cost_per_unit, tt.want)
+			}
+			if !near(flour.Quantity, tt.quantity+30) {
+				t.Fatalf("quantity = %v", flour.Quantity)
+			}
+		})
+	}
+}
+
+func TestReceiveAtOnceAveragesBoth(t *testing.T) {
+	store := NewMemoryStore()
+	addIngredient(t, store, "flour", 10, 0.5)
+	service := NewService(store)
+	var wg sync.WaitGroup
+	for _, cost := range []float64{1, 2} {
+		wg.Add(1)
+		go func(cost float64) {
+			defer wg.Done()
+			if _, err := service.Receive(context.Background(), "flour", 10,
+				cost, "", "", "u1"); err != nil {
+				t.Error(err)
+			}
+		}(cost)
+	}
+	wg.Wait()
+	flour, _ := store.Ingredient(context.Background(), "flour")
+	if want := (10*0.5 + 10*1 + 10*2) / 30.0; !near(*flour.Cost_per_unit, want) {
+		t.Fatalf("cost = %v, want %v", *flour.Cost_per_unit, want)
+	}
+}
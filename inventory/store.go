@@ -0,0 +1,64 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"restro/models"
+	"time"
+)
+
+var ErrNotFound = errors.New("not found")
+
+type MovementFilter struct {
+	Ingredient_ID string
+	Order_item_id string
+	Reason        string
+	Reference     string
+	From          *time.Time
+	To            *time.Time
+}
+
+// Store persists ingredients, recipes and the stock ledger. ApplyMovement
+// has to change the ingredient's quantity and record the movement together,
+// filling in Balance_after.
+type Store interface {
+	Ingredient(ctx context.Context, id string) (models.Ingredient, error)
+	Ingredients(ctx context.Context) ([]models.Ingredient, error)
+	SaveIngredient(ctx context.Context, ingredient models.Ingredient) error
+	SetLowStock(ctx context.Context, id string, low bool) error
+
+	Recipe(ctx context.Context, id string) (models.Recipe, error)
+	Recipes(ctx context.Context, foodID string) ([]models.Recipe, error)
+	SaveRecipe(ctx context.Context, recipe models.Recipe) error
+	DeleteRecipe(ctx context.Context, id string) error
+
+	ApplyMovement(ctx context.Context, movement models.StockMovement) (models.StockMovement, error)
+	Movements(ctx context.Context, filter MovementFilter) ([]models.StockMovement, error)
+
+	// InTransaction runs fn so that what it reads and writes through the
+	// store with the context it is given is one transaction, joining the
+	// one ctx is in if any.
+	InTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+func (f MovementFilter) matches(m models.StockMovement) bool {
+	if f.Ingredient_ID != "" && m.Ingredient_ID != f.Ingredient_ID {
+		return false
+	}
+	if f.Order_item_id != "" && (m.Order_item_id == nil || *m.Order_item_id != f.Order_item_id) {
+		return false
+	}
+	if f.Reason != "" && m.Reason != f.Reason {
+		return false
+	}
+	if f.Reference != "" && (m.Reference == nil || *m.Reference != f.Reference) {
+		return false
+	}
+	if f.From != nil && m.Created_at.Before(*f.From) {
+		return false
+	}
+	if f.To != nil && !m.Created_at.Before(*f.To) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,171 @@
+package labour
+
+import (
+	"math"
+	"restro/models"
+	"sort"
+	"time"
+)
+
+// Row compares one staff member's scheduled and actual hours in a role.
+type Row struct {
+	User_id         string  `json:"user_id"`
+	Name            string  `json:"name"`
+	Role            string  `json:"role"`
+	Scheduled_hours float64 `json:"scheduled_hours"`
+	Actual_hours    float64 `json:"actual_hours"`
+	Variance_hours  float64 `json:"variance_hours"`
+	Scheduled_cost  float64 `json:"scheduled_cost"`
+	Labour_cost     float64 `json:"labour_cost"`
+}
+
+// Report is labour over a period against the sales made in it. Labour cost
+// is what the hours actually worked cost; Labour_percent is that as a
+// percentage of sales, zero when there were none.
+type Report struct {
+	From            time.Time `json:"from"`
+	To              time.Time `json:"to"`
+	Rows            []Row     `json:"rows"`
+	Scheduled_hours float64   `json:"scheduled_hours"`
+	Actual_hours    float64   `json:"actual_hours"`
+	Variance_hours  float64   `json:"variance_hours"`
+	Scheduled_cost  float64   `json:"scheduled_cost"`
+	Labour_cost     float64   `json:"labour_cost"`
+	Sales           float64   `json:"sales"`
+	Labour_percent  float64   `json:"labour_percent"`
+}
+
+// Scheduled is how much of the shift falls between from and to.
+func Scheduled(shift models.Shift, from, to time.Time) time.Duration {
+	if shift.Start == nil || shift.End == nil {
+		return 0
+	}
+	return overlap(*shift.Start, *shift.End, from, to)
+}
+
+// Worked is how much of the entry between from and to was on the clock,
+// less unpaid breaks. An entry or break still open runs until now.
+func Worked(entry models.TimeClockEntry, from, to, now time.Time) time.Duration {
+	end := now
+	if entry.Clock_out != nil {
+		end = *entry.Clock_out
+	}
+	worked := overlap(entry.Clock_in, end, from, to)
+	if worked == 0 {
+		return 0
+	}
+	start := later(entry.Clock_in, from)
+	if to.Before(end) {
+		end = to
+	}
+	for _, pause := range entry.Breaks {
+		if pause.Paid {
+			continue
+		}
+		breakEnd := end
+		if pause.End != nil {
+			breakEnd = *pause.End
+		}
+		worked -= overlap(pause.Start, breakEnd, start, end)
+	}
+	if worked < 0 {
+		return 0
+	}
+	return worked
+}
+
+// Build puts the report together. rates are the staff members' own hourly
+// rates, used for shifts that don't set one, and names label the rows.
+func Build(from, to, now time.Time, shifts []models.Shift,
+	entries []models.TimeClockEntry, rates map[string]float64,
+	names map[string]string, sales float64) Report {
+	type key struct{ user, role string }
+	rows := map[key]*Row{}
+	row := func(user, role string) *Row {
+		k := key{user, role}
+		if rows[k] == nil {
+			rows[k] = &Row{User_id: user, Name: names[user], Role: role}
+		}
+		return rows[k]
+	}
+
+	for _, shift := range shifts {
+		hours := Scheduled(shift, from, to).Hours()
+		if hours == 0 || shift.User_id == nil || shift.Role == nil {
+			continue
+		}
+		rate := rates[*shift.User_id]
+		if shift.Hourly_rate != nil {
+			rate = *shift.Hourly_rate
+		}
+		r := row(*shift.User_id, *shift.Role)
+		r.Scheduled_hours += hours
+		r.Scheduled_cost += hours * rate
+	}
+	for _, entry := range entries {
+		hours := Worked(entry, from, to, now).Hours()
+		if hours == 0 {
+			continue
+		}
+		r := row(entry.User_id, entry.Role)
+		r.Actual_hours += hours
+		r.Labour_cost += hours * entry.Hourly_rate
+	}
+
+	report := Report{From: from, To: to, Rows: []Row{}, Sales: round2(sales)}
+	for _, r := range rows {
+		r.Scheduled_hours = round2(r.Scheduled_hours)
+		r.Actual_hours = round2(r.Actual_hours)
+		r.Variance_hours = round2(r.Actual_hours - r.Scheduled_hours)
+		r.Scheduled_cost = round2(r.Scheduled_cost)
+		r.Labour_cost = round2(r.Labour_cost)
+		report.Rows = append(report.Rows, *r)
+
+		report.Scheduled_hours += r.Scheduled_hours
+		report.Actual_hours += r.Actual_hours
+		report.Scheduled_cost += r.Scheduled_cost
+		report.Labour_cost += r.Labour_cost
+	}
+	sort.Slice(report.Rows, func(i, j int) bool {
+		a, b := report.Rows[i], report.Rows[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.User_id != b.User_id {
+			return a.User_id < b.User_id
+		}
+		return a.Role < b.Role
+	})
+	report.Scheduled_hours = round2(report.Scheduled_hours)
+	report.Actual_hours = round2(report.Actual_hours)
+	report.Variance_hours = round2(report.Actual_hours - report.Scheduled_hours)
+	report.Scheduled_cost = round2(report.Scheduled_cost)
+	report.Labour_cost = round2(report.Labour_cost)
+	if report.Sales > 0 {
+		report.Labour_percent = round2(report.Labour_cost / report.Sales * 100)
+	}
+	return report
+}
+
+// overlap is how long [start, end) and [from, to) have in common.
+func overlap(start, end, from, to time.Time) time.Duration {
+	start = later(start, from)
+	if to.Before(end) {
+		end = to
+	}
+	if !start.Before(end) {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func round2(num float64) float64 {
+	return math.Round(num*100) / 100
+}
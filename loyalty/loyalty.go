@@ -0,0 +1,147 @@
+// Package loyalty works out the points members earn and spend.
+package loyalty
+
+import (
+	"math"
+	"restro/models"
+	"sort"
+	"time"
+)
+
+// Line is what an invoice charged for one of its items.
+type Line struct {
+	Food_id string
+	Amount  float64
+}
+
+// Earn is the points an invoice earns under the rules, multiplied by the
+// member's tier multiplier and rounded down. Only paidShare of each line
+// counts, the rest having been paid with points; spend is what that comes
+// to. A rule for a food earns on what was spent on it, others on the whole
+// spend, and a rule only applies to invoices of its order type spending at
+// least its minimum.
+func Earn(rules []models.EarnRule, orderType string, lines []Line,
+	paidShare, multiplier float64) (points int, spend float64) {
+	if paidShare <= 0 {
+		return 0, 0
+	}
+	if paidShare > 1 {
+		paidShare = 1
+	}
+	for _, line := range lines {
+		spend += line.Amount
+	}
+	spend = round2(spend * paidShare)
+
+	var earned float64
+	for _, rule := range rules {
+		if rule.Order_type != nil && *rule.Order_type != orderType {
+			continue
+		}
+		if spend < rule.Min_spend {
+			continue
+		}
+		ruleSpend := spend
+		if rule.Food_id != nil {
+			ruleSpend = 0
+			for _, line := range lines {
+				if line.Food_id == *rule.Food_id {
+					ruleSpend += line.Amount * paidShare
+				}
+			}
+		}
+		earned += ruleSpend * rule.Points_per_unit
+	}
+	if multiplier <= 0 {
+		multiplier = 1
+	}
+	return int(math.Floor(earned*multiplier + 1e-9)), spend
+}
+
+// TierFor is the highest tier lifetimePoints reach, if any.
+func TierFor(tiers []models.LoyaltyTier, lifetimePoints int) (models.LoyaltyTier, bool) {
+	var best models.LoyaltyTier
+	found := false
+	for _, tier := range tiers {
+		if tier.Min_points <= lifetimePoints &&
+			(!found || tier.Min_points > best.Min_points) {
+			best, found = tier, true
+		}
+	}
+	return best, found
+}
+
+// NextTier is the lowest tier above lifetimePoints, if any.
+func NextTier(tiers []models.LoyaltyTier, lifetimePoints int) (models.LoyaltyTier, bool) {
+	var next models.LoyaltyTier
+	found := false
+	for _, tier := range tiers {
+		if tier.Min_points > lifetimePoints &&
+			(!found || tier.Min_points < next.Min_points) {
+			next, found = tier, true
+		}
+	}
+	return next, found
+}
+
+// PointsFor is the points that pay amount when each point is worth
+// pointValue, rounded up so the amount is covered.
+func PointsFor(amount, pointValue float64) int {
+	if pointValue <= 0 {
+		return 0
+	}
+	return int(math.Ceil(amount/pointValue - 1e-9))
+}
+
+// Share is part of points in proportion to part of whole, rounded to the
+// nearest point and at most points.
+func Share(points int, part, whole float64) int {
+	if whole <= 0 || part >= whole {
+		return points
+	}
+	return int(math.Round(float64(points) * part / whole))
+}
+
+// Lot is points earned or given that are still to be spent, expiring at
+// Expires_at unless that is nil.
+type Lot struct {
+	ID         string
+	Remaining  int
+	Expires_at *time.Time
+}
+
+// Take works out which lots points are spent from: those expiring soonest
+// first, then those that never expire. It returns the lots taken from with
+// how many points to take from each, and how many points the lots fell
+// short by.
+func Take(lots []Lot, points int) (taken []Lot, short int) {
+	sorted := append([]Lot{}, lots...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].Expires_at, sorted[j].Expires_at
+		if a == nil || b == nil {
+			return a != nil
+		}
+		return a.Before(*b)
+	})
+	taken = []Lot{}
+	for _, lot := range sorted {
+		if points == 0 {
+			break
+		}
+		if lot.Remaining <= 0 {
+			continue
+		}
+		take := lot.Remaining
+		if take > points {
+			take = points
+		}
+		taken = append(taken, Lot{ID: lot.ID, Remaining: take,
+			Expires_at: lot.Expires_at})
+		points -= take
+	}
+	return taken, points
+}
+
+func round2(x float64) float64 {
+	return math.Round(x*100) / 100
+}
@@ -0,0 +1,207 @@
+package loyalty
+
+import (
+	"restro/models"
+	"testing"
+	"time"
+)
+
+func text(s string) *string { return &s }
+
+var pizzaAndWine = []Line{
+	{Food_id: "pizza", Amount: 12},
+	{Food_id: "wine", Amount: 8},
+}
+
+func TestEarn(t *testing.T) {
+	base := models.EarnRule{Rule_id: "base", Points_per_unit: 1}
+	pizza := models.EarnRule{Rule_id: "pizza", Points_per_unit: 2,
+		Food_id: text("pizza")}
+	delivery := models.EarnRule{Rule_id: "delivery", Points_per_unit: 0.5,
+		Order_type: text(models.OrderDelivery)}
+	big := models.EarnRule{Rule_id: "big", Points_per_unit: 3, Min_spend: 25}
+	for _, tt := range []struct {
+		name       string
+		rules      []models.EarnRule
+		orderType  string
+		lines      []Line
+		paidShare  float64
+		multiplier float64
+		points     int
+		spend      float64
+	}{
+		{"one point a unit", []models.EarnRule{base}, models.OrderDineIn,
+			pizzaAndWine, 1, 1, 20, 20},
+		{"half paid with points", []models.EarnRule{base}, models.OrderDineIn,
+			pizzaAndWine, 0.5, 1, 10, 10},
+		{"all paid with points", []models.EarnRule{base}, models.OrderDineIn,
+			pizzaAndWine, 0, 1, 0, 0},
+		{"more than paid counts once", []models.EarnRule{base},
+			models.OrderDineIn, pizzaAndWine, 1.5, 1, 20, 20},
+		{"a food earns on what was spent on it",
+			[]models.EarnRule{base, pizza}, models.OrderDineIn, pizzaAndWine,
+			1, 1, 20 + 24, 20},
+		{"a food rule scales with what was paid",
+			[]models.EarnRule{base, pizza}, models.OrderDineIn, pizzaAndWine,
+			0.25, 1, 5 + 6, 5},
+		{"a food rule without the food", []models.EarnRule{pizza},
+			models.OrderDineIn, []Line{{Food_id: "wine", Amount: 8}}, 1, 1,
+			0, 8},
+		{"an order type rule on another type",
+			[]models.EarnRule{base, delivery}, models.OrderDineIn, pizzaAndWine,
+			1, 1, 20, 20},
+		{"an order type rule on its type", []models.EarnRule{base, delivery},
+			models.OrderDelivery, pizzaAndWine, 1, 1, 30, 20},
+		{"below the minimum spend", []models.EarnRule{base, big},
+			models.OrderDineIn, pizzaAndWine, 1, 1, 20, 20},
+		{"at the minimum spend", []models.EarnRule{base, big},
+			models.OrderDineIn, []Line{{Food_id: "pizza", Amount: 25}}, 1, 1,
+			100, 25},
+		{"the minimum is of what was paid", []models.EarnRule{base, big},
+			models.OrderDineIn, []Line{{Food_id: "pizza", Amount: 40}}, 0.5, 1,
+			20, 20},
+		{"a tier multiplies", []models.EarnRule{base, pizza},
+			models.OrderDineIn, pizzaAndWine, 1, 1.5, 66, 20},
+		{"no multiplier is one", []models.EarnRule{base}, models.OrderDineIn,
+			pizzaAndWine, 1, 0, 20, 20},
+		{"rounded down", []models.EarnRule{base}, models.OrderDineIn,
+			[]Line{{Food_id: "pizza", Amount: 19.99}}, 1, 1.5, 29, 19.99},
+		{"not short by a rounding error",
+			[]models.EarnRule{{Rule_id: "tenth", Points_per_unit: 0.1}},
+			models.OrderDineIn, []Line{{Food_id: "pizza", Amount: 30}}, 1, 1,
+			3, 30},
+		{"spend is rounded to the cent", []models.EarnRule{base},
+			models.OrderDineIn, []Line{{Food_id: "pizza", Amount: 10.01}},
+			1.0 / 3, 1, 3, 3.34},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			points, spend := Earn(tt.rules, tt.orderType, tt.lines,
+				tt.paidShare, tt.multiplier)
+			if points != tt.points || spend != tt.spend {
+				t.Fatalf("Earn = %d points on %v, want %d on %v", points,
+					spend, tt.points, tt.spend)
+			}
+		})
+	}
+}
+
+func TestTiers(t *testing.T) {
+	tiers := []models.LoyaltyTier{
+		{Name: "Gold", Min_points: 1000, Multiplier: 1.5},
+		{Name: "Bronze", Min_points: 0, Multiplier: 1},
+		{Name: "Silver", Min_points: 250, Multiplier: 1.2},
+	}
+	for _, tt := range []struct {
+		points      int
+		tier, next  string
+		hasTier     bool
+		hasNextTier bool
+	}{
+		{0, "Bronze", "Silver", true, true},
+		{249, "Bronze", "Silver", true, true},
+		{250, "Silver", "Gold", true, true},
+		{5000, "Gold", "", true, false},
+	} {
+		tier, ok := TierFor(tiers, tt.points)
+		if ok != tt.hasTier || tier.Name != tt.tier {
+			t.Errorf("TierFor(%d) = %q, %v, want %q", tt.points, tier.Name,
+				ok, tt.tier)
+		}
+		next, ok := NextTier(tiers, tt.points)
+		if ok != tt.hasNextTier || next.Name != tt.next {
+			t.Errorf("NextTier(%d) = %q, %v, want %q", tt.points, next.Name,
+				ok, tt.next)
+		}
+	}
+	if _, ok := TierFor(tiers[:1], 10); ok {
+		t.Error("a member below every tier has one")
+	}
+}
+
+func TestPointsFor(t *testing.T) {
+	for _, tt := range []struct {
+		amount, value float64
+		points        int
+	}{
+		{10, 0.05, 200},
+		// a part of a point still has to be paid
+		{10.01, 0.05, 201},
+		// and a rounding error doesn't make one
+		{0.3, 0.1, 3},
+		{10, 0, 0},
+	} {
+		if got := PointsFor(tt.amount, tt.value); got != tt.points {
+			t.Errorf("PointsFor(%v, %v) = %d, want %d", tt.amount, tt.value,
+				got, tt.points)
+		}
+	}
+}
+
+func TestShare(t *testing.T) {
+	for _, tt := range []struct {
+		points      int
+		part, whole float64
+		want        int
+	}{
+		{100, 25, 100, 25},
+		{10, 1, 3, 3},
+		{3, 1, 2, 2},
+		{100, 150, 100, 100},
+		{100, 100, 100, 100},
+		{100, 5, 0, 100},
+		{100, 0, 100, 0},
+	} {
+		if got := Share(tt.points, tt.part, tt.whole); got != tt.want {
+			t.Errorf("Share(%d, %v, %v) = %d, want %d", tt.points, tt.part,
+				tt.whole, got, tt.want)
+		}
+	}
+}
+
+func TestTakeSpendsSoonestExpiringFirst(t *testing.T) {
+	day := func(d int) *time.Time {
+		at := time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC)
+		return &at
+	}
+	lots := []Lot{
+		{ID: "march-10", Remaining: 5, Expires_at: day(10)},
+		{ID: "never", Remaining: 10},
+		{ID: "march-5", Remaining: 3, Expires_at: day(5)},
+		{ID: "spent", Remaining: 0, Expires_at: day(1)},
+		{ID: "march-7", Remaining: 4, Expires_at: day(7)},
+	}
+	for _, tt := range []struct {
+		name   string
+		points int
+		taken  []Lot
+		short  int
+	}{
+		{"nothing", 0, []Lot{}, 0},
+		{"from the soonest", 2, []Lot{{ID: "march-5", Remaining: 2}}, 0},
+		{"across lots", 9, []Lot{{ID: "march-5", Remaining: 3},
+			{ID: "march-7", Remaining: 4}, {ID: "march-10", Remaining: 2}}, 0},
+		{"the ones that never expire last", 15, []Lot{
+			{ID: "march-5", Remaining: 3}, {ID: "march-7", Remaining: 4},
+			{ID: "march-10", Remaining: 5}, {ID: "never", Remaining: 3}}, 0},
+		{"short", 25, []Lot{
+			{ID: "march-5", Remaining: 3}, {ID: "march-7", Remaining: 4},
+			{ID: "march-10", Remaining: 5}, {ID: "never", Remaining: 10}}, 3},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			taken, short := Take(lots, tt.points)
+			if short != tt.short || len(taken) != len(tt.taken) {
+				t.Fatalf("Take = %+v short %d, want %+v short %d", taken,
+					short, tt.taken, tt.short)
+			}
+			for i := range tt.taken {
+				if taken[i].ID != tt.taken[i].ID ||
+					taken[i].Remaining != tt.taken[i].Remaining {
+					t.Fatalf("Take = %+v, want %+v", taken, tt.taken)
+				}
+			}
+		})
+	}
+	if lots[0].ID != "march-10" || lots[0].Remaining != 5 {
+		t.Fatal("Take changed the lots it was given")
+	}
+}
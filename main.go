@@ -4,9 +4,11 @@ import (
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/mongo"
 	"os"
+	controller "restro/controllers"
 	"restro/database"
 	"restro/middleware"
 	"restro/routes"
+	"time"
 )
 
 var foodCollection *mongo.Collection = database.OpenCollection(
@@ -22,14 +24,44 @@ func main() {
 	router := gin.New()
 	router.Use(gin.Logger())
 	routes.UserRoutes(router)
+	routes.ImageRoutes(router)
+	routes.GuestRoutes(router)
+	routes.PlatformWebhookRoutes(router)
 	router.Use(middleware.Authentication())
 
 	routes.FoodRoutes(router)
 	routes.MenuRoutes(router)
+	routes.BundleRoutes(router)
 	routes.TableRoutes(router)
 	routes.OrderRoutes(router)
+	routes.CustomerRoutes(router)
+	routes.LoyaltyRoutes(router)
+	routes.GiftCardRoutes(router)
+	routes.DeliveryZoneRoutes(router)
+	routes.SchedulingRoutes(router)
 	routes.OrderItemRoutes(router)
 	routes.InvoiceRoutes(router)
+	routes.KitchenRoutes(router)
+	routes.InventoryRoutes(router)
+	routes.PurchaseOrderRoutes(router)
+	routes.WasteRoutes(router)
+	routes.ReportRoutes(router)
+	routes.ExportRoutes(router)
+	routes.AccountingRoutes(router)
+	routes.ShiftRoutes(router)
+	routes.SectionRoutes(router)
+	routes.FloorRoutes(router)
+	routes.NotificationRoutes(router)
+	routes.GuestOrderRoutes(router)
+	routes.PlatformRoutes(router)
+
+	go controller.RunPriceScheduler(time.Minute)
+	go controller.RunStockEvaluator(time.Minute)
+	go controller.RunOrderScheduler(time.Minute)
+	go controller.RunLoyaltyExpiry(time.Hour)
+	go controller.RunLoyaltyEarning(10 * time.Minute)
+	go controller.RunGiftCardLoading(10 * time.Minute)
+	go controller.RunPlatformNotifier(time.Minute)
 
 	router.Run(":" + port)
 }
@@ -0,0 +1,177 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// ErrUnsupportedType is returned for uploads that aren't JPEG, PNG or GIF.
+var ErrUnsupportedType = errors.New("unsupported image type")
+
+// ErrTooManyPixels is returned for images larger than MaxPixels, which are
+// refused before they are decoded: a small file can claim a huge size.
+var ErrTooManyPixels = errors.New("image has too many pixels")
+
+// MaxPixels is the most pixels, width times height, an upload may have.
+const MaxPixels = 40_000_000
+
+// Variants are the resized versions made of every upload, by name and
+// longest side in pixels.
+var Variants = []struct {
+	Name    string
+	MaxSide int
+}{
+	{"thumbnail", 150},
+	{"medium", 600},
+}
+
+type Rendition struct {
+	Name         string
+	Content_type string
+	Extension    string
+	Width        int
+	Height       int
+	Data         []byte
+}
+
+// DetectContentType sniffs the image type from its bytes rather than
+// trusting the client's Content-Type header.
+func DetectContentType(data []byte) (string, error) {
+	switch contentType := http.DetectContentType(data); contentType {
+	case "image/jpeg", "image/png", "image/gif":
+		return contentType, nil
+	default:
+		return "", ErrUnsupportedType
+	}
+}
+
+// Process decodes the upload and returns the original followed by one
+// rendition per variant. JPEGs stay JPEG; PNGs and GIFs are resized to PNG
+// so transparency survives (animated GIFs keep only their first frame).
+// The size in the image's header is checked against MaxPixels first.
+func Process(data []byte) ([]Rendition, error) {
+	contentType, err := DetectContentType(data)
+	if err != nil {
+		return nil, err
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 ||
+		int64(config.Width)*int64(config.Height) > MaxPixels {
+		return nil, ErrTooManyPixels
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	original := Rendition{
+		Name:         "original",
+		Content_type: contentType,
+		Extension:    extension(contentType),
+		Width:        src.Bounds().Dx(),
+		Height:       src.Bounds().Dy(),
+		Data:         data,
+	}
+	renditions := []Rendition{original}
+
+	for _, variant := range Variants {
+		resized := Resize(src, variant.MaxSide)
+		var buf bytes.Buffer
+		rendition := Rendition{
+			Name:   variant.Name,
+			Width:  resized.Bounds().Dx(),
+			Height: resized.Bounds().Dy(),
+		}
+		if contentType == "image/jpeg" {
+			err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 85})
+			rendition.Content_type = "image/jpeg"
+		} else {
+			err = png.Encode(&buf, resized)
+			rendition.Content_type = "image/png"
+		}
+		if err != nil {
+			return nil, err
+		}
+		rendition.Extension = extension(rendition.Content_type)
+		rendition.Data = buf.Bytes()
+		renditions = append(renditions, rendition)
+	}
+	return renditions, nil
+}
+
+func extension(contentType string) string {
+	switch contentType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	}
+	return ""
+}
+
+// Resize scales the image down so its longest side is at most maxSide,
+// averaging the source pixels each destination pixel covers. Images that
+// already fit are returned at their own size.
+func Resize(src image.Image, maxSide int) *image.NRGBA {
+	b := src.Bounds()
+	srcN := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(srcN, srcN.Bounds(), src, b.Min, draw.Src)
+
+	w, h := b.Dx(), b.Dy()
+	if w <= maxSide && h <= maxSide {
+		return srcN
+	}
+	nw, nh := maxSide, maxSide
+	if w > h {
+		nh = maxInt(1, h*maxSide/w)
+	} else {
+		nw = maxInt(1, w*maxSide/h)
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, nw, nh))
+	for y := 0; y < nh; y++ {
+		y0, y1 := y*h/nh, maxInt((y+1)*h/nh, y*h/nh+1)
+		for x := 0; x < nw; x++ {
+			x0, x1 := x*w/nw, maxInt((x+1)*w/nw, x*w/nw+1)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := srcN.Pix[sy*srcN.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					alpha := uint64(p[3])
+					r += uint64(p[0]) * alpha
+					g += uint64(p[1]) * alpha
+					bl += uint64(p[2]) * alpha
+					a += alpha
+					n++
+				}
+			}
+			i := y*dst.Stride + x*4
+			if a > 0 {
+				dst.Pix[i] = uint8(r / a)
+				dst.Pix[i+1] = uint8(g / a)
+				dst.Pix[i+2] = uint8(bl / a)
+			}
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
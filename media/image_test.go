@@ -0,0 +1,174 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func filled(w, h int, c color.Color) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestResizeKeepsAspect(t *testing.T) {
+	for _, tt := range []struct {
+		w, h, side   int
+		wantW, wantH int
+	}{
+		{300, 100, 150, 150, 50},
+		{100, 300, 150, 50, 150},
+		{400, 400, 150, 150, 150},
+		// already fits
+		{120, 80, 150, 120, 80},
+		{150, 150, 150, 150, 150},
+		// a side never goes below one pixel
+		{1000, 1, 150, 150, 1},
+	} {
+		got := Resize(filled(tt.w, tt.h, color.White), tt.side).Bounds()
+		if got.Min != (image.Point{}) || got.Dx() != tt.wantW ||
+			got.Dy() != tt.wantH {
+			t.Errorf("Resize(%dx%d, %d) = %v, want %dx%d", tt.w, tt.h,
+				tt.side, got, tt.wantW, tt.wantH)
+		}
+	}
+}
+
+func TestResizeAveragesByAlpha(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(0, 0, color.NRGBA{R: 255, A: 255})
+	src.Set(1, 0, color.NRGBA{B: 255, A: 255})
+	if got := Resize(src, 1).NRGBAAt(0, 0); got != (color.NRGBA{R: 127,
+		B: 127, A: 255}) {
+		t.Errorf("red and blue = %v, want purple", got)
+	}
+
+	// a transparent pixel adds no colour, only transparency
+	src.Set(1, 0, color.NRGBA{B: 255, A: 0})
+	if got := Resize(src, 1).NRGBAAt(0, 0); got != (color.NRGBA{R: 255,
+		A: 127}) {
+		t.Errorf("red and clear = %v, want half see-through red", got)
+	}
+}
+
+func TestResizeFromOffsetBounds(t *testing.T) {
+	src := filled(400, 200, color.NRGBA{G: 200, A: 255}).
+		SubImage(image.Rect(100, 50, 300, 150))
+	got := Resize(src, 100)
+	if got.Bounds() != image.Rect(0, 0, 100, 50) {
+		t.Fatalf("bounds = %v", got.Bounds())
+	}
+	if c := got.NRGBAAt(99, 49); c != (color.NRGBA{G: 200, A: 255}) {
+		t.Fatalf("corner = %v", c)
+	}
+}
+
+func encoded(t *testing.T, encode func(*bytes.Buffer, image.Image) error,
+	w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := encode(&buf, filled(w, h, color.NRGBA{R: 10, G: 20, B: 30,
+		A: 255})); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(buf *bytes.Buffer, img image.Image) error {
+	return jpeg.Encode(buf, img, nil)
+}
+
+func encodePNG(buf *bytes.Buffer, img image.Image) error {
+	return png.Encode(buf, img)
+}
+
+func encodeGIF(buf *bytes.Buffer, img image.Image) error {
+	return gif.Encode(buf, img, nil)
+}
+
+func TestProcess(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		data     []byte
+		original string
+		variants string
+	}{
+		{"jpeg", encoded(t, encodeJPEG, 800, 400), "image/jpeg", "image/jpeg"},
+		{"png", encoded(t, encodePNG, 800, 400), "image/png", "image/png"},
+		{"gif", encoded(t, encodeGIF, 800, 400), "image/gif", "image/png"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			renditions, err := Process(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []struct {
+				name          string
+				contentType   string
+				width, height int
+			}{
+				{"original", tt.original, 800, 400},
+				{"thumbnail", tt.variants, 150, 75},
+				{"medium", tt.variants, 600, 300},
+			}
+			if len(renditions) != len(want) {
+				t.Fatalf("got %d renditions", len(renditions))
+			}
+			for i, w := range want {
+				r := renditions[i]
+				if r.Name != w.name || r.Content_type != w.contentType ||
+					r.Extension != extension(w.contentType) ||
+					r.Width != w.width || r.Height != w.height {
+					t.Errorf("rendition %d = %s %s %dx%d, want %+v", i,
+						r.Name, r.Content_type, r.Width, r.Height, w)
+				}
+				config, _, err := image.DecodeConfig(bytes.NewReader(r.Data))
+				if err != nil || config.Width != w.width ||
+					config.Height != w.height {
+					t.Errorf("%s decodes as %+v, %v", r.Name, config, err)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessRefusesTooManyPixels(t *testing.T) {
+	// a GIF says its size in its header; claim 65535x65535 for one pixel
+	data := encoded(t, encodeGIF, 1, 1)
+	binary.LittleEndian.PutUint16(data[6:], 65535)
+	binary.LittleEndian.PutUint16(data[8:], 65535)
+	if _, err := Process(data); !errors.Is(err, ErrTooManyPixels) {
+		t.Fatalf("err = %v, want ErrTooManyPixels", err)
+	}
+
+	// 8000x5000 is MaxPixels exactly; one row more is too many
+	data = encoded(t, encodeGIF, 1, 1)
+	binary.LittleEndian.PutUint16(data[6:], 8000)
+	binary.LittleEndian.PutUint16(data[8:], 5001)
+	if _, err := Process(data); !errors.Is(err, ErrTooManyPixels) {
+		t.Fatalf("err = %v, want ErrTooManyPixels", err)
+	}
+}
+
+func TestProcessRefusesOtherTypes(t *testing.T) {
+	for _, data := range [][]byte{
+		[]byte("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"),
+		[]byte("just text"),
+		{},
+	} {
+		if _, err := Process(data); !errors.Is(err, ErrUnsupportedType) {
+			t.Errorf("Process(%q) = %v, want ErrUnsupportedType", data, err)
+		}
+	}
+}
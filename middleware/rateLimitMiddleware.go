@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bucket is a token bucket: it holds up to burst tokens, refilled at rate
+// a second, and each request takes one.
+type bucket struct {
+	tokens float64
+	seen   time.Time
+}
+
+// RateLimit lets each client make burst requests at once and rate a second
+// after that, answering 429 with a Retry-After once it is exceeded. key
+// picks the client a request counts against; requests it gives no key for
+// aren't limited. Buckets are kept in memory, so the limit is per instance.
+func RateLimit(rate float64, burst int, key func(c *gin.Context) string) gin.HandlerFunc {
+	var mu sync.Mutex
+	buckets := map[string]*bucket{}
+	lastSweep := time.Now()
+	idle := time.Duration(float64(burst)/rate*float64(time.Second)) + time.Minute
+
+	return func(c *gin.Context) {
+		k := key(c)
+		if k == "" {
+			c.Next()
+			return
+		}
+		now := time.Now()
+
+		mu.Lock()
+		if now.Sub(lastSweep) > idle {
+			for k, b := range buckets {
+				if now.Sub(b.seen) > idle {
+					delete(buckets, k)
+				}
+			}
+			lastSweep = now
+		}
+		b, ok := buckets[k]
+		if !ok {
+			b = &bucket{tokens: float64(burst), seen: now}
+			buckets[k] = b
+		}
+		b.tokens = math.Min(float64(burst),
+			b.tokens+now.Sub(b.seen).Seconds()*rate)
+		b.seen = now
+		allowed := b.tokens >= 1
+		if allowed {
+			b.tokens--
+		}
+		wait := (1 - b.tokens) / rate
+		mu.Unlock()
+
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait))))
+			c.JSON(http.StatusTooManyRequests,
+				gin.H{"error": "too many requests, try again shortly"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ChartOfAccounts maps what the journal books to the bookkeeper's account
+// names.
+type ChartOfAccounts struct {
+	Sales               string `json:"sales" validate:"required"`
+	Sales_tax           string `json:"sales_tax" validate:"required"`
+	Tips                string `json:"tips" validate:"required"`
+	Refunds             string `json:"refunds" validate:"required"`
+	Accounts_receivable string `json:"accounts_receivable" validate:"required"`
+	Cash                string `json:"cash" validate:"required"`
+	Card                string `json:"card" validate:"required"`
+
+	// Loyalty is what points redeemed as a tender are booked to, the
+	// default when not set.
+	Loyalty string `json:"loyalty"`
+
+	// Gift_cards is the liability for gift card balances, the default when
+	// not set. Selling a card adds to it and spending one takes from it.
+	Gift_cards string `json:"gift_cards"`
+}
+
+// AccountingSettings is the single settings document for the journal.
+// With Prices_include_tax the invoice amount already contains the tax at
+// Tax_rate; otherwise the tax is added on top.
+type AccountingSettings struct {
+	Accounts           ChartOfAccounts `json:"accounts" validate:"required"`
+	Tax_rate           float64         `json:"tax_rate" validate:"gte=0,lt=1"`
+	Prices_include_tax bool            `json:"prices_include_tax"`
+	Updated_at         time.Time       `json:"updated_at"`
+	Settings_ID        string          `json:"settings_id"`
+}
+
+// JournalLine is one side of a double-entry journal entry. The lines of an
+// entry share Entry_ID and their debits equal their credits.
+type JournalLine struct {
+	Entry_ID    string    `json:"entry_id"`
+	Date        time.Time `json:"date"`
+	Source      string    `json:"source"`
+	Reference   string    `json:"reference"`
+	Description string    `json:"description"`
+	Account     string    `json:"account"`
+	Debit       float64   `json:"debit"`
+	Credit      float64   `json:"credit"`
+}
+
+// JournalExport is a period handed over to the bookkeeper. Its lines are
+// kept so a download can be repeated exactly, and periods can't overlap so
+// nothing is booked twice.
+type JournalExport struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	From       time.Time          `json:"from"`
+	To         time.Time          `json:"to"`
+	Time_zone  string             `json:"time_zone"`
+	Format     string             `json:"format"`
+	Line_count int                `json:"line_count"`
+	Lines      []JournalLine      `json:"lines,omitempty"`
+	Created_by string             `json:"created_by"`
+	Created_at time.Time          `json:"created_at"`
+	Export_ID  string             `json:"export_id"`
+}
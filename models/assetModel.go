@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AssetVariant is one stored rendition of an uploaded image.
+type AssetVariant struct {
+	Key          string `json:"key"`
+	Content_type string `json:"content_type"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	Size         int    `json:"size"`
+	Etag         string `json:"etag"`
+}
+
+type Asset struct {
+	ID          primitive.ObjectID      `bson:"_id"`
+	Asset_ID    string                  `json:"asset_id"`
+	Filename    string                  `json:"filename"`
+	Variants    map[string]AssetVariant `json:"variants"`
+	Uploaded_by string                  `json:"uploaded_by"`
+	Created_at  time.Time               `json:"created_at"`
+}
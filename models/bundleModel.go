@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	AllocationProportional = "PROPORTIONAL"
+	AllocationWeighted     = "WEIGHTED"
+)
+
+type BundleSlot struct {
+	Slot_ID  string   `json:"slot_id"`
+	Name     string   `json:"name" validate:"required"`
+	Food_IDs []string `json:"food_ids" validate:"required,min=1"`
+	Weight   *float64 `json:"weight" validate:"omitempty,gt=0"`
+}
+
+type Bundle struct {
+	ID                primitive.ObjectID `bson:"_id"`
+	Name              *string            `json:"name" validate:"required,min=2,max=100"`
+	Price             *float64           `json:"price" validate:"required,gt=0"`
+	Slots             []BundleSlot       `json:"slots" validate:"required,min=1,dive"`
+	Allocation_method string             `json:"allocation_method" validate:"omitempty,eq=PROPORTIONAL|eq=WEIGHTED"`
+	Menu_ID           *string            `json:"menu_id"`
+	Created_at        time.Time          `json:"created_at"`
+	Updated_at        time.Time          `json:"updated_at"`
+	Bundle_ID         string             `json:"bundle_id"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Customer is a guest the restaurant knows, as opposed to the staff who
+// are Users. They are found by phone or email, so a customer has at least
+// one of them, and no two customers share either. Consent_updated_at is
+// when Marketing_consent was last given or withdrawn.
+type Customer struct {
+	ID                 primitive.ObjectID `bson:"_id"`
+	Name               *string            `json:"name" validate:"required,min=1,max=100"`
+	Phone              *string            `json:"phone" validate:"omitempty,max=30"`
+	Email              *string            `json:"email" validate:"omitempty,email,max=200"`
+	Preferences        []string           `json:"preferences" validate:"max=20,dive,min=1,max=100"`
+	Allergy_notes      *string            `json:"allergy_notes" validate:"omitempty,max=1000"`
+	Marketing_consent  *bool              `json:"marketing_consent"`
+	Consent_updated_at *time.Time         `json:"consent_updated_at"`
+	Created_at         time.Time          `json:"created_at"`
+	Updated_at         time.Time          `json:"updated_at"`
+	Customer_id        string             `json:"customer_id"`
+}
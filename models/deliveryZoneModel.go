@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DeliveryZone is an area delivered to and the fee delivery orders to it
+// are charged. A delivery address with one of its Postal_codes is put in
+// the zone, and one in a zone with postal codes has to have one of them.
+type DeliveryZone struct {
+	ID               primitive.ObjectID `bson:"_id"`
+	Name             *string            `json:"name" validate:"required,min=2,max=100"`
+	Fee              *float64           `json:"fee" validate:"required,gte=0"`
+	Postal_codes     []string           `json:"postal_codes"`
+	Created_at       time.Time          `json:"created_at"`
+	Updated_at       time.Time          `json:"updated_at"`
+	Delivery_zone_ID string             `json:"delivery_zone_id"`
+}
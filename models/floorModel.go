@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	TableFree         = "FREE"
+	TableSeated       = "SEATED"
+	TableOrdered      = "ORDERED"
+	TableAwaitingBill = "AWAITING_BILL"
+	TableDirty        = "DIRTY"
+)
+
+const (
+	TableRound     = "ROUND"
+	TableSquare    = "SQUARE"
+	TableRectangle = "RECTANGLE"
+)
+
+// Area is a room or part of the floor plan, such as the terrace or the bar,
+// drawn Width by Height units.
+type Area struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	Name       *string            `json:"name" validate:"required,min=2,max=100"`
+	Width      *float64           `json:"width" validate:"omitempty,gt=0"`
+	Height     *float64           `json:"height" validate:"omitempty,gt=0"`
+	Sort_order int                `json:"sort_order"`
+	Created_at time.Time          `json:"created_at"`
+	Updated_at time.Time          `json:"updated_at"`
+	Area_ID    string             `json:"area_id"`
+}
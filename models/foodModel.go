@@ -7,12 +7,42 @@ import (
 )
 
 type Food struct {
-	ID         primitive.ObjectID `bson:"_id"`
-	Name       *string            `json:"name" validate:"required,min=2,max=100"`
-	Price      *float64           `json:"price" validate:"required"`
-	Food_image *string            `json:"food_image" validate:"required"`
-	Created_at time.Time          `json:"created_at"`
-	Updated_at time.Time          `json:"updated_at"`
-	Food_ID    string             `json:"food_id"`
-	Menu_ID    *string            `json:"menu_id" validate:"required"`
+	ID          primitive.ObjectID `bson:"_id"`
+	Name        *string            `json:"name" validate:"required,min=2,max=100"`
+	Description *string            `json:"description" validate:"omitempty,max=500"`
+	Tags        []string           `json:"tags"`
+	Price       *float64           `json:"price" validate:"required"`
+	Food_image  *string            `json:"food_image"`
+	Created_at  time.Time          `json:"created_at"`
+	Updated_at  time.Time          `json:"updated_at"`
+	Food_ID     string             `json:"food_id"`
+	Menu_ID     *string            `json:"menu_id" validate:"required"`
+
+	// Image_asset_id is the uploaded image; Food_image is derived from it
+	// and holds the URL the medium size is served from.
+	Image_asset_id *string `json:"image_asset_id"`
+
+	// Available is nil or true for foods that can be ordered. Auto_sold_out
+	// marks foods the stock evaluator took off sale, which it puts back
+	// once their recipe can be made again. Stock_override is whether the
+	// recipe could be made when staff last set Available by hand; the
+	// evaluator leaves Available alone until the stock changes that.
+	Available      *bool `json:"available"`
+	Auto_sold_out  bool  `json:"auto_sold_out"`
+	Stock_override *bool `json:"stock_override,omitempty"`
+
+	// Plate_costs is kept up to date from the recipes and ingredient costs,
+	// never taken from a client.
+	Plate_costs []PlateCost `json:"plate_costs,omitempty"`
+
+	// Prep_minutes is how long the food takes to make, which decides when
+	// scheduled orders go to the kitchen.
+	Prep_minutes *int `json:"prep_minutes" validate:"omitempty,gte=0,lte=600"`
+
+	// Search_terms are the words of the name, description and tags, which
+	// search matches prefixes of against an index.
+	Search_terms []string `json:"-" bson:"search_terms,omitempty"`
+
+	Translations map[string]Translation `json:"translations,omitempty"`
+	Locale       string                 `json:"locale,omitempty" bson:"-"`
 }
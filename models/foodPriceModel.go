@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FoodPrice is one version of a food's price. The price in force at a given
+// moment is the version with the latest Effective_from not after it.
+type FoodPrice struct {
+	ID             primitive.ObjectID `bson:"_id"`
+	Food_ID        string             `json:"food_id"`
+	Price          *float64           `json:"price" validate:"required,gte=0"`
+	Effective_from *time.Time         `json:"effective_from"`
+	Applied        bool               `json:"applied"`
+	Created_by     string             `json:"created_by"`
+	Created_at     time.Time          `json:"created_at"`
+	Price_ID       string             `json:"price_id"`
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+)
+
+// Gift card statuses. A card sold on an order is PENDING until the order is
+// paid for, when it becomes ACTIVE with its value. An ACTIVE card can be
+// FROZEN, which stops it being spent or topped up until it is unfrozen. A
+// PENDING card whose sale is voided is CANCELLED.
+const (
+	GiftCardPending   = "PENDING"
+	GiftCardActive    = "ACTIVE"
+	GiftCardFrozen    = "FROZEN"
+	GiftCardCancelled = "CANCELLED"
+)
+
+// Kinds of gift card ledger entry. A card is ISSUEd its value when the
+// order it was sold on is paid for, and TOPPED_UP the same way. It is
+// REDEEMed as a tender, and a refund of that payment is REFUNDed back onto
+// it.
+const (
+	GiftCardIssue    = "ISSUE"
+	GiftCardTopUp    = "TOP_UP"
+	GiftCardRedeem   = "REDEEM"
+	GiftCardRefund   = "REFUND"
+	GiftCardFreeze   = "FREEZE"
+	GiftCardUnfreeze = "UNFREEZE"
+)
+
+// GiftCard is a stored-value card, under its code. Issued_value is what it
+// was sold for and Balance what is left to spend.
+type GiftCard struct {
+	Code          string     `json:"code" bson:"_id"`
+	Issued_value  float64    `json:"issued_value"`
+	Balance       float64    `json:"balance"`
+	Status        string     `json:"status"`
+	Order_id      string     `json:"order_id"`
+	Order_item_id string     `json:"order_item_id"`
+	Customer_id   *string    `json:"customer_id,omitempty"`
+	Frozen_reason *string    `json:"frozen_reason,omitempty"`
+	Note          string     `json:"note,omitempty"`
+	Created_by    string     `json:"created_by"`
+	Created_at    time.Time  `json:"created_at"`
+	Activated_at  *time.Time `json:"activated_at,omitempty"`
+	Updated_at    time.Time  `json:"updated_at"`
+}
+
+// GiftCardEntry is a change to a gift card, with its Balance after it.
+// Amount is what was added, or taken away when negative; freezes change
+// nothing and are recorded for the history. The value an order item loads
+// onto a card is entered under "load:" and the item's ID, so it can't load
+// twice.
+type GiftCardEntry struct {
+	ID         string    `json:"entry_id" bson:"_id"`
+	Code       string    `json:"code"`
+	Kind       string    `json:"kind"`
+	Amount     float64   `json:"amount"`
+	Balance    float64   `json:"balance"`
+	Order_id   *string   `json:"order_id,omitempty"`
+	Invoice_id *string   `json:"invoice_id,omitempty"`
+	Payment_id *string   `json:"payment_id,omitempty"`
+	Note       string    `json:"note,omitempty"`
+	Created_by string    `json:"created_by"`
+	Created_at time.Time `json:"created_at"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	GuestOrderPending  = "PENDING"
+	GuestOrderApproved = "APPROVED"
+	GuestOrderRejected = "REJECTED"
+)
+
+// GuestItem is a food a guest orders from the table's QR code.
+type GuestItem struct {
+	Food_id   *string  `json:"food_id" validate:"required"`
+	Quantity  *string  `json:"quantity" validate:"required,eq=S|eq=M|eq=L"`
+	Modifiers []string `json:"modifiers" validate:"max=10,dive,min=1,max=100"`
+}
+
+// GuestOrder is a round of items guests sent from a table's QR code. When
+// the table needs approval it waits as PENDING until staff approve it onto
+// the table's tab or reject it; otherwise it goes on the tab straight away.
+type GuestOrder struct {
+	ID             primitive.ObjectID `bson:"_id"`
+	Table_id       string             `json:"table_id"`
+	Order_id       *string            `json:"order_id"`
+	Items          []GuestItem        `json:"items" validate:"required,min=1,max=30,dive"`
+	Note           string             `json:"note" validate:"max=500"`
+	Status         string             `json:"status"`
+	Order_item_ids []string           `json:"order_item_ids,omitempty"`
+	Reason         string             `json:"reason,omitempty"`
+	Reviewed_by    *string            `json:"reviewed_by,omitempty"`
+	Reviewed_at    *time.Time         `json:"reviewed_at,omitempty"`
+	Created_at     time.Time          `json:"created_at"`
+	Guest_order_ID string             `json:"guest_order_id"`
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	MovementConsumption = "CONSUMPTION"
+	MovementReversal    = "REVERSAL"
+	MovementAdjustment  = "ADJUSTMENT"
+	MovementReceipt     = "RECEIPT"
+	MovementWaste       = "WASTE"
+)
+
+type Ingredient struct {
+	ID            primitive.ObjectID `bson:"_id"`
+	Name          *string            `json:"name" validate:"required,min=2,max=100"`
+	Unit          *string            `json:"unit" validate:"required"`
+	Quantity      float64            `json:"quantity"`
+	Cost_per_unit *float64           `json:"cost_per_unit" validate:"required,gte=0"`
+	// Low_stock is kept by the stock evaluator so an alert is raised once
+	// when the quantity drops to Reorder_threshold, not on every check.
+	Reorder_threshold *float64 `json:"reorder_threshold" validate:"omitempty,gte=0"`
+	Low_stock         bool     `json:"low_stock"`
+	// Par_level is the quantity a reorder should bring the stock back up to.
+	Par_level     *float64  `json:"par_level" validate:"omitempty,gte=0"`
+	Supplier_ID   *string   `json:"supplier_id"`
+	Created_at    time.Time `json:"created_at"`
+	Updated_at    time.Time `json:"updated_at"`
+	Ingredient_ID string    `json:"ingredient_id"`
+}
+
+type RecipeComponent struct {
+	Ingredient_ID string  `json:"ingredient_id" validate:"required"`
+	Quantity      float64 `json:"quantity" validate:"gt=0"`
+}
+
+// Recipe lists the ingredients one portion uses. A recipe with a Food_ID and
+// no Variant is the food's base recipe; a Variant (the order item size)
+// replaces it for that size. A recipe with a Modifier is added on top when
+// the order item carries that modifier, for one food or, without Food_ID,
+// for every food.
+type Recipe struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	Food_ID    *string            `json:"food_id"`
+	Variant    *string            `json:"variant" validate:"omitempty,eq=S|eq=M|eq=L"`
+	Modifier   *string            `json:"modifier"`
+	Components []RecipeComponent  `json:"components" validate:"required,min=1,dive"`
+	Created_at time.Time          `json:"created_at"`
+	Updated_at time.Time          `json:"updated_at"`
+	Recipe_ID  string             `json:"recipe_id"`
+}
+
+// StockMovement is one line of the stock ledger. Change is positive when
+// stock comes in and negative when it goes out.
+type StockMovement struct {
+	ID            primitive.ObjectID `bson:"_id"`
+	Ingredient_ID string             `json:"ingredient_id"`
+	Change        float64            `json:"change"`
+	Balance_after float64            `json:"balance_after"`
+	Unit_cost     float64            `json:"unit_cost"`
+	Reason        string             `json:"reason"`
+	Order_item_id *string            `json:"order_item_id,omitempty"`
+	Reference     *string            `json:"reference,omitempty"`
+	Note          string             `json:"note,omitempty"`
+	Created_by    string             `json:"created_by"`
+	Created_at    time.Time          `json:"created_at"`
+	Movement_ID   string             `json:"movement_id"`
+}
+
+// PlateCost is the ingredient cost of one portion of a food, for its base
+// recipe or, with Variant set, for one size. The margins are worked out
+// against the current price when the cost is read.
+type PlateCost struct {
+	Variant        *string `json:"variant"`
+	Cost           float64 `json:"cost"`
+	Margin         float64 `json:"margin" bson:"-"`
+	Margin_percent float64 `json:"margin_percent" bson:"-"`
+}
@@ -6,12 +6,20 @@ import (
 )
 
 type Invoice struct {
-	ID               primitive.ObjectID `bson: "_id"`
-	Invoice_ID       string             `json: "invoice_id"`
-	Order_ID         string             `json: "order_id"`
-	Payment_Method   *string            `json: "payment_method" validate:"eq=CARD|eq=CASH|eq="`
-	Payment_Status   *string            `json: "payment_status" validate:"required,eq=PENDING|eq=COMPLETE"`
-	Payment_due_date time.Time          `json: "payment_due_date"`
-	Created_at       time.Time          `json: "created_at"`
-	Updated_at       time.Time          `json: "updated_at"`
+	ID               primitive.ObjectID `bson:"_id"`
+	Invoice_ID       string             `json:"invoice_id"`
+	Order_ID         string             `json:"order_id"`
+	Payment_Method   *string            `json:"payment_method" validate:"omitempty,eq=CARD|eq=CASH|eq=POINTS|eq=GIFT_CARD"`
+	Payment_Status   *string            `json:"payment_status" validate:"required,eq=PENDING|eq=COMPLETE"`
+	Payment_due_date time.Time          `json:"payment_due_date"`
+	Created_at       time.Time          `json:"created_at"`
+	Updated_at       time.Time          `json:"updated_at"`
+
+	// Customer_id is who the invoice is for, the order's customer unless
+	// given another.
+	Customer_id *string `json:"customer_id" bson:"customer_id"`
+
+	// Payments counts the payments taken against the invoice. Each payment
+	// bumps it, so two payments can't commit from the same balance.
+	Payments int `json:"payments,omitempty"`
 }
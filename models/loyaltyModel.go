@@ -0,0 +1,102 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Kinds of loyalty ledger entry. Points are EARNed from paid invoices,
+// REDEEMed as a tender or for rewards, EXPIRE, are ADJUSTed by staff and
+// are REVERSEd by refunds: taken back from what a refunded invoice earned,
+// or given back for a refunded points payment.
+const (
+	LoyaltyEarn    = "EARN"
+	LoyaltyRedeem  = "REDEEM"
+	LoyaltyExpire  = "EXPIRE"
+	LoyaltyAdjust  = "ADJUST"
+	LoyaltyReverse = "REVERSE"
+)
+
+// LoyaltySettings is the single settings document for the loyalty
+// program. Points redeemed as a tender are each worth Point_value, 0
+// meaning they can't be. Points expire Expiry_months after they are
+// earned, 0 meaning never.
+type LoyaltySettings struct {
+	Earn_rules    []EarnRule    `json:"earn_rules" validate:"max=50,dive"`
+	Tiers         []LoyaltyTier `json:"tiers" validate:"max=10,dive"`
+	Point_value   float64       `json:"point_value" validate:"gte=0"`
+	Expiry_months int           `json:"expiry_months" validate:"gte=0,lte=120"`
+	Updated_at    time.Time     `json:"updated_at"`
+	Settings_ID   string        `json:"settings_id"`
+}
+
+// EarnRule earns Points_per_unit for each 1.00 spent, only on spend on
+// Food_id when set, only on orders of Order_type when set, and only on
+// invoices spending at least Min_spend.
+type EarnRule struct {
+	Rule_id         string  `json:"rule_id" validate:"required,max=50"`
+	Name            string  `json:"name" validate:"max=100"`
+	Points_per_unit float64 `json:"points_per_unit" validate:"gt=0"`
+	Food_id         *string `json:"food_id"`
+	Order_type      *string `json:"order_type" validate:"omitempty,eq=DINE_IN|eq=TAKEAWAY|eq=DELIVERY|eq=DRIVE_THROUGH"`
+	Min_spend       float64 `json:"min_spend" validate:"gte=0"`
+}
+
+// LoyaltyTier is reached by members who have earned Min_points in all,
+// and multiplies the points they earn by Multiplier.
+type LoyaltyTier struct {
+	Name       string  `json:"name" validate:"required,max=50"`
+	Min_points int     `json:"min_points" validate:"gte=0"`
+	Multiplier float64 `json:"multiplier" validate:"gt=0,lte=10"`
+}
+
+// LoyaltyMember is a customer enrolled in the loyalty program, under the
+// customer's ID. Points is the balance, which reversals can take below
+// zero; Lifetime_points is everything earned, which sets the Tier.
+type LoyaltyMember struct {
+	Customer_id     string    `json:"customer_id" bson:"_id"`
+	Points          int       `json:"points"`
+	Lifetime_points int       `json:"lifetime_points"`
+	Tier            string    `json:"tier"`
+	Enrolled_at     time.Time `json:"enrolled_at"`
+	Updated_at      time.Time `json:"updated_at"`
+}
+
+// LoyaltyReward is a food members can have for Points_cost points.
+type LoyaltyReward struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	Name        *string            `json:"name" validate:"required,max=100"`
+	Food_id     *string            `json:"food_id" validate:"required"`
+	Size        *string            `json:"size" validate:"required,eq=S|eq=M|eq=L"`
+	Points_cost *int               `json:"points_cost" validate:"required,gt=0"`
+	Active      *bool              `json:"active" validate:"required"`
+	Created_at  time.Time          `json:"created_at"`
+	Updated_at  time.Time          `json:"updated_at"`
+	Reward_id   string             `json:"reward_id"`
+}
+
+// LoyaltyEntry is a change to a member's points, with their Balance after
+// it. Points added are a lot spent from, soonest expiring first, as
+// Remaining runs down; Reversed is how much of an EARN or REDEEM refunds
+// have undone. An invoice earns under the entry "earn:" and its ID, so it
+// can't earn twice.
+type LoyaltyEntry struct {
+	ID          string     `json:"entry_id" bson:"_id"`
+	Customer_id string     `json:"customer_id"`
+	Kind        string     `json:"kind"`
+	Points      int        `json:"points"`
+	Balance     int        `json:"balance"`
+	Spend       *float64   `json:"spend,omitempty"`
+	Remaining   int        `json:"remaining"`
+	Expires_at  *time.Time `json:"expires_at,omitempty"`
+	Reversed    int        `json:"reversed,omitempty"`
+	Reverses    *string    `json:"reverses,omitempty"`
+	Invoice_id  *string    `json:"invoice_id,omitempty"`
+	Payment_id  *string    `json:"payment_id,omitempty"`
+	Order_id    *string    `json:"order_id,omitempty"`
+	Reward_id   *string    `json:"reward_id,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+	Created_by  string     `json:"created_by"`
+	Created_at  time.Time  `json:"created_at"`
+}
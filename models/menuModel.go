@@ -14,4 +14,8 @@ type Menu struct {
 	Created_at time.Time          `json: "created_at"`
 	Updated_at time.Time          `json: "updated_at"`
 	Menu_ID    string             `json: "food_id" validate:"required"`
+
+	Description  string                 `json:"description,omitempty"`
+	Translations map[string]Translation `json:"translations,omitempty"`
+	Locale       string                 `json:"locale,omitempty" bson:"-"`
 }
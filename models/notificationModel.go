@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	NotificationLowStock     = "LOW_STOCK"
+	NotificationOutOfStock   = "OUT_OF_STOCK"
+	NotificationRestocked    = "RESTOCKED"
+	NotificationFoodSoldOut  = "FOOD_SOLD_OUT"
+	NotificationFoodRestored = "FOOD_RESTORED"
+)
+
+// Notification is an entry in the in-app notification feed.
+type Notification struct {
+	ID              primitive.ObjectID `bson:"_id"`
+	Type            string             `json:"type"`
+	Message         string             `json:"message"`
+	Ingredient_ID   *string            `json:"ingredient_id,omitempty"`
+	Food_ID         *string            `json:"food_id,omitempty"`
+	Read            bool               `json:"read"`
+	Created_at      time.Time          `json:"created_at"`
+	Notification_ID string             `json:"notification_id"`
+}
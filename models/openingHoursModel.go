@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// OpeningHours is the single settings document for when the restaurant is
+// open, which seat hours are counted over. A period opens on Weekday, 1
+// for Monday to 7 for Sunday, and closes the next day when Closes isn't
+// after Opens. Both are HH:MM in Time_zone.
+type OpeningHours struct {
+	Time_zone   string          `json:"time_zone" validate:"required"`
+	Periods     []OpeningPeriod `json:"periods" validate:"dive"`
+	Updated_at  time.Time       `json:"updated_at"`
+	Settings_ID string          `json:"settings_id"`
+}
+
+type OpeningPeriod struct {
+	Weekday int    `json:"weekday" validate:"gte=1,lte=7"`
+	Opens   string `json:"opens" validate:"required,datetime=15:04"`
+	Closes  string `json:"closes" validate:"required,datetime=15:04"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	OrderAuditMove  = "MOVE"
+	OrderAuditMerge = "MERGE"
+)
+
+// OrderAudit records an order moved to another table or another order
+// merged into it, with the order items that came along.
+type OrderAudit struct {
+	ID              primitive.ObjectID `bson:"_id"`
+	Action          string             `json:"action"`
+	Order_id        string             `json:"order_id"`
+	From_table_id   *string            `json:"from_table_id,omitempty"`
+	To_table_id     *string            `json:"to_table_id,omitempty"`
+	Merged_order_id *string            `json:"merged_order_id,omitempty"`
+	Order_item_ids  []string           `json:"order_item_ids,omitempty"`
+	Note            string             `json:"note,omitempty"`
+	Created_by      string             `json:"created_by"`
+	Created_at      time.Time          `json:"created_at"`
+	Audit_ID        string             `json:"audit_id"`
+}
@@ -6,6 +6,14 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+const (
+	OrderItemScheduled = "SCHEDULED"
+	OrderItemPending   = "PENDING"
+	OrderItemFired     = "FIRED"
+	OrderItemServed    = "SERVED"
+	OrderItemVoid      = "VOID"
+)
+
 type OrderItem struct {
 	ID            primitive.ObjectID `bson: "_id"`
 	Quantity      *string            `json: "quantity" validate:"required,eq=S|eq=M|eq=L"`
@@ -15,4 +23,34 @@ type OrderItem struct {
 	Food_id       *string            `json: "food_id" validate:"required"`
 	Order_item_id string             `json: "order_item_id"`
 	Order_id      string             `json: "order_id" validate:"required"`
+
+	// Set on the components of a bundle sale. Unit_price then holds the
+	// component's share of the bundle price rather than the food's price.
+	Bundle_id      *string `json:"bundle_id,omitempty"`
+	Bundle_line_id *string `json:"bundle_line_id,omitempty"`
+	Bundle_slot_id *string `json:"bundle_slot_id,omitempty"`
+
+	Modifiers []string `json:"modifiers,omitempty"`
+
+	// Reward_id is the loyalty reward the item was had for, at no charge.
+	Reward_id *string `json:"reward_id,omitempty"`
+
+	// Gift_card_code is set on the sale of a gift card, or a top-up of
+	// one, for Unit_price. The item has no food and is served as it is
+	// sold.
+	Gift_card_code *string `json:"gift_card_code,omitempty"`
+	// Gift_card_loaded is set, with the card loaded, once the order is
+	// paid for. From then on the item can't be voided.
+	Gift_card_loaded bool `json:"gift_card_loaded,omitempty"`
+
+	// Status moves PENDING -> FIRED -> SERVED, or to VOID. Items of a
+	// scheduled order are SCHEDULED until it is released to the kitchen,
+	// when they become PENDING. Stock is taken
+	// the first time the item is fired or served and given back when a
+	// depleted item is voided.
+	Status         *string    `json:"status"`
+	Stock_depleted bool       `json:"stock_depleted"`
+	Fired_at       *time.Time `json:"fired_at,omitempty"`
+	Served_at      *time.Time `json:"served_at,omitempty"`
+	Voided_at      *time.Time `json:"voided_at,omitempty"`
 }
@@ -6,11 +6,79 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+const (
+	OrderDineIn       = "DINE_IN"
+	OrderTakeaway     = "TAKEAWAY"
+	OrderDelivery     = "DELIVERY"
+	OrderDriveThrough = "DRIVE_THROUGH"
+)
+
+var OrderTypes = []string{OrderDineIn, OrderTakeaway, OrderDelivery,
+	OrderDriveThrough}
+
 type Order struct {
 	ID         primitive.ObjectID `bson:"_id"`
 	Order_date time.Time          `json:"order_date" validate:"required"`
 	Created_at time.Time          `json:"created_at"`
 	Updated_at time.Time          `json:"updated_at"`
 	Order_ID   string             `json:"order_id"`
-	Table_ID   *string            `json:"table_id" validate:"required"`
+	Table_ID   *string            `json:"table_id"`
+
+	// Created_by is the staff member who took the order. Guests is how many
+	// covers it serves; reports fall back to the table's guest count.
+	Created_by string `json:"created_by"`
+	Guests     *int   `json:"guests" validate:"omitempty,gte=0"`
+
+	// Server_id is the server looking after the order, and Server_transfers
+	// how it was handed over between servers. The order is open until its
+	// invoice is settled at Closed_at.
+	Server_id        *string          `json:"server_id"`
+	Server_transfers []ServerTransfer `json:"server_transfers,omitempty"`
+	Closed_at        *time.Time       `json:"closed_at"`
+
+	// Table_group_id is set when the order is for a table group, in which
+	// case Table_ID is the group's primary table.
+	Table_group_id *string `json:"table_group_id"`
+
+	// Merged_into is the order this one was merged into, which closed it.
+	Merged_into *string `json:"merged_into,omitempty"`
+
+	// Order_type is DINE_IN, TAKEAWAY, DELIVERY or DRIVE_THROUGH; orders
+	// from before there were types are dine-in. Only dine-in orders are at
+	// a table. The others carry who they are for and when they were
+	// promised, and delivery orders where they go and what delivery costs.
+	Order_type       string     `json:"order_type" validate:"eq=DINE_IN|eq=TAKEAWAY|eq=DELIVERY|eq=DRIVE_THROUGH"`
+	Customer_name    *string    `json:"customer_name" validate:"omitempty,max=100"`
+	Customer_phone   *string    `json:"customer_phone" validate:"omitempty,max=30"`
+	Delivery_address *string    `json:"delivery_address" validate:"omitempty,max=500"`
+	Promised_at      *time.Time `json:"promised_at"`
+	Delivery_zone_id *string    `json:"delivery_zone_id"`
+	Delivery_fee     *float64   `json:"delivery_fee" validate:"omitempty,gte=0"`
+
+	// Scheduled_for is when a takeaway or delivery order placed ahead is
+	// wanted. Its items are held back from the kitchen until Release_at,
+	// worked out from how long they take to make, and Released_at is when
+	// they were sent.
+	Scheduled_for *time.Time `json:"scheduled_for"`
+	Release_at    *time.Time `json:"release_at"`
+	Released_at   *time.Time `json:"released_at"`
+	// Slot_freed is set once the order's slot is given back because
+	// nothing was left to make before it went to the kitchen.
+	Slot_freed bool `json:"slot_freed,omitempty"`
+
+	// Platform is the delivery platform an order came from, under its
+	// External_order_id there.
+	Platform          *string `json:"platform,omitempty"`
+	External_order_id *string `json:"external_order_id,omitempty"`
+
+	// Customer_id is the customer the order is for, when known.
+	Customer_id *string `json:"customer_id"`
+}
+
+// ServerTransfer records an order handed from one server to another.
+type ServerTransfer struct {
+	From       string    `json:"from"`
+	To         string    `json:"to"`
+	Created_by string    `json:"created_by"`
+	Created_at time.Time `json:"created_at"`
 }
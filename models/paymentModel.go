@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	PaymentKindPayment = "PAYMENT"
+	PaymentKindRefund  = "REFUND"
+)
+
+// PaymentMethodPoints pays with a loyalty member's points.
+const PaymentMethodPoints = "POINTS"
+
+// PaymentMethodGiftCard pays from the balance of the gift card with
+// Gift_card_code.
+const PaymentMethodGiftCard = "GIFT_CARD"
+
+// Payment is money taken against an invoice or, for a refund, given back.
+// Amount and Tip are positive either way; Kind tells them apart. Amount
+// settles the invoice and Tip is held for the staff.
+type Payment struct {
+	ID             primitive.ObjectID `bson:"_id"`
+	Invoice_ID     string             `json:"invoice_id"`
+	Order_ID       string             `json:"order_id"`
+	Kind           string             `json:"kind"`
+	Method         *string            `json:"method" validate:"required,eq=CARD|eq=CASH|eq=POINTS|eq=GIFT_CARD"`
+	Amount         *float64           `json:"amount" validate:"required,gt=0"`
+	Tip            float64            `json:"tip" validate:"gte=0"`
+	Refund_of      *string            `json:"refund_of,omitempty"`
+	Gift_card_code *string            `json:"gift_card_code,omitempty"`
+	Note           string             `json:"note,omitempty"`
+	Created_by     string             `json:"created_by"`
+	Created_at     time.Time          `json:"created_at"`
+	Payment_ID     string             `json:"payment_id"`
+
+	// Refunds counts the refunds of a payment. Each refund bumps it, so
+	// two refunds of one payment can't commit from the same snapshot.
+	Refunds int `json:"refunds,omitempty"`
+}
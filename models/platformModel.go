@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+const (
+	PlatformOrderReceiving = "RECEIVING"
+	PlatformOrderCreated   = "CREATED"
+	PlatformOrderRejected  = "REJECTED"
+	PlatformOrderFailed    = "FAILED"
+)
+
+// PlatformMenuItem maps an item on a delivery platform's menu to the food
+// it is, made in Size. Its ID is the platform and the external ID, so each
+// item has one mapping.
+type PlatformMenuItem struct {
+	ID          string    `json:"-" bson:"_id"`
+	Platform    string    `json:"platform"`
+	External_id string    `json:"external_id"`
+	Name        *string   `json:"name" validate:"omitempty,max=200"`
+	Food_id     *string   `json:"food_id" validate:"required"`
+	Size        *string   `json:"size" validate:"required,eq=S|eq=M|eq=L"`
+	Updated_at  time.Time `json:"updated_at"`
+}
+
+// PlatformOrder is an order received from a delivery platform. Its ID is
+// the platform and the platform's order ID, so a webhook delivered twice
+// finds the order taken the first time. It is RECEIVING while the order is
+// taken under Attempt_id, then CREATED, REJECTED when it can't be taken as
+// sent, or FAILED when taking it went wrong and a redelivery tries again.
+// Order_id is chosen on the first attempt and kept by the others.
+type PlatformOrder struct {
+	ID          string              `json:"platform_order_id" bson:"_id"`
+	Platform    string              `json:"platform"`
+	External_id string              `json:"external_id"`
+	Status      string              `json:"status"`
+	Error       string              `json:"error,omitempty"`
+	Order_id    string              `json:"order_id"`
+	Attempt_id  string              `json:"-"`
+	Deliveries  int                 `json:"deliveries"`
+	Items       []PlatformOrderItem `json:"items"`
+	Note        string              `json:"note,omitempty"`
+
+	// Notified_status is the last status the platform was told, and
+	// Status_updates every update sent.
+	Notified_status string                 `json:"notified_status"`
+	Status_updates  []PlatformStatusUpdate `json:"status_updates,omitempty"`
+
+	// Pending_status is a status the platform is still to be told, with
+	// Pending_reason: ACCEPTED or REJECTED once the order is taken, or one
+	// that didn't go through, until it is told or the order is past it.
+	Pending_status string `json:"pending_status,omitempty"`
+	Pending_reason string `json:"pending_reason,omitempty"`
+
+	Created_at time.Time `json:"created_at"`
+	Updated_at time.Time `json:"updated_at"`
+}
+
+type PlatformOrderItem struct {
+	External_id string   `json:"external_id"`
+	Name        string   `json:"name,omitempty"`
+	Quantity    int      `json:"quantity"`
+	Modifiers   []string `json:"modifiers,omitempty"`
+}
+
+// PlatformStatusUpdate is a status update sent to a platform, with the
+// error if it didn't go through.
+type PlatformStatusUpdate struct {
+	Status  string    `json:"status"`
+	Reason  string    `json:"reason,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Sent_at time.Time `json:"sent_at"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	PurchaseOrderDraft             = "DRAFT"
+	PurchaseOrderSent              = "SENT"
+	PurchaseOrderPartiallyReceived = "PARTIALLY_RECEIVED"
+	PurchaseOrderClosed            = "CLOSED"
+)
+
+type PurchaseOrderLine struct {
+	Line_ID           string   `json:"line_id"`
+	Ingredient_ID     string   `json:"ingredient_id" validate:"required"`
+	Quantity          float64  `json:"quantity" validate:"gt=0"`
+	Unit_cost         *float64 `json:"unit_cost" validate:"omitempty,gte=0"`
+	Received_quantity float64  `json:"received_quantity"`
+	Received_cost     float64  `json:"received_cost"`
+}
+
+// PurchaseOrderEvent is one entry of a purchase order's audit trail.
+type PurchaseOrderEvent struct {
+	Action     string    `json:"action"`
+	Status     string    `json:"status"`
+	Note       string    `json:"note,omitempty"`
+	Created_by string    `json:"created_by"`
+	Created_at time.Time `json:"created_at"`
+}
+
+// PurchaseOrder moves DRAFT -> SENT -> PARTIALLY_RECEIVED -> CLOSED. Lines
+// can only be edited while it is a draft. Version guards against two
+// receipts being booked from the same stale copy.
+type PurchaseOrder struct {
+	ID                primitive.ObjectID   `bson:"_id"`
+	Supplier_ID       *string              `json:"supplier_id" validate:"required"`
+	Status            string               `json:"status"`
+	Lines             []PurchaseOrderLine  `json:"lines" validate:"required,min=1,dive"`
+	Expected_at       *time.Time           `json:"expected_at"`
+	Note              string               `json:"note,omitempty"`
+	History           []PurchaseOrderEvent `json:"history"`
+	Version           int                  `json:"version"`
+	Created_at        time.Time            `json:"created_at"`
+	Updated_at        time.Time            `json:"updated_at"`
+	Purchase_order_ID string               `json:"purchase_order_id"`
+}
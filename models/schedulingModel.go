@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// SchedulingSettings is the single settings document for orders placed
+// ahead. Slot_capacity caps the orders wanted in any 15 minute slot, 0
+// meaning no cap. Items go to the kitchen Buffer_minutes before the longest
+// of them would need to start, counting Default_prep_minutes for foods
+// without a preparation time.
+type SchedulingSettings struct {
+	Slot_capacity        int       `json:"slot_capacity" validate:"gte=0"`
+	Buffer_minutes       int       `json:"buffer_minutes" validate:"gte=0,lte=240"`
+	Default_prep_minutes int       `json:"default_prep_minutes" validate:"gte=0,lte=600"`
+	Updated_at           time.Time `json:"updated_at"`
+	Settings_ID          string    `json:"settings_id"`
+}
+
+// ScheduleSlot counts the orders wanted in a slot. Its ID is the slot's
+// start, so each slot has one document to count against.
+type ScheduleSlot struct {
+	ID     string    `json:"slot_id" bson:"_id"`
+	Start  time.Time `json:"start"`
+	Orders int       `json:"orders"`
+}
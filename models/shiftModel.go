@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Shift is a planned stretch of work for a staff member in a role.
+// Hourly_rate overrides the staff member's own rate for the shift and
+// Section_ID assigns a server to a floor section for it.
+type Shift struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	User_id     *string            `json:"user_id" validate:"required"`
+	Role        *string            `json:"role" validate:"required,min=2,max=50"`
+	Start       *time.Time         `json:"start" validate:"required"`
+	End         *time.Time         `json:"end" validate:"required"`
+	Hourly_rate *float64           `json:"hourly_rate" validate:"omitempty,gte=0"`
+	Section_ID  *string            `json:"section_id"`
+	Note        string             `json:"note,omitempty"`
+	Created_by  string             `json:"created_by"`
+	Created_at  time.Time          `json:"created_at"`
+	Updated_at  time.Time          `json:"updated_at"`
+	Shift_ID    string             `json:"shift_id"`
+}
+
+// Break is time off the clock within a shift. Unpaid breaks don't count as
+// hours worked.
+type Break struct {
+	Start time.Time  `json:"start"`
+	End   *time.Time `json:"end"`
+	Paid  bool       `json:"paid"`
+}
+
+// TimeClockEntry is one clock-in to clock-out for a staff member. The rate
+// is taken when clocking in, so later rate changes leave past labour cost
+// alone.
+type TimeClockEntry struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	User_id     string             `json:"user_id"`
+	Shift_ID    *string            `json:"shift_id"`
+	Role        string             `json:"role"`
+	Clock_in    time.Time          `json:"clock_in"`
+	Clock_out   *time.Time         `json:"clock_out"`
+	Breaks      []Break            `json:"breaks"`
+	Hourly_rate float64            `json:"hourly_rate"`
+	Version     int                `json:"version"`
+	Created_at  time.Time          `json:"created_at"`
+	Updated_at  time.Time          `json:"updated_at"`
+	Entry_ID    string             `json:"entry_id"`
+}
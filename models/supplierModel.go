@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Supplier struct {
+	ID             primitive.ObjectID `bson:"_id"`
+	Name           *string            `json:"name" validate:"required,min=2,max=100"`
+	Contact_name   *string            `json:"contact_name"`
+	Phone          *string            `json:"phone"`
+	Email          *string            `json:"email" validate:"omitempty,email"`
+	Address        *string            `json:"address"`
+	Lead_time_days *int               `json:"lead_time_days" validate:"omitempty,gte=0"`
+	Created_at     time.Time          `json:"created_at"`
+	Updated_at     time.Time          `json:"updated_at"`
+	Supplier_ID    string             `json:"supplier_id"`
+}
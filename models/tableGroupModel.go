@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TableGroup pushes tables together for one party. Orders for any of them
+// go on the primary table, so the group shares one order and one bill.
+// The group is active until it is split.
+type TableGroup struct {
+	ID               primitive.ObjectID `bson:"_id"`
+	Name             *string            `json:"name"`
+	Table_ids        []string           `json:"table_ids"`
+	Primary_table_id string             `json:"primary_table_id"`
+	Seats            int                `json:"seats"`
+	Created_by       string             `json:"created_by"`
+	Created_at       time.Time          `json:"created_at"`
+	Split_at         *time.Time         `json:"split_at"`
+	Group_ID         string             `json:"group_id"`
+}
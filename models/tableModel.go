@@ -13,4 +13,30 @@ type Table struct {
 	Created_at       time.Time          `json: "created_at"`
 	Updated_at       time.Time          `json: "updated_at"`
 	Table_ID         string             `json: "table_id"`
+
+	// Where the table sits on the floor plan, in the units of its area.
+	// Number_of_guests is how many it seats.
+	Area_ID  *string  `json:"area_id" bson:"area_id"`
+	Shape    *string  `json:"shape" bson:"shape"`
+	X        *float64 `json:"x" bson:"x"`
+	Y        *float64 `json:"y" bson:"y"`
+	Width    *float64 `json:"width" bson:"width"`
+	Height   *float64 `json:"height" bson:"height"`
+	Rotation *float64 `json:"rotation" bson:"rotation"`
+
+	// Group_ID is the table group the table is pushed into, if any.
+	Group_ID *string `json:"group_id" bson:"group_id"`
+
+	// Status is FREE, SEATED, ORDERED, AWAITING_BILL or DIRTY. It follows
+	// the table's open orders and their invoices; staff seat walk-ins and
+	// free a table once it is cleared.
+	Status            string     `json:"status" bson:"status"`
+	Status_updated_at *time.Time `json:"status_updated_at" bson:"status_updated_at"`
+
+	// Qr_version is the version of the table's guest ordering QR code, and
+	// Qr_approval whether staff approve what guests order with it before it
+	// goes on the tab. Guest_tab_id is the open order guests add to.
+	Qr_version   int     `json:"qr_version" bson:"qr_version"`
+	Qr_approval  bool    `json:"qr_approval" bson:"qr_approval"`
+	Guest_tab_id *string `json:"guest_tab_id" bson:"guest_tab_id"`
 }
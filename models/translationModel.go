@@ -0,0 +1,10 @@
+package models
+
+// Translation holds the localized text of a food or menu for one locale.
+// Category is only used by menus. Empty fields fall back along the locale
+// chain.
+type Translation struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Category    string `json:"category,omitempty"`
+}
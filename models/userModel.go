@@ -16,6 +16,8 @@ type User struct {
 	Phone         *string            `json: "phone" validate:"required"`
 	Token         *string            `json: "token"`
 	Refresh_Token *string            `json: "refresh_token"`
+	Hourly_rate   *float64           `json:"hourly_rate" bson:"hourly_rate"`
+	Manager       bool               `json:"manager" bson:"manager"`
 	Created_at    time.Time          `json: "created_at"`
 	Updated_at    time.Time          `json: "updated_at"`
 	User_id       string             `json: "user_id"`
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	WasteExpired        = "EXPIRED"
+	WasteDropped        = "DROPPED"
+	WasteReturned       = "RETURNED"
+	WasteOverproduction = "OVERPRODUCTION"
+)
+
+// WasteEntry records food or an ingredient thrown away. Exactly one of
+// Food_ID and Ingredient_ID is set; for a food, Quantity is in portions of
+// the given size. Cost is the stock taken out, valued at cost, and Name is
+// kept so reports still read well after the item is renamed.
+type WasteEntry struct {
+	ID            primitive.ObjectID `bson:"_id"`
+	Food_ID       *string            `json:"food_id"`
+	Ingredient_ID *string            `json:"ingredient_id"`
+	Variant       *string            `json:"variant" validate:"omitempty,eq=S|eq=M|eq=L"`
+	Modifiers     []string           `json:"modifiers,omitempty"`
+	Name          string             `json:"name"`
+	Quantity      float64            `json:"quantity" validate:"gt=0"`
+	Reason        string             `json:"reason" validate:"required,eq=EXPIRED|eq=DROPPED|eq=RETURNED|eq=OVERPRODUCTION"`
+	Note          string             `json:"note,omitempty"`
+	Order_item_id *string            `json:"order_item_id,omitempty"`
+	Cost          float64            `json:"cost"`
+	Created_by    string             `json:"created_by"`
+	Created_at    time.Time          `json:"created_at"`
+	Waste_ID      string             `json:"waste_id"`
+}
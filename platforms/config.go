@@ -0,0 +1,32 @@
+package platforms
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// FromEnv builds the registry of the platforms named in PLATFORMS, a comma
+// separated list. Each platform NAME posts orders signed with
+// PLATFORM_NAME_SECRET, and is sent status updates at
+// PLATFORM_NAME_STATUS_URL when that is set.
+func FromEnv() (*Registry, error) {
+	registry := NewRegistry()
+	for _, name := range strings.Split(os.Getenv("PLATFORMS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "PLATFORM_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		secret := os.Getenv(prefix + "_SECRET")
+		if secret == "" {
+			return nil, fmt.Errorf("platform %s needs %s_SECRET", name, prefix)
+		}
+		var notifier StatusNotifier
+		if url := os.Getenv(prefix + "_STATUS_URL"); url != "" {
+			notifier = NewHTTPNotifier(url, secret)
+		}
+		registry.Register(NewNormalizedAdapter(name, secret), notifier)
+	}
+	return registry, nil
+}
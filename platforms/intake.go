@@ -0,0 +1,241 @@
+package platforms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"restro/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrRejected is wrapped by the errors of Take about the order as sent,
+// which redelivering it won't change.
+var ErrRejected = errors.New("the order can't be taken")
+
+// ReceivingTimeout is how long an attempt at taking an order may hold it
+// before a redelivered webhook takes over.
+const ReceivingTimeout = 2 * time.Minute
+
+// TakeFunc creates the order for a platform order claimed under its
+// Attempt_id. It marks the record created with Store.Created, together
+// with the order, so a redelivery can't create it twice.
+type TakeFunc func(ctx context.Context, record models.PlatformOrder,
+	order Order) error
+
+// Intake takes the orders platforms post to their webhooks, once each
+// however often a webhook is delivered, and tells the platforms how their
+// orders are getting on.
+type Intake struct {
+	Registry *Registry
+	Store    Store
+	Take     TakeFunc
+}
+
+// ServeWebhook takes an order posted by platform's webhook. The platform
+// is told the order was accepted, or rejected with why when it can't be
+// taken as sent. A webhook delivered again is answered as the first was.
+func (in *Intake) ServeWebhook(w http.ResponseWriter, r *http.Request,
+	platform string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+	p, ok := in.Registry.Lookup(platform)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"error": "unknown platform"})
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": err.Error()})
+		return
+	}
+	if err := p.Adapter.Verify(r.Header, body); err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+			"error": err.Error()})
+		return
+	}
+	incoming, err := p.Adapter.Parse(body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": err.Error()})
+		return
+	}
+
+	record, claimed, err := in.Store.Claim(ctx,
+		newRecord(p.Adapter.Name(), incoming), now().Add(-ReceivingTimeout))
+	if err != nil {
+		log.Println("couldn't record platform order", incoming.External_id,
+			err)
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "order was not received"})
+		return
+	}
+	if claimed {
+		record = in.take(ctx, record, incoming)
+	}
+	switch record.Status {
+	case models.PlatformOrderCreated:
+		writeJSON(w, http.StatusOK, record)
+	case models.PlatformOrderRejected:
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error": record.Error, "platform_order": record})
+	case models.PlatformOrderReceiving:
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"error": "the order is still being taken"})
+	default:
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"error": "order was not created"})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func now() time.Time {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	return now
+}
+
+// newRecord is the record of an order from platform as first received,
+// with the ID its order will have.
+func newRecord(platform string, incoming Order) models.PlatformOrder {
+	now := now()
+	record := models.PlatformOrder{
+		ID:          platform + ":" + incoming.External_id,
+		Platform:    platform,
+		External_id: incoming.External_id,
+		Status:      models.PlatformOrderReceiving,
+		Order_id:    primitive.NewObjectID().Hex(),
+		Attempt_id:  primitive.NewObjectID().Hex(),
+		Deliveries:  1,
+		Items:       []models.PlatformOrderItem{},
+		Note:        incoming.Note,
+		Created_at:  now,
+		Updated_at:  now,
+	}
+	for _, item := range incoming.Items {
+		record.Items = append(record.Items, models.PlatformOrderItem{
+			External_id: item.External_id,
+			Name:        item.Name,
+			Quantity:    item.Quantity,
+			Modifiers:   item.Modifiers,
+		})
+	}
+	return record
+}
+
+// take takes a claimed order and records how it went, telling the
+// platform whether it was accepted.
+func (in *Intake) take(ctx context.Context, record models.PlatformOrder,
+	incoming Order) models.PlatformOrder {
+	err := in.Take(ctx, record, incoming)
+	record.Updated_at = now()
+	switch {
+	case err == nil:
+		record.Status = models.PlatformOrderCreated
+		record.Pending_status = StatusAccepted
+		go in.notify(record.ID, StatusAccepted, "")
+		return record
+	case errors.Is(err, ErrTakenOver):
+		return record
+	case errors.Is(err, ErrRejected):
+		record.Status = models.PlatformOrderRejected
+		record.Error = err.Error()
+	default:
+		log.Println("couldn't take platform order", record.ID, err)
+		record.Status = models.PlatformOrderFailed
+		record.Error = "the order was not created"
+	}
+	err = in.Store.Finish(ctx, record.ID, record.Attempt_id, record.Status,
+		record.Error, record.Updated_at)
+	if errors.Is(err, ErrTakenOver) {
+		return record
+	}
+	if err != nil {
+		log.Println("couldn't record platform order", record.ID, err)
+	}
+	if record.Status == models.PlatformOrderRejected {
+		record.Pending_status = StatusRejected
+		record.Pending_reason = record.Error
+		go in.notify(record.ID, StatusRejected, record.Error)
+	}
+	return record
+}
+
+// Notify tells a platform the status of one of its orders. The status is
+// claimed before it is sent, so each is sent once and never after a later
+// one, and given back if it doesn't go through, to be sent again by
+// RetryStatuses. It is ErrStatus when the order is already past status.
+func (in *Intake) Notify(ctx context.Context, id, status,
+	reason string) error {
+	record, err := in.Store.ClaimStatus(ctx, id, status)
+	if err != nil {
+		return err
+	}
+
+	update := models.PlatformStatusUpdate{Status: status, Reason: reason,
+		Sent_at: now()}
+	var sendErr error
+	platform, ok := in.Registry.Lookup(record.Platform)
+	switch {
+	case !ok:
+		sendErr = fmt.Errorf("platform %s is not set up", record.Platform)
+	case platform.Notifier != nil:
+		sendErr = platform.Notifier.NotifyStatus(ctx, StatusUpdate{
+			Platform:    record.Platform,
+			External_id: record.External_id,
+			Order_id:    record.Order_id,
+			Status:      status,
+			Reason:      reason,
+			Sent_at:     update.Sent_at,
+		})
+	}
+	if sendErr != nil {
+		update.Error = sendErr.Error()
+	}
+	if err := in.Store.StatusSent(ctx, id, record.Notified_status,
+		update); err != nil {
+		log.Println("couldn't record the status of platform order", id, err)
+	}
+	return sendErr
+}
+
+// notify tells a platform the status of one of its orders on its own,
+// after the request that changed it.
+func (in *Intake) notify(id, status, reason string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := in.Notify(ctx, id, status, reason)
+	if err != nil && !errors.Is(err, ErrStatus) {
+		log.Println("couldn't tell the platform order", id, "is", status, err)
+	}
+}
+
+// RetryStatuses tells the platforms the statuses still to be told: those
+// that didn't go through, and the acceptance or rejection of orders whose
+// update was never sent.
+func (in *Intake) RetryStatuses(ctx context.Context) error {
+	pending, err := in.Store.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	for _, record := range pending {
+		err := in.Notify(ctx, record.ID, record.Pending_status,
+			record.Pending_reason)
+		if err != nil && !errors.Is(err, ErrStatus) {
+			log.Println("couldn't tell the platform order", record.ID, "is",
+				record.Pending_status, err)
+		}
+	}
+	return nil
+}
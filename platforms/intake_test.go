@@ -0,0 +1,420 @@
+package platforms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"restro/models"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const secret = "shared-secret"
+
+const order = `{"external_id":"A1","customer":{"name":"Ann"},` +
+	`"items":[{"external_id":"pizza","quantity":2}]}`
+
+// stubPlatform stands in for a platform, taking the status updates sent to
+// it when they are signed.
+type stubPlatform struct {
+	server  *httptest.Server
+	updates chan StatusUpdate
+
+	mu   sync.Mutex
+	down bool
+}
+
+func newStubPlatform(t *testing.T) *stubPlatform {
+	stub := &stubPlatform{updates: make(chan StatusUpdate, 10)}
+	stub.server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			if err := VerifyRequest(r.Header, secret, body); err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			stub.mu.Lock()
+			down := stub.down
+			stub.mu.Unlock()
+			if down {
+				http.Error(w, "down", http.StatusServiceUnavailable)
+				return
+			}
+			var update StatusUpdate
+			if err := json.Unmarshal(body, &update); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			stub.updates <- update
+		}))
+	t.Cleanup(stub.server.Close)
+	return stub
+}
+
+func (s *stubPlatform) setDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+}
+
+func (s *stubPlatform) receive(t *testing.T) StatusUpdate {
+	t.Helper()
+	select {
+	case update := <-s.updates:
+		return update
+	case <-time.After(2 * time.Second):
+		t.Fatal("the platform was told nothing")
+		return StatusUpdate{}
+	}
+}
+
+func (s *stubPlatform) receiveNothing(t *testing.T) {
+	t.Helper()
+	select {
+	case update := <-s.updates:
+		t.Fatalf("the platform was told %s", update.Status)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// restaurant takes the webhooks of the platform "eats" into a memory
+// store, creating orders by counting them.
+type restaurant struct {
+	store  *MemoryStore
+	intake *Intake
+	server *httptest.Server
+
+	mu      sync.Mutex
+	takes   int
+	takeErr error
+}
+
+func newRestaurant(t *testing.T, stub *stubPlatform) *restaurant {
+	registry := NewRegistry()
+	registry.Register(NewNormalizedAdapter("eats", secret),
+		NewHTTPNotifier(stub.server.URL, secret))
+	r := &restaurant{store: NewMemoryStore()}
+	r.intake = &Intake{Registry: registry, Store: r.store, Take: r.take}
+	r.server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			r.intake.ServeWebhook(w, req,
+				strings.TrimPrefix(req.URL.Path, "/webhooks/"))
+		}))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func (r *restaurant) take(ctx context.Context, record models.PlatformOrder,
+	order Order) error {
+	r.mu.Lock()
+	r.takes++
+	err := r.takeErr
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return r.store.Created(ctx, record.ID, record.Attempt_id, time.Now())
+}
+
+func (r *restaurant) failTakes(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.takeErr = err
+}
+
+func (r *restaurant) timesTaken() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.takes
+}
+
+func (r *restaurant) record(t *testing.T) models.PlatformOrder {
+	t.Helper()
+	record, ok := r.store.Get("eats:A1")
+	if !ok {
+		t.Fatal("the order wasn't recorded")
+	}
+	return record
+}
+
+// post posts body to the webhook of platform, with the headers set by
+// sign.
+func (r *restaurant) post(t *testing.T, platform, body string,
+	sign func(http.Header, []byte)) (int, map[string]interface{}) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost,
+		r.server.URL+"/webhooks/"+platform, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign(req.Header, []byte(body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var answer map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, answer
+}
+
+func signed(header http.Header, body []byte) {
+	SignRequest(header, secret, body)
+}
+
+// eventually waits for done to hold.
+func eventually(t *testing.T, done func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); !done(); {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	tests := []struct {
+		name     string
+		platform string
+		body     string
+		sign     func(http.Header, []byte)
+		want     int
+	}{
+		{"signed", "eats", order, signed, http.StatusOK},
+		{"unsigned", "eats", order, func(http.Header, []byte) {},
+			http.StatusUnauthorized},
+		{"another secret", "eats", order, func(h http.Header, body []byte) {
+			SignRequest(h, "guess", body)
+		}, http.StatusUnauthorized},
+		{"changed after signing", "eats", order, func(h http.Header, body []byte) {
+			SignRequest(h, secret, bytes.Replace(body, []byte("2"), []byte("9"), 1))
+		}, http.StatusUnauthorized},
+		{"replayed later", "eats", order, func(h http.Header, body []byte) {
+			timestamp := strconv.FormatInt(
+				time.Now().Add(-2*MaxClockSkew).Unix(), 10)
+			h.Set(TimestampHeader, timestamp)
+			h.Set(SignatureHeader, Sign(secret, timestamp, body))
+		}, http.StatusUnauthorized},
+		{"unknown platform", "other", order, signed, http.StatusNotFound},
+		{"not an order", "eats", `{"external_id":"A1","items":[]}`, signed,
+			http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRestaurant(t, newStubPlatform(t))
+			status, answer := r.post(t, tt.platform, tt.body, tt.sign)
+			if status != tt.want {
+				t.Fatalf("answered %d %v, want %d", status, answer, tt.want)
+			}
+			if taken := r.timesTaken(); (status == http.StatusOK) != (taken == 1) {
+				t.Errorf("the order was taken %d times", taken)
+			}
+		})
+	}
+}
+
+func TestWebhookReplayIsAnsweredAsTheFirst(t *testing.T) {
+	stub := newStubPlatform(t)
+	r := newRestaurant(t, stub)
+
+	status, first := r.post(t, "eats", order, signed)
+	if status != http.StatusOK {
+		t.Fatalf("answered %d %v", status, first)
+	}
+	if update := stub.receive(t); update.Status != StatusAccepted ||
+		update.Order_id != first["order_id"] || update.External_id != "A1" {
+		t.Errorf("the platform was told %+v", update)
+	}
+	status, again := r.post(t, "eats", order, signed)
+	if status != http.StatusOK || again["order_id"] != first["order_id"] {
+		t.Errorf("the replay was answered %d %v, first %v", status, again, first)
+	}
+	if taken := r.timesTaken(); taken != 1 {
+		t.Errorf("the order was taken %d times", taken)
+	}
+	stub.receiveNothing(t)
+	if record := r.record(t); record.Deliveries != 2 ||
+		record.Pending_status != "" {
+		t.Errorf("the record is %+v", record)
+	}
+}
+
+func TestWebhookReplayWhileTaken(t *testing.T) {
+	r := newRestaurant(t, newStubPlatform(t))
+	_, _, err := r.store.Claim(context.Background(),
+		newRecord("eats", Order{External_id: "A1"}), time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, answer := r.post(t, "eats", order, signed); status != http.StatusConflict {
+		t.Errorf("answered %d %v", status, answer)
+	}
+	if taken := r.timesTaken(); taken != 0 {
+		t.Errorf("the order was taken %d times", taken)
+	}
+}
+
+func TestWebhookReplayRetriesAFailedTake(t *testing.T) {
+	stub := newStubPlatform(t)
+	r := newRestaurant(t, stub)
+
+	r.failTakes(errors.New("database down"))
+	if status, answer := r.post(t, "eats", order, signed); status != http.StatusInternalServerError {
+		t.Fatalf("answered %d %v", status, answer)
+	}
+	if record := r.record(t); record.Status != models.PlatformOrderFailed {
+		t.Errorf("the record is %s", record.Status)
+	}
+	stub.receiveNothing(t)
+
+	r.failTakes(nil)
+	if status, answer := r.post(t, "eats", order, signed); status != http.StatusOK {
+		t.Fatalf("answered %d %v", status, answer)
+	}
+	if taken := r.timesTaken(); taken != 2 {
+		t.Errorf("the order was taken %d times", taken)
+	}
+	if update := stub.receive(t); update.Status != StatusAccepted {
+		t.Errorf("the platform was told %s", update.Status)
+	}
+}
+
+func TestWebhookReplayOfARejectedOrder(t *testing.T) {
+	stub := newStubPlatform(t)
+	r := newRestaurant(t, stub)
+
+	r.failTakes(fmt.Errorf("%w: no food is mapped to pizza", ErrRejected))
+	for i := 0; i < 2; i++ {
+		status, answer := r.post(t, "eats", order, signed)
+		if status != http.StatusUnprocessableEntity ||
+			!strings.Contains(answer["error"].(string), "pizza") {
+			t.Fatalf("answered %d %v", status, answer)
+		}
+	}
+	if taken := r.timesTaken(); taken != 1 {
+		t.Errorf("the order was taken %d times", taken)
+	}
+	update := stub.receive(t)
+	if update.Status != StatusRejected ||
+		!strings.Contains(update.Reason, "pizza") {
+		t.Errorf("the platform was told %+v", update)
+	}
+	stub.receiveNothing(t)
+}
+
+func TestStatusCallbacksOnlyMoveForward(t *testing.T) {
+	stub := newStubPlatform(t)
+	r := newRestaurant(t, stub)
+	ctx := context.Background()
+
+	if status, answer := r.post(t, "eats", order, signed); status != http.StatusOK {
+		t.Fatalf("answered %d %v", status, answer)
+	}
+	stub.receive(t)
+	steps := []struct {
+		status string
+		err    error
+	}{
+		{StatusPreparing, nil},
+		{StatusAccepted, ErrStatus},
+		{StatusPreparing, ErrStatus},
+		{StatusReady, nil},
+		{StatusCompleted, nil},
+		{StatusCancelled, ErrStatus},
+	}
+	for _, step := range steps {
+		err := r.intake.Notify(ctx, "eats:A1", step.status, "")
+		if !errors.Is(err, step.err) || (err == nil) != (step.err == nil) {
+			t.Fatalf("telling %s: %v, want %v", step.status, err, step.err)
+		}
+		if step.err == nil {
+			if update := stub.receive(t); update.Status != step.status {
+				t.Errorf("the platform was told %s, want %s", update.Status,
+					step.status)
+			}
+		}
+	}
+	stub.receiveNothing(t)
+	if record := r.record(t); record.Notified_status != StatusCompleted ||
+		len(record.Status_updates) != 4 {
+		t.Errorf("the record is %+v", record)
+	}
+	if err := r.intake.Notify(ctx, "eats:B2", StatusReady, ""); !errors.Is(err, ErrStatus) {
+		t.Errorf("telling an unknown order: %v", err)
+	}
+}
+
+func TestRetryStatusesTellsWhatFailed(t *testing.T) {
+	stub := newStubPlatform(t)
+	r := newRestaurant(t, stub)
+	ctx := context.Background()
+
+	stub.setDown(true)
+	if status, answer := r.post(t, "eats", order, signed); status != http.StatusOK {
+		t.Fatalf("answered %d %v", status, answer)
+	}
+	eventually(t, func() bool { return len(r.record(t).Status_updates) == 1 })
+	if record := r.record(t); record.Pending_status != StatusAccepted ||
+		record.Notified_status != "" || record.Status_updates[0].Error == "" {
+		t.Fatalf("the record is %+v", record)
+	}
+	if err := r.intake.RetryStatuses(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if record := r.record(t); record.Pending_status != StatusAccepted {
+		t.Fatalf("a failed retry settled %+v", record)
+	}
+
+	stub.setDown(false)
+	if err := r.intake.RetryStatuses(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if update := stub.receive(t); update.Status != StatusAccepted {
+		t.Errorf("the platform was told %s", update.Status)
+	}
+
+	stub.setDown(true)
+	if err := r.intake.Notify(ctx, "eats:A1", StatusPreparing, ""); err == nil {
+		t.Fatal("telling a platform that is down went through")
+	}
+	stub.setDown(false)
+	if err := r.intake.Notify(ctx, "eats:A1", StatusReady, ""); err != nil {
+		t.Fatal(err)
+	}
+	stub.receive(t)
+	if record := r.record(t); record.Pending_status != "" {
+		t.Errorf("READY left %s to be told", record.Pending_status)
+	}
+
+	stub.setDown(true)
+	if err := r.intake.Notify(ctx, "eats:A1", StatusCancelled, "closing"); err == nil {
+		t.Fatal("telling a platform that is down went through")
+	}
+	stub.setDown(false)
+	if err := r.intake.RetryStatuses(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if update := stub.receive(t); update.Status != StatusCancelled ||
+		update.Reason != "closing" {
+		t.Errorf("the platform was told %+v", update)
+	}
+	if err := r.intake.RetryStatuses(ctx); err != nil {
+		t.Fatal(err)
+	}
+	stub.receiveNothing(t)
+	if record := r.record(t); record.Pending_status != "" ||
+		record.Notified_status != StatusCancelled {
+		t.Errorf("the record is %+v", record)
+	}
+}
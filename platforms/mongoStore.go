@@ -0,0 +1,182 @@
+package platforms
+
+import (
+	"context"
+	"errors"
+	"restro/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoStore struct {
+	orders *mongo.Collection
+}
+
+// NewMongoStore returns a Store backed by the platform order collection.
+// Its methods take a mongo.SessionContext as ctx to join a transaction.
+func NewMongoStore(orders *mongo.Collection) Store {
+	return &mongoStore{orders: orders}
+}
+
+func (s *mongoStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.orders.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "order_id", Value: 1}}},
+		{
+			Keys: bson.D{{Key: "pending_status", Value: 1}},
+			Options: options.Index().SetPartialFilterExpression(
+				bson.M{"pending_status": bson.M{"$gt": ""}}),
+		},
+	})
+	return err
+}
+
+func (s *mongoStore) Claim(ctx context.Context, record models.PlatformOrder,
+	stale time.Time) (models.PlatformOrder, bool, error) {
+	_, err := s.orders.InsertOne(ctx, record)
+	if err == nil {
+		return record, true, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return record, false, err
+	}
+
+	var existing models.PlatformOrder
+	err = s.orders.FindOneAndUpdate(ctx, bson.M{
+		"_id": record.ID,
+		"$or": bson.A{
+			bson.M{"status": models.PlatformOrderFailed},
+			bson.M{"status": models.PlatformOrderReceiving,
+				"updated_at": bson.M{"$lt": stale}},
+		},
+	}, bson.M{
+		"$set": bson.M{"status": models.PlatformOrderReceiving,
+			"attempt_id": record.Attempt_id, "error": "",
+			"updated_at": record.Updated_at},
+		"$inc": bson.M{"deliveries": 1},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&existing)
+	if err == nil {
+		return existing, true, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return existing, false, err
+	}
+	err = s.orders.FindOneAndUpdate(ctx,
+		bson.M{"_id": record.ID}, bson.M{"$inc": bson.M{"deliveries": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&existing)
+	return existing, false, err
+}
+
+func (s *mongoStore) Created(ctx context.Context, id, attempt string,
+	now time.Time) error {
+	result, err := s.orders.UpdateOne(ctx, bson.M{
+		"_id":        id,
+		"attempt_id": attempt,
+		"status":     models.PlatformOrderReceiving,
+	}, bson.M{"$set": bson.M{"status": models.PlatformOrderCreated,
+		"error": "", "pending_status": StatusAccepted, "pending_reason": "",
+		"updated_at": now}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrTakenOver
+	}
+	return nil
+}
+
+func (s *mongoStore) Finish(ctx context.Context, id, attempt, status,
+	reason string, now time.Time) error {
+	set := bson.M{"status": status, "error": reason, "updated_at": now}
+	if status == models.PlatformOrderRejected {
+		set["pending_status"] = StatusRejected
+		set["pending_reason"] = reason
+	}
+	result, err := s.orders.UpdateOne(ctx,
+		bson.M{"_id": id, "attempt_id": attempt}, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrTakenOver
+	}
+	return nil
+}
+
+func (s *mongoStore) ClaimStatus(ctx context.Context, id, status string) (
+	models.PlatformOrder, error) {
+	var record models.PlatformOrder
+	err := s.orders.FindOneAndUpdate(ctx, bson.M{
+		"_id":             id,
+		"notified_status": bson.M{"$in": earlierStatuses(status)},
+	}, bson.M{"$set": bson.M{"notified_status": status}}).Decode(&record)
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return record, err
+	}
+	_, err = s.orders.UpdateOne(ctx,
+		bson.M{"_id": id, "pending_status": status},
+		bson.M{"$set": bson.M{"pending_status": "", "pending_reason": ""}})
+	if err != nil {
+		return record, err
+	}
+	return record, ErrStatus
+}
+
+// pendingIn matches the orders with one of statuses to be told, counting
+// those saved before pending statuses were kept as having none.
+func pendingIn(statuses []string) bson.M {
+	in := bson.A{nil}
+	for _, status := range statuses {
+		in = append(in, status)
+	}
+	return bson.M{"$in": in}
+}
+
+func (s *mongoStore) StatusSent(ctx context.Context, id, previous string,
+	update models.PlatformStatusUpdate) error {
+	earlier := earlierStatuses(update.Status)
+	if update.Error == "" {
+		_, err := s.orders.UpdateOne(ctx, bson.M{
+			"_id":            id,
+			"pending_status": pendingIn(append(earlier, update.Status)),
+		}, bson.M{"$set": bson.M{"pending_status": "", "pending_reason": ""}})
+		if err != nil {
+			return err
+		}
+	} else {
+		_, err := s.orders.UpdateOne(ctx, bson.M{
+			"_id":             id,
+			"notified_status": update.Status,
+		}, bson.M{"$set": bson.M{"notified_status": previous}})
+		if err != nil {
+			return err
+		}
+		_, err = s.orders.UpdateOne(ctx, bson.M{
+			"_id":            id,
+			"pending_status": pendingIn(earlier),
+		}, bson.M{"$set": bson.M{"pending_status": update.Status,
+			"pending_reason": update.Reason}})
+		if err != nil {
+			return err
+		}
+	}
+	_, err := s.orders.UpdateOne(ctx, bson.M{"_id": id},
+		bson.M{"$push": bson.M{"status_updates": update}})
+	return err
+}
+
+func (s *mongoStore) Pending(ctx context.Context) (
+	[]models.PlatformOrder, error) {
+	cursor, err := s.orders.Find(ctx,
+		bson.M{"pending_status": bson.M{"$gt": ""}})
+	if err != nil {
+		return nil, err
+	}
+	pending := []models.PlatformOrder{}
+	err = cursor.All(ctx, &pending)
+	return pending, err
+}
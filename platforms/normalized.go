@@ -0,0 +1,113 @@
+package platforms
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The headers webhooks and status updates are signed with. The signature
+// is "sha256=" and the hex HMAC-SHA256 of the timestamp, a dot and the
+// body, keyed with the secret shared with the platform.
+const (
+	TimestampHeader = "X-Restro-Timestamp"
+	SignatureHeader = "X-Restro-Signature"
+)
+
+// MaxClockSkew is how far a webhook's timestamp may be from now, so a
+// captured webhook can't be replayed later.
+const MaxClockSkew = 5 * time.Minute
+
+// Sign signs body as sent at timestamp, a Unix time in seconds.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignRequest sets the signature headers of a request sending body now.
+func SignRequest(header http.Header, secret string, body []byte) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	header.Set(TimestampHeader, timestamp)
+	header.Set(SignatureHeader, Sign(secret, timestamp, body))
+}
+
+// VerifyRequest checks the signature headers of a request carrying body.
+func VerifyRequest(header http.Header, secret string, body []byte) error {
+	timestamp := header.Get(TimestampHeader)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrSignature
+	}
+	if skew := time.Since(time.Unix(seconds, 0)); skew > MaxClockSkew ||
+		skew < -MaxClockSkew {
+		return ErrSignature
+	}
+	if !hmac.Equal([]byte(header.Get(SignatureHeader)),
+		[]byte(Sign(secret, timestamp, body))) {
+		return ErrSignature
+	}
+	return nil
+}
+
+type normalizedAdapter struct {
+	name   string
+	secret string
+}
+
+// NewNormalizedAdapter returns an Adapter for a platform, or a middleware
+// in front of one, that posts orders already in the shape of Order,
+// signed with secret.
+func NewNormalizedAdapter(name, secret string) Adapter {
+	return &normalizedAdapter{name: name, secret: secret}
+}
+
+func (a *normalizedAdapter) Name() string {
+	return a.name
+}
+
+func (a *normalizedAdapter) Verify(header http.Header, body []byte) error {
+	return VerifyRequest(header, a.secret, body)
+}
+
+func (a *normalizedAdapter) Parse(body []byte) (Order, error) {
+	var order Order
+	if err := json.Unmarshal(body, &order); err != nil {
+		return order, fmt.Errorf("%w: %v", ErrPayload, err)
+	}
+	if order.Type == "" {
+		order.Type = "DELIVERY"
+	}
+	return order, CheckOrder(order)
+}
+
+// CheckOrder checks an order read by an adapter has what is needed to take
+// it.
+func CheckOrder(order Order) error {
+	if strings.TrimSpace(order.External_id) == "" {
+		return fmt.Errorf("%w: the order has no external_id", ErrPayload)
+	}
+	if order.Type != "DELIVERY" && order.Type != "TAKEAWAY" {
+		return fmt.Errorf("%w: type must be DELIVERY or TAKEAWAY", ErrPayload)
+	}
+	if len(order.Items) == 0 {
+		return fmt.Errorf("%w: the order has no items", ErrPayload)
+	}
+	for _, item := range order.Items {
+		if strings.TrimSpace(item.External_id) == "" {
+			return fmt.Errorf("%w: every item needs an external_id", ErrPayload)
+		}
+		if item.Quantity < 1 || item.Quantity > 50 {
+			return fmt.Errorf("%w: item %s has a quantity outside 1 to 50",
+				ErrPayload, item.External_id)
+		}
+	}
+	return nil
+}
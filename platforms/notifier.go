@@ -0,0 +1,49 @@
+package platforms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+type httpNotifier struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// NewHTTPNotifier returns a StatusNotifier that posts each update as JSON
+// to url, signed with secret the same way webhooks are.
+func NewHTTPNotifier(url, secret string) StatusNotifier {
+	return &httpNotifier{url: url, secret: secret,
+		client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (n *httpNotifier) NotifyStatus(ctx context.Context,
+	update StatusUpdate) error {
+	body, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url,
+		bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	SignRequest(req.Header, n.secret, body)
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s answered %s", n.url, resp.Status)
+	}
+	return nil
+}
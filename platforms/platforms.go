@@ -0,0 +1,140 @@
+// Package platforms connects the restaurant to the delivery platforms that
+// take orders for it. Each platform has an Adapter that checks its webhooks
+// and reads its orders into one shape, and a StatusNotifier that tells it
+// how its orders are getting on. An Intake takes the webhooks, keeping the
+// orders received in a Store so each is taken once.
+package platforms
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+var (
+	// ErrSignature is returned by Verify when a webhook isn't signed by
+	// the platform.
+	ErrSignature = errors.New("invalid webhook signature")
+	// ErrPayload is returned by Parse when a webhook isn't an order.
+	ErrPayload = errors.New("invalid order payload")
+)
+
+// Statuses an order goes through, as told to the platform. An order is
+// ACCEPTED or REJECTED when it arrives, then PREPARING, READY and
+// COMPLETED; it can be CANCELLED until it is completed.
+const (
+	StatusAccepted  = "ACCEPTED"
+	StatusRejected  = "REJECTED"
+	StatusPreparing = "PREPARING"
+	StatusReady     = "READY"
+	StatusCompleted = "COMPLETED"
+	StatusCancelled = "CANCELLED"
+)
+
+// Statuses lists every status an order can be told.
+var Statuses = []string{StatusAccepted, StatusRejected, StatusPreparing,
+	StatusReady, StatusCompleted, StatusCancelled}
+
+var statusRank = map[string]int{
+	"":              0,
+	StatusAccepted:  1,
+	StatusPreparing: 2,
+	StatusReady:     3,
+	StatusCompleted: 4,
+	StatusRejected:  4,
+	StatusCancelled: 4,
+}
+
+// Advances tells whether an order told from can be told to: statuses only
+// move forward, and nothing follows COMPLETED, REJECTED or CANCELLED.
+func Advances(from, to string) bool {
+	fromRank, ok := statusRank[from]
+	if !ok || fromRank == statusRank[StatusCompleted] {
+		return false
+	}
+	toRank, ok := statusRank[to]
+	return ok && toRank > fromRank
+}
+
+// Order is an order from a platform. Type is DELIVERY or TAKEAWAY, for
+// orders the customer collects. Scheduled_for is set on orders placed
+// ahead.
+type Order struct {
+	External_id   string     `json:"external_id"`
+	Type          string     `json:"type"`
+	Customer      Customer   `json:"customer"`
+	Items         []Item     `json:"items"`
+	Note          string     `json:"note,omitempty"`
+	Delivery_fee  *float64   `json:"delivery_fee,omitempty"`
+	Scheduled_for *time.Time `json:"scheduled_for,omitempty"`
+	Placed_at     *time.Time `json:"placed_at,omitempty"`
+}
+
+type Customer struct {
+	Name    string `json:"name"`
+	Phone   string `json:"phone,omitempty"`
+	Address string `json:"address,omitempty"`
+}
+
+// Item is a line of a platform order. External_id is the item's ID on the
+// platform's menu.
+type Item struct {
+	External_id string   `json:"external_id"`
+	Name        string   `json:"name,omitempty"`
+	Quantity    int      `json:"quantity"`
+	Modifiers   []string `json:"modifiers,omitempty"`
+}
+
+// StatusUpdate tells a platform the status of one of its orders.
+type StatusUpdate struct {
+	Platform    string    `json:"platform"`
+	External_id string    `json:"external_id"`
+	Order_id    string    `json:"order_id,omitempty"`
+	Status      string    `json:"status"`
+	Reason      string    `json:"reason,omitempty"`
+	Sent_at     time.Time `json:"sent_at"`
+}
+
+// Adapter reads the webhooks of one platform.
+type Adapter interface {
+	// Name is how the platform appears in its webhook path.
+	Name() string
+	// Verify checks a webhook was signed by the platform.
+	Verify(header http.Header, body []byte) error
+	// Parse reads the order in a verified webhook.
+	Parse(body []byte) (Order, error)
+}
+
+// StatusNotifier sends status updates back to a platform.
+type StatusNotifier interface {
+	NotifyStatus(ctx context.Context, update StatusUpdate) error
+}
+
+// Platform is a platform's adapter and notifier. Notifier is nil for
+// platforms that don't take status updates.
+type Platform struct {
+	Adapter  Adapter
+	Notifier StatusNotifier
+}
+
+// Registry holds the platforms orders are taken from.
+type Registry struct {
+	platforms map[string]Platform
+}
+
+func NewRegistry() *Registry {
+	return &Registry{platforms: map[string]Platform{}}
+}
+
+// Register adds a platform under its adapter's name, replacing any with
+// the same name.
+func (r *Registry) Register(adapter Adapter, notifier StatusNotifier) {
+	r.platforms[adapter.Name()] = Platform{Adapter: adapter, Notifier: notifier}
+}
+
+// Lookup finds a platform by name.
+func (r *Registry) Lookup(name string) (Platform, bool) {
+	platform, ok := r.platforms[name]
+	return platform, ok
+}
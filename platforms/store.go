@@ -0,0 +1,223 @@
+package platforms
+
+import (
+	"context"
+	"errors"
+	"restro/models"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrStatus is returned when an order doesn't exist or was already
+	// told a status at or past the one to tell.
+	ErrStatus = errors.New("the platform order doesn't exist or is " +
+		"already past that status")
+	// ErrTakenOver is returned when a redelivered webhook has claimed
+	// taking an order since the attempt at hand.
+	ErrTakenOver = errors.New("the order was taken over by a redelivery")
+)
+
+// Store keeps the orders received from platforms. Each method is atomic,
+// so webhooks delivered at once, the updates sent as orders move and the
+// retries of those that failed can share it.
+type Store interface {
+	EnsureIndexes(ctx context.Context) error
+	// Claim records an order received and claims taking it under its
+	// Attempt_id. An order received before is claimed again only if
+	// taking it failed or its attempt was last updated before stale;
+	// otherwise it is returned unclaimed, as it stands. Every delivery
+	// is counted.
+	Claim(ctx context.Context, record models.PlatformOrder,
+		stale time.Time) (models.PlatformOrder, bool, error)
+	// Created marks an order claimed under attempt as created, with
+	// ACCEPTED to be told. It is ErrTakenOver if the order was claimed
+	// again since.
+	Created(ctx context.Context, id, attempt string, now time.Time) error
+	// Finish records that the attempt at taking an order ended REJECTED,
+	// with REJECTED and why to be told, or FAILED. It is ErrTakenOver if
+	// the order was claimed again since.
+	Finish(ctx context.Context, id, attempt, status, reason string,
+		now time.Time) error
+	// ClaimStatus claims telling an order status, if that advances from
+	// the status it was last told, and returns the order as it was. It is
+	// ErrStatus otherwise, and the order no longer has status to be told.
+	ClaimStatus(ctx context.Context, id, status string) (
+		models.PlatformOrder, error)
+	// StatusSent records an update sent after ClaimStatus. One that went
+	// through settles the statuses to be told up to it; one with an Error
+	// gives back previous as the status last told and leaves its own to
+	// be told.
+	StatusSent(ctx context.Context, id, previous string,
+		update models.PlatformStatusUpdate) error
+	// Pending lists the orders with a status to be told.
+	Pending(ctx context.Context) ([]models.PlatformOrder, error)
+}
+
+// earlierStatuses lists the statuses an order may have been told before
+// status, including none.
+func earlierStatuses(status string) []string {
+	earlier := []string{""}
+	for _, from := range Statuses {
+		if Advances(from, status) {
+			earlier = append(earlier, from)
+		}
+	}
+	return earlier
+}
+
+func isOneOf(status string, statuses []string) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// MemoryStore keeps platform orders in memory. It is meant for tests and
+// for running without a database.
+type MemoryStore struct {
+	mu     sync.Mutex
+	orders map[string]models.PlatformOrder
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{orders: map[string]models.PlatformOrder{}}
+}
+
+// Get finds an order by ID.
+func (s *MemoryStore) Get(id string) (models.PlatformOrder, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.orders[id]
+	return record, ok
+}
+
+func (s *MemoryStore) EnsureIndexes(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemoryStore) Claim(ctx context.Context, record models.PlatformOrder,
+	stale time.Time) (models.PlatformOrder, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.orders[record.ID]
+	if !ok {
+		s.orders[record.ID] = record
+		return record, true, nil
+	}
+	existing.Deliveries++
+	claimed := existing.Status == models.PlatformOrderFailed ||
+		existing.Status == models.PlatformOrderReceiving &&
+			existing.Updated_at.Before(stale)
+	if claimed {
+		existing.Status = models.PlatformOrderReceiving
+		existing.Attempt_id = record.Attempt_id
+		existing.Error = ""
+		existing.Updated_at = record.Updated_at
+	}
+	s.orders[record.ID] = existing
+	return existing, claimed, nil
+}
+
+func (s *MemoryStore) Created(ctx context.Context, id, attempt string,
+	now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.orders[id]
+	if !ok || record.Attempt_id != attempt ||
+		record.Status != models.PlatformOrderReceiving {
+		return ErrTakenOver
+	}
+	record.Status = models.PlatformOrderCreated
+	record.Error = ""
+	record.Pending_status = StatusAccepted
+	record.Pending_reason = ""
+	record.Updated_at = now
+	s.orders[id] = record
+	return nil
+}
+
+func (s *MemoryStore) Finish(ctx context.Context, id, attempt, status,
+	reason string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.orders[id]
+	if !ok || record.Attempt_id != attempt {
+		return ErrTakenOver
+	}
+	record.Status = status
+	record.Error = reason
+	if status == models.PlatformOrderRejected {
+		record.Pending_status = StatusRejected
+		record.Pending_reason = reason
+	}
+	record.Updated_at = now
+	s.orders[id] = record
+	return nil
+}
+
+func (s *MemoryStore) ClaimStatus(ctx context.Context, id, status string) (
+	models.PlatformOrder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.orders[id]
+	if !ok {
+		return record, ErrStatus
+	}
+	if !isOneOf(record.Notified_status, earlierStatuses(status)) {
+		if record.Pending_status == status {
+			record.Pending_status = ""
+			record.Pending_reason = ""
+			s.orders[id] = record
+		}
+		return record, ErrStatus
+	}
+	claimed := record
+	claimed.Notified_status = status
+	s.orders[id] = claimed
+	return record, nil
+}
+
+func (s *MemoryStore) StatusSent(ctx context.Context, id, previous string,
+	update models.PlatformStatusUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.orders[id]
+	if !ok {
+		return ErrStatus
+	}
+	earlier := earlierStatuses(update.Status)
+	switch {
+	case update.Error == "":
+		if isOneOf(record.Pending_status, append(earlier, update.Status)) {
+			record.Pending_status = ""
+			record.Pending_reason = ""
+		}
+	default:
+		if record.Notified_status == update.Status {
+			record.Notified_status = previous
+		}
+		if isOneOf(record.Pending_status, earlier) {
+			record.Pending_status = update.Status
+			record.Pending_reason = update.Reason
+		}
+	}
+	record.Status_updates = append(record.Status_updates, update)
+	s.orders[id] = record
+	return nil
+}
+
+func (s *MemoryStore) Pending(ctx context.Context) (
+	[]models.PlatformOrder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending := []models.PlatformOrder{}
+	for _, record := range s.orders {
+		if record.Pending_status != "" {
+			pending = append(pending, record)
+		}
+	}
+	return pending, nil
+}
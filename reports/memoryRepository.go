@@ -0,0 +1,91 @@
+package reports
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryRepository reports over sales held in memory.
+type MemoryRepository struct {
+	mu    sync.Mutex
+	sales []Sale
+	seats int
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{}
+}
+
+func (r *MemoryRepository) Add(sales ...Sale) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sales = append(r.sales, sales...)
+}
+
+// SetSeats sets how many seats the dining room has.
+func (r *MemoryRepository) SetSeats(seats int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seats = seats
+}
+
+func (r *MemoryRepository) inRange(q Query) []Sale {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var sales []Sale
+	for _, sale := range r.sales {
+		if !sale.At.Before(q.From) && sale.At.Before(q.To) {
+			sales = append(sales, sale)
+		}
+	}
+	return sales
+}
+
+func (r *MemoryRepository) Revenue(ctx context.Context, q Query, by Dimension) ([]Row, error) {
+	rows := []Row{}
+	index := map[string]int{}
+	orders := map[string]map[string]bool{}
+	for _, sale := range r.inRange(q) {
+		key, label := bucket(sale, by, q.location())
+		i, ok := index[key]
+		if !ok {
+			i = len(rows)
+			index[key] = i
+			rows = append(rows, Row{Key: key, Label: label})
+			orders[key] = map[string]bool{}
+		}
+		rows[i].Revenue += sale.Amount
+		rows[i].Items++
+		if !orders[key][sale.Order_id] {
+			orders[key][sale.Order_id] = true
+			rows[i].Orders++
+		}
+	}
+	return finish(rows, q, by), nil
+}
+
+func (r *MemoryRepository) Summary(ctx context.Context, q Query) (Summary, error) {
+	var summary Summary
+	counted := map[string]bool{}
+	for _, sale := range r.inRange(q) {
+		summary.Revenue += sale.Amount
+		summary.Items++
+		if sale.Guests != nil {
+			summary.Covered_revenue += sale.Amount
+		}
+		if counted[sale.Order_id] {
+			continue
+		}
+		counted[sale.Order_id] = true
+		summary.Orders++
+		if sale.Guests != nil {
+			summary.Covers += *sale.Guests
+		} else {
+			summary.Orders_without_guests++
+		}
+	}
+	r.mu.Lock()
+	summary.Seats = r.seats
+	r.mu.Unlock()
+	return finishSummary(summary, q), nil
+}
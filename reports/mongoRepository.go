@@ -0,0 +1,209 @@
+package reports
+
+import (
+	"context"
+	"fmt"
+	"restro/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type mongoRepository struct {
+	orderItems *mongo.Collection
+	orders     *mongo.Collection
+	foods      *mongo.Collection
+	menus      *mongo.Collection
+	tables     *mongo.Collection
+	users      *mongo.Collection
+}
+
+// NewMongoRepository returns a Repository that aggregates the order items,
+// joined with their order, food, menu, table and the server of the order.
+func NewMongoRepository(orderItems, orders, foods, menus, tables,
+	users *mongo.Collection) Repository {
+	return &mongoRepository{
+		orderItems: orderItems,
+		orders:     orders,
+		foods:      foods,
+		menus:      menus,
+		tables:     tables,
+		users:      users,
+	}
+}
+
+func lookup(from *mongo.Collection, localField, foreignField, as string) bson.A {
+	return bson.A{
+		bson.M{"$lookup": bson.M{
+			"from":         from.Name(),
+			"localField":   localField,
+			"foreignField": foreignField,
+			"as":           as,
+		}},
+		bson.M{"$unwind": bson.M{"path": "$" + as,
+			"preserveNullAndEmptyArrays": true}},
+	}
+}
+
+// sales is the pipeline that turns the order items in the period into the
+// Sale shape. Items sold before unit prices were recorded count at the
+// food's price.
+func (r *mongoRepository) sales(q Query) bson.A {
+	pipeline := bson.A{
+		bson.M{"$match": bson.M{
+			"created_at": bson.M{"$gte": q.From, "$lt": q.To},
+			"status":     bson.M{"$ne": "VOID"},
+			// gift cards are paid for in advance, not sold
+			"gift_card_code": nil,
+		}},
+	}
+	pipeline = append(pipeline, lookup(r.foods, "food_id", "food_id", "food")...)
+	pipeline = append(pipeline, lookup(r.menus, "food.menu_id", "menu_id", "menu")...)
+	pipeline = append(pipeline, lookup(r.orders, "order_id", "order_id", "order")...)
+	pipeline = append(pipeline, lookup(r.tables, "order.table_id", "table_id", "table")...)
+	pipeline = append(pipeline, bson.M{"$addFields": bson.M{
+		"server_id": bson.M{"$ifNull": bson.A{"$order.server_id",
+			"$order.created_by", ""}},
+	}})
+	pipeline = append(pipeline, lookup(r.users, "server_id", "user_id", "user")...)
+	return append(pipeline, bson.M{"$project": bson.M{
+		"_id":           0,
+		"order_id":      1,
+		"order_item_id": 1,
+		"at":            "$created_at",
+		"amount":        bson.M{"$ifNull": bson.A{"$unit_price", "$food.price", 0}},
+		"food_id":       1,
+		"food_name":     bson.M{"$ifNull": bson.A{"$food.name", ""}},
+		"category":      bson.M{"$ifNull": bson.A{"$menu.category", ""}},
+		"table_id":      bson.M{"$ifNull": bson.A{"$order.table_id", ""}},
+		"table_number":  "$table.table_number",
+		"staff_id":      "$server_id",
+		"staff_name": bson.M{"$trim": bson.M{"input": bson.M{"$concat": bson.A{
+			bson.M{"$ifNull": bson.A{"$user.first_name", ""}}, " ",
+			bson.M{"$ifNull": bson.A{"$user.last_name", ""}},
+		}}}},
+		"guests": "$order.guests",
+		"order_type": bson.M{"$ifNull": bson.A{"$order.order_type",
+			models.OrderDineIn}},
+	}})
+}
+
+// bucketExpression is the Mongo equivalent of bucket: the key a sale falls
+// under and its label.
+func bucketExpression(by Dimension, timezone string) (key, label interface{}) {
+	date := func(format string) bson.M {
+		return bson.M{"$dateToString": bson.M{"format": format, "date": "$at",
+			"timezone": timezone}}
+	}
+	switch by {
+	case ByDay:
+		return date("%Y-%m-%d"), ""
+	case ByHour:
+		return date("%H"), ""
+	case ByWeekday:
+		return date("%u"), ""
+	case ByCategory:
+		return "$category", "$category"
+	case ByFood:
+		return "$food_id", "$food_name"
+	case ByTable:
+		return "$table_id", bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{bson.M{"$type": "$table_number"}, "missing"}},
+			"",
+			bson.M{"$concat": bson.A{"Table ",
+				bson.M{"$toString": "$table_number"}}},
+		}}
+	case ByStaff:
+		return "$staff_id", "$staff_name"
+	case ByOrderType:
+		return "$order_type", ""
+	}
+	return nil, ""
+}
+
+func (r *mongoRepository) Revenue(ctx context.Context, q Query, by Dimension) ([]Row, error) {
+	if !by.Valid() {
+		return nil, fmt.Errorf("unknown report dimension %q", by)
+	}
+	key, label := bucketExpression(by, q.location().String())
+	pipeline := append(r.sales(q),
+		bson.M{"$group": bson.M{
+			"_id":     key,
+			"label":   bson.M{"$first": label},
+			"revenue": bson.M{"$sum": "$amount"},
+			"items":   bson.M{"$sum": 1},
+			"orders":  bson.M{"$addToSet": "$order_id"},
+		}},
+		bson.M{"$project": bson.M{
+			"_id":     0,
+			"key":     "$_id",
+			"label":   1,
+			"revenue": 1,
+			"items":   1,
+			"orders":  bson.M{"$size": "$orders"},
+		}},
+	)
+	cursor, err := r.orderItems.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	rows := []Row{}
+	if err = cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	return finish(rows, q, by), nil
+}
+
+func (r *mongoRepository) Summary(ctx context.Context, q Query) (Summary, error) {
+	pipeline := append(r.sales(q),
+		bson.M{"$group": bson.M{
+			"_id":     "$order_id",
+			"revenue": bson.M{"$sum": "$amount"},
+			"items":   bson.M{"$sum": 1},
+			"guests":  bson.M{"$first": "$guests"},
+		}},
+		bson.M{"$addFields": bson.M{"has_guests": bson.M{"$in": bson.A{
+			bson.M{"$type": "$guests"}, bson.A{"int", "long", "double"}}}}},
+		bson.M{"$group": bson.M{
+			"_id":     nil,
+			"revenue": bson.M{"$sum": "$revenue"},
+			"items":   bson.M{"$sum": "$items"},
+			"orders":  bson.M{"$sum": 1},
+			"covers":  bson.M{"$sum": "$guests"},
+			"covered_revenue": bson.M{"$sum": bson.M{"$cond": bson.A{
+				"$has_guests", "$revenue", 0}}},
+			"orders_without_guests": bson.M{"$sum": bson.M{"$cond": bson.A{
+				"$has_guests", 0, 1}}},
+		}},
+	)
+	cursor, err := r.orderItems.Aggregate(ctx, pipeline)
+	if err != nil {
+		return Summary{}, err
+	}
+	var totals []Summary
+	if err = cursor.All(ctx, &totals); err != nil {
+		return Summary{}, err
+	}
+	var summary Summary
+	if len(totals) > 0 {
+		summary = totals[0]
+	}
+
+	cursor, err = r.tables.Aggregate(ctx, bson.A{
+		bson.M{"$group": bson.M{"_id": nil,
+			"seats": bson.M{"$sum": "$number_of_guests"}}},
+	})
+	if err != nil {
+		return Summary{}, err
+	}
+	var seats []struct {
+		Seats int `bson:"seats"`
+	}
+	if err = cursor.All(ctx, &seats); err != nil {
+		return Summary{}, err
+	}
+	if len(seats) > 0 {
+		summary.Seats = seats[0].Seats
+	}
+	return finishSummary(summary, q), nil
+}
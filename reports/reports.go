@@ -0,0 +1,304 @@
+package reports
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"restro/models"
+	"sort"
+	"time"
+)
+
+// Dimension is what revenue is broken down by.
+type Dimension string
+
+const (
+	ByDay       Dimension = "day"
+	ByHour      Dimension = "hour"
+	ByWeekday   Dimension = "weekday"
+	ByCategory  Dimension = "category"
+	ByFood      Dimension = "food"
+	ByTable     Dimension = "table"
+	ByStaff     Dimension = "staff"
+	ByOrderType Dimension = "order_type"
+)
+
+var Dimensions = []Dimension{ByDay, ByHour, ByWeekday, ByCategory, ByFood,
+	ByTable, ByStaff, ByOrderType}
+
+func (d Dimension) Valid() bool {
+	for _, dimension := range Dimensions {
+		if d == dimension {
+			return true
+		}
+	}
+	return false
+}
+
+// Query is the period a report covers, from inclusive to exclusive. Days,
+// hours and weekdays are bucketed in Location. Seat hours are counted over
+// the Opening_hours in the period, or the whole of it when there are none.
+type Query struct {
+	From          time.Time
+	To            time.Time
+	Location      *time.Location
+	Opening_hours *models.OpeningHours
+}
+
+func (q Query) location() *time.Location {
+	if q.Location == nil {
+		return time.UTC
+	}
+	return q.Location
+}
+
+// Sale is one sold order item together with what reports group it by. Voided
+// items are not sales. The staff member is the order's server, or who took
+// it for orders from before servers were assigned. Orders from before there
+// were order types are dine-in. Delivery fees and gift cards aren't sales of
+// food, so reports leave them out.
+type Sale struct {
+	Order_id      string    `json:"order_id"`
+	Order_item_id string    `json:"order_item_id"`
+	At            time.Time `json:"at"`
+	Amount        float64   `json:"amount"`
+	Food_id       string    `json:"food_id"`
+	Food_name     string    `json:"food_name"`
+	Category      string    `json:"category"`
+	Table_id      string    `json:"table_id"`
+	Table_number  *int      `json:"table_number"`
+	Staff_id      string    `json:"staff_id"`
+	Staff_name    string    `json:"staff_name"`
+	Guests        *int      `json:"guests"`
+	Order_type    string    `json:"order_type"`
+}
+
+type Row struct {
+	Key            string  `json:"key"`
+	Label          string  `json:"label"`
+	Revenue        float64 `json:"revenue"`
+	Orders         int     `json:"orders"`
+	Items          int     `json:"items"`
+	Average_ticket float64 `json:"average_ticket"`
+}
+
+// Summary is the headline figures for a period. Covers are the guests
+// served, and revenue per cover is over the orders that say how many guests
+// they had; the others are counted apart. A seat hour is one seat available
+// for one hour the restaurant was open in the period.
+type Summary struct {
+	From                  time.Time `json:"from"`
+	To                    time.Time `json:"to"`
+	Time_zone             string    `json:"time_zone"`
+	Revenue               float64   `json:"revenue"`
+	Orders                int       `json:"orders"`
+	Items                 int       `json:"items"`
+	Average_ticket        float64   `json:"average_ticket"`
+	Covers                int       `json:"covers"`
+	Covered_revenue       float64   `json:"-"`
+	Orders_without_guests int       `json:"orders_without_guests"`
+	Revenue_per_cover     float64   `json:"revenue_per_cover"`
+	Open_hours            float64   `json:"open_hours"`
+	Seats                 int       `json:"seats"`
+	Seat_hours            float64   `json:"seat_hours"`
+	Revenue_per_seat_hour float64   `json:"revenue_per_seat_hour"`
+}
+
+// Repository computes the sales reports. The Mongo repository aggregates in
+// the database for the API; the memory repository works over a list of
+// sales for tests and local tooling. Both finish their results the same
+// way, so they agree.
+type Repository interface {
+	Revenue(ctx context.Context, q Query, by Dimension) ([]Row, error)
+	Summary(ctx context.Context, q Query) (Summary, error)
+}
+
+var weekdays = []string{"", "Monday", "Tuesday", "Wednesday", "Thursday",
+	"Friday", "Saturday", "Sunday"}
+
+// bucket returns the key a sale falls under and its label.
+func bucket(sale Sale, by Dimension, loc *time.Location) (key, label string) {
+	at := sale.At.In(loc)
+	switch by {
+	case ByDay:
+		return at.Format("2006-01-02"), ""
+	case ByHour:
+		return at.Format("15"), ""
+	case ByWeekday:
+		return fmt.Sprint(isoWeekday(at)), ""
+	case ByCategory:
+		return sale.Category, sale.Category
+	case ByFood:
+		return sale.Food_id, sale.Food_name
+	case ByTable:
+		if sale.Table_number != nil {
+			return sale.Table_id, fmt.Sprintf("Table %d", *sale.Table_number)
+		}
+		return sale.Table_id, ""
+	case ByStaff:
+		return sale.Staff_id, sale.Staff_name
+	case ByOrderType:
+		if sale.Order_type == "" {
+			return models.OrderDineIn, ""
+		}
+		return sale.Order_type, ""
+	}
+	return "", ""
+}
+
+var orderTypeLabels = map[string]string{
+	models.OrderDineIn:       "Dine-in",
+	models.OrderTakeaway:     "Takeaway",
+	models.OrderDelivery:     "Delivery",
+	models.OrderDriveThrough: "Drive-through",
+}
+
+func isoWeekday(t time.Time) int {
+	if t.Weekday() == time.Sunday {
+		return 7
+	}
+	return int(t.Weekday())
+}
+
+// finish fills in the time buckets nothing sold in, labels and rounds the
+// rows and puts them in order: time buckets chronologically, everything else
+// by revenue.
+func finish(rows []Row, q Query, by Dimension) []Row {
+	byKey := map[string]int{}
+	for i, row := range rows {
+		byKey[row.Key] = i
+	}
+	var keys []string
+	switch by {
+	case ByDay:
+		loc := q.location()
+		from := q.From.In(loc)
+		day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+		for ; day.Before(q.To); day = day.AddDate(0, 0, 1) {
+			keys = append(keys, day.Format("2006-01-02"))
+		}
+	case ByHour:
+		for hour := 0; hour < 24; hour++ {
+			keys = append(keys, fmt.Sprintf("%02d", hour))
+		}
+	case ByWeekday:
+		for day := 1; day <= 7; day++ {
+			keys = append(keys, fmt.Sprint(day))
+		}
+	}
+	for _, key := range keys {
+		if _, ok := byKey[key]; !ok {
+			byKey[key] = len(rows)
+			rows = append(rows, Row{Key: key})
+		}
+	}
+
+	for i := range rows {
+		row := &rows[i]
+		switch by {
+		case ByHour:
+			row.Label = row.Key + ":00"
+		case ByWeekday:
+			var day int
+			fmt.Sscan(row.Key, &day)
+			if day >= 1 && day <= 7 {
+				row.Label = weekdays[day]
+			}
+		case ByDay:
+			row.Label = row.Key
+		case ByOrderType:
+			row.Label = orderTypeLabels[row.Key]
+		}
+		if row.Label == "" {
+			row.Label = row.Key
+		}
+		row.Revenue = round2(row.Revenue)
+		if row.Orders > 0 {
+			row.Average_ticket = round2(row.Revenue / float64(row.Orders))
+		}
+	}
+
+	switch by {
+	case ByDay, ByHour, ByWeekday:
+		sort.Slice(rows, func(i, j int) bool { return rows[i].Key < rows[j].Key })
+	default:
+		sort.SliceStable(rows, func(i, j int) bool {
+			if rows[i].Revenue != rows[j].Revenue {
+				return rows[i].Revenue > rows[j].Revenue
+			}
+			return rows[i].Key < rows[j].Key
+		})
+	}
+	return rows
+}
+
+// finishSummary works out the averages and rates from the totals.
+func finishSummary(s Summary, q Query) Summary {
+	s.From = q.From
+	s.To = q.To
+	s.Time_zone = q.location().String()
+	s.Revenue = round2(s.Revenue)
+	if s.Orders > 0 {
+		s.Average_ticket = round2(s.Revenue / float64(s.Orders))
+	}
+	if s.Covers > 0 {
+		s.Revenue_per_cover = round2(s.Covered_revenue / float64(s.Covers))
+	}
+	s.Open_hours = round2(openHours(q))
+	s.Seat_hours = round2(float64(s.Seats) * s.Open_hours)
+	if s.Seat_hours > 0 {
+		s.Revenue_per_seat_hour = round2(s.Revenue / s.Seat_hours)
+	}
+	return s
+}
+
+// openHours is how many hours of the period the restaurant was open.
+func openHours(q Query) float64 {
+	if q.Opening_hours == nil || len(q.Opening_hours.Periods) == 0 {
+		return q.To.Sub(q.From).Hours()
+	}
+	loc, err := time.LoadLocation(q.Opening_hours.Time_zone)
+	if err != nil {
+		loc = q.location()
+	}
+	// a day's last period can run into the next day
+	from := q.From.In(loc).AddDate(0, 0, -1)
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	var open time.Duration
+	for ; day.Before(q.To); day = day.AddDate(0, 0, 1) {
+		for _, period := range q.Opening_hours.Periods {
+			if period.Weekday != isoWeekday(day) {
+				continue
+			}
+			opens, err := time.Parse("15:04", period.Opens)
+			if err != nil {
+				continue
+			}
+			closes, err := time.Parse("15:04", period.Closes)
+			if err != nil {
+				continue
+			}
+			start := time.Date(day.Year(), day.Month(), day.Day(),
+				opens.Hour(), opens.Minute(), 0, 0, loc)
+			end := time.Date(day.Year(), day.Month(), day.Day(),
+				closes.Hour(), closes.Minute(), 0, 0, loc)
+			if !end.After(start) {
+				end = end.AddDate(0, 0, 1)
+			}
+			if start.Before(q.From) {
+				start = q.From
+			}
+			if end.After(q.To) {
+				end = q.To
+			}
+			if end.After(start) {
+				open += end.Sub(start)
+			}
+		}
+	}
+	return open.Hours()
+}
+
+func round2(num float64) float64 {
+	return math.Round(num*100) / 100
+}
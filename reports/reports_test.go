@@ -0,0 +1,237 @@
+package reports
+
+import (
+	"context"
+	"restro/models"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func guests(n int) *int { return &n }
+
+func at(t *testing.T, s string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func newYork(t *testing.T) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+// Monday 4 March 2024 in New York, UTC-5, and the Tuesday after.
+func twoDays(t *testing.T) (*MemoryRepository, Query) {
+	repo := NewMemoryRepository()
+	repo.Add(
+		// Monday 22:30 in New York, already Tuesday in UTC
+		Sale{Order_id: "o1", Order_item_id: "a", Amount: 10,
+			At: at(t, "2024-03-05T03:30:00Z")},
+		Sale{Order_id: "o1", Order_item_id: "b", Amount: 5.255,
+			At: at(t, "2024-03-05T03:35:00Z")},
+		// Tuesday 10:00 in New York
+		Sale{Order_id: "o2", Order_item_id: "c", Amount: 20,
+			At: at(t, "2024-03-05T15:00:00Z")},
+		// Tuesday 23:00 in New York: Wednesday in UTC, but in the period
+		Sale{Order_id: "o3", Order_item_id: "d", Amount: 7,
+			At: at(t, "2024-03-06T04:00:00Z")},
+		// Wednesday 00:00 in New York, past the period
+		Sale{Order_id: "o4", Order_item_id: "e", Amount: 99,
+			At: at(t, "2024-03-06T05:00:00Z")},
+	)
+	return repo, Query{
+		From:     at(t, "2024-03-04T05:00:00Z"),
+		To:       at(t, "2024-03-06T05:00:00Z"),
+		Location: newYork(t),
+	}
+}
+
+func rowsByKey(rows []Row) map[string]Row {
+	byKey := map[string]Row{}
+	for _, row := range rows {
+		byKey[row.Key] = row
+	}
+	return byKey
+}
+
+func TestRevenueByDayInLocation(t *testing.T) {
+	repo, q := twoDays(t)
+	rows, err := repo.Revenue(context.Background(), q, ByDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Row{
+		{Key: "2024-03-04", Label: "2024-03-04", Revenue: 15.26, Orders: 1,
+			Items: 2, Average_ticket: 15.26},
+		{Key: "2024-03-05", Label: "2024-03-05", Revenue: 27, Orders: 2,
+			Items: 2, Average_ticket: 13.5},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("rows = %+v, want %+v", rows, want)
+	}
+	for i := range want {
+		if rows[i] != want[i] {
+			t.Errorf("row %d = %+v, want %+v", i, rows[i], want[i])
+		}
+	}
+
+	// the same sales bucketed in UTC fall on the Tuesday and Wednesday
+	q.Location = time.UTC
+	rows, _ = repo.Revenue(context.Background(), q, ByDay)
+	days := rowsByKey(rows)
+	if len(rows) != 3 || days["2024-03-04"].Items != 0 ||
+		days["2024-03-05"].Items != 3 || days["2024-03-06"].Items != 1 {
+		t.Fatalf("UTC rows = %+v", rows)
+	}
+}
+
+func TestRevenueByHourInLocation(t *testing.T) {
+	repo, q := twoDays(t)
+	rows, err := repo.Revenue(context.Background(), q, ByHour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 24 {
+		t.Fatalf("got %d hours, want all 24", len(rows))
+	}
+	if rows[0].Key != "00" || rows[23].Key != "23" {
+		t.Fatalf("hours run %s to %s, want 00 to 23", rows[0].Key,
+			rows[23].Key)
+	}
+	hours := rowsByKey(rows)
+	for key, want := range map[string]float64{"22": 15.26, "10": 20,
+		"23": 7, "03": 0, "15": 0} {
+		if hours[key].Revenue != want {
+			t.Errorf("hour %s revenue = %v, want %v", key,
+				hours[key].Revenue, want)
+		}
+	}
+	if hours["22"].Label != "22:00" {
+		t.Errorf("label = %q, want 22:00", hours["22"].Label)
+	}
+}
+
+func TestRevenueByWeekdayInLocation(t *testing.T) {
+	repo, q := twoDays(t)
+	rows, err := repo.Revenue(context.Background(), q, ByWeekday)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 7 {
+		t.Fatalf("got %d weekdays, want all 7", len(rows))
+	}
+	days := rowsByKey(rows)
+	if days["1"].Label != "Monday" || days["1"].Revenue != 15.26 {
+		t.Errorf("Monday = %+v", days["1"])
+	}
+	if days["2"].Label != "Tuesday" || days["2"].Revenue != 27 ||
+		days["2"].Orders != 2 {
+		t.Errorf("Tuesday = %+v", days["2"])
+	}
+	if days["7"].Label != "Sunday" || days["3"].Revenue != 0 {
+		t.Errorf("Sunday = %+v, Wednesday = %+v", days["7"], days["3"])
+	}
+}
+
+func TestSummaryCovers(t *testing.T) {
+	repo := NewMemoryRepository()
+	noon := at(t, "2024-03-04T12:00:00Z")
+	repo.Add(
+		Sale{Order_id: "o1", Amount: 10, Guests: guests(4), At: noon},
+		Sale{Order_id: "o1", Amount: 5, Guests: guests(4), At: noon},
+		// a takeaway says nothing of guests
+		Sale{Order_id: "o2", Amount: 20, At: noon},
+		Sale{Order_id: "o3", Amount: 9, Guests: guests(2), At: noon},
+	)
+	summary, err := repo.Summary(context.Background(), Query{
+		From: at(t, "2024-03-04T00:00:00Z"),
+		To:   at(t, "2024-03-05T00:00:00Z"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Revenue != 44 || summary.Orders != 3 || summary.Items != 4 {
+		t.Fatalf("totals = %v, %d orders, %d items", summary.Revenue,
+			summary.Orders, summary.Items)
+	}
+	if summary.Average_ticket != 14.67 {
+		t.Errorf("average ticket = %v, want 14.67", summary.Average_ticket)
+	}
+	if summary.Covers != 6 || summary.Orders_without_guests != 1 {
+		t.Errorf("covers = %d with %d orders without guests, want 6 and 1",
+			summary.Covers, summary.Orders_without_guests)
+	}
+	// only what the orders with guests took is spread over the covers
+	if summary.Revenue_per_cover != 4 {
+		t.Errorf("revenue per cover = %v, want 4", summary.Revenue_per_cover)
+	}
+}
+
+func TestRevenuePerSeatHour(t *testing.T) {
+	repo := NewMemoryRepository()
+	repo.SetSeats(10)
+	repo.Add(Sale{Order_id: "o1", Amount: 60,
+		At: at(t, "2024-03-04T12:00:00Z")})
+	q := Query{
+		From: at(t, "2024-03-04T00:00:00Z"),
+		To:   at(t, "2024-03-05T00:00:00Z"),
+	}
+	for _, tt := range []struct {
+		name    string
+		hours   *models.OpeningHours
+		open    float64
+		perSeat float64
+	}{
+		{"open all day without opening hours", nil, 24, 0.25},
+		{"lunch and a late dinner", &models.OpeningHours{
+			Time_zone: "UTC",
+			Periods: []models.OpeningPeriod{
+				// Sunday night runs two hours into the Monday
+				{Weekday: 7, Opens: "22:00", Closes: "02:00"},
+				{Weekday: 1, Opens: "11:00", Closes: "15:00"},
+				// runs an hour past the period
+				{Weekday: 1, Opens: "18:00", Closes: "01:00"},
+				{Weekday: 2, Opens: "11:00", Closes: "15:00"},
+			},
+		}, 12, 0.5},
+		{"opening hours in their own time zone", &models.OpeningHours{
+			Time_zone: "America/New_York",
+			Periods: []models.OpeningPeriod{
+				// 16:00 to 20:00 UTC
+				{Weekday: 1, Opens: "11:00", Closes: "15:00"},
+				// 23:00 UTC Monday to 02:00 UTC Tuesday
+				{Weekday: 1, Opens: "18:00", Closes: "21:00"},
+				// 04:00 to 06:00 UTC Monday
+				{Weekday: 7, Opens: "23:00", Closes: "01:00"},
+			},
+		}, 7, 60.0 / 70},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			q.Opening_hours = tt.hours
+			summary, err := repo.Summary(context.Background(), q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if summary.Open_hours != tt.open {
+				t.Fatalf("open hours = %v, want %v", summary.Open_hours,
+					tt.open)
+			}
+			if summary.Seats != 10 || summary.Seat_hours != 10*tt.open {
+				t.Fatalf("seat hours = %d x %v", summary.Seats,
+					summary.Seat_hours)
+			}
+			if want := round2(tt.perSeat); summary.Revenue_per_seat_hour != want {
+				t.Fatalf("revenue per seat hour = %v, want %v",
+					summary.Revenue_per_seat_hour, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package routes
+
+import (
+	controller "restro/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func AccountingRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/payments", controller.GetPayments())
+	incomingRoutes.POST("/invoices/:invoice_id/payments",
+		controller.CreatePayment())
+	incomingRoutes.POST("/payments/:payment_id/refunds",
+		controller.RefundPayment())
+	incomingRoutes.GET("/accounting/settings",
+		controller.GetAccountingSettings())
+	incomingRoutes.PUT("/accounting/settings",
+		controller.UpdateAccountingSettings())
+	incomingRoutes.GET("/accounting/journal", controller.GetJournal())
+	incomingRoutes.GET("/accounting/exports", controller.GetJournalExports())
+	incomingRoutes.POST("/accounting/exports",
+		controller.CreateJournalExport())
+	incomingRoutes.GET("/accounting/exports/:export_id/download",
+		controller.DownloadJournalExport())
+}
@@ -0,0 +1,14 @@
+package routes
+
+import (
+	controller "restro/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func BundleRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/bundles", controller.GetBundles())
+	incomingRoutes.GET("/bundles/:bundle_id", controller.GetBundle())
+	incomingRoutes.POST("/bundles", controller.CreateBundle())
+	incomingRoutes.PATCH("/bundles/:bundle_id", controller.UpdateBundle())
+}
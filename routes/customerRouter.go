@@ -0,0 +1,17 @@
+package routes
+
+import (
+	controller "restro/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func CustomerRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/customers", controller.GetCustomers())
+	incomingRoutes.GET("/customers/:customer_id", controller.GetCustomer())
+	incomingRoutes.POST("/customers", controller.CreateCustomer())
+	incomingRoutes.PATCH("/customers/:customer_id", controller.UpdateCustomer())
+	incomingRoutes.DELETE("/customers/:customer_id", controller.DeleteCustomer())
+	incomingRoutes.GET("/customers/:customer_id/history",
+		controller.GetCustomerHistory())
+}
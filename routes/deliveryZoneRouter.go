@@ -0,0 +1,16 @@
+package routes
+
+import (
+	controller "restro/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func DeliveryZoneRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/deliveryZones", controller.GetDeliveryZones())
+	incomingRoutes.POST("/deliveryZones", controller.CreateDeliveryZone())
+	incomingRoutes.PATCH("/deliveryZones/:delivery_zone_id",
+		controller.UpdateDeliveryZone())
+	incomingRoutes.DELETE("/deliveryZones/:delivery_zone_id",
+		controller.DeleteDeliveryZone())
+}
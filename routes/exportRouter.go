@@ -0,0 +1,17 @@
+package routes
+
+import (
+	controller "restro/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ExportRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/export/:dataset", controller.ExportDataset())
+	incomingRoutes.GET("/export/reports/summary",
+		controller.ExportSalesSummary())
+	incomingRoutes.GET("/export/reports/revenue/:dimension",
+		controller.ExportRevenueReport())
+	incomingRoutes.GET("/export/reports/menuEngineering",
+		controller.ExportMenuEngineering())
+}
@@ -0,0 +1,25 @@
+package routes
+
+import (
+	controller "restro/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func FloorRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/floor", controller.GetFloorPlan())
+	incomingRoutes.GET("/floor/areas", controller.GetAreas())
+	incomingRoutes.POST("/floor/areas", controller.CreateArea())
+	incomingRoutes.PATCH("/floor/areas/:area_id", controller.UpdateArea())
+	incomingRoutes.DELETE("/floor/areas/:area_id", controller.DeleteArea())
+	incomingRoutes.PATCH("/tables/:table_id/layout",
+		controller.UpdateTableLayout())
+	incomingRoutes.POST("/tables/:table_id/status",
+		controller.SetTableStatus())
+	incomingRoutes.GET("/tables/available", controller.GetAvailableTables())
+	incomingRoutes.GET("/tableGroups", controller.GetTableGroups())
+	incomingRoutes.GET("/tableGroups/:group_id", controller.GetTableGroup())
+	incomingRoutes.POST("/tableGroups", controller.CreateTableGroup())
+	incomingRoutes.POST("/tableGroups/:group_id/split",
+		controller.SplitTableGroup())
+}
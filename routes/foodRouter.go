@@ -8,7 +8,17 @@ import (
 
 func FoodRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/foods", controller.GetFoods())
+	incomingRoutes.GET("/foods/search", controller.SearchFoods())
+	incomingRoutes.GET("/foods/costs", controller.GetFoodCosts())
 	incomingRoutes.GET("/foods/:food_id", controller.GetFood())
 	incomingRoutes.POST("/foods", controller.CreateFood())
 	incomingRoutes.PATCH("/foods/:food_id", controller.UpdateFood())
+	incomingRoutes.POST("/foods/:food_id/image", controller.UploadFoodImage())
+	incomingRoutes.GET("/foods/:food_id/cost", controller.GetFoodCost())
+	incomingRoutes.GET("/foods/:food_id/prices", controller.GetFoodPrices())
+	incomingRoutes.POST("/foods/:food_id/prices", controller.CreateFoodPrice())
+	incomingRoutes.PUT("/foods/:food_id/translations/:locale",
+		controller.PutFoodTranslation())
+	incomingRoutes.DELETE("/foods/:food_id/translations/:locale",
+		controller.DeleteFoodTranslation())
 }
@@ -0,0 +1,17 @@
+package routes
+
+import (
+	controller "restro/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GiftCardRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/gift-cards", controller.GetGiftCards())
+	incomingRoutes.GET("/gift-cards/:code", controller.GetGiftCard())
+	incomingRoutes.GET("/gift-cards/:code/ledger", controller.GetGiftCardLedger())
+	incomingRoutes.POST("/gift-cards/:code/freeze", controller.FreezeGiftCard())
+	incomingRoutes.POST("/gift-cards/:code/unfreeze",
+		controller.UnfreezeGiftCard())
+	incomingRoutes.POST("/orders/:order_id/gift-cards", controller.SellGiftCard())
+}
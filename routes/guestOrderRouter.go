@@ -0,0 +1,36 @@
+package routes
+
+import (
+	controller "restro/controllers"
+	"restro/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GuestRoutes is the ordering API the table QR codes open. It needs no
+// login, so it is registered before the authentication middleware and
+// rate limited by client address, with sending orders limited per table.
+func GuestRoutes(incomingRoutes *gin.Engine) {
+	guest := incomingRoutes.Group("/guest/:token",
+		middleware.RateLimit(2, 30, func(c *gin.Context) string {
+			return c.ClientIP()
+		}))
+	guest.GET("/menu", controller.GetGuestMenu())
+	guest.GET("/tab", controller.GetGuestTab())
+	guest.POST("/orders",
+		middleware.RateLimit(0.1, 5, func(c *gin.Context) string {
+			return c.Param("token")
+		}),
+		controller.CreateGuestOrder())
+}
+
+func GuestOrderRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/tables/:table_id/qr", controller.GetTableQR())
+	incomingRoutes.PUT("/tables/:table_id/qr", controller.UpdateTableQR())
+	incomingRoutes.POST("/tables/:table_id/qr/rotate", controller.RotateTableQR())
+	incomingRoutes.GET("/guestOrders", controller.GetGuestOrders())
+	incomingRoutes.POST("/guestOrders/:guest_order_id/approve",
+		controller.ApproveGuestOrder())
+	incomingRoutes.POST("/guestOrders/:guest_order_id/reject",
+		controller.RejectGuestOrder())
+}
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	controller "restro/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImageRoutes are registered before authentication so images can be used
+// directly in <img> tags.
+func ImageRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/images/:asset_id/:variant", controller.GetImage())
+}
@@ -0,0 +1,23 @@
+package routes
+
+import (
+	controller "restro/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func InventoryRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/ingredients", controller.GetIngredients())
+	incomingRoutes.GET("/ingredients/:ingredient_id", controller.GetIngredient())
+	incomingRoutes.POST("/ingredients", controller.CreateIngredient())
+	incomingRoutes.PATCH("/ingredients/:ingredient_id",
+		controller.UpdateIngredient())
+	incomingRoutes.GET("/recipes", controller.GetRecipes())
+	incomingRoutes.POST("/recipes", controller.CreateRecipe())
+	incomingRoutes.PATCH("/recipes/:recipe_id", controller.UpdateRecipe())
+	incomingRoutes.DELETE("/recipes/:recipe_id", controller.DeleteRecipe())
+	incomingRoutes.GET("/inventory/stock", controller.GetIngredients())
+	incomingRoutes.GET("/inventory/movements", controller.GetStockMovements())
+	incomingRoutes.POST("/inventory/adjustments",
+		controller.CreateStockAdjustment())
+}
@@ -0,0 +1,26 @@
+package routes
+
+import (
+	controller "restro/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func LoyaltyRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/loyalty/settings", controller.GetLoyaltySettings())
+	incomingRoutes.PUT("/loyalty/settings", controller.UpdateLoyaltySettings())
+	incomingRoutes.GET("/loyalty/members", controller.GetLoyaltyMembers())
+	incomingRoutes.POST("/loyalty/members", controller.EnrollLoyaltyMember())
+	incomingRoutes.GET("/loyalty/members/:customer_id",
+		controller.GetLoyaltyMember())
+	incomingRoutes.GET("/loyalty/members/:customer_id/ledger",
+		controller.GetLoyaltyLedger())
+	incomingRoutes.POST("/loyalty/members/:customer_id/adjust",
+		controller.AdjustLoyaltyPoints())
+	incomingRoutes.POST("/loyalty/members/:customer_id/rewards/:reward_id/redeem",
+		controller.RedeemLoyaltyReward())
+	incomingRoutes.GET("/loyalty/rewards", controller.GetLoyaltyRewards())
+	incomingRoutes.POST("/loyalty/rewards", controller.CreateLoyaltyReward())
+	incomingRoutes.PATCH("/loyalty/rewards/:reward_id",
+		controller.UpdateLoyaltyReward())
+}
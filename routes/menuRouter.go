@@ -11,4 +11,10 @@ func MenuRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/menus/:menu_id", controller.GetMenu())
 	incomingRoutes.POST("/menus", controller.CreateMenu())
 	incomingRoutes.PATCH("/menus/:menu_id", controller.UpdateMenu())
+	incomingRoutes.PUT("/menus/:menu_id/translations/:locale",
+		controller.PutMenuTranslation())
+	incomingRoutes.DELETE("/menus/:menu_id/translations/:locale",
+		controller.DeleteMenuTranslation())
+	incomingRoutes.GET("/translations/missing",
+		controller.GetMissingTranslations())
 }
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	controller "restro/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func NotificationRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/notifications", controller.GetNotifications())
+	incomingRoutes.POST("/notifications/:notification_id/read",
+		controller.MarkNotificationRead())
+}
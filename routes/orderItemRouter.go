@@ -14,4 +14,10 @@ func OrderItemRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.POST("/orderItems", controller.CreateOrderItem())
 	incomingRoutes.PATCH("/orderItems/:orderItem_id",
 		controller.UpdateOrderItem())
+	incomingRoutes.POST("/orderItems/:orderItem_id/fire",
+		controller.FireOrderItem())
+	incomingRoutes.POST("/orderItems/:orderItem_id/serve",
+		controller.ServeOrderItem())
+	incomingRoutes.POST("/orderItems/:orderItem_id/void",
+		controller.VoidOrderItem())
 }
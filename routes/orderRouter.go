@@ -11,4 +11,7 @@ func OrderRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/orders/:order_id", controller.GetOrder())
 	incomingRoutes.POST("/orders", controller.CreateOrder())
 	incomingRoutes.PATCH("/orders/:order_id", controller.UpdateOrder())
+	incomingRoutes.POST("/orders/:order_id/move", controller.MoveOrder())
+	incomingRoutes.POST("/orders/:order_id/merge", controller.MergeOrder())
+	incomingRoutes.GET("/orders/:order_id/audit", controller.GetOrderAudit())
 }
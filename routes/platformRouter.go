@@ -0,0 +1,28 @@
+package routes
+
+import (
+	controller "restro/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PlatformWebhookRoutes is where delivery platforms post their orders. The
+// webhooks are signed rather than logged in, so it is registered before
+// the authentication middleware.
+func PlatformWebhookRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.POST("/webhooks/platforms/:platform/orders",
+		controller.ReceivePlatformOrder())
+}
+
+func PlatformRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/platforms/:platform/menu", controller.GetPlatformMenu())
+	incomingRoutes.PUT("/platforms/:platform/menu/:external_id",
+		controller.PutPlatformMenuItem())
+	incomingRoutes.DELETE("/platforms/:platform/menu/:external_id",
+		controller.DeletePlatformMenuItem())
+	incomingRoutes.GET("/platformOrders", controller.GetPlatformOrders())
+	incomingRoutes.GET("/platformOrders/:platform_order_id",
+		controller.GetPlatformOrder())
+	incomingRoutes.POST("/platformOrders/:platform_order_id/status",
+		controller.SendPlatformOrderStatus())
+}
@@ -0,0 +1,28 @@
+package routes
+
+import (
+	controller "restro/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func PurchaseOrderRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/suppliers", controller.GetSuppliers())
+	incomingRoutes.GET("/suppliers/:supplier_id", controller.GetSupplier())
+	incomingRoutes.POST("/suppliers", controller.CreateSupplier())
+	incomingRoutes.PATCH("/suppliers/:supplier_id", controller.UpdateSupplier())
+	incomingRoutes.GET("/purchaseOrders", controller.GetPurchaseOrders())
+	incomingRoutes.GET("/purchaseOrders/:purchase_order_id",
+		controller.GetPurchaseOrder())
+	incomingRoutes.POST("/purchaseOrders", controller.CreatePurchaseOrder())
+	incomingRoutes.PATCH("/purchaseOrders/:purchase_order_id",
+		controller.UpdatePurchaseOrder())
+	incomingRoutes.POST("/purchaseOrders/:purchase_order_id/send",
+		controller.SendPurchaseOrder())
+	incomingRoutes.POST("/purchaseOrders/:purchase_order_id/receipts",
+		controller.ReceivePurchaseOrder())
+	incomingRoutes.POST("/purchaseOrders/:purchase_order_id/close",
+		controller.ClosePurchaseOrder())
+	incomingRoutes.GET("/inventory/reorderSuggestions",
+		controller.GetReorderSuggestions())
+}
@@ -0,0 +1,20 @@
+package routes
+
+import (
+	controller "restro/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ReportRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/reports/summary", controller.GetSalesSummary())
+	incomingRoutes.GET("/reports/openingHours", controller.GetOpeningHours())
+	incomingRoutes.PUT("/reports/openingHours",
+		controller.UpdateOpeningHours())
+	incomingRoutes.GET("/reports/revenue/:dimension",
+		controller.GetRevenueReport())
+	incomingRoutes.GET("/reports/menuEngineering",
+		controller.GetMenuEngineering())
+	incomingRoutes.GET("/reports/labour", controller.GetLabourReport())
+	incomingRoutes.GET("/reports/servers", controller.GetServerReport())
+}
@@ -0,0 +1,17 @@
+package routes
+
+import (
+	controller "restro/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SchedulingRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/scheduling/settings",
+		controller.GetSchedulingSettings())
+	incomingRoutes.PUT("/scheduling/settings",
+		controller.UpdateSchedulingSettings())
+	incomingRoutes.GET("/scheduling/slots", controller.GetScheduleSlots())
+	incomingRoutes.GET("/scheduling/orders", controller.GetScheduledOrders())
+	incomingRoutes.POST("/orders/:order_id/release", controller.ReleaseOrder())
+}
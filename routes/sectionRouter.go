@@ -0,0 +1,18 @@
+package routes
+
+import (
+	controller "restro/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SectionRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/sections", controller.GetSections())
+	incomingRoutes.GET("/sections/assignments",
+		controller.GetSectionAssignments())
+	incomingRoutes.GET("/sections/:section_id", controller.GetSection())
+	incomingRoutes.POST("/sections", controller.CreateSection())
+	incomingRoutes.PATCH("/sections/:section_id", controller.UpdateSection())
+	incomingRoutes.DELETE("/sections/:section_id", controller.DeleteSection())
+	incomingRoutes.POST("/tables/transfer", controller.TransferTables())
+}
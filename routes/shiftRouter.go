@@ -0,0 +1,23 @@
+package routes
+
+import (
+	controller "restro/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ShiftRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.PUT("/users/:user_id/hourlyRate",
+		controller.SetUserHourlyRate())
+	incomingRoutes.PUT("/users/:user_id/manager", controller.SetUserManager())
+	incomingRoutes.GET("/shifts", controller.GetShifts())
+	incomingRoutes.GET("/shifts/:shift_id", controller.GetShift())
+	incomingRoutes.POST("/shifts", controller.CreateShift())
+	incomingRoutes.PATCH("/shifts/:shift_id", controller.UpdateShift())
+	incomingRoutes.DELETE("/shifts/:shift_id", controller.DeleteShift())
+	incomingRoutes.GET("/timeClock", controller.GetTimeClockEntries())
+	incomingRoutes.POST("/timeClock/clockIn", controller.ClockIn())
+	incomingRoutes.POST("/timeClock/clockOut", controller.ClockOut())
+	incomingRoutes.POST("/timeClock/breaks/start", controller.StartBreak())
+	incomingRoutes.POST("/timeClock/breaks/end", controller.EndBreak())
+}
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	controller "restro/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func WasteRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/waste", controller.GetWasteEntries())
+	incomingRoutes.POST("/waste", controller.CreateWasteEntry())
+	incomingRoutes.GET("/waste/report", controller.GetWasteReport())
+}
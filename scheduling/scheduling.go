@@ -0,0 +1,50 @@
+// Package scheduling works out the slots orders placed ahead are booked
+// into and when they should reach the kitchen.
+package scheduling
+
+import "time"
+
+// SlotLength is how long a booking slot lasts.
+const SlotLength = 15 * time.Minute
+
+// Slot is the start of the slot t falls in. Slots start on the quarter
+// hour.
+func Slot(t time.Time) time.Time {
+	return t.Truncate(SlotLength)
+}
+
+// SlotID names the slot t falls in.
+func SlotID(t time.Time) string {
+	return Slot(t).UTC().Format(time.RFC3339)
+}
+
+// Slots lists the starts of the slots between from and to.
+func Slots(from, to time.Time) []time.Time {
+	slots := []time.Time{}
+	for slot := Slot(from); slot.Before(to); slot = slot.Add(SlotLength) {
+		slots = append(slots, slot)
+	}
+	return slots
+}
+
+// ReleaseAt is when an order wanted at wanted should reach the kitchen:
+// early enough for the item that takes longest, as the items are made
+// alongside each other, plus a buffer. Items with no preparation time
+// count as defaultPrep minutes, as does an order with no items yet.
+func ReleaseAt(wanted time.Time, prepMinutes []*int, defaultPrep,
+	bufferMinutes int) time.Time {
+	longest := 0
+	if len(prepMinutes) == 0 {
+		longest = defaultPrep
+	}
+	for _, minutes := range prepMinutes {
+		prep := defaultPrep
+		if minutes != nil {
+			prep = *minutes
+		}
+		if prep > longest {
+			longest = prep
+		}
+	}
+	return wanted.Add(-time.Duration(longest+bufferMinutes) * time.Minute)
+}
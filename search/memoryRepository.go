@@ -0,0 +1,48 @@
+package search
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryRepository keeps the catalogue in memory. It is meant for tests and
+// for running without a database.
+type MemoryRepository struct {
+	mu   sync.RWMutex
+	docs map[string]Document
+}
+
+// NewMemoryRepository returns a MemoryRepository seeded with docs.
+func NewMemoryRepository(docs ...Document) *MemoryRepository {
+	repo := &MemoryRepository{docs: map[string]Document{}}
+	for _, doc := range docs {
+		repo.Put(doc)
+	}
+	return repo
+}
+
+func (r *MemoryRepository) Put(doc Document) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.docs[doc.Food_ID] = doc
+}
+
+func (r *MemoryRepository) Delete(foodID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.docs, foodID)
+}
+
+func (r *MemoryRepository) EnsureIndexes(ctx context.Context) error {
+	return nil
+}
+
+func (r *MemoryRepository) Search(ctx context.Context, q Query) (Result, error) {
+	r.mu.RLock()
+	docs := make([]Document, 0, len(r.docs))
+	for _, doc := range r.docs {
+		docs = append(docs, doc)
+	}
+	r.mu.RUnlock()
+	return rank(docs, q.Normalize()), nil
+}
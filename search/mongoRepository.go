@@ -0,0 +1,214 @@
+package search
+
+import (
+	"context"
+	"regexp"
+	"restro/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoRepository struct {
+	foods *mongo.Collection
+	menus *mongo.Collection
+}
+
+// NewMongoRepository returns a Repository backed by the food and menu
+// collections. Mongo narrows the candidates with its indexes on the foods'
+// words and the structured filters; ranking and facets are then computed by rank so they
+// match the memory repository exactly.
+func NewMongoRepository(foods, menus *mongo.Collection) Repository {
+	return &mongoRepository{foods: foods, menus: menus}
+}
+
+func (r *mongoRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.foods.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "name", Value: "text"},
+				{Key: "description", Value: "text"},
+				{Key: "tags", Value: "text"},
+			},
+			Options: options.Index().
+				SetName("food_text").
+				SetWeights(bson.M{"name": 10, "tags": 5, "description": 1}),
+		},
+		{Keys: bson.D{{Key: "search_terms", Value: 1}}},
+		{Keys: bson.D{{Key: "menu_id", Value: 1}}},
+		{Keys: bson.D{{Key: "price", Value: 1}}},
+		{Keys: bson.D{{Key: "tags", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.menus.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "category", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+	return r.fillTerms(ctx)
+}
+
+// fillTerms stores the words of the foods saved before they were kept.
+func (r *mongoRepository) fillTerms(ctx context.Context) error {
+	cursor, err := r.foods.Find(ctx,
+		bson.M{"search_terms": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var food models.Food
+		if err := cursor.Decode(&food); err != nil {
+			return err
+		}
+		if _, err := r.foods.UpdateOne(ctx, bson.M{"_id": food.ID},
+			bson.M{"$set": bson.M{"search_terms": Terms(deref(food.Name),
+				deref(food.Description), food.Tags)}}); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func (r *mongoRepository) Search(ctx context.Context, q Query) (Result, error) {
+	q = q.Normalize()
+
+	menus, err := r.loadMenus(ctx, bson.M{})
+	if err != nil {
+		return Result{}, err
+	}
+
+	filter := bson.M{}
+	priceFilter := bson.M{}
+	if q.Min_price != nil {
+		priceFilter["$gte"] = *q.Min_price
+	}
+	if q.Max_price != nil {
+		priceFilter["$lte"] = *q.Max_price
+	}
+	if len(priceFilter) > 0 {
+		filter["price"] = priceFilter
+	}
+	if len(q.Tags) > 0 {
+		filter["tags"] = bson.M{"$all": q.Tags}
+	}
+	if q.Category != "" {
+		ids := []string{}
+		for id, menu := range menus {
+			if equalFold(menu.Category, q.Category) {
+				ids = append(ids, id)
+			}
+		}
+		filter["menu_id"] = bson.M{"$in": ids}
+	}
+
+	// Foods whose menu matches the text are candidates too, since the
+	// food's words don't cover its menu. Otherwise a candidate has a word
+	// starting with a term, or with the part of it a fuzzy match keeps,
+	// which the index on search_terms finds.
+	if terms := tokenize(q.Text); len(terms) > 0 {
+		menuIDs := []string{}
+		for id, menu := range menus {
+			if _, ok := score(Document{Menu_name: menu.Name, Category: menu.Category}, q.Text, q.Match); ok {
+				menuIDs = append(menuIDs, id)
+			}
+		}
+		textClauses := []bson.M{{"menu_id": bson.M{"$in": menuIDs}}}
+		if q.Match == MatchExact {
+			textClauses = append(textClauses, bson.M{"$text": bson.M{"$search": q.Text}})
+		} else {
+			for _, prefix := range termPrefixes(q) {
+				textClauses = append(textClauses, bson.M{"search_terms": bson.M{
+					"$regex": "^" + regexp.QuoteMeta(prefix)}})
+			}
+		}
+		filter["$or"] = textClauses
+	}
+
+	cursor, err := r.foods.Find(ctx, filter,
+		options.Find().SetLimit(MaxCandidates))
+	if err != nil {
+		return Result{}, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []Document
+	for cursor.Next(ctx) {
+		var food models.Food
+		if err := cursor.Decode(&food); err != nil {
+			return Result{}, err
+		}
+		docs = append(docs, FromFood(food, menus[deref(food.Menu_ID)]))
+	}
+	if err := cursor.Err(); err != nil {
+		return Result{}, err
+	}
+	return rank(docs, q), nil
+}
+
+// MaxCandidates caps how many foods a search reads to rank, so a short
+// query can't load the whole catalogue. Ranking only sees the first ones
+// the index finds.
+const MaxCandidates = 1000
+
+// termPrefixes are what the words of a food that may match the query text
+// start with: each term, or for fuzzy matches the part of it they keep.
+func termPrefixes(q Query) []string {
+	prefixes := []string{}
+	for _, term := range tokenize(q.Text) {
+		if q.Match == MatchFuzzy {
+			term = fuzzyPrefix(term)
+		}
+		prefixes = append(prefixes, term)
+	}
+	return prefixes
+}
+
+func (r *mongoRepository) loadMenus(ctx context.Context, filter bson.M) (map[string]models.Menu, error) {
+	cursor, err := r.menus.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var all []models.Menu
+	if err := cursor.All(ctx, &all); err != nil {
+		return nil, err
+	}
+	menus := make(map[string]models.Menu, len(all))
+	for _, menu := range all {
+		menus[menu.Menu_ID] = menu
+	}
+	return menus, nil
+}
+
+// FromFood builds the search document for a food and its menu.
+func FromFood(food models.Food, menu models.Menu) Document {
+	return Document{
+		Food_ID:     food.Food_ID,
+		Name:        deref(food.Name),
+		Description: deref(food.Description),
+		Tags:        food.Tags,
+		Price:       derefFloat(food.Price),
+		Food_image:  deref(food.Food_image),
+		Menu_ID:     deref(food.Menu_ID),
+		Menu_name:   menu.Name,
+		Category:    menu.Category,
+	}
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func derefFloat(f *float64) float64 {
+	if f == nil {
+		return 0
+	}
+	return *f
+}
@@ -0,0 +1,363 @@
+package search
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	MatchExact  = "exact"
+	MatchPrefix = "prefix"
+	MatchFuzzy  = "fuzzy"
+
+	SortRelevance = "relevance"
+	SortPriceAsc  = "price_asc"
+	SortPriceDesc = "price_desc"
+	SortName      = "name"
+)
+
+// PriceBuckets are the lower bounds of the price facet buckets; the last
+// bucket is open ended.
+var PriceBuckets = []float64{0, 5, 10, 20, 50}
+
+// Document is a food joined with the menu it belongs to, which is the unit
+// the search endpoint works with.
+type Document struct {
+	Food_ID     string   `json:"food_id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+	Price       float64  `json:"price"`
+	Food_image  string   `json:"food_image"`
+	Menu_ID     string   `json:"menu_id"`
+	Menu_name   string   `json:"menu_name"`
+	Category    string   `json:"category"`
+}
+
+type Query struct {
+	Text          string
+	Match         string
+	Category      string
+	Tags          []string
+	Min_price     *float64
+	Max_price     *float64
+	Sort          string
+	Page          int
+	RecordPerPage int
+}
+
+type Hit struct {
+	Document
+	Score float64 `json:"score"`
+}
+
+type PriceBucket struct {
+	Min   float64  `json:"min"`
+	Max   *float64 `json:"max"`
+	Count int      `json:"count"`
+}
+
+type Facets struct {
+	Categories map[string]int `json:"categories"`
+	Tags       map[string]int `json:"tags"`
+	Prices     []PriceBucket  `json:"prices"`
+}
+
+type Result struct {
+	Total_count int    `json:"total_count"`
+	Food_items  []Hit  `json:"food_items"`
+	Facets      Facets `json:"facets"`
+}
+
+// Repository runs searches over the food catalogue. The Mongo repository is
+// used by the API; the memory repository backs tests and local tooling.
+type Repository interface {
+	EnsureIndexes(ctx context.Context) error
+	Search(ctx context.Context, q Query) (Result, error)
+}
+
+// Normalize fills in defaults so both repositories see the same query.
+func (q Query) Normalize() Query {
+	q.Text = strings.TrimSpace(q.Text)
+	switch q.Match {
+	case MatchExact, MatchPrefix, MatchFuzzy:
+	default:
+		q.Match = MatchPrefix
+	}
+	switch q.Sort {
+	case SortRelevance, SortPriceAsc, SortPriceDesc, SortName:
+	default:
+		q.Sort = SortRelevance
+	}
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.RecordPerPage < 1 {
+		q.RecordPerPage = 10
+	}
+	// the caller's tags are left as they were
+	tags := make([]string, 0, len(q.Tags))
+	for _, tag := range q.Tags {
+		tags = append(tags, NormalizeTag(tag))
+	}
+	q.Tags = tags
+	return q
+}
+
+// NormalizeTag lowercases a dietary tag and joins its words with
+// underscores, so "Gluten Free" and "gluten_free" are the same tag.
+func NormalizeTag(tag string) string {
+	return strings.Join(tokenize(tag), "_")
+}
+
+// equalFold compares categories the same way tags are compared.
+func equalFold(a, b string) bool {
+	return NormalizeTag(a) == NormalizeTag(b)
+}
+
+// Terms returns the distinct words of a food's name, description and tags.
+// The Mongo repository keeps them on the food, indexed, to match prefixes.
+func Terms(name, description string, tags []string) []string {
+	terms := []string{}
+	seen := map[string]bool{}
+	words := append(tokenize(name), tokenize(description)...)
+	for _, tag := range tags {
+		words = append(words, tokenize(tag)...)
+	}
+	for _, word := range words {
+		if !seen[word] {
+			seen[word] = true
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// filter reports whether the document passes the structured part of the
+// query (category, tags and price range).
+func filter(doc Document, q Query) bool {
+	if q.Category != "" && !equalFold(doc.Category, q.Category) {
+		return false
+	}
+	if q.Min_price != nil && doc.Price < *q.Min_price {
+		return false
+	}
+	if q.Max_price != nil && doc.Price > *q.Max_price {
+		return false
+	}
+	for _, want := range q.Tags {
+		found := false
+		for _, tag := range doc.Tags {
+			if NormalizeTag(tag) == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+type field struct {
+	weight float64
+	tokens []string
+}
+
+// score returns the relevance of the document for the query text. Every query
+// term has to match at least one field for the document to match at all.
+func score(doc Document, text, match string) (float64, bool) {
+	terms := tokenize(text)
+	if len(terms) == 0 {
+		return 0, true
+	}
+	var tagTokens []string
+	for _, tag := range doc.Tags {
+		tagTokens = append(tagTokens, tokenize(tag)...)
+	}
+	fields := []field{
+		{3, tokenize(doc.Name)},
+		{2, tokenize(doc.Category)},
+		{2, tagTokens},
+		{1.5, tokenize(doc.Menu_name)},
+		{1, tokenize(doc.Description)},
+	}
+
+	total := 0.0
+	for _, term := range terms {
+		best := 0.0
+		for _, f := range fields {
+			for _, token := range f.tokens {
+				if s := f.weight * termScore(term, token, match); s > best {
+					best = s
+				}
+			}
+		}
+		if best == 0 {
+			return 0, false
+		}
+		total += best
+	}
+	return total, true
+}
+
+func termScore(term, token, match string) float64 {
+	if term == token {
+		return 1
+	}
+	if match == MatchExact {
+		return 0
+	}
+	if strings.HasPrefix(token, term) {
+		return 0.7
+	}
+	if match == MatchFuzzy && strings.HasPrefix(token, fuzzyPrefix(term)) {
+		if d := levenshtein(term, token); d <= maxEdits(term) {
+			return 0.5 - 0.1*float64(d)
+		}
+	}
+	return 0
+}
+
+// fuzzyPrefixLength is how many leading runes of a term a fuzzy match has
+// to get right, which lets the Mongo repository narrow the candidates with
+// the index on the food's words.
+const fuzzyPrefixLength = 2
+
+func fuzzyPrefix(term string) string {
+	runes := []rune(term)
+	return string(runes[:minInt(fuzzyPrefixLength, len(runes))])
+}
+
+// maxEdits is the number of typos tolerated for a term, growing with its
+// length the same way most search engines do.
+func maxEdits(term string) int {
+	switch n := len([]rune(term)); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(minInt(prev[j]+1, curr[j-1]+1), prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// rank applies the query to the candidate documents and builds the paged
+// result with its facet counts. Both repositories end up here so prefix and
+// fuzzy matching behave identically whatever the storage.
+func rank(docs []Document, q Query) Result {
+	var hits []Hit
+	for _, doc := range docs {
+		if !filter(doc, q) {
+			continue
+		}
+		s, ok := score(doc, q.Text, q.Match)
+		if !ok {
+			continue
+		}
+		hits = append(hits, Hit{Document: doc, Score: s})
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		switch q.Sort {
+		case SortPriceAsc:
+			if a.Price != b.Price {
+				return a.Price < b.Price
+			}
+		case SortPriceDesc:
+			if a.Price != b.Price {
+				return a.Price > b.Price
+			}
+		case SortRelevance:
+			if a.Score != b.Score {
+				return a.Score > b.Score
+			}
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+
+	result := Result{
+		Total_count: len(hits),
+		Food_items:  []Hit{},
+		Facets:      facets(hits),
+	}
+	start := (q.Page - 1) * q.RecordPerPage
+	if start < len(hits) {
+		end := minInt(start+q.RecordPerPage, len(hits))
+		result.Food_items = hits[start:end]
+	}
+	return result
+}
+
+func facets(hits []Hit) Facets {
+	f := Facets{
+		Categories: map[string]int{},
+		Tags:       map[string]int{},
+		Prices:     make([]PriceBucket, len(PriceBuckets)),
+	}
+	for i, lower := range PriceBuckets {
+		f.Prices[i].Min = lower
+		if i+1 < len(PriceBuckets) {
+			upper := PriceBuckets[i+1]
+			f.Prices[i].Max = &upper
+		}
+	}
+	for _, hit := range hits {
+		if hit.Category != "" {
+			f.Categories[hit.Category]++
+		}
+		seen := map[string]bool{}
+		for _, tag := range hit.Tags {
+			tag = NormalizeTag(tag)
+			if tag != "" && !seen[tag] {
+				seen[tag] = true
+				f.Tags[tag]++
+			}
+		}
+		for i := len(PriceBuckets) - 1; i >= 0; i-- {
+			if hit.Price >= PriceBuckets[i] {
+				f.Prices[i].Count++
+				break
+			}
+		}
+	}
+	return f
+}
@@ -0,0 +1,188 @@
+package search
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func catalogue() *MemoryRepository {
+	return NewMemoryRepository(
+		Document{Food_ID: "1", Name: "Margherita", Description: "Tomato and mozzarella",
+			Tags: []string{"vegetarian"}, Price: 9, Menu_ID: "m1", Menu_name: "Pizzas",
+			Category: "Mains"},
+		Document{Food_ID: "2", Name: "Diavola", Description: "Spicy salami",
+			Tags: []string{"spicy"}, Price: 11.5, Menu_ID: "m1", Menu_name: "Pizzas",
+			Category: "Mains"},
+		Document{Food_ID: "3", Name: "Caesar Salad", Description: "Romaine and croutons",
+			Tags: []string{"Gluten Free"}, Price: 7, Menu_ID: "m2", Menu_name: "Starters",
+			Category: "Starters"},
+		Document{Food_ID: "4", Name: "Tiramisu", Description: "Coffee and mascarpone",
+			Tags: []string{"vegetarian"}, Price: 6, Menu_ID: "m3", Menu_name: "Desserts",
+			Category: "Desserts"},
+	)
+}
+
+func search(t *testing.T, q Query) Result {
+	t.Helper()
+	result, err := catalogue().Search(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func foodIDs(result Result) []string {
+	ids := []string{}
+	for _, hit := range result.Food_items {
+		ids = append(ids, hit.Food_ID)
+	}
+	return ids
+}
+
+func TestSearchMatchModes(t *testing.T) {
+	tests := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{"prefix is the default", Query{Text: "marg"}, []string{"1"}},
+		{"prefix starts a word", Query{Text: "herita"}, []string{}},
+		{"prefix of a later word", Query{Text: "mozz"}, []string{"1"}},
+		{"exact needs the whole word", Query{Text: "marg", Match: MatchExact}, []string{}},
+		{"exact word", Query{Text: "margherita", Match: MatchExact}, []string{"1"}},
+		{"prefix doesn't forgive typos", Query{Text: "margarita"}, []string{}},
+		{"fuzzy forgives typos", Query{Text: "margarita", Match: MatchFuzzy}, []string{"1"}},
+		{"fuzzy keeps the first two letters", Query{Text: "mrgherita", Match: MatchFuzzy}, []string{}},
+		{"every term has to match", Query{Text: "spicy tomato"}, []string{}},
+		{"menu name matches", Query{Text: "pizza", Sort: SortName}, []string{"2", "1"}},
+		{"tag words match", Query{Text: "gluten"}, []string{"3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := foodIDs(search(t, tt.query)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchFilters(t *testing.T) {
+	min, max := 7.0, 10.0
+	tests := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{"category ignores case", Query{Category: "mains", Sort: SortName}, []string{"2", "1"}},
+		{"tags are normalized", Query{Tags: []string{"gluten free"}}, []string{"3"}},
+		{"price range is inclusive", Query{Min_price: &min, Max_price: &max,
+			Sort: SortPriceAsc}, []string{"3", "1"}},
+		{"filters and text together", Query{Text: "t", Tags: []string{"vegetarian"},
+			Sort: SortName}, []string{"1", "4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := foodIDs(search(t, tt.query)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchRanksNameAboveDescription(t *testing.T) {
+	repo := NewMemoryRepository(
+		Document{Food_ID: "a", Name: "Garlic bread", Description: "Baked"},
+		Document{Food_ID: "b", Name: "Focaccia", Description: "With garlic"},
+	)
+	result, err := repo.Search(context.Background(), Query{Text: "garlic"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := foodIDs(result); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Fatalf("got %v, want [a b]", got)
+	}
+	if result.Food_items[0].Score <= result.Food_items[1].Score {
+		t.Errorf("name match scored %v, description match %v",
+			result.Food_items[0].Score, result.Food_items[1].Score)
+	}
+}
+
+func TestSearchPaging(t *testing.T) {
+	result := search(t, Query{Sort: SortPriceDesc, Page: 2, RecordPerPage: 3})
+	if result.Total_count != 4 {
+		t.Errorf("total_count is %d, want 4", result.Total_count)
+	}
+	if got := foodIDs(result); !reflect.DeepEqual(got, []string{"4"}) {
+		t.Errorf("page 2 is %v, want [4]", got)
+	}
+	result = search(t, Query{Page: 3, RecordPerPage: 3})
+	if len(result.Food_items) != 0 {
+		t.Errorf("page past the end has %d items", len(result.Food_items))
+	}
+}
+
+func TestSearchFacets(t *testing.T) {
+	facets := search(t, Query{}).Facets
+	if want := map[string]int{"Mains": 2, "Starters": 1, "Desserts": 1}; !reflect.DeepEqual(facets.Categories, want) {
+		t.Errorf("categories are %v, want %v", facets.Categories, want)
+	}
+	if want := map[string]int{"vegetarian": 2, "spicy": 1, "gluten_free": 1}; !reflect.DeepEqual(facets.Tags, want) {
+		t.Errorf("tags are %v, want %v", facets.Tags, want)
+	}
+	counts := []int{}
+	for _, bucket := range facets.Prices {
+		counts = append(counts, bucket.Count)
+	}
+	if want := []int{0, 3, 1, 0, 0}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("price buckets are %v, want %v", counts, want)
+	}
+}
+
+func TestTerms(t *testing.T) {
+	got := Terms("Caesar Salad", "Romaine, salad leaves", []string{"gluten_free"})
+	want := []string{"caesar", "salad", "romaine", "leaves", "gluten", "free"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// The Mongo repository only ranks the foods with a word starting with one
+// of termPrefixes, or on a menu that matches, so every hit has to be one.
+func TestTermPrefixesCoverHits(t *testing.T) {
+	for _, match := range []string{MatchPrefix, MatchFuzzy} {
+		for _, text := range []string{"marg", "margarita", "tiramsu", "salda",
+			"cofee mascarpone", "spicy"} {
+			q := Query{Text: text, Match: match}.Normalize()
+			prefixes := termPrefixes(q)
+			for _, hit := range search(t, q).Food_items {
+				if _, ok := score(Document{Menu_name: hit.Menu_name,
+					Category: hit.Category}, q.Text, q.Match); ok {
+					continue
+				}
+				found := false
+				for _, word := range Terms(hit.Name, hit.Description, hit.Tags) {
+					for _, prefix := range prefixes {
+						found = found || strings.HasPrefix(word, prefix)
+					}
+				}
+				if !found {
+					t.Errorf("%s %q: hit %s has no word starting with %v",
+						match, text, hit.Food_ID, prefixes)
+				}
+			}
+		}
+	}
+}
+
+func TestNormalizeLeavesTagsAlone(t *testing.T) {
+	tags := []string{"Gluten Free"}
+	q := Query{Tags: tags}.Normalize()
+	if tags[0] != "Gluten Free" {
+		t.Errorf("the caller's tag became %q", tags[0])
+	}
+	if !reflect.DeepEqual(q.Tags, []string{"gluten_free"}) {
+		t.Errorf("normalized tags are %v", q.Tags)
+	}
+}
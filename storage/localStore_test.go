@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalStoreKeepsBlobsUnderItsDir(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "blobs")
+	store := NewLocalStore(dir)
+	ctx := context.Background()
+
+	for _, key := range []string{
+		"../escaped",
+		"foods/../../escaped",
+		"foods/..",
+		"..",
+		"",
+		"/",
+	} {
+		if err := store.Put(ctx, key, []byte("x"), "text/plain"); err == nil {
+			t.Errorf("Put(%q) was allowed", key)
+		}
+		if _, err := store.Get(ctx, key); err == nil {
+			t.Errorf("Get(%q) was allowed", key)
+		}
+		if err := store.Delete(ctx, key); err == nil {
+			t.Errorf("Delete(%q) was allowed", key)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "escaped")); err == nil {
+		t.Fatal("a blob was written outside the store's dir")
+	}
+
+	// a leading slash is still under the dir
+	if err := store.Put(ctx, "/foods/pizza.jpg", []byte("x"), ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "foods", "pizza.jpg")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLocalStoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	store := NewLocalStore(dir)
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "foods/f1/large.jpg", []byte("image"),
+		"image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	blob, err := store.Get(ctx, "foods/f1/large.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(blob)
+	blob.Close()
+	if string(data) != "image" {
+		t.Fatalf("got %q", data)
+	}
+	// no temporary files are left behind
+	entries, _ := os.ReadDir(filepath.Join(dir, "foods", "f1"))
+	if len(entries) != 1 {
+		t.Fatalf("dir holds %d files, want 1", len(entries))
+	}
+
+	if err := store.Delete(ctx, "foods/f1/large.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "foods/f1/large.jpg"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after Delete = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "foods/f1/large.jpg"); err != nil {
+		t.Fatalf("deleting again = %v, want nil", err)
+	}
+}